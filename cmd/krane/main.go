@@ -1,15 +1,19 @@
 package main
 
 import (
+	"context"
 	"os"
 	"os/signal"
 	"syscall"
 
 	"github.com/krane/krane/internal/api"
 	"github.com/krane/krane/internal/constants"
+	"github.com/krane/krane/internal/deployment"
 	"github.com/krane/krane/internal/docker"
+	"github.com/krane/krane/internal/encryption"
 	"github.com/krane/krane/internal/job"
 	"github.com/krane/krane/internal/logger"
+	"github.com/krane/krane/internal/proxy"
 	"github.com/krane/krane/internal/scheduler"
 	"github.com/krane/krane/internal/store"
 	"github.com/krane/krane/internal/utils"
@@ -21,36 +25,76 @@ func init() {
 	utils.EnvOrDefault(constants.EnvListenAddress, "0.0.0.0:8500")
 	utils.EnvOrDefault(constants.EnvDatabasePath, "/tmp/krane.db")
 	utils.EnvOrDefault(constants.EnvWorkerPoolSize, "1")
-	utils.EnvOrDefault(constants.EnvJobQueueSize, "1")
+	utils.EnvOrDefault(constants.EnvJobQueueSize, "100")
 	utils.EnvOrDefault(constants.EnvJobMaxRetryPolicy, "5")
+	utils.EnvOrDefault(constants.EnvJobTimeout, "30m")
 	utils.EnvOrDefault(constants.EnvDeploymentRetryPolicy, "1")
 	utils.EnvOrDefault(constants.EnvSchedulerIntervalMs, "30000")
 	utils.EnvOrDefault(constants.EnvWatchMode, "false")
+	utils.EnvOrDefault(constants.EnvWatchPullInterval, "1h")
 	utils.EnvOrDefault(constants.EnvProxyEnabled, "true")
 	utils.EnvOrDefault(constants.EnvProxyDashboardSecure, "false")
 	utils.EnvOrDefault(constants.EnvProxyDashboardAlias, "")
+	utils.EnvOrDefault(constants.EnvProxyEntrypoints, "")
+	utils.EnvOrDefault(constants.EnvProxyProvider, "traefik")
+	utils.EnvOrDefault(constants.EnvProxyConfigPath, "")
+	utils.EnvOrDefault(constants.EnvProxyReloadCommand, "")
 	utils.EnvOrDefault(constants.EnvLetsEncryptEmail, "")
+	utils.EnvOrDefault(constants.EnvSecretsMasterKey, "")
+	utils.EnvOrDefault(constants.EnvSecretsKeyFile, "")
+	utils.EnvOrDefault(constants.EnvSecretsPreviousKey, "")
+	utils.EnvOrDefault(constants.EnvSecretsMountPath, "/run/krane/secrets")
+	utils.EnvOrDefault(constants.EnvSecretsMountAllowDisk, "false")
+	utils.EnvOrDefault(constants.EnvSecretsVersionLimit, "20")
 
 	logger.Configure()
 	logger.Info("Setting up Krane")
 
-	docker.Connect()
 	store.Connect(os.Getenv(constants.EnvDatabasePath))
+	encryption.Configure()
 }
 
 func main() {
+	// re-encrypt secrets with a new master key, the store is locked while Krane is running
+	if len(os.Args) > 1 && os.Args[1] == encryption.RotateCommand {
+		rotateSecretsKey()
+		return
+	}
+
 	logger.Info("Starting Krane")
 
-	// rest api
-	go api.Run()
+	docker.Connect()
+	proxy.Configure()
 
 	// embedded database
 	db := store.Client()
 	defer db.Disconnect()
 
-	// deployment job queue
+	// secrets cannot be decrypted with a master key they were not encrypted with
+	if err := deployment.VerifySecretsKey(); err != nil {
+		logger.Fatalf("Invalid secrets master key, %v", err)
+	}
+
+	// secrets saved before secrets were encrypted at rest
+	deployment.EncryptPlaintextSecrets()
+
+	// secret files are lost when the host reboots, they are restored for existing containers
+	if deployments, err := deployment.GetAllDeployments(context.Background()); err != nil {
+		logger.Errorf("Unable to restore secret files %v", err)
+	} else {
+		deployment.RestoreSecretFiles(context.Background(), deployments)
+	}
+
+	// deployment job queue; jobs queued before Krane stopped are resumed and
+	// jobs that were running when Krane stopped are marked as interrupted
 	qsize := utils.UIntEnv(constants.EnvJobQueueSize)
-	queue := job.NewBufferedQueue(qsize)
+	queue := job.NewQueue(db, qsize)
+	if err := queue.Restore(); err != nil {
+		logger.Errorf("Unable to restore job queue %v", err)
+	}
+
+	// rest api
+	go api.Run()
 
 	// if watch mode is enabled, the scheduler will run in a separate routine polling
 	// and queuing jobs to maintain the deployment state in parity with the desired state
@@ -59,14 +103,16 @@ func main() {
 		enqueuer := job.NewEnqueuer(queue)
 		interval := utils.EnvOrDefault(constants.EnvSchedulerIntervalMs, utils.TwoMinMs)
 
-		jobScheduler := scheduler.New(db, docker.GetClient(), enqueuer, interval)
+		pullInterval := utils.DurationEnv(constants.EnvWatchPullInterval)
+
+		jobScheduler := scheduler.New(db, docker.GetClient(), enqueuer, interval, pullInterval)
 		go jobScheduler.Run()
 	}
 
 	// workers for executing deployment jobs; when no workers are instantiated,
 	// queued jobs will block until a worker is added to the worker pool.
 	wpSize := utils.UIntEnv(constants.EnvWorkerPoolSize)
-	workers := job.NewWorkerPool(wpSize, queue, store.Client())
+	workers := job.NewWorkerPool(wpSize, queue, db)
 	workers.Start()
 
 	// ensure internal services are running
@@ -74,10 +120,13 @@ func main() {
 	// service for krane (others include the statuspage)
 	EnsureNetworkProxy()
 
+	// warm containers of blue/green deployments are removed once their rollback window expires
+	deployment.ScheduleWarmContainers()
+
 	// block until an exit signal is received
 	wait()
 
-	// when an exit signal is received, workers are stopped and cleaned up.
+	// when an exit signal is received, workers are stopped after completing the jobs they are executing.
 	workers.Stop()
 
 	logger.Info("Shutdown complete")
@@ -1,11 +1,19 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
 
 	"github.com/krane/krane/internal/constants"
 	"github.com/krane/krane/internal/deployment"
+	"github.com/krane/krane/internal/docker"
 	"github.com/krane/krane/internal/logger"
+	"github.com/krane/krane/internal/proxy"
 	"github.com/krane/krane/internal/utils"
 )
 
@@ -13,7 +21,7 @@ var proxyConfig = deployment.Config{
 	Name:     "krane-proxy",
 	Image:    "krane/proxy",
 	Secure:   utils.BoolEnv(constants.EnvProxyDashboardSecure),
-	Alias:    []string{os.Getenv(constants.EnvProxyDashboardAlias)},
+	Alias:    []proxy.Alias{{Host: os.Getenv(constants.EnvProxyDashboardAlias)}},
 	Scale:    1,
 	Internal: true,
 	Registry: deployment.Registry{
@@ -26,10 +34,10 @@ var proxyConfig = deployment.Config{
 		"/var/run/docker.sock": "/var/run/docker.sock",
 	},
 	TargetPort: "8080",
-	Ports: map[string]string{
-		"80":  "80",
-		"443": "443",
-		"":    "8080",
+	Ports: deployment.PortBindings{
+		"80:80",
+		"443:443",
+		"8080",
 	},
 }
 
@@ -43,13 +51,34 @@ func EnsureNetworkProxy() {
 		return
 	}
 
+	// caddy and nginx run on the host, their configuration is rendered from the routes of deployments
+	if provider := proxy.GetProvider(); provider.Name() != proxy.TraefikProvider {
+		if err := deployment.SyncRoutes(context.Background()); err != nil {
+			logger.Errorf("Unable to sync network proxy routes %v", err)
+		}
+		return
+	}
+
 	leEmail := os.Getenv(constants.EnvLetsEncryptEmail)
 	if proxyConfig.Secure && leEmail == "" {
 		logger.Fatalf("Missing required environment variable %s when running in SECURE mode", constants.EnvLetsEncryptEmail)
 	}
 
+	entrypoints, err := proxy.ParseEntrypoints(os.Getenv(constants.EnvProxyEntrypoints))
+	if err != nil {
+		logger.Fatalf("Invalid environment variable %s, %v", constants.EnvProxyEntrypoints, err)
+	}
+	applyProxyEntrypoints(entrypoints)
+	applyProxyDynamicConfig(proxy.GetProvider().(*proxy.Traefik).ConfigDir())
+	checkProxyDynamicConfigMount(proxy.GetProvider().(*proxy.Traefik).ConfigDir())
+
+	// blue/green deployments are routed through the dynamic configuration
+	if err := deployment.SyncRoutes(context.Background()); err != nil {
+		logger.Errorf("Unable to sync network proxy routes %v", err)
+	}
+
 	// get containers (if any) for the proxy deployment
-	containers, err := deployment.GetContainersByDeployment(proxyConfig.Name)
+	containers, err := deployment.GetContainersByDeployment(context.Background(), proxyConfig.Name)
 	if err != nil {
 		logger.Fatalf("Unable to create network proxy, %v", err)
 	}
@@ -78,15 +107,86 @@ func EnsureNetworkProxy() {
 		}
 	}
 
+	// re-create the proxy when its entrypoints or dynamic configuration changed since it was created
+	if proxyConfigChanged() {
+		logger.Info("Network proxy configuration changed, re-creating the network proxy")
+		if err := createProxy(); err != nil {
+			logger.Fatalf("Unable to create network proxy, %v", err)
+		}
+		return
+	}
+
 	logger.Debug("Network proxy already in a running state")
 }
 
+// proxyConfigChanged returns true if the environment, volumes or ports of the saved proxy configuration
+// differ from the configuration applied from PROXY_ENTRYPOINTS and PROXY_CONFIG_PATH
+func proxyConfigChanged() bool {
+	saved, err := deployment.GetDeploymentConfig(proxyConfig.Name)
+	if err != nil {
+		return true
+	}
+
+	if !reflect.DeepEqual(saved.Env, proxyConfig.Env) || !reflect.DeepEqual(saved.Volumes, proxyConfig.Volumes) {
+		return true
+	}
+
+	savedPorts := append([]string{}, saved.Ports...)
+	ports := append([]string{}, proxyConfig.Ports...)
+	sort.Strings(savedPorts)
+	sort.Strings(ports)
+	return !reflect.DeepEqual(savedPorts, ports)
+}
+
+// applyProxyEntrypoints configures and publishes the tcp and udp entrypoints of the network proxy
+func applyProxyEntrypoints(entrypoints []proxy.Entrypoint) {
+	for k, v := range proxy.TraefikEntrypointEnvs(entrypoints) {
+		proxyConfig.Env[k] = v
+	}
+
+	for _, e := range entrypoints {
+		proxyConfig.Ports = append(proxyConfig.Ports, fmt.Sprintf("%s:%s/%s", e.Port, e.Port, e.Protocol))
+	}
+}
+
+// applyProxyDynamicConfig mounts the directory of the dynamic configuration routing blue/green
+// deployments into the network proxy and enables the Traefik file provider
+func applyProxyDynamicConfig(dir string) {
+	for k, v := range proxy.TraefikFileProviderEnvs() {
+		proxyConfig.Env[k] = v
+	}
+	proxyConfig.Volumes[dir] = proxy.TraefikConfigMountPath
+}
+
+// checkProxyDynamicConfigMount warns when Krane runs in a container without the directory of the dynamic
+// configuration mounted from the same path on the host. The network proxy mounts the directory from the
+// host, it would not see the configuration rendered by Krane and blue/green deployments would not be routed.
+func checkProxyDynamicConfigMount(dir string) {
+	self, ok := docker.GetClient().Self(context.Background())
+	if !ok {
+		return
+	}
+
+	for _, m := range self.Mounts {
+		rel, err := filepath.Rel(m.Destination, dir)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+
+		if filepath.Join(m.Source, rel) == dir {
+			return
+		}
+	}
+
+	logger.Warnf("%s is not mounted from the host, blue/green deployments will not be routed. Run Krane with -v %s:%s", dir, dir, dir)
+}
+
 func createProxy() error {
-	if err := deployment.SaveConfig(proxyConfig); err != nil {
+	if err := deployment.SaveConfig(proxyConfig, deployment.KraneUser); err != nil {
 		return err
 	}
 
-	if err := deployment.Run(proxyConfig.Name); err != nil {
+	if _, err := deployment.Run(proxyConfig.Name); err != nil {
 		return err
 	}
 
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/krane/krane/internal/constants"
+	"github.com/krane/krane/internal/deployment"
+	"github.com/krane/krane/internal/encryption"
+	"github.com/krane/krane/internal/logger"
+	"github.com/krane/krane/internal/store"
+)
+
+// rotateSecretsKey re-encrypts every secret with a new master key. The new key is written to
+// a pending key file until every secret is re-encrypted, an interrupted rotation resumes with it.
+// When the master key is set in the environment, the new key is printed instead. An interrupted
+// rotation then resumes once the new key is set as the master key and the old key as the previous
+// master key, secrets are re-encrypted with the master key set in the environment.
+func rotateSecretsKey() {
+	db := store.Client()
+	defer db.Disconnect()
+
+	// every secret must be decrypted before being re-encrypted
+	if err := deployment.VerifySecretsKey(); err != nil {
+		logger.Fatalf("Unable to rotate secrets master key, %v", err)
+		return
+	}
+
+	current, err := encryption.LoadKey()
+	if err != nil {
+		logger.Fatalf("Unable to load secrets master key, %v", err)
+		return
+	}
+
+	fromEnv := os.Getenv(constants.EnvSecretsMasterKey) != ""
+	previous, resume, err := encryption.PreviousKey()
+	if err != nil {
+		logger.Fatalf("Unable to load previous secrets master key, %v", err)
+		return
+	}
+
+	// resume an interrupted rotation of a master key set in the environment
+	if fromEnv && resume {
+		encryption.SetKeys(current, previous)
+		count, err := deployment.ReEncryptSecrets()
+		if err != nil {
+			logger.Fatalf("Unable to re-encrypt secrets, %v", err)
+			return
+		}
+
+		logger.Infof("%d secret(s) re-encrypted with master key %s, unset %s before starting Krane", count, current.ID, constants.EnvSecretsPreviousKey)
+		return
+	}
+
+	pendingPath := encryption.PendingKeyPath()
+
+	next, err := encryption.ReadKeyFile(pendingPath)
+	if fromEnv || err != nil {
+		next, err = encryption.NewKey()
+		if err != nil {
+			logger.Fatalf("Unable to generate secrets master key, %v", err)
+			return
+		}
+	}
+
+	// the new key is saved before re-encrypting, secrets cannot be decrypted without it
+	if fromEnv {
+		fmt.Printf("New secrets master key: %s\n", next)
+	} else if err := encryption.WriteKeyFile(pendingPath, next); err != nil {
+		logger.Fatalf("Unable to write secrets master key, %v", err)
+		return
+	}
+
+	encryption.SetKeys(next, current)
+	count, err := deployment.ReEncryptSecrets()
+	if err != nil {
+		if fromEnv {
+			logger.Fatalf("Unable to re-encrypt secrets, set %s to the new key and %s to the current key then run `krane %s` again, %v",
+				constants.EnvSecretsMasterKey, constants.EnvSecretsPreviousKey, encryption.RotateCommand, err)
+			return
+		}
+		logger.Fatalf("Unable to re-encrypt secrets, %v", err)
+		return
+	}
+
+	if fromEnv {
+		logger.Infof("%d secret(s) re-encrypted with master key %s, set %s to the new key before starting Krane", count, next.ID, constants.EnvSecretsMasterKey)
+		return
+	}
+
+	if err := os.Rename(pendingPath, encryption.KeyFilePath()); err != nil {
+		logger.Fatalf("Unable to replace secrets master key, %v", err)
+		return
+	}
+	logger.Infof("%d secret(s) re-encrypted with master key %s", count, next.ID)
+}
@@ -134,6 +134,7 @@ download_and_verify() {
     -v /var/run/docker.sock:/var/run/docker.sock \
     -v "${SSH_KEYS_DIR:-/root/.ssh}":/root/.ssh  \
     -v "${DB_DIR:-/tmp}":"${DB_DIR:-/tmp}" \
+    -v /etc/krane/traefik:/etc/krane/traefik \
     -l "traefik.enable=true" \
     -l "traefik.http.middlewares.redirect-to-https.redirectscheme.permanent=true" \
     -l "traefik.http.middlewares.redirect-to-https.redirectscheme.port=443" \
@@ -59,18 +59,41 @@ func withRoutes(router *mux.Router) {
 	withRoute(authRouter, "/deployments/{deployment}", controllers.GetDeployment, middlewares.ValidateSessionMiddleware).Methods(http.MethodGet)
 	withRoute(authRouter, "/deployments/{deployment}", controllers.RunDeployment, middlewares.ValidateSessionMiddleware).Methods(http.MethodPost)
 	withRoute(authRouter, "/deployments/{deployment}", controllers.DeleteDeployment, middlewares.ValidateSessionMiddleware).Methods(http.MethodDelete)
+	withRoute(authRouter, "/deployments/{deployment}/revisions", controllers.GetRevisions, middlewares.ValidateSessionMiddleware).Methods(http.MethodGet)
+	withRoute(authRouter, "/deployments/{deployment}/revisions/diff", controllers.DiffRevisions, middlewares.ValidateSessionMiddleware).Methods(http.MethodGet)
+	withRoute(authRouter, "/deployments/{deployment}/revisions/{revision}", controllers.GetRevision, middlewares.ValidateSessionMiddleware).Methods(http.MethodGet)
+	withRoute(authRouter, "/deployments/{deployment}/rollback", controllers.RollbackDeployment, middlewares.ValidateSessionMiddleware).Methods(http.MethodPost)
+	withRoute(authRouter, "/deployments/{deployment}/scale", controllers.ScaleDeployment, middlewares.ValidateSessionMiddleware).Methods(http.MethodPost)
+	withRoute(authRouter, "/deployments/{deployment}/dry-run", controllers.DryRunDeployment, middlewares.ValidateSessionMiddleware).Methods(http.MethodPost)
+	withRoute(authRouter, "/deployments/{deployment}/promote", controllers.PromoteDeployment, middlewares.ValidateSessionMiddleware).Methods(http.MethodPost)
+	withRoute(authRouter, "/deployments/{deployment}/abort", controllers.AbortDeployment, middlewares.ValidateSessionMiddleware).Methods(http.MethodPost)
 	withRoute(authRouter, "/deployments/{deployment}/containers", controllers.GetDeploymentContainers, middlewares.ValidateSessionMiddleware).Methods(http.MethodGet)
 	withRoute(authRouter, "/deployments/{deployment}/containers/start", controllers.StartDeploymentContainers, middlewares.ValidateSessionMiddleware).Methods(http.MethodPost)
 	withRoute(authRouter, "/deployments/{deployment}/containers/stop", controllers.StopDeploymentContainers, middlewares.ValidateSessionMiddleware).Methods(http.MethodPost)
 	withRoute(authRouter, "/deployments/{deployment}/containers/restart", controllers.RestartDeploymentContainers, middlewares.ValidateSessionMiddleware).Methods(http.MethodPost)
+	withRoute(authRouter, "/deployments/{deployment}/volumes", controllers.GetVolumes, middlewares.ValidateSessionMiddleware).Methods(http.MethodGet)
+	withRoute(authRouter, "/deployments/{deployment}/volumes/{volume}", controllers.GetVolume, middlewares.ValidateSessionMiddleware).Methods(http.MethodGet)
+	withRoute(authRouter, "/deployments/{deployment}/volumes/{volume}", controllers.DeleteVolume, middlewares.ValidateSessionMiddleware).Methods(http.MethodDelete)
+	withRoute(authRouter, "/deployments/{deployment}/volumes/{volume}/backup", controllers.BackupVolume, middlewares.ValidateSessionMiddleware).Methods(http.MethodGet)
 	// secrets
 	withRoute(authRouter, "/secrets/{deployment}", controllers.GetSecrets, middlewares.ValidateSessionMiddleware).Methods(http.MethodGet)
 	withRoute(authRouter, "/secrets/{deployment}", controllers.CreateOrUpdateSecret, middlewares.ValidateSessionMiddleware).Methods(http.MethodPost)
 	withRoute(authRouter, "/secrets/{deployment}/{key}", controllers.DeleteSecret, middlewares.ValidateSessionMiddleware).Methods(http.MethodDelete)
+	withRoute(authRouter, "/secrets/{deployment}/{key}/versions", controllers.GetSecretVersions, middlewares.ValidateSessionMiddleware).Methods(http.MethodGet)
+	withRoute(authRouter, "/global/secrets", controllers.GetGlobalSecrets, middlewares.ValidateSessionMiddleware).Methods(http.MethodGet)
+	withRoute(authRouter, "/global/secrets", controllers.CreateOrUpdateGlobalSecret, middlewares.ValidateSessionMiddleware).Methods(http.MethodPost)
+	withRoute(authRouter, "/global/secrets/{key}", controllers.DeleteGlobalSecret, middlewares.ValidateSessionMiddleware).Methods(http.MethodDelete)
+	withRoute(authRouter, "/global/secrets/{key}/versions", controllers.GetGlobalSecretVersions, middlewares.ValidateSessionMiddleware).Methods(http.MethodGet)
+	withRoute(authRouter, "/groups", controllers.GetSecretGroups, middlewares.ValidateSessionMiddleware).Methods(http.MethodGet)
+	withRoute(authRouter, "/groups/{group}/secrets", controllers.GetGroupSecrets, middlewares.ValidateSessionMiddleware).Methods(http.MethodGet)
+	withRoute(authRouter, "/groups/{group}/secrets", controllers.CreateOrUpdateGroupSecret, middlewares.ValidateSessionMiddleware).Methods(http.MethodPost)
+	withRoute(authRouter, "/groups/{group}/secrets/{key}", controllers.DeleteGroupSecret, middlewares.ValidateSessionMiddleware).Methods(http.MethodDelete)
+	withRoute(authRouter, "/groups/{group}/secrets/{key}/versions", controllers.GetGroupSecretVersions, middlewares.ValidateSessionMiddleware).Methods(http.MethodGet)
 	// jobs
 	withRoute(authRouter, "/jobs", controllers.GetJobsByDaysAgo, middlewares.ValidateSessionMiddleware).Methods(http.MethodGet)
 	withRoute(authRouter, "/jobs/{deployment}", controllers.GetJobsByDeployment, middlewares.ValidateSessionMiddleware).Methods(http.MethodGet)
 	withRoute(authRouter, "/jobs/{deployment}/{id}", controllers.GetJobByID, middlewares.ValidateSessionMiddleware).Methods(http.MethodGet)
+	withRoute(authRouter, "/jobs/{deployment}/{id}", controllers.CancelJob, middlewares.ValidateSessionMiddleware).Methods(http.MethodDelete)
 	// sessions
 	withRoute(authRouter, "/sessions", controllers.GetSessions, middlewares.ValidateSessionMiddleware).Methods(http.MethodGet)
 	withRoute(authRouter, "/sessions", controllers.CreateSession, middlewares.ValidateSessionMiddleware).Methods(http.MethodPost)
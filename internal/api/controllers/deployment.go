@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"strconv"
 
 	"github.com/gorilla/mux"
 
@@ -13,6 +15,7 @@ import (
 	"github.com/krane/krane/internal/api/response"
 	"github.com/krane/krane/internal/deployment"
 	"github.com/krane/krane/internal/session"
+	"github.com/krane/krane/internal/utils"
 )
 
 // WSUpgrader upgrades HTTP connections to WebSocket connections
@@ -41,7 +44,7 @@ func GetDeployment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	d, err := deployment.GetDeployment(deploymentName)
+	d, err := deployment.GetDeployment(r.Context(), deploymentName)
 	if err != nil {
 		response.HTTPBad(w, err)
 		return
@@ -52,8 +55,8 @@ func GetDeployment(w http.ResponseWriter, r *http.Request) {
 }
 
 // GetAllDeployments returns a list of deployments with their configurations, containers and recent activity
-func GetAllDeployments(w http.ResponseWriter, _ *http.Request) {
-	deployments, err := deployment.GetAllDeployments()
+func GetAllDeployments(w http.ResponseWriter, r *http.Request) {
+	deployments, err := deployment.GetAllDeployments(r.Context())
 	if err != nil {
 		response.HTTPBad(w, err)
 		return
@@ -72,7 +75,7 @@ func CreateOrUpdateDeployment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := deployment.SaveConfig(config); err != nil {
+	if err := deployment.SaveConfig(config, sessionUser(r)); err != nil {
 		response.HTTPBad(w, err)
 		return
 	}
@@ -96,12 +99,19 @@ func DeleteDeployment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := deployment.Delete(deploymentName); err != nil {
+	removeVolumes, err := strconv.ParseBool(utils.QueryParamOrDefault(r, "volumes", "false"))
+	if err != nil {
+		response.HTTPBad(w, errors.New("volumes must be true or false"))
+		return
+	}
+
+	j, err := deployment.Delete(deploymentName, removeVolumes)
+	if err != nil {
 		response.HTTPBad(w, err)
 		return
 	}
 
-	response.HTTPAccepted(w)
+	response.HTTPAcceptedWithBody(w, j)
 	return
 }
 
@@ -120,12 +130,164 @@ func RunDeployment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := deployment.Run(deploymentName); err != nil {
+	j, err := deployment.Run(deploymentName)
+	if err != nil {
 		response.HTTPBad(w, err)
 		return
 	}
 
-	response.HTTPAccepted(w)
+	response.HTTPAcceptedWithBody(w, j)
+	return
+}
+
+// RollbackDeployment re-deploys a previous revision of a deployment configuration.
+// If no revision is provided, the last healthy revision is used.
+func RollbackDeployment(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	deploymentName := params["deployment"]
+
+	if deploymentName == "" {
+		response.HTTPBad(w, errors.New("deployment name not provided"))
+		return
+	}
+
+	if !deployment.Exist(deploymentName) {
+		response.HTTPBad(w, fmt.Errorf("deployment %s does not exist", deploymentName))
+		return
+	}
+
+	revision, err := strconv.Atoi(utils.QueryParamOrDefault(r, "revision", "0"))
+	if err != nil || revision < 0 {
+		response.HTTPBad(w, errors.New("revision must be a positive number, or 0 to rollback to the last healthy revision"))
+		return
+	}
+
+	j, err := deployment.Rollback(deploymentName, revision, sessionUser(r))
+	if err != nil {
+		response.HTTPBad(w, err)
+		return
+	}
+
+	response.HTTPAcceptedWithBody(w, j)
+	return
+}
+
+// ScaleDeployment updates the number of containers for a deployment without re-creating existing containers
+func ScaleDeployment(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	deploymentName := params["deployment"]
+
+	if deploymentName == "" {
+		response.HTTPBad(w, errors.New("deployment name not provided"))
+		return
+	}
+
+	if !deployment.Exist(deploymentName) {
+		response.HTTPBad(w, fmt.Errorf("deployment %s does not exist", deploymentName))
+		return
+	}
+
+	replicas, err := strconv.Atoi(r.URL.Query().Get("replicas"))
+	if err != nil || replicas < 0 {
+		response.HTTPBad(w, errors.New("replicas must be a positive number"))
+		return
+	}
+
+	j, err := deployment.Scale(deploymentName, replicas, sessionUser(r))
+	if err != nil {
+		response.HTTPBad(w, err)
+		return
+	}
+
+	response.HTTPAcceptedWithBody(w, j)
+	return
+}
+
+// DryRunDeployment validates a deployment configuration and reports the secrets it references which cannot be resolved.
+// The configuration is read from the request body, or is the saved configuration when no body is provided.
+func DryRunDeployment(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	deploymentName := params["deployment"]
+
+	if deploymentName == "" {
+		response.HTTPBad(w, errors.New("deployment name not provided"))
+		return
+	}
+
+	var config deployment.Config
+	err := json.NewDecoder(r.Body).Decode(&config)
+	switch {
+	case err == io.EOF:
+		config, err = deployment.GetDeploymentConfig(deploymentName)
+		if err != nil {
+			response.HTTPBad(w, fmt.Errorf("deployment %s does not exist", deploymentName))
+			return
+		}
+	case err != nil:
+		response.HTTPBad(w, err)
+		return
+	}
+
+	if config.Name == "" {
+		config.Name = deploymentName
+	}
+
+	if config.Name != deploymentName {
+		response.HTTPBad(w, fmt.Errorf("config name %s does not match deployment %s", config.Name, deploymentName))
+		return
+	}
+
+	response.HTTPOk(w, deployment.ValidateConfig(config))
+	return
+}
+
+// PromoteDeployment removes the warm containers of a blue/green deployment, ending its rollback window
+func PromoteDeployment(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	deploymentName := params["deployment"]
+
+	if deploymentName == "" {
+		response.HTTPBad(w, errors.New("deployment name not provided"))
+		return
+	}
+
+	if !deployment.Exist(deploymentName) {
+		response.HTTPBad(w, fmt.Errorf("deployment %s does not exist", deploymentName))
+		return
+	}
+
+	j, err := deployment.Promote(deploymentName)
+	if err != nil {
+		response.HTTPBad(w, err)
+		return
+	}
+
+	response.HTTPAcceptedWithBody(w, j)
+	return
+}
+
+// AbortDeployment switches a blue/green deployment back to its warm containers and removes the live containers
+func AbortDeployment(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	deploymentName := params["deployment"]
+
+	if deploymentName == "" {
+		response.HTTPBad(w, errors.New("deployment name not provided"))
+		return
+	}
+
+	if !deployment.Exist(deploymentName) {
+		response.HTTPBad(w, fmt.Errorf("deployment %s does not exist", deploymentName))
+		return
+	}
+
+	j, err := deployment.Abort(deploymentName)
+	if err != nil {
+		response.HTTPBad(w, err)
+		return
+	}
+
+	response.HTTPAcceptedWithBody(w, j)
 	return
 }
 
@@ -144,7 +306,7 @@ func GetDeploymentContainers(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	containers, err := deployment.GetContainersByDeployment(deploymentName)
+	containers, err := deployment.GetContainersByDeployment(r.Context(), deploymentName)
 	if err != nil {
 		response.HTTPBad(w, err)
 		return
@@ -170,12 +332,13 @@ func StartDeploymentContainers(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := deployment.StartContainers(deploymentName); err != nil {
+	j, err := deployment.StartContainers(deploymentName)
+	if err != nil {
 		response.HTTPBad(w, err)
 		return
 	}
 
-	response.HTTPAccepted(w)
+	response.HTTPAcceptedWithBody(w, j)
 	return
 }
 
@@ -195,12 +358,13 @@ func StopDeploymentContainers(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := deployment.StopContainers(deploymentName); err != nil {
+	j, err := deployment.StopContainers(deploymentName)
+	if err != nil {
 		response.HTTPBad(w, err)
 		return
 	}
 
-	response.HTTPAccepted(w)
+	response.HTTPAcceptedWithBody(w, j)
 	return
 }
 
@@ -220,12 +384,13 @@ func RestartDeploymentContainers(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := deployment.RestartContainers(deploymentName); err != nil {
+	j, err := deployment.RestartContainers(deploymentName)
+	if err != nil {
 		response.HTTPBad(w, err)
 		return
 	}
 
-	response.HTTPAccepted(w)
+	response.HTTPAcceptedWithBody(w, j)
 	return
 }
 
@@ -89,3 +89,34 @@ func GetJobByID(w http.ResponseWriter, r *http.Request) {
 	response.HTTPOk(w, j)
 	return
 }
+
+// CancelJob cancels a pending or running job
+func CancelJob(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	deploymentName := params["deployment"]
+	jobID := params["id"]
+
+	if deploymentName == "" {
+		response.HTTPBad(w, errors.New("deployment name not provided"))
+		return
+	}
+
+	if jobID == "" {
+		response.HTTPBad(w, errors.New("job id not provided"))
+		return
+	}
+
+	if !deployment.Exist(deploymentName) {
+		response.HTTPBad(w, fmt.Errorf("deployment %s does not exist", deploymentName))
+		return
+	}
+
+	j, err := deployment.CancelJob(deploymentName, jobID)
+	if err != nil {
+		response.HTTPBad(w, err)
+		return
+	}
+
+	response.HTTPAcceptedWithBody(w, j)
+	return
+}
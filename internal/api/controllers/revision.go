@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/krane/krane/internal/api/response"
+	"github.com/krane/krane/internal/deployment"
+	"github.com/krane/krane/internal/utils"
+)
+
+// GetRevisions returns every saved configuration revision for a deployment
+func GetRevisions(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	deploymentName := params["deployment"]
+
+	if deploymentName == "" {
+		response.HTTPBad(w, errors.New("deployment name not provided"))
+		return
+	}
+
+	if !deployment.Exist(deploymentName) {
+		response.HTTPBad(w, fmt.Errorf("deployment %s does not exist", deploymentName))
+		return
+	}
+
+	revisions, err := deployment.GetRevisions(deploymentName)
+	if err != nil {
+		response.HTTPBad(w, err)
+		return
+	}
+
+	response.HTTPOk(w, revisions)
+	return
+}
+
+// GetRevision returns a single configuration revision for a deployment
+func GetRevision(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	deploymentName := params["deployment"]
+
+	if deploymentName == "" {
+		response.HTTPBad(w, errors.New("deployment name not provided"))
+		return
+	}
+
+	revision, err := strconv.Atoi(params["revision"])
+	if err != nil {
+		response.HTTPBad(w, errors.New("revision must be a number"))
+		return
+	}
+
+	if !deployment.Exist(deploymentName) {
+		response.HTTPBad(w, fmt.Errorf("deployment %s does not exist", deploymentName))
+		return
+	}
+
+	rev, err := deployment.GetRevision(deploymentName, revision)
+	if err != nil {
+		response.HTTPNotFound(w, err)
+		return
+	}
+
+	response.HTTPOk(w, rev)
+	return
+}
+
+// DiffRevisions returns the changes between two configuration revisions of a deployment.
+// Defaults to comparing the latest revision against the revision before it.
+func DiffRevisions(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	deploymentName := params["deployment"]
+
+	if deploymentName == "" {
+		response.HTTPBad(w, errors.New("deployment name not provided"))
+		return
+	}
+
+	if !deployment.Exist(deploymentName) {
+		response.HTTPBad(w, fmt.Errorf("deployment %s does not exist", deploymentName))
+		return
+	}
+
+	latest, err := deployment.GetLatestRevision(deploymentName)
+	if err != nil {
+		response.HTTPBad(w, err)
+		return
+	}
+
+	to, err := strconv.Atoi(utils.QueryParamOrDefault(r, "to", strconv.Itoa(latest.Revision)))
+	if err != nil {
+		response.HTTPBad(w, errors.New("to must be a revision number"))
+		return
+	}
+
+	from, err := strconv.Atoi(utils.QueryParamOrDefault(r, "from", strconv.Itoa(to-1)))
+	if err != nil {
+		response.HTTPBad(w, errors.New("from must be a revision number"))
+		return
+	}
+
+	diff, err := deployment.DiffRevisions(deploymentName, from, to)
+	if err != nil {
+		response.HTTPBad(w, err)
+		return
+	}
+
+	response.HTTPOk(w, diff)
+	return
+}
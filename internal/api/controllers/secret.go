@@ -12,6 +12,12 @@ import (
 	"github.com/krane/krane/internal/deployment"
 )
 
+// SecretRequest is the body of requests creating or updating a secret
+type SecretRequest struct {
+	Key   string `json:"key" binding:"required"`
+	Value string `json:"value" binding:"required"`
+}
+
 // GetSecrets returns all secrets for a deployment
 func GetSecrets(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
@@ -42,18 +48,13 @@ func CreateOrUpdateSecret(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	type SecretRequest struct {
-		Key   string `json:"key" binding:"required"`
-		Value string `json:"value" binding:"required"`
-	}
-
 	var body SecretRequest
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		response.HTTPBad(w, err)
 		return
 	}
 
-	newSecret, err := deployment.AddSecret(deploymentName, body.Key, body.Value)
+	newSecret, err := deployment.AddSecret(deploymentName, body.Key, body.Value, sessionUser(r))
 	if err != nil {
 		response.HTTPBad(w, err)
 		return
@@ -89,3 +90,199 @@ func DeleteSecret(w http.ResponseWriter, r *http.Request) {
 	response.HTTPNoContent(w)
 	return
 }
+
+// GetGlobalSecrets returns all global secrets
+func GetGlobalSecrets(w http.ResponseWriter, r *http.Request) {
+	response.HTTPOk(w, deployment.GetAllGlobalSecretsRedacted())
+	return
+}
+
+// CreateOrUpdateGlobalSecret saves a global secret shared by every deployment
+func CreateOrUpdateGlobalSecret(w http.ResponseWriter, r *http.Request) {
+	var body SecretRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		response.HTTPBad(w, err)
+		return
+	}
+
+	newSecret, err := deployment.AddGlobalSecret(body.Key, body.Value, sessionUser(r))
+	if err != nil {
+		response.HTTPBad(w, err)
+		return
+	}
+
+	newSecret.Redact()
+
+	response.HTTPOk(w, newSecret)
+	return
+}
+
+// DeleteGlobalSecret removes a global secret
+func DeleteGlobalSecret(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	key := params["key"]
+
+	if key == "" {
+		response.HTTPBad(w, errors.New("secret key required"))
+		return
+	}
+
+	if err := deployment.DeleteGlobalSecret(key); err != nil {
+		response.HTTPBad(w, err)
+		return
+	}
+
+	response.HTTPNoContent(w)
+	return
+}
+
+// GetSecretGroups returns the names of the secret groups
+func GetSecretGroups(w http.ResponseWriter, r *http.Request) {
+	groups, err := deployment.GetSecretGroups()
+	if err != nil {
+		response.HTTPBad(w, err)
+		return
+	}
+
+	response.HTTPOk(w, groups)
+	return
+}
+
+// GetGroupSecrets returns all secrets of a secret group
+func GetGroupSecrets(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	group := params["group"]
+
+	if group == "" {
+		response.HTTPBad(w, errors.New("secret group required"))
+		return
+	}
+
+	response.HTTPOk(w, deployment.GetAllGroupSecretsRedacted(group))
+	return
+}
+
+// CreateOrUpdateGroupSecret saves a secret of a secret group
+func CreateOrUpdateGroupSecret(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	group := params["group"]
+
+	if group == "" {
+		response.HTTPBad(w, errors.New("secret group required"))
+		return
+	}
+
+	var body SecretRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		response.HTTPBad(w, err)
+		return
+	}
+
+	newSecret, err := deployment.AddGroupSecret(group, body.Key, body.Value, sessionUser(r))
+	if err != nil {
+		response.HTTPBad(w, err)
+		return
+	}
+
+	newSecret.Redact()
+
+	response.HTTPOk(w, newSecret)
+	return
+}
+
+// DeleteGroupSecret removes a secret of a secret group
+func DeleteGroupSecret(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	group := params["group"]
+	key := params["key"]
+
+	if group == "" {
+		response.HTTPBad(w, errors.New("secret group required"))
+		return
+	}
+
+	if key == "" {
+		response.HTTPBad(w, errors.New("secret key required"))
+		return
+	}
+
+	if err := deployment.DeleteGroupSecret(group, key); err != nil {
+		response.HTTPBad(w, err)
+		return
+	}
+
+	response.HTTPNoContent(w)
+	return
+}
+
+// GetSecretVersions returns every version of a deployment secret
+func GetSecretVersions(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	deploymentName := params["deployment"]
+	key := params["key"]
+
+	if deploymentName == "" {
+		response.HTTPBad(w, errors.New("deployment name required"))
+		return
+	}
+
+	if key == "" {
+		response.HTTPBad(w, errors.New("secret key required"))
+		return
+	}
+
+	versions, err := deployment.GetSecretVersionsRedacted(deploymentName, key)
+	if err != nil {
+		response.HTTPBad(w, err)
+		return
+	}
+
+	response.HTTPOk(w, versions)
+	return
+}
+
+// GetGlobalSecretVersions returns every version of a global secret
+func GetGlobalSecretVersions(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	key := params["key"]
+
+	if key == "" {
+		response.HTTPBad(w, errors.New("secret key required"))
+		return
+	}
+
+	versions, err := deployment.GetGlobalSecretVersionsRedacted(key)
+	if err != nil {
+		response.HTTPBad(w, err)
+		return
+	}
+
+	response.HTTPOk(w, versions)
+	return
+}
+
+// GetGroupSecretVersions returns every version of a group secret
+func GetGroupSecretVersions(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	group := params["group"]
+	key := params["key"]
+
+	if group == "" {
+		response.HTTPBad(w, errors.New("secret group required"))
+		return
+	}
+
+	if key == "" {
+		response.HTTPBad(w, errors.New("secret key required"))
+		return
+	}
+
+	versions, err := deployment.GetGroupSecretVersionsRedacted(group, key)
+	if err != nil {
+		response.HTTPBad(w, err)
+		return
+	}
+
+	response.HTTPOk(w, versions)
+	return
+}
@@ -91,3 +91,12 @@ func DeleteSession(w http.ResponseWriter, r *http.Request) {
 	response.HTTPOk(w, nil)
 	return
 }
+
+// sessionUser returns the user for the session attached to a request
+func sessionUser(r *http.Request) string {
+	s, ok := r.Context().Value("session").(session.Session)
+	if !ok {
+		return ""
+	}
+	return s.User
+}
@@ -2,8 +2,13 @@ package constants
 
 const (
 	AuthenticationCollectionName = "authentication"
+	ColorsCollectionName         = "colors"
 	DeploymentsCollectionName    = "deployments"
 	JobsCollectionName           = "jobs"
+	QueueCollectionName          = "queue"
+	RevisionsCollectionName      = "revisions"
 	SessionsCollectionName       = "sessions"
 	SecretsCollectionName        = "secrets"
+	GlobalSecretsCollectionName  = "global_secrets"
+	SecretGroupsCollectionName   = "secret_groups"
 )
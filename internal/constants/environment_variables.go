@@ -5,14 +5,26 @@ const (
 	EnvLogLevel              = "LOG_LEVEL"
 	EnvListenAddress         = "LISTEN_ADDRESS"
 	EnvWatchMode             = "WATCH_MODE"
+	EnvWatchPullInterval     = "WATCH_PULL_INTERVAL"
 	EnvDatabasePath          = "DB_PATH"
 	EnvWorkerPoolSize        = "WORKERPOOL_SIZE"
 	EnvJobQueueSize          = "JOB_QUEUE_SIZE"
 	EnvJobMaxRetryPolicy     = "JOB_MAX_RETRY_POLICY"
+	EnvJobTimeout            = "JOB_TIMEOUT"
 	EnvDeploymentRetryPolicy = "DEPLOYMENT_RETRY_POLICY"
 	EnvSchedulerIntervalMs   = "SCHEDULER_INTERVAL_MS"
 	EnvProxyEnabled          = "PROXY_ENABLED"
 	EnvProxyDashboardSecure  = "PROXY_DASHBOARD_SECURE"
 	EnvProxyDashboardAlias   = "PROXY_DASHBOARD_ALIAS"
+	EnvProxyEntrypoints      = "PROXY_ENTRYPOINTS"
+	EnvProxyProvider         = "PROXY_PROVIDER"
+	EnvProxyConfigPath       = "PROXY_CONFIG_PATH"
+	EnvProxyReloadCommand    = "PROXY_RELOAD_COMMAND"
 	EnvLetsEncryptEmail      = "LETSENCRYPT_EMAIL"
+	EnvSecretsMasterKey      = "SECRETS_MASTER_KEY"
+	EnvSecretsKeyFile        = "SECRETS_KEY_FILE"
+	EnvSecretsPreviousKey    = "SECRETS_PREVIOUS_KEY"
+	EnvSecretsMountPath      = "SECRETS_MOUNT_PATH"
+	EnvSecretsMountAllowDisk = "SECRETS_MOUNT_ALLOW_DISK"
+	EnvSecretsVersionLimit   = "SECRETS_VERSION_LIMIT"
 )
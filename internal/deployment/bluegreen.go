@@ -0,0 +1,372 @@
+package deployment
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/docker/distribution/uuid"
+
+	"github.com/krane/krane/internal/constants"
+	"github.com/krane/krane/internal/job"
+	"github.com/krane/krane/internal/logger"
+	"github.com/krane/krane/internal/store"
+)
+
+// Color is the color of the containers of a blue/green deployment
+type Color string
+
+const (
+	Blue  Color = "blue"
+	Green Color = "green"
+)
+
+// other returns the color containers are created with on the next run, blue when no color is live
+func (c Color) other() Color {
+	if c == Blue {
+		return Green
+	}
+	return Blue
+}
+
+// BlueGreen is the state of a blue/green deployment
+type BlueGreen struct {
+	Deployment   string `json:"deployment"`
+	Live         Color  `json:"live"`                    // color requests are routed to
+	LiveRevision int    `json:"live_revision"`           // revision the live containers were created from
+	Warm         Color  `json:"warm,omitempty"`          // previous live color kept running for an instant rollback
+	WarmRevision int    `json:"warm_revision,omitempty"` // revision the warm containers were created from
+	WarmUntil    int64  `json:"warm_until,omitempty"`    // unix time the warm containers are removed at
+}
+
+// GetBlueGreen returns the state of a blue/green deployment, the live color is empty until the deployment first switched colors
+func GetBlueGreen(deployment string) (BlueGreen, error) {
+	bytes, err := store.Client().Get(constants.ColorsCollectionName, deployment)
+	if err != nil {
+		return BlueGreen{}, err
+	}
+
+	if bytes == nil {
+		return BlueGreen{Deployment: deployment}, nil
+	}
+
+	var state BlueGreen
+	if err := store.Deserialize(bytes, &state); err != nil {
+		return BlueGreen{}, err
+	}
+	return state, nil
+}
+
+// putBlueGreen upserts the state of a blue/green deployment into the db
+func putBlueGreen(state BlueGreen) error {
+	bytes, err := store.Serialize(state)
+	if err != nil {
+		return err
+	}
+	return store.Client().Put(constants.ColorsCollectionName, state.Deployment, bytes)
+}
+
+// deleteBlueGreen removes the state of a blue/green deployment from the db
+func deleteBlueGreen(deployment string) error {
+	return store.Client().Remove(constants.ColorsCollectionName, deployment)
+}
+
+// liveColor returns the color requests of a deployment are routed to, empty if the deployment does not use colors
+func liveColor(deployment string) Color {
+	state, err := GetBlueGreen(deployment)
+	if err != nil {
+		logger.Warnf("Unable to get blue/green state for deployment %s, %v", deployment, err)
+		return ""
+	}
+	return state.Live
+}
+
+// containersByColor returns the containers of a color, containers created before a deployment used colors have no color
+func containersByColor(containers []KraneContainer, color Color) []KraneContainer {
+	filtered := make([]KraneContainer, 0)
+	for _, c := range containers {
+		if c.Color == color {
+			filtered = append(filtered, c)
+		}
+	}
+	return filtered
+}
+
+// blueGreenWorkflow returns the workflow creating, starting and health checking the containers of the next color
+// without routing requests to them, then switching the routing of the deployment to the next color. The
+// containers of the next color are removed if switching fails.
+func blueGreenWorkflow(config Config, revision int, containers []KraneContainer, e *EventEmitter, tracker *job.Tracker) job.Workflow {
+	next := liveColor(config.Name).other()
+
+	// containers of the next color left running by a previous switch (ie. warm containers) are replaced
+	stale := containersByColor(containers, next)
+
+	wf := replaceContainersWorkflow(config.withColor(next), config.Scale, stale, e, tracker)
+	wf.With(SwitchStep, func(ctx context.Context, _ interface{}) error {
+		return switchColor(ctx, config, revision, next, e, tracker)
+	}, job.DependsOn(TeardownStep))
+	return wf
+}
+
+// switchColor routes the requests of a deployment to the containers of a color by syncing the routes of the
+// proxy provider, containers are never re-created. The previous live containers are kept warm for the keep_warm
+// window of the strategy, containers of any other color are removed.
+func switchColor(ctx context.Context, config Config, revision int, next Color, e *EventEmitter, tracker *job.Tracker) error {
+	e.Phase = SwitchPhase
+
+	state, err := GetBlueGreen(config.Name)
+	if err != nil {
+		return err
+	}
+
+	containers, err := GetContainersByDeployment(ctx, config.Name)
+	if err != nil {
+		logger.Errorf("unable to get containers %v", err)
+		return err
+	}
+
+	switched := BlueGreen{Deployment: config.Name, Live: next, LiveRevision: revision}
+	if keepWarm := config.Strategy.keepWarm(); state.Live != "" && keepWarm > 0 && len(containersByColor(containers, state.Live)) > 0 {
+		switched.Warm = state.Live
+		switched.WarmRevision = state.LiveRevision
+		switched.WarmUntil = time.Now().Add(keepWarm).Unix()
+	}
+
+	if err := putBlueGreen(switched); err != nil {
+		return err
+	}
+
+	// requests are routed to the next color once the routes are synced, the previous
+	// state is restored when syncing fails so requests keep reaching the live containers
+	if err := SyncRoutes(ctx); err != nil {
+		if err := putBlueGreen(state); err != nil {
+			logger.Errorf("unable to restore blue/green state %v", err)
+		}
+		syncRoutes(ctx)
+		return err
+	}
+
+	// containers created before a switch are removed, including containers created before the deployment used
+	// colors. Requests are already switched, containers failing to be removed are removed by the next switch.
+	remove := make([]KraneContainer, 0)
+	for _, c := range containers {
+		if c.Color == next || (switched.Warm != "" && c.Color == switched.Warm) {
+			continue
+		}
+		remove = append(remove, c)
+	}
+
+	e.Phase = TeardownPhase
+	if err := removeContainers(ctx, remove); err != nil {
+		logger.Warnf("Unable to remove previous containers of deployment %s, %v", config.Name, err)
+	}
+
+	message := fmt.Sprintf("Switched to %s containers", next)
+	if switched.Warm != "" {
+		message = fmt.Sprintf("%s, %s containers kept warm until %s", message, switched.Warm, time.Unix(switched.WarmUntil, 0).UTC().Format(time.RFC3339))
+	}
+	tracker.Track(string(SwitchPhase), message)
+	e.emit(message)
+
+	scheduleRetirement(switched)
+	return nil
+}
+
+// scheduleRetirement promotes a blue/green deployment once its warm containers expire
+func scheduleRetirement(state BlueGreen) {
+	if state.Warm == "" {
+		return
+	}
+
+	time.AfterFunc(time.Until(time.Unix(state.WarmUntil, 0)), func() {
+		// the deployment could have been promoted, aborted or switched again since
+		current, err := GetBlueGreen(state.Deployment)
+		if err != nil || current.Warm == "" || current.WarmUntil > time.Now().Unix() {
+			return
+		}
+
+		if _, err := Promote(state.Deployment); err != nil {
+			logger.Errorf("unable to remove warm containers %v", err)
+		}
+	})
+}
+
+// ScheduleWarmContainers schedules the removal of the warm containers of every blue/green deployment, warm
+// containers which expired while Krane was stopped are removed right away
+func ScheduleWarmContainers() {
+	bytes, err := store.Client().GetAll(constants.ColorsCollectionName)
+	if err != nil {
+		logger.Errorf("unable to get blue/green deployments %v", err)
+		return
+	}
+
+	for _, b := range bytes {
+		var state BlueGreen
+		if err := store.Deserialize(b, &state); err != nil {
+			logger.Errorf("unable to deserialize blue/green state %v", err)
+			continue
+		}
+		scheduleRetirement(state)
+	}
+}
+
+// Promote removes the warm containers of a blue/green deployment, ending its rollback window early
+func Promote(deployment string) (job.Job, error) {
+	state, err := GetBlueGreen(deployment)
+	if err != nil {
+		return job.Job{}, err
+	}
+
+	if state.Warm == "" {
+		return job.Job{}, fmt.Errorf("deployment %s has no warm containers to promote", deployment)
+	}
+
+	return enqueue(promoteJob(uuid.Generate().String(), deployment))
+}
+
+// promoteJob returns a promote deployment job with a given id
+func promoteJob(id, deployment string) job.Job {
+	type PromoteDeploymentJobArgs struct {
+		job.Tracker
+		Deployment string
+	}
+
+	e := createEventEmitter(deployment, id)
+	return job.Job{
+		ID:          id,
+		Deployment:  deployment,
+		Type:        string(PromoteDeploymentJobType),
+		RetryPolicy: retryPolicy(),
+		Args: &PromoteDeploymentJobArgs{
+			Deployment: deployment,
+		},
+		Run: func(ctx context.Context, args interface{}) error {
+			jobArgs := args.(*PromoteDeploymentJobArgs)
+			deploymentName := jobArgs.Deployment
+
+			state, err := GetBlueGreen(deploymentName)
+			if err != nil {
+				return err
+			}
+
+			// the warm containers were already removed
+			if state.Warm == "" {
+				return nil
+			}
+
+			containers, err := GetContainersByDeployment(ctx, deploymentName)
+			if err != nil {
+				logger.Errorf("unable to get containers %v", err)
+				return err
+			}
+
+			e.Phase = TeardownPhase
+			if err := removeContainers(ctx, containersByColor(containers, state.Warm)); err != nil {
+				return err
+			}
+
+			message := fmt.Sprintf("Promoted %s containers, %s containers removed", state.Live, state.Warm)
+			state.Warm, state.WarmRevision, state.WarmUntil = "", 0, 0
+			if err := putBlueGreen(state); err != nil {
+				return err
+			}
+
+			jobArgs.Track(string(SwitchPhase), message)
+			e.Phase = DonePhase
+			e.emit(message)
+			return nil
+		},
+	}
+}
+
+// Abort switches the requests of a blue/green deployment back to its warm containers and removes the live
+// containers. The configuration the warm containers were created from is saved as the latest revision.
+func Abort(deployment string) (job.Job, error) {
+	state, err := GetBlueGreen(deployment)
+	if err != nil {
+		return job.Job{}, err
+	}
+
+	if state.Warm == "" {
+		return job.Job{}, fmt.Errorf("deployment %s has no warm containers to switch back to", deployment)
+	}
+
+	return enqueue(abortJob(uuid.Generate().String(), deployment))
+}
+
+// abortJob returns an abort deployment job with a given id
+func abortJob(id, deployment string) job.Job {
+	type AbortDeploymentJobArgs struct {
+		job.Tracker
+		Deployment string
+	}
+
+	e := createEventEmitter(deployment, id)
+	return job.Job{
+		ID:          id,
+		Deployment:  deployment,
+		Type:        string(AbortDeploymentJobType),
+		RetryPolicy: retryPolicy(),
+		Args: &AbortDeploymentJobArgs{
+			Deployment: deployment,
+		},
+		Run: func(ctx context.Context, args interface{}) error {
+			jobArgs := args.(*AbortDeploymentJobArgs)
+			deploymentName := jobArgs.Deployment
+
+			state, err := GetBlueGreen(deploymentName)
+			if err != nil {
+				return err
+			}
+
+			if state.Warm == "" {
+				return fmt.Errorf("deployment %s has no warm containers to switch back to", deploymentName)
+			}
+
+			warm, err := GetRevision(deploymentName, state.WarmRevision)
+			if err != nil {
+				return err
+			}
+
+			containers, err := GetContainersByDeployment(ctx, deploymentName)
+			if err != nil {
+				logger.Errorf("unable to get containers %v", err)
+				return err
+			}
+
+			// the warm configuration is saved as the latest revision
+			e.Phase = SwitchPhase
+			revision, err := saveConfig(warm.Config, KraneUser)
+			if err != nil {
+				logger.Errorf("unable to save warm configuration %v", err)
+				return err
+			}
+
+			aborted := BlueGreen{Deployment: deploymentName, Live: state.Warm, LiveRevision: revision.Revision}
+			if err := putBlueGreen(aborted); err != nil {
+				return err
+			}
+
+			// requests are routed back to the warm containers once the routes are synced
+			if err := SyncRoutes(ctx); err != nil {
+				if err := putBlueGreen(state); err != nil {
+					logger.Errorf("unable to restore blue/green state %v", err)
+				}
+				syncRoutes(ctx)
+				return err
+			}
+
+			e.Phase = TeardownPhase
+			if err := removeContainers(ctx, containersByColor(containers, state.Live)); err != nil {
+				return err
+			}
+
+			message := fmt.Sprintf("Switched back to %s containers running revision %d, %s containers removed", state.Warm, state.WarmRevision, state.Live)
+			jobArgs.Track(string(SwitchPhase), message)
+			e.Phase = DonePhase
+			e.emit(message)
+
+			return markRevisionHealthy(deploymentName, revision.Revision)
+		},
+	}
+}
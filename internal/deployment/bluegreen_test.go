@@ -0,0 +1,67 @@
+package deployment
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/krane/krane/internal/docker"
+	"github.com/krane/krane/internal/proxy"
+)
+
+func TestNextColor(t *testing.T) {
+	assert.Equal(t, Blue, Color("").other())
+	assert.Equal(t, Green, Blue.other())
+	assert.Equal(t, Blue, Green.other())
+}
+
+func TestBlueGreenState(t *testing.T) {
+	deployment := "krane-test-bluegreen"
+
+	state, err := GetBlueGreen(deployment)
+	assert.Nil(t, err)
+	assert.Equal(t, BlueGreen{Deployment: deployment}, state)
+	assert.Equal(t, Color(""), liveColor(deployment))
+
+	switched := BlueGreen{Deployment: deployment, Live: Green, LiveRevision: 2, Warm: Blue, WarmRevision: 1, WarmUntil: 1600000000}
+	assert.Nil(t, putBlueGreen(switched))
+
+	state, err = GetBlueGreen(deployment)
+	assert.Nil(t, err)
+	assert.Equal(t, switched, state)
+	assert.Equal(t, Green, liveColor(deployment))
+
+	assert.Nil(t, deleteBlueGreen(deployment))
+	assert.Equal(t, Color(""), liveColor(deployment))
+}
+
+func TestLiveContainers(t *testing.T) {
+	containers := []KraneContainer{
+		{Name: "legacy"},
+		{Name: "blue", Color: Blue},
+		{Name: "green", Color: Green},
+	}
+
+	assert.Equal(t, containers, Deployment{Containers: containers}.LiveContainers())
+	assert.Equal(t, containers, Deployment{Containers: containers, BlueGreen: &BlueGreen{}}.LiveContainers())
+	assert.Equal(t, []KraneContainer{{Name: "green", Color: Green}}, Deployment{Containers: containers, BlueGreen: &BlueGreen{Live: Green}}.LiveContainers())
+	assert.Equal(t, []KraneContainer{{Name: "legacy"}}, containersByColor(containers, ""))
+}
+
+func TestColorLabels(t *testing.T) {
+	config := Config{Name: "krane-test-colors", Labels: map[string]string{"app": "web"}, TargetPort: "8080", Alias: []proxy.Alias{{Host: "example.com"}}}
+	config.applyDefaults()
+
+	// containers of a color only define the service of their color, routers are synced to the traefik dynamic configuration
+	labels, err := config.withColor(Blue).DockerLabels()
+	assert.Nil(t, err)
+	assert.Equal(t, "blue", labels[docker.ContainerColorLabel])
+	assert.Equal(t, "web", labels["app"])
+	assert.Equal(t, "true", labels["traefik.enable"])
+	assert.Equal(t, "8080", labels["traefik.http.services.krane-test-colors-blue.loadbalancer.server.port"])
+	assert.NotContains(t, labels, "traefik.http.routers.krane-test-colors-insecure.rule")
+
+	// colored configs do not share labels with the deployment config
+	assert.NotContains(t, config.Labels, docker.ContainerColorLabel)
+	assert.NotContains(t, config.Labels, "traefik.enable")
+}
@@ -1,13 +1,14 @@
 package deployment
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"os"
 	"regexp"
 	"strings"
 
-	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/go-connections/nat"
 	"github.com/lithammer/shortuuid/v3"
 
@@ -15,40 +16,81 @@ import (
 	"github.com/krane/krane/internal/docker"
 	"github.com/krane/krane/internal/logger"
 	"github.com/krane/krane/internal/proxy"
+	"github.com/krane/krane/internal/proxy/middlewares"
 	"github.com/krane/krane/internal/store"
 )
 
 // Config represents a deployment configuration
 type Config struct {
-	Name       string            `json:"name" binding:"required"`  // deployment name
-	Image      string            `json:"image" binding:"required"` // container image
-	Registry   Registry          `json:"registry"`                 // container registry credentials / auth
-	Tag        string            `json:"tag"`                      // container image tag
-	Alias      []string          `json:"alias"`                    // custom domain aliases (my-app.example.com or my-app.localhost)
-	Env        map[string]string `json:"env"`                      // deployment environment variables
-	Secrets    map[string]string `json:"secrets"`                  // deployment secrets resolved as environment variables
-	Labels     map[string]string `json:"labels"`                   // container labels
-	Ports      map[string]string `json:"ports"`                    // container ports to expose from the container to the host
-	TargetPort string            `json:"target_port"`              // the target port to load-balance request through
-	Volumes    map[string]string `json:"volumes"`                  // container volumes
-	Command    string            `json:"command"`                  // container start command
-	Entrypoint string            `json:"entrypoint"`               // container entrypoint
-	Scale      int               `json:"scale"`                    // number of containers to create for the deployment
-	Secure     bool              `json:"secure"`                   // enable/disable secure communication over HTTPS/TLS w/ auto generated certs
-	Internal   bool              `json:"internal"`                 // whether a deployment is internal (ie. krane-proxy)
-	RateLimit  uint              `json:"rate_limit"`               // requests per second for a given deployment (default 0, which means no rate limit)
+	Name                   string                  `json:"name" binding:"required"`   // deployment name
+	Image                  string                  `json:"image" binding:"required"`  // container image
+	Registry               Registry                `json:"registry"`                  // container registry credentials / auth
+	Tag                    string                  `json:"tag"`                       // container image tag
+	Alias                  []proxy.Alias           `json:"alias"`                     // custom domain aliases (my-app.example.com or my-app.localhost) w/ optional path prefixes
+	Env                    map[string]string       `json:"env"`                       // deployment environment variables
+	Secrets                map[string]string       `json:"secrets"`                   // deployment secrets resolved as environment variables
+	SecretFiles            []SecretFile            `json:"secret_files"`              // deployment secrets mounted into the containers as read-only files
+	SecretGroups           []string                `json:"secret_groups"`             // secret groups imported by the deployment, resolved after the deployment secrets
+	RedeployOnSecretChange bool                    `json:"redeploy_on_secret_change"` // run the deployment when a secret it references without a pinned version changes
+	Labels                 map[string]string       `json:"labels"`                    // container labels
+	Ports                  PortBindings            `json:"ports"`                     // container ports published to the host ([[host_ip:]host_port:]container_port[/protocol])
+	TargetPort             string                  `json:"target_port"`               // the target port to load-balance request through
+	Volumes                map[string]string       `json:"volumes"`                   // host paths or named volumes mounted into the container (/data or data: /var/lib/data[:ro])
+	Tmpfs                  map[string]string       `json:"tmpfs"`                     // tmpfs mounts by container path with an optional size (/tmp: 64m)
+	Command                string                  `json:"command"`                   // container start command
+	Entrypoint             string                  `json:"entrypoint"`                // container entrypoint
+	Scale                  int                     `json:"scale"`                     // number of containers to create for the deployment
+	Secure                 bool                    `json:"secure"`                    // enable/disable secure communication over HTTPS/TLS w/ auto generated certs
+	Internal               bool                    `json:"internal"`                  // whether a deployment is internal (ie. krane-proxy)
+	RateLimit              uint                    `json:"rate_limit"`                // requests per second for a given deployment (default 0, which means no rate limit)
+	Strategy               Strategy                `json:"strategy"`                  // how containers are replaced when running the deployment
+	HealthCheck            HealthCheck             `json:"health_check"`              // how containers are checked for health
+	Resources              Resources               `json:"resources"`                 // memory, cpu and process limits for each container
+	RestartPolicy          string                  `json:"restart_policy"`            // how containers are restarted when they exit (no, always, unless-stopped, on-failure:N)
+	TCP                    []proxy.TCPRouter       `json:"tcp"`                       // tcp connections routed from proxy entrypoints to the containers (ie. HostSNI rules)
+	UDP                    []proxy.UDPRouter       `json:"udp"`                       // udp datagrams routed from proxy entrypoints to the containers
+	Middlewares            middlewares.Middlewares `json:"middlewares"`               // basic auth, ip allowlist, headers, compression, retry and circuit breaker
+
+	color Color // color of the containers created for blue/green deployments
 }
 
-// SaveConfig a deployment configuration into the db
-func SaveConfig(config Config) error {
+// SaveConfig a deployment configuration into the db. Every saved configuration
+// is also stored as a new revision attributed to the user saving it.
+func SaveConfig(config Config, user string) error {
+	_, err := saveConfig(config, user)
+	return err
+}
+
+// saveConfig saves a deployment configuration and returns the revision it was stored as
+func saveConfig(config Config, user string) (Revision, error) {
 	config.applyDefaults()
 
 	if err := config.isValid(); err != nil {
 		logger.Errorf("deployment config is not valid %v", err)
+		return Revision{}, err
+	}
+
+	if err := putConfig(config); err != nil {
+		return Revision{}, err
+	}
+
+	return saveRevision(config, user)
+}
+
+// restoreConfig saves a deployment configuration back as the latest configuration, removing the revision saved after it
+func restoreConfig(config Config, revision int) error {
+	if err := putConfig(config); err != nil {
 		return err
 	}
+	return deleteRevision(config.Name, revision)
+}
 
-	bytes, _ := config.Serialize()
+// putConfig upserts a deployment configuration into the db without saving a revision
+func putConfig(config Config) error {
+	bytes, err := config.Serialize()
+	if err != nil {
+		return err
+	}
 	return store.Client().Put(constants.DeploymentsCollectionName, config.Name, bytes)
 }
 
@@ -71,7 +113,7 @@ func (config *Config) applyDefaults() {
 	}
 
 	if config.Alias == nil {
-		config.Alias = make([]string, 0)
+		config.Alias = make([]proxy.Alias, 0)
 	}
 
 	if config.Labels == nil {
@@ -82,6 +124,19 @@ func (config *Config) applyDefaults() {
 		config.Secrets = make(map[string]string, 0)
 	}
 
+	groups := make([]string, 0, len(config.SecretGroups))
+	for _, group := range config.SecretGroups {
+		groups = append(groups, normalizeSecretGroup(group))
+	}
+	config.SecretGroups = groups
+
+	if config.SecretFiles == nil {
+		config.SecretFiles = make([]SecretFile, 0)
+	}
+	for i := range config.SecretFiles {
+		config.SecretFiles[i].applyDefaults()
+	}
+
 	if config.Env == nil {
 		config.Env = make(map[string]string, 0)
 	}
@@ -90,14 +145,33 @@ func (config *Config) applyDefaults() {
 		config.Volumes = make(map[string]string, 0)
 	}
 
+	if config.Tmpfs == nil {
+		config.Tmpfs = make(map[string]string, 0)
+	}
+
 	if config.Ports == nil {
-		config.Ports = make(map[string]string, 0)
+		config.Ports = make(PortBindings, 0)
+	}
+
+	if config.TCP == nil {
+		config.TCP = make([]proxy.TCPRouter, 0)
+	}
+
+	if config.UDP == nil {
+		config.UDP = make([]proxy.UDPRouter, 0)
 	}
 
 	if config.Tag == "" {
 		config.Tag = "latest"
 	}
 
+	if config.RestartPolicy == "" {
+		config.RestartPolicy = NoRestart
+	}
+
+	config.Strategy.applyDefaults()
+	config.HealthCheck.applyDefaults(*config)
+
 	return
 }
 
@@ -112,6 +186,134 @@ func (config Config) isValid() error {
 		return errors.New("image required in deployment config")
 	}
 
+	if err := config.Strategy.isValid(); err != nil {
+		return err
+	}
+
+	if err := config.HealthCheck.isValid(); err != nil {
+		return err
+	}
+
+	if err := config.isValidPorts(); err != nil {
+		return err
+	}
+
+	if err := config.Middlewares.IsValid(); err != nil {
+		return err
+	}
+
+	aliases := make(map[string]bool)
+	for _, alias := range config.Alias {
+		if err := alias.IsValid(); err != nil {
+			return err
+		}
+
+		if !alias.Empty() && aliases[alias.String()] {
+			return fmt.Errorf("alias %s is defined more than once", alias)
+		}
+		aliases[alias.String()] = true
+	}
+
+	if err := config.isValidRouters(); err != nil {
+		return err
+	}
+
+	if err := config.isValidRoute(); err != nil {
+		return err
+	}
+
+	if err := config.isValidVolumes(); err != nil {
+		return err
+	}
+
+	if err := config.isValidSecretFiles(); err != nil {
+		return err
+	}
+
+	if err := config.isValidSecretGroups(); err != nil {
+		return err
+	}
+
+	if err := config.Resources.isValid(); err != nil {
+		return err
+	}
+
+	if _, err := parseRestartPolicy(config.RestartPolicy); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// isValidSecretGroups returns an error if a deployment imports a secret group which does not exist
+func (config Config) isValidSecretGroups() error {
+	for _, group := range config.SecretGroups {
+		if !isValidSecretKey(group) {
+			return fmt.Errorf("invalid secret group %s in deployment config", group)
+		}
+
+		exists, err := isSecretGroup(group)
+		if err != nil {
+			return err
+		}
+
+		if !exists {
+			return fmt.Errorf("unknown secret group %s in deployment config", group)
+		}
+	}
+	return nil
+}
+
+// isValidRouters returns an error if the tcp or udp routers of a deployment are not valid.
+// A deployment can only route a single tcp and a single udp router per proxy entrypoint,
+// and only to the entrypoints the proxy is configured with (PROXY_ENTRYPOINTS).
+func (config Config) isValidRouters() error {
+	if len(config.TCP) == 0 && len(config.UDP) == 0 {
+		return nil
+	}
+
+	declared, err := proxy.ParseEntrypoints(os.Getenv(constants.EnvProxyEntrypoints))
+	if err != nil {
+		return err
+	}
+
+	protocols := make(map[string]string)
+	for _, e := range declared {
+		protocols[e.Name] = e.Protocol
+	}
+
+	entrypoints := make(map[string]bool)
+	for _, r := range config.TCP {
+		if err := r.IsValid(); err != nil {
+			return err
+		}
+
+		if protocols[r.Entrypoint] != "tcp" {
+			return fmt.Errorf("tcp entrypoint %s is not declared as a tcp entrypoint in %s", r.Entrypoint, constants.EnvProxyEntrypoints)
+		}
+
+		if entrypoints[r.Entrypoint] {
+			return fmt.Errorf("tcp entrypoint %s is routed more than once", r.Entrypoint)
+		}
+		entrypoints[r.Entrypoint] = true
+	}
+
+	entrypoints = make(map[string]bool)
+	for _, r := range config.UDP {
+		if err := r.IsValid(); err != nil {
+			return err
+		}
+
+		if protocols[r.Entrypoint] != "udp" {
+			return fmt.Errorf("udp entrypoint %s is not declared as a udp entrypoint in %s", r.Entrypoint, constants.EnvProxyEntrypoints)
+		}
+
+		if entrypoints[r.Entrypoint] {
+			return fmt.Errorf("udp entrypoint %s is routed more than once", r.Entrypoint)
+		}
+		entrypoints[r.Entrypoint] = true
+	}
+
 	return nil
 }
 
@@ -182,10 +384,25 @@ func (config Config) Empty() bool {
 }
 
 // DockerConfig returns the docker configuration for creating a container
-func (config Config) DockerConfig() docker.DockerConfig {
-	kraneNetwork, err := docker.GetClient().GetNetworkByName(docker.KraneNetworkName)
+func (config Config) DockerConfig(ctx context.Context) (docker.DockerConfig, error) {
+	kraneNetwork, err := docker.GetClient().GetNetworkByName(ctx, docker.KraneNetworkName)
+	if err != nil {
+		return docker.DockerConfig{}, err
+	}
+
+	labels, err := config.DockerLabels()
+	if err != nil {
+		return docker.DockerConfig{}, err
+	}
+
+	envs, err := config.DockerEnvs()
 	if err != nil {
-		return docker.DockerConfig{}
+		return docker.DockerConfig{}, err
+	}
+
+	restartPolicy, err := parseRestartPolicy(config.RestartPolicy)
+	if err != nil {
+		logger.Warnf("Invalid restart policy for deployment %s, %v", config.Name, err)
 	}
 
 	var command []string
@@ -205,99 +422,105 @@ func (config Config) DockerConfig() docker.DockerConfig {
 		ContainerName: containerName,
 		Image:         imageName,
 		NetworkID:     kraneNetwork.ID,
-		Aliases:       config.Alias,
-		Labels:        config.DockerLabels(),
+		Aliases:       proxy.Hosts(config.Alias),
+		Labels:        labels,
 		Ports:         config.DockerPorts(),
 		PortSet:       config.DockerPortSet(),
 		VolumeMounts:  config.DockerVolumeMount(),
 		VolumeSet:     config.DockerVolumeSet(),
-		Env:           config.DockerEnvs(),
+		Resources:     config.Resources.DockerResources(),
+		RestartPolicy: restartPolicy,
+		Env:           envs,
 		Command:       command,
 		Entrypoint:    entrypoint,
-	}
+	}, nil
 }
 
-// DockerEnvs returns a list of formatted Docker environment variables
-func (config Config) DockerEnvs() []string {
+// DockerEnvs returns a list of formatted Docker environment variables, an error is returned
+// if a secret referenced by the deployment config cannot be resolved
+func (config Config) DockerEnvs() ([]string, error) {
 	envs := make([]string, 0)
 
-	// environment variables sourced from the deployment config
-	for k, v := range config.Env {
-		envs = append(envs, fmt.Sprintf("%s=%s", k, v))
+	// environment variables sourced from the deployment config, values referencing a secret (@MY_SECRET) are resolved
+	for _, k := range sortedMapKeys(config.Env) {
+		value, err := config.resolveSecretValue(config.Env[k])
+		if err != nil {
+			return nil, fmt.Errorf("unable to resolve environment variable %s for %s, %v", k, config.Name, err)
+		}
+		envs = append(envs, fmt.Sprintf("%s=%s", k, value))
 	}
 
 	// secrets specified in the deployment config which work the same as environment variables
 	// but with resolved values located server side
-	for key, alias := range config.Secrets {
-		secret, err := GetSecret(config.Name, key)
+	for _, key := range sortedMapKeys(config.Secrets) {
+		ref := SecretReference{Field: "secrets", Key: key, Secret: secretAlias(key, config.Secrets[key])}
+		secret, err := config.resolveReference(ref)
 		if err != nil || secret == nil {
-			logger.Infof("unable to resolve secret for %s with alias %s", config.Name, alias)
-			continue
+			return nil, fmt.Errorf("unable to resolve secret %s for %s", ref, config.Name)
 		}
 		envs = append(envs, fmt.Sprintf("%s=%s", key, secret.Value))
 	}
 
-	return envs
+	return envs, nil
 }
 
 // DockerLabels returns a map of Docker labels that are applied to Krane managed containers
-func (config Config) DockerLabels() map[string]string {
-	config.Labels[docker.ContainerDeploymentLabel] = config.Name
-	config.ApplyProxyLabels()
-	return config.Labels
-}
-
-// ApplyProxyLabels applies network labels to a deployment config
-func (config Config) ApplyProxyLabels() {
-	// default traefik labels
-	config.Labels["traefik.enable"] = "true"
-	config.Labels["traefik.docker.network"] = docker.KraneNetworkName
-
-	// router labels
-	for k, v := range proxy.TraefikRouterLabels(config.Name, config.Alias, config.Secure) {
-		config.Labels[k] = v
+func (config Config) DockerLabels() (map[string]string, error) {
+	// labels referencing a secret (@MY_SECRET) are resolved without changing the deployment config
+	labels := make(map[string]string, len(config.Labels))
+	for k, v := range config.Labels {
+		value, err := config.resolveSecretValue(v)
+		if err != nil {
+			return nil, fmt.Errorf("unable to resolve label %s for %s, %v", k, config.Name, err)
+		}
+		labels[k] = value
 	}
+	config.Labels = labels
 
-	// middleware labels
-	for k, v := range proxy.TraefikMiddlewareLabels(config.Name, config.Secure, config.RateLimit) {
-		config.Labels[k] = v
+	config.Labels[docker.ContainerDeploymentLabel] = config.Name
+	if config.color != "" {
+		config.Labels[docker.ContainerColorLabel] = string(config.color)
 	}
 
-	// service labels
-	for k, v := range proxy.TraefikServiceLabels(config.Name, config.Ports, config.TargetPort) {
-		config.Labels[k] = v
+	if err := config.ApplyProxyLabels(); err != nil {
+		return nil, err
 	}
+	return config.Labels, nil
 }
 
-// DockerVolumeMount returns a list of formatted Docker volume mounts
-func (config Config) DockerVolumeMount() []mount.Mount {
-	volumes := make([]mount.Mount, 0)
-	for hostVolume, containerVolume := range config.Volumes {
-		volumes = append(volumes, mount.Mount{
-			Type:   mount.TypeBind,
-			Source: hostVolume,
-			Target: containerVolume,
-		})
-	}
-	return volumes
+// withColor returns a copy of a deployment config creating containers of a blue/green color
+func (config Config) withColor(color Color) Config {
+	labels := make(map[string]string, len(config.Labels))
+	for k, v := range config.Labels {
+		labels[k] = v
+	}
+
+	config.Labels = labels
+	config.color = color
+	return config
 }
 
-// DockerVolumeSet returns a set of Docker formatted volumes
-func (config Config) DockerVolumeSet() map[string]struct{} {
-	volumes := make(map[string]struct{}, 0)
-	for _, containerVolume := range config.Volumes {
-		volumes[containerVolume] = struct{}{}
+// ApplyProxyLabels applies the routing labels of the proxy provider to a deployment config
+func (config Config) ApplyProxyLabels() error {
+	route, err := config.route()
+	if err != nil {
+		return err
 	}
-	return volumes
+
+	for k, v := range proxy.GetProvider().Labels(route) {
+		config.Labels[k] = v
+	}
+	return nil
 }
 
 // DockerPorts returns Docker formatted port map
 func (config Config) DockerPorts() nat.PortMap {
 	bindings := nat.PortMap{}
-	for hostPort, containerPort := range config.Ports {
+	for _, p := range config.portBindings() {
+		hostPort := p.HostPort
 		if hostPort == "" {
 			// randomly assign a host port if no explicit host port to bind to was provided
-			freePort, err := findFreePort()
+			freePort, err := findFreePort(p.Protocol)
 			if err != nil {
 				logger.Errorf("Error looking for a free port on host machine %v", err)
 				continue
@@ -305,16 +528,14 @@ func (config Config) DockerPorts() nat.PortMap {
 			hostPort = freePort
 		}
 
-		hostBinding := nat.PortBinding{HostPort: hostPort}
-
-		// TODO: expose functionality for binding to other protocols besides tcp
-		cPort, err := nat.NewPort(string(TCP), containerPort)
+		cPort, err := nat.NewPort(string(p.Protocol), p.ContainerPort)
 		if err != nil {
 			logger.Errorf("Error creating a new container port %v", err)
 			continue
 		}
 
-		bindings[cPort] = []nat.PortBinding{hostBinding}
+		// a container port can be published on multiple host ports or host ips
+		bindings[cPort] = append(bindings[cPort], nat.PortBinding{HostIP: p.HostIP, HostPort: hostPort})
 	}
 
 	return bindings
@@ -323,8 +544,8 @@ func (config Config) DockerPorts() nat.PortMap {
 // DockerPortSet returns Docker formatted port set
 func (config Config) DockerPortSet() nat.PortSet {
 	bindings := nat.PortSet{}
-	for _, containerPort := range config.Ports {
-		cPort, err := nat.NewPort(string(TCP), containerPort)
+	for _, p := range config.portBindings() {
+		cPort, err := nat.NewPort(string(p.Protocol), p.ContainerPort)
 		if err != nil {
 			logger.Errorf("Error creating a new container port %v", err)
 			continue
@@ -334,27 +555,34 @@ func (config Config) DockerPortSet() nat.PortSet {
 	return bindings
 }
 
-func (config *Config) ResolveRegistryCredentials() error {
-	if strings.HasPrefix(config.Registry.URL, "@") {
-		secret, err := GetSecret(config.Name, strings.Trim(config.Registry.URL, "@"))
+// basicAuthCredentials returns the htpasswd entries (user:hash) of the basic auth users resolved from the deployment secrets
+func (config Config) basicAuthCredentials() ([]string, error) {
+	credentials := make([]string, 0)
+	for _, user := range config.Middlewares.BasicAuth.Users {
+		secret, err := config.resolveSecret(user)
 		if err != nil {
-			return fmt.Errorf("secret \"%s\" not found", config.Registry.URL)
+			return credentials, fmt.Errorf("basic auth secret \"%s\" not found", user)
 		}
-		config.Registry.URL = secret.Value
-	}
-	if strings.HasPrefix(config.Registry.Username, "@") {
-		secret, err := GetSecret(config.Name, strings.Trim(config.Registry.Username, "@"))
-		if err != nil {
-			return fmt.Errorf("secret \"%s\" not found", config.Registry.Username)
+
+		if !strings.Contains(secret.Value, ":") {
+			return credentials, fmt.Errorf("basic auth secret \"%s\" must be formatted as user:hash", user)
 		}
-		config.Registry.Username = secret.Value
+		credentials = append(credentials, secret.Value)
+	}
+
+	if err := proxy.ValidateCredentials(proxy.GetProvider().Name(), credentials); err != nil {
+		return credentials, fmt.Errorf("invalid basic auth users, %v", err)
 	}
-	if strings.HasPrefix(config.Registry.Password, "@") {
-		secret, err := GetSecret(config.Name, strings.Trim(config.Registry.Password, "@"))
+	return credentials, nil
+}
+
+func (config *Config) ResolveRegistryCredentials() error {
+	for _, value := range []*string{&config.Registry.URL, &config.Registry.Username, &config.Registry.Password} {
+		resolved, err := config.resolveSecretValue(*value)
 		if err != nil {
-			return fmt.Errorf("secret \"%s\" not found", config.Registry.Password)
+			return err
 		}
-		config.Registry.Password = secret.Value
+		*value = resolved
 	}
 	return nil
 }
@@ -1,10 +1,14 @@
 package deployment
 
 import (
+	"os"
 	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/krane/krane/internal/constants"
+	"github.com/krane/krane/internal/proxy"
 )
 
 func TestMinimalDeploymentConfig(t *testing.T) {
@@ -18,6 +22,44 @@ func TestInvalidDeployment(t *testing.T) {
 	assert.Error(t, Config{Name: "example-$123", Image: "biensupernice/krane"}.isValid())
 }
 
+func TestRoutersRequireDeclaredEntrypoints(t *testing.T) {
+	os.Setenv(constants.EnvProxyEntrypoints, "postgres=5432,dns=53/udp")
+	defer os.Unsetenv(constants.EnvProxyEntrypoints)
+
+	assert.Nil(t, Config{TCP: []proxy.TCPRouter{{Entrypoint: "postgres", Port: "5432"}}, UDP: []proxy.UDPRouter{{Entrypoint: "dns", Port: "53"}}}.isValidRouters())
+	assert.Error(t, Config{TCP: []proxy.TCPRouter{{Entrypoint: "redis", Port: "6379"}}}.isValidRouters())
+	assert.Error(t, Config{TCP: []proxy.TCPRouter{{Entrypoint: "dns", Port: "53"}}}.isValidRouters())
+	assert.Error(t, Config{UDP: []proxy.UDPRouter{{Entrypoint: "postgres", Port: "5432"}}}.isValidRouters())
+}
+
+func TestRouteConflicts(t *testing.T) {
+	web := Config{Name: "web", Alias: []proxy.Alias{{Host: "example.com"}}}
+	api := Config{Name: "api", Alias: []proxy.Alias{{Host: "example.com", PathPrefix: "/api"}}}
+	others := []Config{web, api}
+
+	assert.Nil(t, routeConflicts(web, proxy.CaddyProvider, others))
+	assert.Nil(t, routeConflicts(Config{Name: "docs", Alias: []proxy.Alias{{Host: "example.com", PathPrefix: "/docs"}}}, proxy.NginxProvider, others))
+
+	// caddy and nginx route a domain and path prefix for a single deployment
+	duplicate := Config{Name: "other", Alias: []proxy.Alias{{Host: "example.com", PathPrefix: "/api"}}}
+	assert.EqualError(t, routeConflicts(duplicate, proxy.NginxProvider, others), "alias example.com/api is already routed by deployment api")
+	assert.Nil(t, routeConflicts(duplicate, proxy.TraefikProvider, others))
+
+	// nginx does not provision TLS certificates
+	assert.Error(t, routeConflicts(Config{Name: "secure", Secure: true}, proxy.NginxProvider, others))
+
+	// caddy only supports bcrypt hashed passwords, users whose secrets are not saved yet are checked when running
+	deployment := "route-conflicts-test"
+	assert.Nil(t, CreateSecretsCollection(deployment))
+	_, err := AddSecret(deployment, "ADMIN", "admin:$apr1$H6uskkkW$IgXLP6ewTrSuBkTrqE8wj/", KraneUser)
+	assert.Nil(t, err)
+
+	basicAuth := Config{Name: deployment}
+	basicAuth.Middlewares.BasicAuth.Users = []string{"@ADMIN", "@MISSING"}
+	assert.Error(t, routeConflicts(basicAuth, proxy.CaddyProvider, others))
+	assert.Nil(t, routeConflicts(basicAuth, proxy.NginxProvider, others))
+}
+
 func TestValidDeploymentNames(t *testing.T) {
 	assert.True(t, Config{Name: "example"}.isValidName())
 	assert.True(t, Config{Name: "example-_hello-world_deployment"}.isValidName())
@@ -55,11 +97,11 @@ func TestResolveRegistryCredentials_WithSecrets(t *testing.T) {
 	}
 
 	// setup
-	urlSecret, err := AddSecret(config.Name, "TEST_URL", "test-url")
+	urlSecret, err := AddSecret(config.Name, "TEST_URL", "test-url", KraneUser)
 	assert.Nil(t, err)
-	usernameSecret, err := AddSecret(config.Name, "TEST_USERNAME", "test")
+	usernameSecret, err := AddSecret(config.Name, "TEST_USERNAME", "test", KraneUser)
 	assert.Nil(t, err)
-	passwordSecret, err := AddSecret(config.Name, "TEST_PASSWORD", "123")
+	passwordSecret, err := AddSecret(config.Name, "TEST_PASSWORD", "123", KraneUser)
 	assert.Nil(t, err)
 
 	// act
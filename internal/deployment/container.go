@@ -14,8 +14,10 @@ import (
 type KraneContainer struct {
 	ID         string            `json:"id"`
 	Deployment string            `json:"deployment"`
+	Color      Color             `json:"color,omitempty"` // color of the containers of blue/green deployments
 	Name       string            `json:"name"`
 	NetworkID  string            `json:"network_id"`
+	IPAddress  string            `json:"ip_address"` // address of the container on the krane network
 	Image      string            `json:"image"`
 	ImageID    string            `json:"image_id"`
 	CreatedAt  int64             `json:"created_at"`
@@ -25,22 +27,24 @@ type KraneContainer struct {
 	Volumes    []Volume          `json:"volumes"`
 	Command    []string          `json:"command"`
 	Entrypoint []string          `json:"entrypoint"`
+	Resources  Resources         `json:"resources"`
 }
 
 // ContainerState represents the state of a Krane container
 type ContainerState struct {
-	Status     string        `json:"status"` // created,started,running ...
-	Running    bool          `json:"running"`
-	Paused     bool          `json:"paused"`
-	Restarting bool          `json:"restarting"`
-	OOMKilled  bool          `json:"oom_killed"`
-	Dead       bool          `json:"dead"`
-	Pid        int           `json:"pid"`
-	ExitCode   int           `json:"exit_code"`
-	Error      string        `json:"error"`
-	StartedAt  string        `json:"started_at"`
-	FinishedAt string        `json:"finished_at"`
-	Health     *types.Health `json:",omitempty"`
+	Status       string        `json:"status"` // created,started,running ...
+	Running      bool          `json:"running"`
+	Paused       bool          `json:"paused"`
+	Restarting   bool          `json:"restarting"`
+	OOMKilled    bool          `json:"oom_killed"`
+	Dead         bool          `json:"dead"`
+	Pid          int           `json:"pid"`
+	ExitCode     int           `json:"exit_code"`
+	Error        string        `json:"error"`
+	StartedAt    string        `json:"started_at"`
+	FinishedAt   string        `json:"finished_at"`
+	Health       *types.Health `json:",omitempty"`
+	RestartCount int           `json:"restart_count"` // number of times the container was restarted by its restart policy
 }
 
 type ContainerStatus string
@@ -52,13 +56,22 @@ const (
 )
 
 // ContainerCreate creates a docker container from a deployment config
-func ContainerCreate(config Config) (KraneContainer, error) {
-	ctx := context.Background()
-	defer ctx.Done()
+func ContainerCreate(ctx context.Context, config Config) (KraneContainer, error) {
+	mappedConfig, err := config.DockerConfig(ctx)
+	if err != nil {
+		return KraneContainer{}, err
+	}
+
+	// secret files are written for each container and bind mounted, never stored in its labels or env
+	secretMounts, err := writeSecretFiles(config, mappedConfig.ContainerName)
+	if err != nil {
+		return KraneContainer{}, err
+	}
+	mappedConfig.VolumeMounts = append(mappedConfig.VolumeMounts, secretMounts...)
 
-	mappedConfig := config.DockerConfig()
 	body, err := docker.GetClient().CreateContainer(ctx, mappedConfig)
 	if err != nil {
+		removeSecretFiles(mappedConfig.ContainerName)
 		return KraneContainer{}, err
 	}
 
@@ -73,44 +86,50 @@ func ContainerCreate(config Config) (KraneContainer, error) {
 }
 
 // Start starts a Krane managed Docker Container
-func (c KraneContainer) Start() error {
-	ctx := context.Background()
-	defer ctx.Done()
-
+func (c KraneContainer) Start(ctx context.Context) error {
 	return docker.GetClient().StartContainer(ctx, c.ID)
 }
 
 // Stop stops a Krane managed Docker Container
-func (c KraneContainer) Stop() error {
-	ctx := context.Background()
-	defer ctx.Done()
-
+func (c KraneContainer) Stop(ctx context.Context) error {
 	return docker.GetClient().StopContainer(ctx, c.ID)
 }
 
 // Remove removes a Krane managed Docker container
-func (c KraneContainer) Remove() error {
-	ctx := context.Background()
-	defer ctx.Done()
+func (c KraneContainer) Remove(ctx context.Context) error {
+	if err := docker.GetClient().RemoveContainer(ctx, c.ID, true); err != nil {
+		return err
+	}
 
-	return docker.GetClient().RemoveContainer(ctx, c.ID, true)
+	forgetHealth(c.ID)
+	removeSecretFiles(c.Name)
+	return nil
 }
 
 // fromDockerContainerToKcontainer converts a docker container into a KraneContainer
 func fromDockerContainerToKcontainer(container types.ContainerJSON) KraneContainer {
-	ctx := context.Background()
-	defer ctx.Done()
-
 	createdAt, _ := time.Parse(time.RFC3339, container.ContainerJSONBase.Created)
 	state := fromDockerStateToState(*container.State)
+	state.RestartCount = container.RestartCount
+	if health := recordedHealth(container.ID); health != nil {
+		// health check results recorded by Krane take precedence over Docker health checks
+		state.Health = health
+	}
 	ports := fromPortMapToPortList(container.NetworkSettings.Ports)
 	volumes := fromMountPointToVolumeList(container.Mounts)
 
+	var resources Resources
+	if container.HostConfig != nil {
+		resources = fromDockerResourcesToResources(container.HostConfig.Resources)
+	}
+
 	return KraneContainer{
 		ID:         container.ID,
 		Deployment: container.Config.Labels[docker.ContainerDeploymentLabel],
+		Color:      Color(container.Config.Labels[docker.ContainerColorLabel]),
 		Name:       container.Config.Hostname,
 		NetworkID:  container.NetworkSettings.Networks[docker.KraneNetworkName].NetworkID,
+		IPAddress:  container.NetworkSettings.Networks[docker.KraneNetworkName].IPAddress,
 		Image:      container.Config.Image,
 		ImageID:    container.ContainerJSONBase.Image,
 		CreatedAt:  createdAt.Unix(),
@@ -120,6 +139,7 @@ func fromDockerContainerToKcontainer(container types.ContainerJSON) KraneContain
 		Volumes:    volumes,
 		Command:    container.Config.Cmd,
 		Entrypoint: container.Config.Entrypoint,
+		Resources:  resources,
 	}
 }
 
@@ -142,11 +162,8 @@ func fromDockerStateToState(state types.ContainerState) ContainerState {
 }
 
 // GetContainers get all containers managed by Krane
-func GetContainers() ([]KraneContainer, error) {
-	ctx := context.Background()
-	defer ctx.Done()
-
-	allContainers, err := docker.GetClient().GetAllContainers(&ctx)
+func GetContainers(ctx context.Context) ([]KraneContainer, error) {
+	allContainers, err := docker.GetClient().GetAllContainers(ctx)
 	if err != nil {
 		return make([]KraneContainer, 0), err
 	}
@@ -168,8 +185,8 @@ func isKraneManagedContainer(container types.ContainerJSON) bool {
 }
 
 // GetContainersByDeployment get containers filtered by deployment
-func GetContainersByDeployment(deployment string) ([]KraneContainer, error) {
-	allContainers, err := GetContainers()
+func GetContainersByDeployment(ctx context.Context, deployment string) ([]KraneContainer, error) {
+	allContainers, err := GetContainers(ctx)
 	if err != nil {
 		return make([]KraneContainer, 0), err
 	}
@@ -185,40 +202,8 @@ func GetContainersByDeployment(deployment string) ([]KraneContainer, error) {
 	return containers, nil
 }
 
-// RetriableContainersHealthCheck returns an error if a container is considered unhealthy
-func RetriableContainersHealthCheck(containers []KraneContainer, retries int) error {
-	for _, c := range containers {
-		for i := 0; i <= retries; i++ {
-			expBackOff := time.Duration(10 * i)
-			time.Sleep(expBackOff * time.Second)
-
-			isRunning, err := c.Running()
-			if err != nil {
-				if i == retries {
-					return fmt.Errorf("container is not healthy %v", err)
-				}
-				continue
-			}
-
-			if !isRunning {
-				if i == retries {
-					return fmt.Errorf("container is not healthy %v", err)
-				}
-				continue
-			}
-
-			// if reached here container in a running state
-			break
-		}
-	}
-	return nil
-}
-
 // Running returns whether a container is in a running state
-func (c KraneContainer) Running() (bool, error) {
-	ctx := context.Background()
-	defer ctx.Done()
-
+func (c KraneContainer) Running(ctx context.Context) (bool, error) {
 	resp, err := docker.GetClient().GetOneContainer(ctx, c.ID)
 	if err != nil {
 		return false, err
@@ -1,10 +1,10 @@
 package deployment
 
 import (
+	"context"
 	"fmt"
 	"github.com/docker/distribution/uuid"
 
-	"github.com/krane/krane/internal/constants"
 	"github.com/krane/krane/internal/docker"
 	"github.com/krane/krane/internal/job"
 	"github.com/krane/krane/internal/logger"
@@ -16,6 +16,7 @@ type Deployment struct {
 	Config     Config           `json:"config"`
 	Containers []KraneContainer `json:"containers"`
 	Jobs       []job.Job        `json:"jobs"`
+	BlueGreen  *BlueGreen       `json:"blue_green,omitempty"` // live and warm colors of blue/green deployments
 }
 
 // Exist returns true if a deployment exist, false otherwise
@@ -33,13 +34,13 @@ func Exist(deployment string) bool {
 }
 
 // GetDeployment returns a single deployment
-func GetDeployment(deployment string) (Deployment, error) {
+func GetDeployment(ctx context.Context, deployment string) (Deployment, error) {
 	config, err := GetDeploymentConfig(deployment)
 	if err != nil {
 		return Deployment{}, err
 	}
 
-	containers, err := GetContainersByDeployment(deployment)
+	containers, err := GetContainersByDeployment(ctx, deployment)
 	if err != nil {
 		return Deployment{}, err
 	}
@@ -49,15 +50,33 @@ func GetDeployment(deployment string) (Deployment, error) {
 		return Deployment{}, err
 	}
 
+	var colors *BlueGreen
+	if config.Strategy.Type == BlueGreenStrategy {
+		state, err := GetBlueGreen(deployment)
+		if err != nil {
+			return Deployment{}, err
+		}
+		colors = &state
+	}
+
 	return Deployment{
 		Config:     config,
 		Containers: containers,
 		Jobs:       jobs,
+		BlueGreen:  colors,
 	}, nil
 }
 
+// LiveContainers returns the containers requests are routed to, excluding the warm containers of blue/green deployments
+func (d Deployment) LiveContainers() []KraneContainer {
+	if d.BlueGreen == nil || d.BlueGreen.Live == "" {
+		return d.Containers
+	}
+	return containersByColor(d.Containers, d.BlueGreen.Live)
+}
+
 // GetAllDeployments returns a list of all deployments
-func GetAllDeployments() ([]Deployment, error) {
+func GetAllDeployments(ctx context.Context) ([]Deployment, error) {
 	configs, err := GetAllDeploymentConfigs()
 	if err != nil {
 		return []Deployment{}, err
@@ -65,7 +84,7 @@ func GetAllDeployments() ([]Deployment, error) {
 
 	deployments := make([]Deployment, 0)
 	for _, config := range configs {
-		d, err := GetDeployment(config.Name)
+		d, err := GetDeployment(ctx, config.Name)
 		if err != nil {
 			return []Deployment{}, err
 		}
@@ -78,32 +97,89 @@ func GetAllDeployments() ([]Deployment, error) {
 
 // Run a deployment runs the current configuration for a
 // deployment creating or re-creating container resources
-func Run(deployment string) error {
+func Run(deployment string) (job.Job, error) {
+	j, err := RunJob(deployment)
+	if err != nil {
+		return job.Job{}, err
+	}
+
+	return enqueue(j)
+}
+
+// RunJob returns the job used to run the current configuration for a deployment. Deployments
+// binding a host port already bound by another deployment fail early, before the job is queued.
+func RunJob(deployment string) (job.Job, error) {
 	config, err := GetDeploymentConfig(deployment)
 	if err != nil {
-		return err
+		return job.Job{}, err
+	}
+
+	if err := checkPortConflicts(config); err != nil {
+		return job.Job{}, err
+	}
+
+	return runJob(uuid.Generate().String(), deployment)
+}
+
+// runJob returns a run deployment job with a given id
+func runJob(id, deployment string) (job.Job, error) {
+	config, err := GetDeploymentConfig(deployment)
+	if err != nil {
+		return job.Job{}, err
+	}
+
+	// deployments saved before revisions existed are stored as their first revision
+	revision, err := GetLatestRevision(deployment)
+	if err != nil {
+		revision, err = saveRevision(config, KraneUser)
+		if err != nil {
+			return job.Job{}, err
+		}
 	}
 
 	type RunDeploymentJobArgs struct {
+		job.Tracker
 		Config             Config
+		Revision           int
 		ContainersToRemove []KraneContainer
 	}
 
-	jobID := uuid.Generate().String()
-	e := createEventEmitter(config.Name, jobID)
-	go enqueue(job.Job{
-		ID:          jobID,
+	e := createEventEmitter(config.Name, id)
+	return job.Job{
+		ID:          id,
 		Deployment:  config.Name,
 		Type:        string(RunDeploymentJobType),
-		RetryPolicy: utils.UIntEnv(constants.EnvDeploymentRetryPolicy),
+		RetryPolicy: retryPolicy(),
+		Supersede:   true,
 		Args: &RunDeploymentJobArgs{
 			Config:             config,
+			Revision:           revision.Revision,
 			ContainersToRemove: []KraneContainer{},
 		},
-		Setup: func(args interface{}) error {
+		Setup: func(ctx context.Context, args interface{}) error {
 			jobArgs := args.(*RunDeploymentJobArgs)
 			deploymentName := jobArgs.Config.Name
 
+			// host ports could have been bound by another deployment since the job was queued
+			if err := checkPortConflicts(jobArgs.Config); err != nil {
+				logger.Errorf("unable to bind deployment ports %v", err)
+				return err
+			}
+
+			// containers are never created without the secrets they reference
+			e.Phase = ValidatePhase
+			if err := jobArgs.Config.validateSecrets(); err != nil {
+				e.emit(err.Error())
+				logger.Errorf("unable to resolve deployment secrets %v", err)
+				return job.NonRetryable(err)
+			}
+
+			// containers are never exposed without the basic auth users they require
+			if _, err := jobArgs.Config.basicAuthCredentials(); err != nil {
+				logger.Errorf("unable to resolve basic auth credentials %v", err)
+				return job.NonRetryable(err)
+			}
+
 			// ensure secrets collections
 			if err := CreateSecretsCollection(deploymentName); err != nil {
 				logger.Errorf("unable to create secrets collection %v", err)
@@ -116,8 +192,14 @@ func Run(deployment string) error {
 				return err
 			}
 
+			// ensure revisions collections
+			if err := CreateRevisionsCollection(deploymentName); err != nil {
+				logger.Errorf("unable to create revisions collection %v", err)
+				return err
+			}
+
 			// get containers (if any) currently part of this deployment
-			containers, err := GetContainersByDeployment(deploymentName)
+			containers, err := GetContainersByDeployment(ctx, deploymentName)
 			if err != nil {
 				logger.Errorf("unable to get containers %v", err)
 				return err
@@ -128,102 +210,147 @@ func Run(deployment string) error {
 
 			return nil
 		},
-		Run: func(args interface{}) error {
+		Run: func(ctx context.Context, args interface{}) error {
 			jobArgs := args.(*RunDeploymentJobArgs)
-			config := jobArgs.Config
 
-			// resolve registry credentials
-			if err := config.ResolveRegistryCredentials(); err != nil {
-				logger.Errorf("unable to resolve registry credentials: %v", err)
+			if err := deploy(ctx, jobArgs.Config, jobArgs.Revision, jobArgs.ContainersToRemove, e, &jobArgs.Tracker); err != nil {
 				return err
 			}
 
-			// pull image
-			logger.Debugf("Pulling image for deployment %s", config.Name)
-			pullImageReader, err := docker.GetClient().PullImage(
-				config.Image, config.Tag, docker.RegistryCredentials{
-					URL:      config.Registry.URL,
-					Username: config.Registry.Username,
-					Password: config.Registry.Password,
-				})
+			return markRevisionHealthy(jobArgs.Config.Name, jobArgs.Revision)
+		},
+		Rollback: func(ctx context.Context, args interface{}) error {
+			jobArgs := args.(*RunDeploymentJobArgs)
+			deploymentName := jobArgs.Config.Name
+
+			// the running containers are only replaced once new containers were created, deployments failing
+			// before (ie. resolving secrets, binding ports or pulling the image) leave them untouched
+			switch jobArgs.FailedStep() {
+			case StartStep, HealthStep, TeardownStep, RollingUpdateStep:
+			default:
+				logger.Debugf("Deployment %s failed before replacing its containers, nothing to roll back", deploymentName)
+				return job.ErrNothingToRollback
+			}
+
+			// find the last known-good revision to redeploy
+			healthy, err := lastHealthyRevision(deploymentName, jobArgs.Revision)
 			if err != nil {
-				logger.Errorf("unable to pull image %v", err)
+				logger.Warnf("unable to rollback deployment %s, %v", deploymentName, err)
 				return err
 			}
-			e.emitStream(pullImageReader)
-
-			// create containers
-			containersCreated := make([]KraneContainer, 0)
-			for i := 0; i < config.Scale; i++ {
-				c, err := ContainerCreate(config)
-				if err != nil {
-					logger.Errorf("unable to create container %v", err)
-					return err
-				}
-				containersCreated = append(containersCreated, c)
-			}
-			logger.Debugf("%d/%d container(s) for deployment %s created", config.Scale, len(containersCreated), config.Name)
 
-			// start containers
-			containersStarted := make([]KraneContainer, 0)
-			for _, c := range containersCreated {
-				if err := c.Start(); err != nil {
-					logger.Errorf("unable to start container %v", err)
-					return err
-				}
-				containersStarted = append(containersStarted, c)
+			e.Phase = RollbackPhase
+			e.emit(fmt.Sprintf("Rolling back to revision %d", healthy.Revision))
+			jobArgs.Track(string(RollbackPhase), fmt.Sprintf("rolling back revision %d to revision %d", jobArgs.Revision, healthy.Revision))
+
+			// the known-good configuration is saved as the latest revision
+			revision, err := saveConfig(healthy.Config, KraneUser)
+			if err != nil {
+				logger.Errorf("unable to save rollback configuration %v", err)
+				return err
 			}
-			logger.Debugf("%d/%d container(s) for deployment %s started", len(containersStarted), len(containersCreated), config.Name)
 
-			// health check
-			retries := 10
-			if err := RetriableContainersHealthCheck(containersStarted, retries); err != nil {
-				logger.Errorf("containers did not pass health check %v", err)
+			containers, err := GetContainersByDeployment(ctx, deploymentName)
+			if err != nil {
+				logger.Errorf("unable to get containers %v", err)
 				return err
 			}
-			logger.Debugf("Deployment %s health check complete", config.Name)
-			return nil
-		},
-		Finally: func(args interface{}) error {
-			jobArgs := args.(*RunDeploymentJobArgs)
 
-			for _, c := range jobArgs.ContainersToRemove {
-				logger.Debugf("Removing container %s", c.Name)
-				err := c.Remove()
-				if err != nil {
-					logger.Errorf("unable to remove container %v", err)
-					return err
-				}
+			if err := deploy(ctx, revision.Config, revision.Revision, containers, e, &jobArgs.Tracker); err != nil {
+				logger.Errorf("unable to rollback deployment %v", err)
+				return err
 			}
 
-			return nil
+			return markRevisionHealthy(deploymentName, revision.Revision)
 		},
-	})
+	}, nil
+}
 
-	return nil
+// Rollback saves a previous revision as the latest deployment configuration and runs the deployment.
+// When revision is 0, the last healthy revision prior to the latest revision is used.
+func Rollback(deployment string, revision int, user string) (job.Job, error) {
+	if revision == 0 {
+		latest, err := GetLatestRevision(deployment)
+		if err != nil {
+			return job.Job{}, err
+		}
+
+		healthy, err := lastHealthyRevision(deployment, latest.Revision)
+		if err != nil {
+			return job.Job{}, err
+		}
+		revision = healthy.Revision
+	}
+
+	target, err := GetRevision(deployment, revision)
+	if err != nil {
+		return job.Job{}, err
+	}
+
+	// fail early when a host port is already bound by another deployment
+	if err := checkPortConflicts(target.Config); err != nil {
+		return job.Job{}, err
+	}
+
+	previous, err := GetDeploymentConfig(deployment)
+	if err != nil {
+		return job.Job{}, err
+	}
+
+	saved, err := saveConfig(target.Config, user)
+	if err != nil {
+		return job.Job{}, err
+	}
+
+	j, err := RunJob(deployment)
+	if err == nil {
+		j, err = enqueue(j)
+	}
+
+	// the rolled back configuration is only kept once its run is queued
+	if err != nil {
+		if restoreErr := restoreConfig(previous, saved.Revision); restoreErr != nil {
+			logger.Warnf("Unable to restore the configuration of deployment %s, %v", deployment, restoreErr)
+		}
+		return job.Job{}, err
+	}
+	return j, nil
 }
 
 // Delete removes a deployments container resources and configuration.
 // Note: This will also remove any existing collections created for the deployment (Secrets, Jobs, Config etc...)
-func Delete(deployment string) error {
+// Named volumes are kept unless removeVolumes is true.
+func Delete(deployment string, removeVolumes bool) (job.Job, error) {
+	return enqueue(deleteJob(uuid.Generate().String(), deployment, removeVolumes))
+}
+
+// deleteJob returns a delete deployment job with a given id
+func deleteJob(id, deployment string, removeVolumes bool) job.Job {
 	type DeleteDeploymentJobArgs struct {
-		Deployment string
+		Deployment    string
+		RemoveVolumes bool
 	}
 
-	go enqueue(job.Job{
-		ID:          uuid.Generate().String(),
+	jobType := DeleteDeploymentJobType
+	if removeVolumes {
+		jobType = DeleteDeploymentVolumesJobType
+	}
+
+	return job.Job{
+		ID:          id,
 		Deployment:  deployment,
-		Type:        string(DeleteDeploymentJobType),
-		RetryPolicy: utils.UIntEnv(constants.EnvDeploymentRetryPolicy),
+		Type:        string(jobType),
+		RetryPolicy: retryPolicy(),
 		Args: DeleteDeploymentJobArgs{
-			Deployment: deployment,
+			Deployment:    deployment,
+			RemoveVolumes: removeVolumes,
 		},
-		Run: func(args interface{}) error {
+		Run: func(ctx context.Context, args interface{}) error {
 			jobArgs := args.(DeleteDeploymentJobArgs)
 			deploymentName := jobArgs.Deployment
 
 			// get current containers
-			containers, err := GetContainersByDeployment(deploymentName)
+			containers, err := GetContainersByDeployment(ctx, deploymentName)
 			if err != nil {
 				logger.Errorf("unable get containers %v", err)
 				return err
@@ -231,16 +358,26 @@ func Delete(deployment string) error {
 
 			// remove containers
 			for _, c := range containers {
-				if err := c.Remove(); err != nil {
+				if err := c.Remove(ctx); err != nil {
 					logger.Errorf("unable to remove container %v", err)
 					return err
 				}
 			}
 			logger.Debugf("%d container(s) for deployment %s removed", len(containers), deploymentName)
 
+			// remove named volumes
+			if jobArgs.RemoveVolumes {
+				if err := DeleteVolumes(ctx, deploymentName); err != nil {
+					logger.Errorf("unable to remove volumes %v", err)
+					return err
+				}
+				logger.Debugf("Volumes for deployment %s removed", deploymentName)
+			}
+
+			syncRoutes(ctx)
 			return nil
 		},
-		Finally: func(args interface{}) error {
+		Finally: func(ctx context.Context, args interface{}) error {
 			jobArgs := args.(DeleteDeploymentJobArgs)
 			deploymentName := jobArgs.Deployment
 
@@ -258,6 +395,20 @@ func Delete(deployment string) error {
 				return err
 			}
 
+			// delete blue/green state
+			logger.Debugf("removing blue/green state for deployment %s", deploymentName)
+			if err := deleteBlueGreen(deploymentName); err != nil {
+				logger.Errorf("unable to remove blue/green state %v", err)
+				return err
+			}
+
+			// delete revisions collection
+			logger.Debugf("removing revisions collection for deployment %s", deploymentName)
+			if err := DeleteRevisionsCollection(deploymentName); err != nil {
+				logger.Errorf("unable to remove revisions collection %v", err)
+				return err
+			}
+
 			// delete deployment configuration
 			logger.Debugf("removing config for deployment %s", deploymentName)
 			if err := DeleteConfig(deploymentName); err != nil {
@@ -267,32 +418,35 @@ func Delete(deployment string) error {
 
 			return nil
 		},
-	})
-
-	return nil
+	}
 }
 
 // StartContainers starts current existing containers (if any) for a deployment
 // Note: this does not re-create container resources, only start existing ones
-func StartContainers(deployment string) error {
+func StartContainers(deployment string) (job.Job, error) {
+	return enqueue(startContainersJob(uuid.Generate().String(), deployment))
+}
+
+// startContainersJob returns a start containers job with a given id
+func startContainersJob(id, deployment string) job.Job {
 	type StartContainersJobArgs struct {
 		Deployment string
 	}
 
-	go enqueue(job.Job{
-		ID:          uuid.Generate().String(),
+	return job.Job{
+		ID:          id,
 		Deployment:  deployment,
 		Type:        string(StartContainersJobType),
-		RetryPolicy: utils.UIntEnv(constants.EnvDeploymentRetryPolicy),
+		RetryPolicy: retryPolicy(),
 		Args: StartContainersJobArgs{
 			Deployment: deployment,
 		},
-		Run: func(args interface{}) error {
+		Run: func(ctx context.Context, args interface{}) error {
 			jobArgs := args.(StartContainersJobArgs)
 			deploymentName := jobArgs.Deployment
 
 			// get current containers
-			containers, err := GetContainersByDeployment(deploymentName)
+			containers, err := GetContainersByDeployment(ctx, deploymentName)
 			if err != nil {
 				logger.Errorf("unable to get containers %v", err)
 				return err
@@ -305,40 +459,45 @@ func StartContainers(deployment string) error {
 			// start containers
 			for _, c := range containers {
 				logger.Debugf("Starting container %s", c.Name)
-				if err := c.Start(); err != nil {
+				if err := c.Start(ctx); err != nil {
 					logger.Errorf("unable to start container %v", err)
 					return err
 				}
 			}
 			logger.Debugf("%d container(s) for deployment %s started", len(containers), deploymentName)
 
+			syncRoutes(ctx)
 			return nil
 		},
-	})
-	return nil
+	}
 }
 
 // StopContainers stops current existing containers (if any) for a deployment
 // Note: this does not re-create container resources, only stop existing ones
-func StopContainers(deployment string) error {
+func StopContainers(deployment string) (job.Job, error) {
+	return enqueue(stopContainersJob(uuid.Generate().String(), deployment))
+}
+
+// stopContainersJob returns a stop containers job with a given id
+func stopContainersJob(id, deployment string) job.Job {
 	type StopContainersJobArgs struct {
 		Deployment string
 	}
 
-	go enqueue(job.Job{
-		ID:          uuid.Generate().String(),
+	return job.Job{
+		ID:          id,
 		Deployment:  deployment,
 		Type:        string(StopContainersJobType),
-		RetryPolicy: utils.UIntEnv(constants.EnvDeploymentRetryPolicy),
+		RetryPolicy: retryPolicy(),
 		Args: StopContainersJobArgs{
 			Deployment: deployment,
 		},
-		Run: func(args interface{}) error {
+		Run: func(ctx context.Context, args interface{}) error {
 			jobArgs := args.(StopContainersJobArgs)
 			deploymentName := jobArgs.Deployment
 
 			// get current containers
-			containers, err := GetContainersByDeployment(deploymentName)
+			containers, err := GetContainersByDeployment(ctx, deploymentName)
 			if err != nil {
 				logger.Errorf("unable to get containers %v", err)
 				return err
@@ -351,49 +510,59 @@ func StopContainers(deployment string) error {
 			// stop containers
 			for _, c := range containers {
 				logger.Debugf("Stopping container %s", c.Name)
-				if err := c.Stop(); err != nil {
+				if err := c.Stop(ctx); err != nil {
 					logger.Errorf("unable to stop container %v", err)
 					return err
 				}
 			}
 			logger.Debugf("%d container(s) for deployment %s stopped", len(containers), deploymentName)
 
+			syncRoutes(ctx)
 			return nil
 		},
-	})
-	return nil
+	}
 }
 
 // RestartContainers will re-create container resources for a deployment
 // Note: this almost the same call as 'Run' since they both re-create container resources based on the current configuration
-func RestartContainers(deployment string) error {
+func RestartContainers(deployment string) (job.Job, error) {
+	j, err := restartContainersJob(uuid.Generate().String(), deployment)
+	if err != nil {
+		return job.Job{}, err
+	}
+
+	return enqueue(j)
+}
+
+// restartContainersJob returns a restart containers job with a given id
+func restartContainersJob(id, deployment string) (job.Job, error) {
 	config, err := GetDeploymentConfig(deployment)
 	if err != nil {
-		return fmt.Errorf("unable to get configuration for deployment %s", deployment)
+		return job.Job{}, fmt.Errorf("unable to get configuration for deployment %s", deployment)
 	}
 
 	type RestartContainersJobArgs struct {
+		job.Tracker
 		Config             Config
 		ContainersToRemove []KraneContainer
 	}
 
-	jobID := uuid.Generate().String()
-	e := createEventEmitter(config.Name, jobID)
-	go enqueue(job.Job{
-		ID:          jobID,
+	e := createEventEmitter(config.Name, id)
+	return job.Job{
+		ID:          id,
 		Deployment:  deployment,
 		Type:        string(RestartContainersJobType),
-		RetryPolicy: utils.UIntEnv(constants.EnvDeploymentRetryPolicy),
+		RetryPolicy: retryPolicy(),
 		Args: &RestartContainersJobArgs{
 			ContainersToRemove: []KraneContainer{},
 			Config:             config,
 		},
-		Setup: func(args interface{}) error {
+		Setup: func(ctx context.Context, args interface{}) error {
 			jobArgs := args.(*RestartContainersJobArgs)
 			deploymentName := jobArgs.Config.Name
 
 			// get current containers (if any) which will be removed after new containers are created
-			containers, err := GetContainersByDeployment(deploymentName)
+			containers, err := GetContainersByDeployment(ctx, deploymentName)
 			if err != nil {
 				logger.Errorf("unable to get containers %v", err)
 				return err
@@ -402,74 +571,86 @@ func RestartContainers(deployment string) error {
 			jobArgs.ContainersToRemove = containers
 			return nil
 		},
-		Run: func(args interface{}) error {
+		Run: func(ctx context.Context, args interface{}) error {
 			jobArgs := args.(*RestartContainersJobArgs)
 			config := jobArgs.Config
 
-			// resolve registry credentials
-			if err := config.ResolveRegistryCredentials(); err != nil {
-				logger.Errorf("unable to resolve registry credentials: %v", err)
-				return err
+			// the live color of blue/green deployments is re-created, warm containers are removed
+			color := liveColor(config.Name)
+			if color != "" {
+				config = config.withColor(color)
 			}
 
-			// pull image
-			logger.Debugf("Pulling image for deployment %s", config.Name)
-			pullImageReader, err := docker.GetClient().PullImage(
-				config.Image, config.Tag, docker.RegistryCredentials{
-					URL:      config.Registry.URL,
-					Username: config.Registry.Username,
-					Password: config.Registry.Password,
-				})
-			if err != nil {
-				logger.Errorf("unable to pull image %v", err)
+			// restarting re-creates every container at once regardless of the deployment strategy
+			wf := replaceContainersWorkflow(config, config.Scale, jobArgs.ContainersToRemove, e, &jobArgs.Tracker)
+			if err := wf.Start(ctx); err != nil {
 				return err
 			}
-			e.emitStream(pullImageReader)
-
-			// create containers
-			containersCreated := make([]KraneContainer, 0)
-			for i := 0; i < config.Scale; i++ {
-				c, err := ContainerCreate(config)
-				if err != nil {
-					logger.Errorf("unable to create container %v", err)
-					return err
-				}
-				containersCreated = append(containersCreated, c)
-			}
-			logger.Debugf("%d/%d container(s) for deployment %s created", len(containersCreated), config.Scale, config.Name)
 
-			// start containers
-			containersStarted := make([]KraneContainer, 0)
-			for _, c := range containersCreated {
-				if err := c.Start(); err != nil {
-					logger.Errorf("unable to start container %v", err)
-					return err
+			// the live color now runs the latest configuration without warm containers
+			if color != "" {
+				state := BlueGreen{Deployment: config.Name, Live: color}
+				if latest, err := GetLatestRevision(config.Name); err == nil {
+					state.LiveRevision = latest.Revision
 				}
-				containersStarted = append(containersStarted, c)
-			}
-			logger.Debugf("%d/%d container(s) for deployment %s started", len(containersStarted), len(containersCreated), config.Name)
 
-			retries := 10
-			if err := RetriableContainersHealthCheck(containersStarted, retries); err != nil {
-				logger.Errorf("containers did not pass health check %v", err)
-				return err
-			}
-			logger.Debugf("Deployment %s health check complete", config.Name)
-
-			return nil
-		},
-		Finally: func(args interface{}) error {
-			jobArgs := args.(*RestartContainersJobArgs)
-			for _, c := range jobArgs.ContainersToRemove {
-				logger.Debugf("Removing container %s", c.Name)
-				if err := c.Remove(); err != nil {
-					logger.Errorf("unable to remove container %v", err)
+				if err := putBlueGreen(state); err != nil {
 					return err
 				}
 			}
 
+			syncRoutes(ctx)
 			return nil
 		},
-	})
+	}, nil
+}
+
+// deploy pulls the image for a deployment and replaces the current containers using the deployment strategy
+func deploy(ctx context.Context, config Config, revision int, containers []KraneContainer, e *EventEmitter, tracker *job.Tracker) error {
+	// replace the current containers using the deployment strategy
+	wf := deployWorkflow(config, revision, containers, e, tracker)
+	if err := wf.Start(ctx); err != nil {
+		return err
+	}
+
+	// every container was replaced, deployments no longer using blue/green forget their colors
+	if config.Strategy.Type != BlueGreenStrategy {
+		if err := deleteBlueGreen(config.Name); err != nil {
+			logger.Warnf("Unable to remove blue/green state for deployment %s, %v", config.Name, err)
+		}
+	}
+
+	syncRoutes(ctx)
+	return nil
+}
+
+// pullImage resolves the registry credentials for a deployment and pulls its image
+func pullImage(ctx context.Context, config Config, e *EventEmitter) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// resolve registry credentials
+	if err := config.ResolveRegistryCredentials(); err != nil {
+		logger.Errorf("unable to resolve registry credentials: %v", err)
+		return err
+	}
+
+	// pull image
+	logger.Debugf("Pulling image for deployment %s", config.Name)
+	e.Phase = PullImagePhase
+	pullImageReader, err := docker.GetClient().PullImage(
+		ctx,
+		config.Image, config.Tag, docker.RegistryCredentials{
+			URL:      config.Registry.URL,
+			Username: config.Registry.Username,
+			Password: config.Registry.Password,
+		})
+	if err != nil {
+		logger.Errorf("unable to pull image %v", err)
+		return err
+	}
+	e.emitStream(pullImageReader)
+
 	return nil
 }
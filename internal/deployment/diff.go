@@ -0,0 +1,276 @@
+package deployment
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/krane/krane/internal/proxy"
+)
+
+// ChangeType represents how a field changed between two revisions
+type ChangeType string
+
+const (
+	Added    ChangeType = "added"
+	Removed  ChangeType = "removed"
+	Modified ChangeType = "modified"
+)
+
+// Change is a single difference between two deployment configurations
+type Change struct {
+	Field string     `json:"field"`         // config field that changed (env, secrets, ports...)
+	Key   string     `json:"key,omitempty"` // key within the field for map or list fields
+	Type  ChangeType `json:"type"`
+	From  string     `json:"from,omitempty"`
+	To    string     `json:"to,omitempty"`
+}
+
+// RevisionDiff represents the changes between two revisions of a deployment
+type RevisionDiff struct {
+	Deployment string   `json:"deployment"`
+	From       int      `json:"from"`
+	To         int      `json:"to"`
+	Changes    []Change `json:"changes"`
+}
+
+// DiffRevisions returns the structured differences between two revisions of a deployment
+func DiffRevisions(deployment string, from, to int) (RevisionDiff, error) {
+	fromRevision, err := GetRevision(deployment, from)
+	if err != nil {
+		return RevisionDiff{}, err
+	}
+
+	toRevision, err := GetRevision(deployment, to)
+	if err != nil {
+		return RevisionDiff{}, err
+	}
+
+	return RevisionDiff{
+		Deployment: deployment,
+		From:       from,
+		To:         to,
+		Changes:    diffConfigs(fromRevision.Config, toRevision.Config),
+	}, nil
+}
+
+// diffConfigs returns the changes required to go from one deployment configuration to another
+func diffConfigs(from, to Config) []Change {
+	changes := make([]Change, 0)
+	changes = append(changes, diffValues("image", from.Image, to.Image)...)
+	changes = append(changes, diffValues("tag", from.Tag, to.Tag)...)
+	changes = append(changes, diffValues("scale", strconv.Itoa(from.Scale), strconv.Itoa(to.Scale))...)
+	changes = append(changes, diffValues("restart_policy", from.RestartPolicy, to.RestartPolicy)...)
+	changes = append(changes, diffValues("command", from.Command, to.Command)...)
+	changes = append(changes, diffValues("entrypoint", from.Entrypoint, to.Entrypoint)...)
+	changes = append(changes, diffValues("target_port", from.TargetPort, to.TargetPort)...)
+	changes = append(changes, diffValues("secure", strconv.FormatBool(from.Secure), strconv.FormatBool(to.Secure))...)
+	changes = append(changes, diffValues("internal", strconv.FormatBool(from.Internal), strconv.FormatBool(to.Internal))...)
+	changes = append(changes, diffValues("rate_limit", strconv.FormatUint(uint64(from.RateLimit), 10), strconv.FormatUint(uint64(to.RateLimit), 10))...)
+	changes = append(changes, diffRegistry(from.Registry, to.Registry)...)
+	changes = append(changes, diffMaps("env", from.Env, to.Env)...)
+	changes = append(changes, diffMaps("secrets", from.Secrets, to.Secrets)...)
+	changes = append(changes, diffLists("secret_groups", from.SecretGroups, to.SecretGroups)...)
+	changes = append(changes, diffValues("redeploy_on_secret_change", strconv.FormatBool(from.RedeployOnSecretChange), strconv.FormatBool(to.RedeployOnSecretChange))...)
+	changes = append(changes, diffMaps("secret_files", secretFilesMap(from.SecretFiles), secretFilesMap(to.SecretFiles))...)
+	changes = append(changes, diffLists("ports", from.Ports, to.Ports)...)
+	changes = append(changes, diffMaps("volumes", from.Volumes, to.Volumes)...)
+	changes = append(changes, diffMaps("tmpfs", from.Tmpfs, to.Tmpfs)...)
+	changes = append(changes, diffLists("alias", aliasList(from.Alias), aliasList(to.Alias))...)
+	changes = append(changes, diffMaps("labels", from.Labels, to.Labels)...)
+	changes = append(changes, diffMaps("resources", fieldsMap(from.Resources), fieldsMap(to.Resources))...)
+	changes = append(changes, diffMaps("health_check", fieldsMap(from.HealthCheck), fieldsMap(to.HealthCheck))...)
+	changes = append(changes, diffMaps("strategy", fieldsMap(from.Strategy), fieldsMap(to.Strategy))...)
+	changes = append(changes, diffMaps("middlewares", fieldsMap(from.Middlewares), fieldsMap(to.Middlewares))...)
+	changes = append(changes, diffLists("tcp", tcpRouterList(from.TCP), tcpRouterList(to.TCP))...)
+	changes = append(changes, diffLists("udp", udpRouterList(from.UDP), udpRouterList(to.UDP))...)
+	return changes
+}
+
+// diffValues returns a modified change if two values differ
+func diffValues(field, from, to string) []Change {
+	if from == to {
+		return []Change{}
+	}
+	return []Change{{Field: field, Type: Modified, From: from, To: to}}
+}
+
+// diffMaps returns the added, removed and modified keys between two maps sorted by key
+func diffMaps(field string, from, to map[string]string) []Change {
+	keys := make(map[string]struct{}, 0)
+	for k := range from {
+		keys[k] = struct{}{}
+	}
+	for k := range to {
+		keys[k] = struct{}{}
+	}
+
+	changes := make([]Change, 0)
+	for _, k := range sortedKeys(keys) {
+		fromValue, inFrom := from[k]
+		toValue, inTo := to[k]
+
+		switch {
+		case inFrom && !inTo:
+			changes = append(changes, Change{Field: field, Key: k, Type: Removed, From: fromValue})
+		case !inFrom && inTo:
+			changes = append(changes, Change{Field: field, Key: k, Type: Added, To: toValue})
+		case fromValue != toValue:
+			changes = append(changes, Change{Field: field, Key: k, Type: Modified, From: fromValue, To: toValue})
+		}
+	}
+	return changes
+}
+
+// diffLists returns the added and removed values between two lists
+func diffLists(field string, from, to []string) []Change {
+	fromSet := make(map[string]struct{}, 0)
+	for _, v := range from {
+		fromSet[v] = struct{}{}
+	}
+
+	toSet := make(map[string]struct{}, 0)
+	for _, v := range to {
+		toSet[v] = struct{}{}
+	}
+
+	changes := make([]Change, 0)
+	for _, v := range sortedKeys(fromSet) {
+		if _, ok := toSet[v]; !ok {
+			changes = append(changes, Change{Field: field, Key: v, Type: Removed})
+		}
+	}
+	for _, v := range sortedKeys(toSet) {
+		if _, ok := fromSet[v]; !ok {
+			changes = append(changes, Change{Field: field, Key: v, Type: Added})
+		}
+	}
+	return changes
+}
+
+// secretFilesMap returns the secret, mode and owner of secret files by container path
+func secretFilesMap(files []SecretFile) map[string]string {
+	m := make(map[string]string, len(files))
+	for _, f := range files {
+		m[f.Path] = fmt.Sprintf("%s %s %d:%d", f.Secret, f.Mode, f.UID, f.GID)
+	}
+	return m
+}
+
+// aliasList returns the domains and path prefixes of a list of aliases
+func aliasList(aliases []proxy.Alias) []string {
+	list := make([]string, 0, len(aliases))
+	for _, a := range aliases {
+		list = append(list, a.String())
+	}
+	return list
+}
+
+// diffRegistry returns the changes between two registries, passwords which are not secret references are redacted
+func diffRegistry(from, to Registry) []Change {
+	changes := diffMaps("registry",
+		map[string]string{"url": from.URL, "username": from.Username},
+		map[string]string{"url": to.URL, "username": to.Username},
+	)
+
+	if from.Password == to.Password {
+		return changes
+	}
+
+	change := Change{Field: "registry", Key: "password", Type: Modified, From: redactPassword(from.Password), To: redactPassword(to.Password)}
+	switch {
+	case from.Password == "":
+		change.Type = Added
+	case to.Password == "":
+		change.Type = Removed
+	}
+	return append(changes, change)
+}
+
+// redactPassword returns a password unless it is stored in plain text
+func redactPassword(password string) string {
+	if password == "" || isSecretReference(password) {
+		return password
+	}
+	return "<redacted>"
+}
+
+// tcpRouterList returns the entrypoints, container ports and options of a list of tcp routers
+func tcpRouterList(routers []proxy.TCPRouter) []string {
+	list := make([]string, 0, len(routers))
+	for _, r := range routers {
+		route := fmt.Sprintf("%s:%s", r.Entrypoint, r.Port)
+		if len(r.HostSNI) > 0 {
+			route += " host_sni=" + strings.Join(r.HostSNI, ",")
+		}
+		if r.TLS {
+			route += " tls"
+		}
+		if r.Passthrough {
+			route += " passthrough"
+		}
+		list = append(list, route)
+	}
+	return list
+}
+
+// udpRouterList returns the entrypoints and container ports of a list of udp routers
+func udpRouterList(routers []proxy.UDPRouter) []string {
+	list := make([]string, 0, len(routers))
+	for _, r := range routers {
+		list = append(list, fmt.Sprintf("%s:%s", r.Entrypoint, r.Port))
+	}
+	return list
+}
+
+// fieldsMap flattens a configuration struct into its non-zero json fields by dotted
+// path (ie. basic_auth.realm), lists are compared as a single json value
+func fieldsMap(v interface{}) map[string]string {
+	bytes, _ := json.Marshal(v)
+
+	var fields map[string]interface{}
+	_ = json.Unmarshal(bytes, &fields)
+
+	m := make(map[string]string)
+	flattenFields(m, "", fields)
+	return m
+}
+
+func flattenFields(m map[string]string, prefix string, fields map[string]interface{}) {
+	for k, v := range fields {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+
+		switch value := v.(type) {
+		case nil:
+		case map[string]interface{}:
+			flattenFields(m, key, value)
+		case string:
+			if value != "" {
+				m[key] = value
+			}
+		case []interface{}:
+			if len(value) > 0 {
+				bytes, _ := json.Marshal(value)
+				m[key] = string(bytes)
+			}
+		default:
+			if value != false && value != float64(0) {
+				m[key] = fmt.Sprint(value)
+			}
+		}
+	}
+}
+
+func sortedKeys(set map[string]struct{}) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,103 @@
+package deployment
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/krane/krane/internal/proxy"
+	"github.com/krane/krane/internal/proxy/middlewares"
+)
+
+func TestDiffIdenticalConfigs(t *testing.T) {
+	config := Config{Name: "diff-test", Image: "biensupernice/krane", Env: map[string]string{"A": "1"}}
+	assert.Empty(t, diffConfigs(config, config))
+}
+
+func TestDiffConfigs(t *testing.T) {
+	from := Config{
+		Image:   "biensupernice/krane",
+		Tag:     "1.0.0",
+		Scale:   1,
+		Env:     map[string]string{"NODE_ENV": "dev", "REMOVED": "x"},
+		Secrets: map[string]string{"TOKEN": "@TOKEN"},
+		Ports:   PortBindings{"80:8080"},
+		Volumes: map[string]string{"/host": "/data"},
+		Alias:   []proxy.Alias{{Host: "a.example.com"}, {Host: "b.example.com"}},
+	}
+	to := Config{
+		Image:   "biensupernice/krane",
+		Tag:     "1.1.0",
+		Scale:   3,
+		Env:     map[string]string{"NODE_ENV": "prod", "ADDED": "y"},
+		Secrets: map[string]string{"TOKEN": "@NEW_TOKEN"},
+		Ports:   PortBindings{},
+		Volumes: map[string]string{"/host": "/data"},
+		Alias:   []proxy.Alias{{Host: "b.example.com"}, {Host: "c.example.com", PathPrefix: "/api"}},
+	}
+
+	assert.Equal(t, []Change{
+		{Field: "tag", Type: Modified, From: "1.0.0", To: "1.1.0"},
+		{Field: "scale", Type: Modified, From: "1", To: "3"},
+		{Field: "env", Key: "ADDED", Type: Added, To: "y"},
+		{Field: "env", Key: "NODE_ENV", Type: Modified, From: "dev", To: "prod"},
+		{Field: "env", Key: "REMOVED", Type: Removed, From: "x"},
+		{Field: "secrets", Key: "TOKEN", Type: Modified, From: "@TOKEN", To: "@NEW_TOKEN"},
+		{Field: "ports", Key: "80:8080", Type: Removed},
+		{Field: "alias", Key: "a.example.com", Type: Removed},
+		{Field: "alias", Key: "c.example.com/api", Type: Added},
+	}, diffConfigs(from, to))
+}
+
+func TestDiffConfigsSettings(t *testing.T) {
+	from := Config{
+		Registry:    Registry{URL: "docker.io", Password: "hunter2"},
+		Labels:      map[string]string{"team": "a"},
+		Resources:   Resources{Memory: "512m"},
+		HealthCheck: HealthCheck{Type: HTTPProbe, Path: "/health"},
+		Strategy:    Strategy{Type: RollingStrategy, MaxSurge: 1},
+		Middlewares: middlewares.Middlewares{Compress: true},
+		TCP:         []proxy.TCPRouter{{Entrypoint: "postgres", Port: "5432"}},
+		UDP:         []proxy.UDPRouter{{Entrypoint: "dns", Port: "53"}},
+	}
+	to := Config{
+		Registry:    Registry{URL: "docker.io", Password: "@REGISTRY_PASSWORD"},
+		Labels:      map[string]string{"team": "b"},
+		Resources:   Resources{Memory: "1g", PidsLimit: 100},
+		HealthCheck: HealthCheck{Type: HTTPProbe, Path: "/ready"},
+		Strategy:    Strategy{Type: RollingStrategy},
+		Middlewares: middlewares.Middlewares{BasicAuth: middlewares.BasicAuth{Users: []string{"@ADMIN"}}},
+		TCP:         []proxy.TCPRouter{{Entrypoint: "postgres", Port: "5432", TLS: true}},
+	}
+
+	assert.Equal(t, []Change{
+		{Field: "registry", Key: "password", Type: Modified, From: "<redacted>", To: "@REGISTRY_PASSWORD"},
+		{Field: "labels", Key: "team", Type: Modified, From: "a", To: "b"},
+		{Field: "resources", Key: "memory", Type: Modified, From: "512m", To: "1g"},
+		{Field: "resources", Key: "pids_limit", Type: Added, To: "100"},
+		{Field: "health_check", Key: "path", Type: Modified, From: "/health", To: "/ready"},
+		{Field: "strategy", Key: "max_surge", Type: Removed, From: "1"},
+		{Field: "middlewares", Key: "basic_auth.users", Type: Added, To: `["@ADMIN"]`},
+		{Field: "middlewares", Key: "compress", Type: Removed, From: "true"},
+		{Field: "tcp", Key: "postgres:5432", Type: Removed},
+		{Field: "tcp", Key: "postgres:5432 tls", Type: Added},
+		{Field: "udp", Key: "dns:53", Type: Removed},
+	}, diffConfigs(from, to))
+}
+
+func TestDiffRevisions(t *testing.T) {
+	config := Config{Name: "diff-revisions-test", Image: "biensupernice/krane", Tag: "1"}
+	_, err := saveRevision(config, "alice")
+	assert.Nil(t, err)
+
+	config.Tag = "2"
+	_, err = saveRevision(config, "alice")
+	assert.Nil(t, err)
+
+	diff, err := DiffRevisions(config.Name, 1, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, []Change{{Field: "tag", Type: Modified, From: "1", To: "2"}}, diff.Changes)
+
+	_, err = DiffRevisions(config.Name, 1, 3)
+	assert.Error(t, err)
+}
@@ -0,0 +1,329 @@
+package deployment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+
+	"github.com/krane/krane/internal/docker"
+	"github.com/krane/krane/internal/logger"
+)
+
+// ProbeType is the kind of probe used to check the health of a container
+type ProbeType string
+
+const (
+	HTTPProbe ProbeType = "http"
+	TCPProbe  ProbeType = "tcp"
+	ExecProbe ProbeType = "exec"
+)
+
+const (
+	defaultHealthCheckInterval = 10 * time.Second
+	defaultHealthCheckTimeout  = 5 * time.Second
+	defaultHealthCheckRetries  = 10
+	defaultExpectedStatus      = http.StatusOK
+
+	// healthLogSize is the number of probe results kept for a container
+	healthLogSize = 5
+)
+
+// HealthCheck represents how the containers of a deployment are checked for health.
+// When no probe type is set, containers are considered healthy once in a running state.
+type HealthCheck struct {
+	Type           ProbeType `json:"type"`            // http, tcp or exec
+	Path           string    `json:"path"`            // http request path
+	Port           string    `json:"port"`            // container port for http and tcp probes (defaults to the target port)
+	ExpectedStatus int       `json:"expected_status"` // expected http response status (default 200)
+	Command        []string  `json:"command"`         // command executed inside the container for exec probes
+	Interval       string    `json:"interval"`        // time between probes (default 10s)
+	Timeout        string    `json:"timeout"`         // time before a probe is considered failed (default 5s)
+	Retries        int       `json:"retries"`         // probes attempted before a container is considered unhealthy (default 10)
+	StartPeriod    string    `json:"start_period"`    // time given to containers to start before probing (default 0s)
+}
+
+// healthResults are the probe results recorded by Krane keyed by container id
+var healthResults = struct {
+	sync.RWMutex
+	containers map[string]*types.Health
+}{containers: make(map[string]*types.Health)}
+
+// applyDefaults applies default health check values
+func (hc *HealthCheck) applyDefaults(config Config) {
+	if hc.Interval == "" {
+		hc.Interval = defaultHealthCheckInterval.String()
+	}
+
+	if hc.Timeout == "" {
+		hc.Timeout = defaultHealthCheckTimeout.String()
+	}
+
+	if hc.Retries == 0 {
+		hc.Retries = defaultHealthCheckRetries
+	}
+
+	if hc.Type == HTTPProbe && hc.ExpectedStatus == 0 {
+		hc.ExpectedStatus = defaultExpectedStatus
+	}
+
+	if hc.Type == HTTPProbe && hc.Path == "" {
+		hc.Path = "/"
+	}
+
+	if (hc.Type == HTTPProbe || hc.Type == TCPProbe) && hc.Port == "" {
+		hc.Port = config.TargetPort
+	}
+
+	if (hc.Type == HTTPProbe || hc.Type == TCPProbe) && hc.Port == "" {
+		if ports := config.containerPorts(TCP); len(ports) > 0 {
+			hc.Port = ports[0]
+		}
+	}
+}
+
+// isValid returns an error if a health check is not valid
+func (hc HealthCheck) isValid() error {
+	switch hc.Type {
+	case "", ExecProbe:
+	case HTTPProbe, TCPProbe:
+		if hc.Port == "" {
+			return fmt.Errorf("%s health check requires a port", hc.Type)
+		}
+	default:
+		return fmt.Errorf("invalid health check type %s", hc.Type)
+	}
+
+	if hc.Type == ExecProbe && len(hc.Command) == 0 {
+		return errors.New("exec health check requires a command")
+	}
+
+	if hc.ExpectedStatus != 0 && (hc.ExpectedStatus < 100 || hc.ExpectedStatus > 599) {
+		return fmt.Errorf("invalid health check expected status %d", hc.ExpectedStatus)
+	}
+
+	if hc.Retries < 0 {
+		return errors.New("health check retries cannot be negative")
+	}
+
+	for field, value := range map[string]string{"interval": hc.Interval, "timeout": hc.Timeout, "start_period": hc.StartPeriod} {
+		if value == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(value); err != nil || d < 0 {
+			return fmt.Errorf("invalid health check %s %s", field, value)
+		}
+	}
+
+	return nil
+}
+
+// RetriableContainersHealthCheck returns an error if a container is considered unhealthy.
+// Containers are given the start period to start, then probed until healthy or out of retries.
+func RetriableContainersHealthCheck(ctx context.Context, containers []KraneContainer, hc HealthCheck) error {
+	if err := sleep(ctx, durationOrDefault(hc.StartPeriod, 0)); err != nil {
+		return err
+	}
+
+	retries := hc.Retries
+	if retries == 0 {
+		retries = defaultHealthCheckRetries
+	}
+	interval := durationOrDefault(hc.Interval, defaultHealthCheckInterval)
+
+	for _, c := range containers {
+		var err error
+		for i := 0; i < retries; i++ {
+			if i > 0 {
+				if err := sleep(ctx, interval); err != nil {
+					return err
+				}
+			}
+
+			if err = c.Probe(ctx, hc); err == nil {
+				break
+			}
+		}
+
+		if err != nil {
+			return fmt.Errorf("container %s is not healthy %v", c.Name, err)
+		}
+	}
+	return nil
+}
+
+// Probe checks the health of a container once and records the result onto the container health.
+// A container must be in a running state and pass the health check probe (if any) to be considered healthy.
+func (c KraneContainer) Probe(ctx context.Context, hc HealthCheck) error {
+	start := time.Now()
+	err := c.probe(ctx, hc)
+	recordHealth(c.ID, start, err)
+	return err
+}
+
+func (c KraneContainer) probe(ctx context.Context, hc HealthCheck) error {
+	timeout := durationOrDefault(hc.Timeout, defaultHealthCheckTimeout)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	container, err := docker.GetClient().GetOneContainer(ctx, c.ID)
+	if err != nil {
+		return err
+	}
+
+	if !container.State.Running {
+		return fmt.Errorf("container %s is not in running state", c.ID)
+	}
+
+	switch hc.Type {
+	case HTTPProbe:
+		url := fmt.Sprintf("http://%s%s", net.JoinHostPort(containerIP(container), hc.Port), hc.Path)
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+
+		resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		expected := hc.ExpectedStatus
+		if expected == 0 {
+			expected = defaultExpectedStatus
+		}
+		if resp.StatusCode != expected {
+			return fmt.Errorf("http health check %s returned status %d, expected %d", url, resp.StatusCode, expected)
+		}
+	case TCPProbe:
+		dialer := net.Dialer{Timeout: timeout}
+		conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(containerIP(container), hc.Port))
+		if err != nil {
+			return err
+		}
+		_ = conn.Close()
+	case ExecProbe:
+		exitCode, err := docker.GetClient().ExecContainer(ctx, c.ID, hc.Command)
+		if err != nil {
+			return err
+		}
+		if exitCode != 0 {
+			return fmt.Errorf("exec health check exited with code %d", exitCode)
+		}
+	}
+
+	return nil
+}
+
+// recordHealth records a probe result for a container
+func recordHealth(containerID string, start time.Time, err error) {
+	healthResults.Lock()
+	defer healthResults.Unlock()
+
+	health, ok := healthResults.containers[containerID]
+	if !ok {
+		health = &types.Health{Status: types.Starting}
+		healthResults.containers[containerID] = health
+	}
+
+	result := &types.HealthcheckResult{Start: start, End: time.Now()}
+	if err != nil {
+		result.ExitCode = 1
+		result.Output = err.Error()
+		health.FailingStreak++
+		health.Status = types.Unhealthy
+	} else {
+		health.FailingStreak = 0
+		health.Status = types.Healthy
+	}
+
+	health.Log = append(health.Log, result)
+	if len(health.Log) > healthLogSize {
+		health.Log = health.Log[len(health.Log)-healthLogSize:]
+	}
+}
+
+// recordedHealth returns a copy of the probe results recorded for a container (if any)
+func recordedHealth(containerID string) *types.Health {
+	healthResults.RLock()
+	defer healthResults.RUnlock()
+
+	health, ok := healthResults.containers[containerID]
+	if !ok {
+		return nil
+	}
+
+	copied := *health
+	copied.Log = append([]*types.HealthcheckResult{}, health.Log...)
+	return &copied
+}
+
+// forgetHealth removes the probe results recorded for a container
+func forgetHealth(containerID string) {
+	healthResults.Lock()
+	defer healthResults.Unlock()
+	delete(healthResults.containers, containerID)
+}
+
+// PruneHealth removes the probe results recorded for containers which no longer belong to a deployment
+func PruneHealth(deployments []Deployment) {
+	live := make(map[string]bool)
+	for _, d := range deployments {
+		for _, c := range d.Containers {
+			live[c.ID] = true
+		}
+	}
+
+	healthResults.Lock()
+	defer healthResults.Unlock()
+	for id := range healthResults.containers {
+		if !live[id] {
+			delete(healthResults.containers, id)
+		}
+	}
+}
+
+// containerIP returns the ip address of a container on the Krane network
+func containerIP(container types.ContainerJSON) string {
+	if container.NetworkSettings == nil {
+		return ""
+	}
+
+	network, ok := container.NetworkSettings.Networks[docker.KraneNetworkName]
+	if !ok || network == nil {
+		return ""
+	}
+
+	return network.IPAddress
+}
+
+// sleep pauses for a duration returning an error if the context is done first
+func sleep(ctx context.Context, d time.Duration) error {
+	select {
+	case <-time.After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// durationOrDefault parses a duration string returning a fallback if the duration is empty or invalid
+func durationOrDefault(value string, fallback time.Duration) time.Duration {
+	if value == "" {
+		return fallback
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		logger.Warnf("invalid duration %s, defaulting to %s", value, fallback)
+		return fallback
+	}
+
+	return d
+}
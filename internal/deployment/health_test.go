@@ -0,0 +1,85 @@
+package deployment
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthCheckDefaults(t *testing.T) {
+	config := Config{TargetPort: "8080", Ports: PortBindings{"9000:80"}}
+
+	hc := HealthCheck{Type: HTTPProbe}
+	hc.applyDefaults(config)
+	assert.Equal(t, "/", hc.Path)
+	assert.Equal(t, "8080", hc.Port)
+	assert.Equal(t, 200, hc.ExpectedStatus)
+	assert.Equal(t, "10s", hc.Interval)
+	assert.Equal(t, "5s", hc.Timeout)
+	assert.Equal(t, 10, hc.Retries)
+
+	tcp := HealthCheck{Type: TCPProbe}
+	tcp.applyDefaults(Config{Ports: PortBindings{"9000:80"}})
+	assert.Equal(t, "80", tcp.Port)
+	assert.Equal(t, 0, tcp.ExpectedStatus)
+
+	// udp ports are never probed
+	udp := HealthCheck{Type: TCPProbe}
+	udp.applyDefaults(Config{Ports: PortBindings{"53:53/udp", "9000:8080"}})
+	assert.Equal(t, "8080", udp.Port)
+}
+
+func TestInvalidHealthCheck(t *testing.T) {
+	assert.Error(t, HealthCheck{Type: "grpc"}.isValid())
+	assert.Error(t, HealthCheck{Type: HTTPProbe}.isValid())
+	assert.Error(t, HealthCheck{Type: TCPProbe}.isValid())
+	assert.Error(t, HealthCheck{Type: ExecProbe}.isValid())
+	assert.Error(t, HealthCheck{Type: HTTPProbe, Port: "80", ExpectedStatus: 1000}.isValid())
+	assert.Error(t, HealthCheck{Interval: "10"}.isValid())
+	assert.Error(t, HealthCheck{Timeout: "-1s"}.isValid())
+	assert.Error(t, HealthCheck{Retries: -1}.isValid())
+
+	assert.Nil(t, HealthCheck{}.isValid())
+	assert.Nil(t, HealthCheck{Type: HTTPProbe, Port: "80", Path: "/health", StartPeriod: "30s"}.isValid())
+	assert.Nil(t, HealthCheck{Type: ExecProbe, Command: []string{"pg_isready"}}.isValid())
+}
+
+func TestRecordHealth(t *testing.T) {
+	id := "test-record-health"
+	defer forgetHealth(id)
+
+	assert.Nil(t, recordedHealth(id))
+
+	recordHealth(id, time.Now(), errors.New("connection refused"))
+	health := recordedHealth(id)
+	assert.Equal(t, types.Unhealthy, health.Status)
+	assert.Equal(t, 1, health.FailingStreak)
+	assert.Equal(t, "connection refused", health.Log[0].Output)
+
+	for i := 0; i < healthLogSize; i++ {
+		recordHealth(id, time.Now(), nil)
+	}
+	health = recordedHealth(id)
+	assert.Equal(t, types.Healthy, health.Status)
+	assert.Equal(t, 0, health.FailingStreak)
+	assert.Len(t, health.Log, healthLogSize)
+
+	forgetHealth(id)
+	assert.Nil(t, recordedHealth(id))
+}
+
+func TestPruneHealth(t *testing.T) {
+	live, removed := "test-prune-health-live", "test-prune-health-removed"
+	defer forgetHealth(live)
+	defer forgetHealth(removed)
+
+	recordHealth(live, time.Now(), nil)
+	recordHealth(removed, time.Now(), nil)
+
+	PruneHealth([]Deployment{{Containers: []KraneContainer{{ID: live}}}})
+	assert.NotNil(t, recordedHealth(live))
+	assert.Nil(t, recordedHealth(removed))
+}
@@ -17,18 +17,55 @@ const (
 	StopContainersJobType    JobType = "STOP_CONTAINERS"
 	StartContainersJobType   JobType = "START_CONTAINERS"
 	RestartContainersJobType JobType = "RESTART_CONTAINERS"
+	ScaleDeploymentJobType   JobType = "SCALE_DEPLOYMENT"
+	PromoteDeploymentJobType JobType = "PROMOTE_DEPLOYMENT"
+	AbortDeploymentJobType   JobType = "ABORT_DEPLOYMENT"
+
+	// DeleteDeploymentVolumesJobType deletes a deployment along with its named volumes
+	DeleteDeploymentVolumesJobType JobType = "DELETE_DEPLOYMENT_VOLUMES"
 )
 
-// enqueue queues up deployment job for processing
-func enqueue(j job.Job) {
-	enqueuer := job.NewEnqueuer(job.Queue())
+// init registers the deployment job builders used to resume queued jobs after a restart
+func init() {
+	job.Register(string(RunDeploymentJobType), func(j job.Job) (job.Job, error) {
+		return runJob(j.ID, j.Deployment)
+	})
+	job.Register(string(DeleteDeploymentJobType), func(j job.Job) (job.Job, error) {
+		return deleteJob(j.ID, j.Deployment, false), nil
+	})
+	job.Register(string(DeleteDeploymentVolumesJobType), func(j job.Job) (job.Job, error) {
+		return deleteJob(j.ID, j.Deployment, true), nil
+	})
+	job.Register(string(StartContainersJobType), func(j job.Job) (job.Job, error) {
+		return startContainersJob(j.ID, j.Deployment), nil
+	})
+	job.Register(string(StopContainersJobType), func(j job.Job) (job.Job, error) {
+		return stopContainersJob(j.ID, j.Deployment), nil
+	})
+	job.Register(string(RestartContainersJobType), func(j job.Job) (job.Job, error) {
+		return restartContainersJob(j.ID, j.Deployment)
+	})
+	job.Register(string(ScaleDeploymentJobType), func(j job.Job) (job.Job, error) {
+		return scaleJob(j.ID, j.Deployment)
+	})
+	job.Register(string(PromoteDeploymentJobType), func(j job.Job) (job.Job, error) {
+		return promoteJob(j.ID, j.Deployment), nil
+	})
+	job.Register(string(AbortDeploymentJobType), func(j job.Job) (job.Job, error) {
+		return abortJob(j.ID, j.Deployment), nil
+	})
+}
+
+// enqueue queues up deployment job for processing returning the queued job
+func enqueue(j job.Job) (job.Job, error) {
+	enqueuer := job.NewEnqueuer(job.GetQueue())
 	queuedJob, err := enqueuer.Enqueue(j)
 	if err != nil {
 		logger.Errorf("Error enqueuing deployment job %v", err)
-		return
+		return job.Job{}, err
 	}
 	logger.Debugf("Deployment job %s queued for processing", queuedJob.Deployment)
-	return
+	return queuedJob, nil
 }
 
 // CreateCollection create the job collection for a deployment
@@ -43,6 +80,21 @@ func DeleteJobsCollection(deployment string) error {
 	return store.Client().DeleteCollection(collection)
 }
 
+// CancelJob cancels a pending or running job for a deployment
+func CancelJob(deployment, id string) (job.Job, error) {
+	q := job.GetQueue()
+	if q == nil {
+		return job.Job{}, fmt.Errorf("unable to find a pending or running job with id %s", id)
+	}
+
+	j, ok := q.Get(id)
+	if !ok || j.Deployment != deployment {
+		return job.Job{}, fmt.Errorf("unable to find a pending or running job with id %s", id)
+	}
+
+	return q.Cancel(id)
+}
+
 // GetJobs returns all deployment jobs within a given date range
 func GetJobs(daysAgo uint) ([]job.Job, error) {
 	deployments, err := GetAllDeploymentConfigs()
@@ -68,8 +120,14 @@ func GetJobs(daysAgo uint) ([]job.Job, error) {
 	return sortedJobs, nil
 }
 
-// GetJobByID returns a job by id
+// GetJobByID returns a job by id, including jobs pending or running in the job queue
 func GetJobByID(deployment, id string, daysAgo uint) (job.Job, error) {
+	if q := job.GetQueue(); q != nil {
+		if j, ok := q.Get(id); ok && j.Deployment == deployment {
+			return j, nil
+		}
+	}
+
 	jobs, err := GetJobsByDeployment(deployment, daysAgo)
 	if err != nil {
 		return job.Job{}, fmt.Errorf("unable to find a job with id %s", id)
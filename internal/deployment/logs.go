@@ -1,6 +1,8 @@
 package deployment
 
 import (
+	"context"
+
 	"github.com/gorilla/websocket"
 
 	"github.com/krane/krane/internal/docker"
@@ -12,7 +14,7 @@ func SubscribeToDeploymentLogs(client *websocket.Conn, deployment string) {
 	data := make(chan []byte)
 	done := make(chan bool)
 
-	containers, err := GetContainersByDeployment(deployment)
+	containers, err := GetContainersByDeployment(context.Background(), deployment)
 	if err != nil {
 		logger.Warnf("unable to get containers for deployment %s, %v", deployment, err)
 		if err := client.Close(); err != nil {
@@ -6,10 +6,15 @@ type Phase string
 
 const (
 	SetupPhase           Phase = "DEPLOYMENT_SETUP"
+	ValidatePhase        Phase = "DEPLOYMENT_VALIDATE"
 	HealthCheckPhase     Phase = "DEPLOYMENT_HEALTHCHECK"
 	TeardownPhase        Phase = "DEPLOYMENT_TEARDOWN"
 	DonePhase            Phase = "DEPLOYMENT_DONE"
 	PullImagePhase       Phase = "PULL_IMAGE"
 	CreateContainerPhase Phase = "CREATE_CONTAINER"
 	StartContainerPhase  Phase = "START_CONTAINER"
+	RollingUpdatePhase   Phase = "ROLLING_UPDATE"
+	RollbackPhase        Phase = "DEPLOYMENT_ROLLBACK"
+	ScalePhase           Phase = "DEPLOYMENT_SCALE"
+	SwitchPhase          Phase = "DEPLOYMENT_SWITCH"
 )
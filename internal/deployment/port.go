@@ -1,25 +1,221 @@
 package deployment
 
 import (
+	"encoding/json"
+	"fmt"
 	"net"
+	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/docker/go-connections/nat"
+
+	"github.com/krane/krane/internal/job"
+	"github.com/krane/krane/internal/logger"
 )
 
 type Port struct {
-	IP            string `json:"ip"`
-	Type          string `json:"type"`
-	HostPort      string `json:"host_port"`
-	ContainerPort string `json:"container_port"`
+	IP            string       `json:"ip"`
+	Type          string       `json:"type"`     // same as protocol, kept for backwards compatibility
+	Protocol      PortProtocol `json:"protocol"` // tcp or udp
+	HostPort      string       `json:"host_port"`
+	ContainerPort string       `json:"container_port"`
 }
 
 type PortProtocol string
 
 const (
 	TCP PortProtocol = "tcp"
+	UDP PortProtocol = "udp"
 )
 
+// PortBindings are the ports published from the containers of a deployment to the host, each
+// formatted as [[host_ip:]host_port:]container_port[/protocol] (ie. 8080:80, 53/udp or 127.0.0.1:8080:80/tcp)
+type PortBindings []string
+
+// UnmarshalJSON decodes port bindings from a list of bindings or from a map of
+// host ports to container ports ({"8080": "80"}) used by earlier configurations
+func (p *PortBindings) UnmarshalJSON(data []byte) error {
+	var list []string
+	if err := json.Unmarshal(data, &list); err == nil {
+		*p = list
+		return nil
+	}
+
+	var ports map[string]string
+	if err := json.Unmarshal(data, &ports); err != nil {
+		return fmt.Errorf("invalid ports, expected a list of port bindings, %v", err)
+	}
+
+	bindings := make(PortBindings, 0, len(ports))
+	for hostPort, containerPort := range ports {
+		if hostPort == "" {
+			bindings = append(bindings, containerPort)
+			continue
+		}
+		bindings = append(bindings, fmt.Sprintf("%s:%s", hostPort, containerPort))
+	}
+
+	sort.Strings(bindings)
+	*p = bindings
+	return nil
+}
+
+// portBinding is a parsed port binding of a deployment
+type portBinding struct {
+	HostIP        string
+	HostPort      string // empty when a free host port is assigned
+	ContainerPort string
+	Protocol      PortProtocol
+}
+
+// parsePortBinding parses a port binding formatted as [[host_ip:]host_port:]container_port[/protocol].
+// The protocol defaults to tcp, IPv6 host addresses must be enclosed in brackets ([::1]:8080:80).
+func parsePortBinding(binding string) (portBinding, error) {
+	p := portBinding{Protocol: TCP}
+
+	spec := binding
+	if i := strings.LastIndex(spec, "/"); i >= 0 {
+		switch protocol := PortProtocol(strings.ToLower(spec[i+1:])); protocol {
+		case TCP, UDP:
+			p.Protocol = protocol
+		default:
+			return portBinding{}, fmt.Errorf("invalid port %s, protocol must be tcp or udp", binding)
+		}
+		spec = spec[:i]
+	}
+
+	p.ContainerPort = spec
+	if i := strings.LastIndex(spec, ":"); i >= 0 {
+		host := spec[:i]
+		p.ContainerPort = spec[i+1:]
+		p.HostPort = host
+
+		if j := strings.LastIndex(host, ":"); j >= 0 {
+			p.HostIP = strings.TrimSuffix(strings.TrimPrefix(host[:j], "["), "]")
+			p.HostPort = host[j+1:]
+
+			if net.ParseIP(p.HostIP) == nil {
+				return portBinding{}, fmt.Errorf("invalid port %s, host ip %s is not a valid ip address", binding, p.HostIP)
+			}
+		}
+	}
+
+	if !isValidPortNumber(p.ContainerPort) {
+		return portBinding{}, fmt.Errorf("invalid port %s, container port must be between 1 and 65535", binding)
+	}
+
+	if p.HostPort != "" && !isValidPortNumber(p.HostPort) {
+		return portBinding{}, fmt.Errorf("invalid port %s, host port must be between 1 and 65535", binding)
+	}
+
+	return p, nil
+}
+
+// isValidPortNumber returns whether a port is a number between 1 and 65535
+func isValidPortNumber(port string) bool {
+	n, err := strconv.Atoi(port)
+	return err == nil && n > 0 && n <= 65535
+}
+
+// conflicts returns whether two port bindings bind the same host port for the same protocol
+func (p portBinding) conflicts(other portBinding) bool {
+	if p.HostPort == "" || p.HostPort != other.HostPort || p.Protocol != other.Protocol {
+		return false
+	}
+	return isAnyIP(p.HostIP) || isAnyIP(other.HostIP) || net.ParseIP(p.HostIP).Equal(net.ParseIP(other.HostIP))
+}
+
+// isAnyIP returns whether a host ip binds every interface of the host
+func isAnyIP(ip string) bool {
+	return ip == "" || net.ParseIP(ip).IsUnspecified()
+}
+
+// portBindings returns the parsed port bindings of a deployment
+func (config Config) portBindings() []portBinding {
+	bindings := make([]portBinding, 0)
+	for _, spec := range config.Ports {
+		p, err := parsePortBinding(spec)
+		if err != nil {
+			logger.Warnf("Skipping port for deployment %s, %v", config.Name, err)
+			continue
+		}
+		bindings = append(bindings, p)
+	}
+	return bindings
+}
+
+// containerPorts returns the sorted unique container ports of a deployment published for a protocol
+func (config Config) containerPorts(protocol PortProtocol) []string {
+	set := make(map[string]struct{}, 0)
+	for _, p := range config.portBindings() {
+		if p.Protocol == protocol {
+			set[p.ContainerPort] = struct{}{}
+		}
+	}
+
+	ports := make([]string, 0, len(set))
+	for port := range set {
+		ports = append(ports, port)
+	}
+
+	// sort numerically so the lowest port comes first
+	sort.Slice(ports, func(i, j int) bool {
+		a, _ := strconv.Atoi(ports[i])
+		b, _ := strconv.Atoi(ports[j])
+		return a < b
+	})
+	return ports
+}
+
+// isValidPorts returns an error if the port bindings of a deployment are not valid or bind the same host port twice
+func (config Config) isValidPorts() error {
+	bindings := make([]portBinding, 0)
+	for _, spec := range config.Ports {
+		p, err := parsePortBinding(spec)
+		if err != nil {
+			return err
+		}
+
+		for _, other := range bindings {
+			if p.conflicts(other) {
+				return fmt.Errorf("host port %s/%s is bound more than once", p.HostPort, p.Protocol)
+			}
+		}
+		bindings = append(bindings, p)
+	}
+	return nil
+}
+
+// checkPortConflicts returns an error if a deployment binds a host port already bound by another deployment.
+// Conflicts are not retried, the host port stays bound until the other deployment is updated.
+func checkPortConflicts(config Config) error {
+	configs, err := GetAllDeploymentConfigs()
+	if err != nil {
+		return err
+	}
+	return job.NonRetryable(portConflicts(config, configs))
+}
+
+// portConflicts returns an error if a deployment binds a host port bound by one of the other deployment configurations
+func portConflicts(config Config, others []Config) error {
+	bindings := config.portBindings()
+	for _, other := range others {
+		if other.Name == config.Name {
+			continue
+		}
+
+		for _, otherBinding := range other.portBindings() {
+			for _, p := range bindings {
+				if p.conflicts(otherBinding) {
+					return fmt.Errorf("host port %s/%s is already bound by deployment %s", p.HostPort, p.Protocol, other.Name)
+				}
+			}
+		}
+	}
+	return nil
+}
+
 func fromPortMapToPortList(pMap nat.PortMap) []Port {
 	bindings := make([]Port, 0)
 
@@ -29,6 +225,7 @@ func fromPortMapToPortList(pMap nat.PortMap) []Port {
 				IP:            hostB.HostIP,
 				HostPort:      hostB.HostPort,
 				Type:          container.Proto(),
+				Protocol:      PortProtocol(container.Proto()),
 				ContainerPort: container.Port(),
 			})
 		}
@@ -37,8 +234,19 @@ func fromPortMapToPortList(pMap nat.PortMap) []Port {
 	return bindings
 }
 
-// findFreePort returns a free port on the host machine
-func findFreePort() (string, error) {
+// findFreePort returns a free port on the host machine for a protocol
+func findFreePort(protocol PortProtocol) (string, error) {
+	if protocol == UDP {
+		conn, err := net.ListenPacket(string(UDP), "localhost:0")
+		if err != nil {
+			return "", err
+		}
+		defer conn.Close()
+
+		port := conn.LocalAddr().(*net.UDPAddr).Port
+		return strconv.Itoa(port), nil
+	}
+
 	addr, err := net.ResolveTCPAddr(string(TCP), "localhost:0")
 	if err != nil {
 		return "", err
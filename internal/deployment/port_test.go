@@ -0,0 +1,103 @@
+package deployment
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/docker/go-connections/nat"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePortBinding(t *testing.T) {
+	p, err := parsePortBinding("8080")
+	assert.Nil(t, err)
+	assert.Equal(t, portBinding{ContainerPort: "8080", Protocol: TCP}, p)
+
+	p, err = parsePortBinding("53/udp")
+	assert.Nil(t, err)
+	assert.Equal(t, portBinding{ContainerPort: "53", Protocol: UDP}, p)
+
+	p, err = parsePortBinding("80:9000")
+	assert.Nil(t, err)
+	assert.Equal(t, portBinding{HostPort: "80", ContainerPort: "9000", Protocol: TCP}, p)
+
+	p, err = parsePortBinding("127.0.0.1:8080:80/tcp")
+	assert.Nil(t, err)
+	assert.Equal(t, portBinding{HostIP: "127.0.0.1", HostPort: "8080", ContainerPort: "80", Protocol: TCP}, p)
+
+	p, err = parsePortBinding("127.0.0.1::514/udp")
+	assert.Nil(t, err)
+	assert.Equal(t, portBinding{HostIP: "127.0.0.1", ContainerPort: "514", Protocol: UDP}, p)
+
+	p, err = parsePortBinding("[::1]:8080:80")
+	assert.Nil(t, err)
+	assert.Equal(t, portBinding{HostIP: "::1", HostPort: "8080", ContainerPort: "80", Protocol: TCP}, p)
+}
+
+func TestInvalidPortBinding(t *testing.T) {
+	invalid := []string{"", "http", "80/sctp", "0:80", "80:70000", "localhost:80:80", "80:", "1.2.3:80:80"}
+	for _, binding := range invalid {
+		_, err := parsePortBinding(binding)
+		assert.Error(t, err, binding)
+	}
+}
+
+func TestUnmarshalPortBindings(t *testing.T) {
+	var ports PortBindings
+	assert.Nil(t, json.Unmarshal([]byte(`["53/udp", "127.0.0.1:8080:80/tcp"]`), &ports))
+	assert.Equal(t, PortBindings{"53/udp", "127.0.0.1:8080:80/tcp"}, ports)
+
+	// host ports mapped to container ports
+	assert.Nil(t, json.Unmarshal([]byte(`{"80": "9000", "": "8080"}`), &ports))
+	assert.Equal(t, PortBindings{"8080", "80:9000"}, ports)
+
+	assert.Error(t, json.Unmarshal([]byte(`80`), &ports))
+}
+
+func TestMarshalPortBindings(t *testing.T) {
+	// port bindings are always encoded as a list, including those configured as a map
+	var ports PortBindings
+	assert.Nil(t, json.Unmarshal([]byte(`{"80": "9000", "": "8080"}`), &ports))
+
+	bytes, err := json.Marshal(ports)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `["8080", "80:9000"]`, string(bytes))
+
+	bytes, err = json.Marshal(PortBindings{"53:53/udp", "127.0.0.1:8080:80"})
+	assert.Nil(t, err)
+	assert.JSONEq(t, `["53:53/udp", "127.0.0.1:8080:80"]`, string(bytes))
+}
+
+func TestIsValidPorts(t *testing.T) {
+	assert.Nil(t, Config{Ports: PortBindings{"53:53/tcp", "53:53/udp", "8080", "8080"}}.isValidPorts())
+	assert.Nil(t, Config{Ports: PortBindings{"127.0.0.1:80:80", "127.0.0.2:80:80"}}.isValidPorts())
+
+	assert.Error(t, Config{Ports: PortBindings{"80:80", "80:8080"}}.isValidPorts())
+	assert.Error(t, Config{Ports: PortBindings{"127.0.0.1:80:80", "80:8080"}}.isValidPorts())
+	assert.Error(t, Config{Ports: PortBindings{"53/dns"}}.isValidPorts())
+}
+
+func TestPortConflicts(t *testing.T) {
+	dns := Config{Name: "dns", Ports: PortBindings{"53:53/udp", "127.0.0.1:8080:80"}}
+
+	assert.Nil(t, portConflicts(Config{Name: "app", Ports: PortBindings{"53:53/tcp", "8080"}}, []Config{dns}))
+	assert.Nil(t, portConflicts(Config{Name: "app", Ports: PortBindings{"10.0.0.1:8080:80"}}, []Config{dns}))
+	assert.Nil(t, portConflicts(Config{Name: "dns", Ports: PortBindings{"53:53/udp"}}, []Config{dns}))
+
+	assert.Error(t, portConflicts(Config{Name: "app", Ports: PortBindings{"53:5353/udp"}}, []Config{dns}))
+	assert.Error(t, portConflicts(Config{Name: "app", Ports: PortBindings{"0.0.0.0:8080:80"}}, []Config{dns}))
+}
+
+func TestDockerPorts(t *testing.T) {
+	config := Config{Ports: PortBindings{"53:53/udp", "53:53/tcp", "127.0.0.1:8080:80", "127.0.0.1:8081:80"}}
+
+	assert.Equal(t, nat.PortMap{
+		"53/udp": []nat.PortBinding{{HostPort: "53"}},
+		"53/tcp": []nat.PortBinding{{HostPort: "53"}},
+		"80/tcp": []nat.PortBinding{{HostIP: "127.0.0.1", HostPort: "8080"}, {HostIP: "127.0.0.1", HostPort: "8081"}},
+	}, config.DockerPorts())
+
+	assert.Equal(t, nat.PortSet{"53/udp": {}, "53/tcp": {}, "80/tcp": {}}, config.DockerPortSet())
+	assert.Equal(t, []string{"53", "80"}, config.containerPorts(TCP))
+	assert.Equal(t, []string{"53"}, config.containerPorts(UDP))
+}
@@ -0,0 +1,144 @@
+package deployment
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-units"
+)
+
+// minMemory is the smallest memory limit Docker allows for a container
+const minMemory = 6 * 1024 * 1024
+
+// Resources represents the compute resources available to each container of a deployment
+type Resources struct {
+	Memory            string   `json:"memory"`             // memory limit (ex: 512m, 1g), containers exceeding the limit are OOM killed
+	MemoryReservation string   `json:"memory_reservation"` // memory soft limit, enforced when the host is low on memory
+	CPUShares         int64    `json:"cpu_shares"`         // CPU weight relative to other containers (Docker defaults to 1024)
+	CPUPeriod         int64    `json:"cpu_period"`         // CPU CFS period in microseconds (Docker defaults to 100000)
+	CPUQuota          int64    `json:"cpu_quota"`          // CPU CFS quota in microseconds per period (ex: 50000 for half a CPU)
+	PidsLimit         int64    `json:"pids_limit"`         // max number of processes in a container
+	Ulimits           []Ulimit `json:"ulimits"`            // resource limits applied to the processes of a container
+}
+
+// Ulimit is a resource limit applied to the processes of a container
+type Ulimit struct {
+	Name string `json:"name"` // nofile, nproc, core...
+	Soft int64  `json:"soft"`
+	Hard int64  `json:"hard"`
+}
+
+// isValid returns an error if resources are not valid
+func (r Resources) isValid() error {
+	memory, err := parseMemory("memory", r.Memory)
+	if err != nil {
+		return err
+	}
+
+	if memory > 0 && memory < minMemory {
+		return fmt.Errorf("resources memory %s is below the minimum of 6m", r.Memory)
+	}
+
+	reservation, err := parseMemory("memory_reservation", r.MemoryReservation)
+	if err != nil {
+		return err
+	}
+
+	if memory > 0 && reservation > memory {
+		return errors.New("resources memory_reservation cannot be greater than memory")
+	}
+
+	if r.CPUShares < 0 {
+		return errors.New("resources cpu_shares cannot be negative")
+	}
+
+	if r.CPUPeriod != 0 && (r.CPUPeriod < 1000 || r.CPUPeriod > 1000000) {
+		return errors.New("resources cpu_period must be between 1000 and 1000000 microseconds")
+	}
+
+	if r.CPUQuota != 0 && r.CPUQuota < 1000 {
+		return errors.New("resources cpu_quota must be at least 1000 microseconds")
+	}
+
+	if r.PidsLimit < 0 {
+		return errors.New("resources pids_limit cannot be negative")
+	}
+
+	for _, u := range r.Ulimits {
+		if _, err := u.dockerUlimit(); err != nil {
+			return fmt.Errorf("invalid ulimit %s, %v", u.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// DockerResources returns the Docker resources for a deployment container
+func (r Resources) DockerResources() container.Resources {
+	memory, _ := parseMemory("memory", r.Memory)
+	reservation, _ := parseMemory("memory_reservation", r.MemoryReservation)
+
+	ulimits := make([]*units.Ulimit, 0)
+	for _, u := range r.Ulimits {
+		ulimit, err := u.dockerUlimit()
+		if err != nil {
+			continue
+		}
+		ulimits = append(ulimits, ulimit)
+	}
+
+	return container.Resources{
+		Memory:            memory,
+		MemoryReservation: reservation,
+		CPUShares:         r.CPUShares,
+		CPUPeriod:         r.CPUPeriod,
+		CPUQuota:          r.CPUQuota,
+		PidsLimit:         r.PidsLimit,
+		Ulimits:           ulimits,
+	}
+}
+
+// dockerUlimit returns the Docker ulimit, validating the ulimit name and limits
+func (u Ulimit) dockerUlimit() (*units.Ulimit, error) {
+	return units.ParseUlimit(fmt.Sprintf("%s=%d:%d", u.Name, u.Soft, u.Hard))
+}
+
+// parseMemory returns the bytes for a memory value, 0 if the value is empty
+func parseMemory(field, value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	bytes, err := units.RAMInBytes(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid resources %s %s", field, value)
+	}
+	return bytes, nil
+}
+
+// fromDockerResourcesToResources converts Docker container resources into Krane resources
+func fromDockerResourcesToResources(resources container.Resources) Resources {
+	ulimits := make([]Ulimit, 0)
+	for _, u := range resources.Ulimits {
+		ulimits = append(ulimits, Ulimit{Name: u.Name, Soft: u.Soft, Hard: u.Hard})
+	}
+
+	return Resources{
+		Memory:            formatMemory(resources.Memory),
+		MemoryReservation: formatMemory(resources.MemoryReservation),
+		CPUShares:         resources.CPUShares,
+		CPUPeriod:         resources.CPUPeriod,
+		CPUQuota:          resources.CPUQuota,
+		PidsLimit:         resources.PidsLimit,
+		Ulimits:           ulimits,
+	}
+}
+
+// formatMemory returns a human readable memory value (ex: 512MiB), empty if no memory was set
+func formatMemory(bytes int64) string {
+	if bytes == 0 {
+		return ""
+	}
+	return units.BytesSize(float64(bytes))
+}
@@ -0,0 +1,57 @@
+package deployment
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInvalidResources(t *testing.T) {
+	assert.Error(t, Resources{Memory: "lots"}.isValid())
+	assert.Error(t, Resources{Memory: "1m"}.isValid())
+	assert.Error(t, Resources{Memory: "256m", MemoryReservation: "512m"}.isValid())
+	assert.Error(t, Resources{CPUShares: -1}.isValid())
+	assert.Error(t, Resources{CPUPeriod: 10}.isValid())
+	assert.Error(t, Resources{CPUQuota: 10}.isValid())
+	assert.Error(t, Resources{PidsLimit: -1}.isValid())
+	assert.Error(t, Resources{Ulimits: []Ulimit{{Name: "files", Soft: 1024, Hard: 1024}}}.isValid())
+	assert.Error(t, Resources{Ulimits: []Ulimit{{Name: "nofile", Soft: 2048, Hard: 1024}}}.isValid())
+
+	assert.Nil(t, Resources{}.isValid())
+	assert.Nil(t, Resources{
+		Memory:            "512m",
+		MemoryReservation: "256m",
+		CPUShares:         512,
+		CPUPeriod:         100000,
+		CPUQuota:          50000,
+		PidsLimit:         100,
+		Ulimits:           []Ulimit{{Name: "nofile", Soft: 1024, Hard: 2048}},
+	}.isValid())
+}
+
+func TestDockerResources(t *testing.T) {
+	resources := Resources{
+		Memory:            "512m",
+		MemoryReservation: "256m",
+		CPUShares:         512,
+		CPUQuota:          50000,
+		PidsLimit:         100,
+		Ulimits:           []Ulimit{{Name: "nofile", Soft: 1024, Hard: 2048}},
+	}
+
+	docker := resources.DockerResources()
+	assert.Equal(t, int64(512*1024*1024), docker.Memory)
+	assert.Equal(t, int64(256*1024*1024), docker.MemoryReservation)
+	assert.Equal(t, int64(512), docker.CPUShares)
+	assert.Equal(t, int64(50000), docker.CPUQuota)
+	assert.Equal(t, int64(100), docker.PidsLimit)
+	assert.Equal(t, "nofile", docker.Ulimits[0].Name)
+	assert.Equal(t, int64(2048), docker.Ulimits[0].Hard)
+
+	// resources read back from a container are in the same format as the deployment config
+	container := fromDockerResourcesToResources(docker)
+	assert.Equal(t, "512MiB", container.Memory)
+	assert.Equal(t, "256MiB", container.MemoryReservation)
+	assert.Equal(t, resources.Ulimits, container.Ulimits)
+	assert.Equal(t, docker, container.DockerResources())
+}
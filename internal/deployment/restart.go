@@ -0,0 +1,52 @@
+package deployment
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// Restart policies applied to the containers of a deployment when they exit
+const (
+	NoRestart            = "no"
+	AlwaysRestart        = "always"
+	UnlessStoppedRestart = "unless-stopped"
+	OnFailureRestart     = "on-failure"
+)
+
+// parseRestartPolicy returns the Docker restart policy for a restart policy formatted as
+// no, always, unless-stopped or on-failure[:max-retries] (ie. on-failure:5)
+func parseRestartPolicy(policy string) (container.RestartPolicy, error) {
+	name, retries := policy, ""
+	hasRetries := strings.Contains(policy, ":")
+	if hasRetries {
+		i := strings.Index(policy, ":")
+		name, retries = policy[:i], policy[i+1:]
+	}
+
+	switch name {
+	case "", NoRestart:
+		name = NoRestart
+	case AlwaysRestart, UnlessStoppedRestart:
+	case OnFailureRestart:
+		if !hasRetries {
+			return container.RestartPolicy{Name: name}, nil
+		}
+
+		maxRetries, err := strconv.Atoi(retries)
+		if err != nil || maxRetries < 0 {
+			return container.RestartPolicy{}, fmt.Errorf("invalid restart policy %s, max retries must be a positive number", policy)
+		}
+		return container.RestartPolicy{Name: name, MaximumRetryCount: maxRetries}, nil
+	default:
+		return container.RestartPolicy{}, fmt.Errorf("invalid restart policy %s, must be one of no, always, unless-stopped or on-failure:N", policy)
+	}
+
+	if hasRetries {
+		return container.RestartPolicy{}, fmt.Errorf("invalid restart policy %s, max retries only apply to the on-failure policy", policy)
+	}
+
+	return container.RestartPolicy{Name: name}, nil
+}
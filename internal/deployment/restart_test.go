@@ -0,0 +1,34 @@
+package deployment
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRestartPolicy(t *testing.T) {
+	policy, err := parseRestartPolicy("")
+	assert.Nil(t, err)
+	assert.Equal(t, container.RestartPolicy{Name: "no"}, policy)
+
+	policy, err = parseRestartPolicy("unless-stopped")
+	assert.Nil(t, err)
+	assert.Equal(t, container.RestartPolicy{Name: "unless-stopped"}, policy)
+
+	policy, err = parseRestartPolicy("on-failure")
+	assert.Nil(t, err)
+	assert.Equal(t, container.RestartPolicy{Name: "on-failure"}, policy)
+
+	policy, err = parseRestartPolicy("on-failure:5")
+	assert.Nil(t, err)
+	assert.Equal(t, container.RestartPolicy{Name: "on-failure", MaximumRetryCount: 5}, policy)
+}
+
+func TestInvalidRestartPolicy(t *testing.T) {
+	invalid := []string{"sometimes", "on-failure:", "on-failure:-1", "on-failure:five", "always:3"}
+	for _, policy := range invalid {
+		_, err := parseRestartPolicy(policy)
+		assert.Error(t, err, policy)
+	}
+}
@@ -0,0 +1,186 @@
+package deployment
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/krane/krane/internal/constants"
+	"github.com/krane/krane/internal/store"
+	"github.com/krane/krane/internal/utils"
+)
+
+// Revision represents a saved version of a deployment configuration
+type Revision struct {
+	Deployment string `json:"deployment"`
+	Revision   int    `json:"revision"`
+	Config     Config `json:"config"`
+	Healthy    bool   `json:"healthy"`    // true once the revision was deployed and passed its health check
+	CreatedAt  string `json:"created_at"` // RFC3339 timestamp of when the revision was saved
+	CreatedBy  string `json:"created_by"` // user of the session that saved the revision
+}
+
+// KraneUser is the user attributed to revisions saved by Krane itself (ie. automatic rollbacks)
+const KraneUser = "krane"
+
+// saveRevision stores a deployment configuration as a new immutable revision
+func saveRevision(config Config, user string) (Revision, error) {
+	// the error is ignored since deployments without revisions start at revision 1
+	latest, _ := GetLatestRevision(config.Name)
+
+	revision := Revision{
+		Deployment: config.Name,
+		Revision:   latest.Revision + 1,
+		Config:     config,
+		CreatedAt:  utils.UTCDateString(),
+		CreatedBy:  user,
+	}
+
+	if err := putRevision(revision); err != nil {
+		return Revision{}, err
+	}
+
+	return revision, nil
+}
+
+// putRevision upserts a revision into the db
+func putRevision(revision Revision) error {
+	bytes, err := store.Serialize(revision)
+	if err != nil {
+		return err
+	}
+
+	collection := getRevisionsCollectionName(revision.Deployment)
+	return store.Client().Put(collection, formatRevisionKey(revision.Revision), bytes)
+}
+
+// deleteRevision removes a revision from the db
+func deleteRevision(deployment string, revision int) error {
+	return store.Client().Remove(getRevisionsCollectionName(deployment), formatRevisionKey(revision))
+}
+
+// GetRevisions returns every revision for a deployment ordered from oldest to newest
+func GetRevisions(deployment string) ([]Revision, error) {
+	collection := getRevisionsCollectionName(deployment)
+	bytes, err := store.Client().GetAll(collection)
+	if err != nil {
+		return make([]Revision, 0), err
+	}
+
+	revisions := make([]Revision, 0)
+	for _, b := range bytes {
+		var revision Revision
+		if err := store.Deserialize(b, &revision); err != nil {
+			return make([]Revision, 0), err
+		}
+		revisions = append(revisions, revision)
+	}
+
+	return revisions, nil
+}
+
+// GetRevision returns a single revision for a deployment
+func GetRevision(deployment string, revision int) (Revision, error) {
+	collection := getRevisionsCollectionName(deployment)
+	bytes, err := store.Client().Get(collection, formatRevisionKey(revision))
+	if err != nil {
+		return Revision{}, err
+	}
+
+	if bytes == nil {
+		return Revision{}, fmt.Errorf("revision %d not found for deployment %s", revision, deployment)
+	}
+
+	var r Revision
+	if err := store.Deserialize(bytes, &r); err != nil {
+		return Revision{}, err
+	}
+
+	return r, nil
+}
+
+// GetLatestRevision returns the most recent revision for a deployment
+func GetLatestRevision(deployment string) (Revision, error) {
+	revisions, err := GetRevisions(deployment)
+	if err != nil {
+		return Revision{}, err
+	}
+
+	if len(revisions) == 0 {
+		return Revision{}, fmt.Errorf("no revisions found for deployment %s", deployment)
+	}
+
+	return revisions[len(revisions)-1], nil
+}
+
+// lastHealthyRevision returns the most recent healthy revision prior to a given revision
+func lastHealthyRevision(deployment string, before int) (Revision, error) {
+	revisions, err := GetRevisions(deployment)
+	if err != nil {
+		return Revision{}, err
+	}
+
+	for i := len(revisions) - 1; i >= 0; i-- {
+		if revisions[i].Revision < before && revisions[i].Healthy {
+			return revisions[i], nil
+		}
+	}
+
+	return Revision{}, fmt.Errorf("no healthy revision found for deployment %s prior to revision %d", deployment, before)
+}
+
+// runningRevision returns the revision the containers of a deployment are running, which is the most
+// recent healthy revision or the latest revision when no revision was deployed successfully yet
+func runningRevision(deployment string) (Revision, error) {
+	revisions, err := GetRevisions(deployment)
+	if err != nil {
+		return Revision{}, err
+	}
+
+	if len(revisions) == 0 {
+		return Revision{}, fmt.Errorf("no revisions found for deployment %s", deployment)
+	}
+
+	for i := len(revisions) - 1; i >= 0; i-- {
+		if revisions[i].Healthy {
+			return revisions[i], nil
+		}
+	}
+
+	return revisions[len(revisions)-1], nil
+}
+
+// markRevisionHealthy flags a revision as successfully deployed
+func markRevisionHealthy(deployment string, revision int) error {
+	r, err := GetRevision(deployment, revision)
+	if err != nil {
+		return err
+	}
+
+	r.Healthy = true
+	return putRevision(r)
+}
+
+// CreateRevisionsCollection creates the revisions collection for a deployment
+func CreateRevisionsCollection(deployment string) error {
+	collection := getRevisionsCollectionName(deployment)
+	return store.Client().CreateCollection(collection)
+}
+
+// DeleteRevisionsCollection deletes the revisions collection for a deployment.
+// Deployments created before revisions were tracked have no collection, which is not an error.
+func DeleteRevisionsCollection(deployment string) error {
+	collection := getRevisionsCollectionName(deployment)
+	if err := store.Client().CreateCollection(collection); err != nil {
+		return err
+	}
+	return store.Client().DeleteCollection(collection)
+}
+
+// formatRevisionKey zero pads revision numbers so revisions are sorted in the db
+func formatRevisionKey(revision int) string {
+	return fmt.Sprintf("%010d", revision)
+}
+
+func getRevisionsCollectionName(deployment string) string {
+	return strings.ToLower(fmt.Sprintf("%s-%s", deployment, constants.RevisionsCollectionName))
+}
@@ -0,0 +1,116 @@
+package deployment
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSaveRevisions(t *testing.T) {
+	config := Config{Name: "revisions-test", Image: "biensupernice/krane", Tag: "1"}
+
+	r1, err := saveRevision(config, "alice")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, r1.Revision)
+	assert.Equal(t, "alice", r1.CreatedBy)
+	assert.NotEmpty(t, r1.CreatedAt)
+
+	// every save is stored as a new revision, even when the configuration did not change
+	r2, err := saveRevision(config, "bob")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, r2.Revision)
+
+	config.Tag = "2"
+	r3, err := saveRevision(config, "alice")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, r3.Revision)
+
+	revisions, err := GetRevisions(config.Name)
+	assert.Nil(t, err)
+	assert.Len(t, revisions, 3)
+	assert.Equal(t, "1", revisions[0].Config.Tag)
+	assert.Equal(t, "bob", revisions[1].CreatedBy)
+	assert.Equal(t, "2", revisions[2].Config.Tag)
+
+	latest, err := GetLatestRevision(config.Name)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, latest.Revision)
+}
+
+func TestLastHealthyRevision(t *testing.T) {
+	config := Config{Name: "healthy-revisions-test", Image: "biensupernice/krane"}
+	for _, tag := range []string{"1", "2", "3"} {
+		config.Tag = tag
+		_, err := saveRevision(config, "alice")
+		assert.Nil(t, err)
+	}
+
+	_, err := lastHealthyRevision(config.Name, 3)
+	assert.Error(t, err)
+
+	assert.Nil(t, markRevisionHealthy(config.Name, 1))
+	assert.Nil(t, markRevisionHealthy(config.Name, 3))
+
+	healthy, err := lastHealthyRevision(config.Name, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, healthy.Revision)
+	assert.Equal(t, "1", healthy.Config.Tag)
+}
+
+func TestRunningRevision(t *testing.T) {
+	config := Config{Name: "running-revisions-test", Image: "biensupernice/krane"}
+
+	_, err := runningRevision(config.Name)
+	assert.Error(t, err)
+
+	for _, tag := range []string{"1", "2", "3"} {
+		config.Tag = tag
+		_, err := saveRevision(config, "alice")
+		assert.Nil(t, err)
+	}
+
+	// no revision was deployed yet
+	running, err := runningRevision(config.Name)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, running.Revision)
+
+	// revisions saved after the healthy revision are pending
+	assert.Nil(t, markRevisionHealthy(config.Name, 2))
+	running, err = runningRevision(config.Name)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, running.Revision)
+	assert.Equal(t, "2", running.Config.Tag)
+}
+
+func TestGetRevisionNotFound(t *testing.T) {
+	_, err := GetRevision("unknown-revisions-test", 1)
+	assert.Error(t, err)
+}
+
+func TestDeleteMissingRevisionsCollection(t *testing.T) {
+	// deployments created before revisions were tracked have no revisions collection
+	assert.Nil(t, DeleteRevisionsCollection("legacy-revisions-test"))
+}
+
+func TestRestoreConfig(t *testing.T) {
+	previous := Config{Name: "restore-revisions-test", Image: "biensupernice/krane", Tag: "1"}
+	assert.Nil(t, SaveConfig(previous, KraneUser))
+	defer DeleteConfig(previous.Name)
+
+	target := previous
+	target.Tag = "2"
+	saved, err := saveConfig(target, KraneUser)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, saved.Revision)
+
+	// a configuration which cannot be run is not kept as the latest configuration or revision
+	assert.Nil(t, restoreConfig(previous, saved.Revision))
+
+	config, err := GetDeploymentConfig(previous.Name)
+	assert.Nil(t, err)
+	assert.Equal(t, "1", config.Tag)
+
+	latest, err := GetLatestRevision(previous.Name)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, latest.Revision)
+}
@@ -0,0 +1,172 @@
+package deployment
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/krane/krane/internal/logger"
+	"github.com/krane/krane/internal/proxy"
+)
+
+// route returns the routing configuration of a deployment. Deployments are never routed
+// without the basic auth credentials they require, an error is returned instead.
+func (config Config) route() (proxy.Route, error) {
+	mw := config.Middlewares
+	credentials, err := config.basicAuthCredentials()
+	if err != nil {
+		return proxy.Route{}, fmt.Errorf("unable to resolve basic auth credentials for deployment %s, %v", config.Name, err)
+	}
+	mw.BasicAuth.Credentials = credentials
+
+	return proxy.Route{
+		Deployment:  config.Name,
+		Aliases:     config.Alias,
+		Secure:      config.Secure,
+		RateLimit:   config.RateLimit,
+		Middlewares: mw,
+		TCP:         config.TCP,
+		UDP:         config.UDP,
+		Ports:       config.containerPorts(TCP),
+		TargetPort:  config.TargetPort,
+		Upstreams:   make([]string, 0),
+		Color:       string(config.color),
+	}, nil
+}
+
+// isValidRoute returns an error if the proxy provider cannot route a deployment (see proxy.ValidateRoute),
+// or if Caddy or nginx already route one of its aliases for another deployment
+func (config Config) isValidRoute() error {
+	configs, err := GetAllDeploymentConfigs()
+	if err != nil {
+		return err
+	}
+	return routeConflicts(config, proxy.GetProvider().Name(), configs)
+}
+
+// routeConflicts returns an error if a provider cannot route a deployment or routes one of its aliases for one of
+// the other deployment configurations. Basic auth users whose secrets are not saved yet are checked when running.
+func routeConflicts(config Config, provider string, others []Config) error {
+	route := proxy.Route{Deployment: config.Name, Aliases: config.Alias, Secure: config.Secure, Middlewares: config.Middlewares}
+	for _, user := range config.Middlewares.BasicAuth.Users {
+		if secret, err := config.resolveSecret(user); err == nil && secret != nil {
+			route.Middlewares.BasicAuth.Credentials = append(route.Middlewares.BasicAuth.Credentials, secret.Value)
+		}
+	}
+
+	if err := proxy.ValidateRoute(provider, route); err != nil {
+		return err
+	}
+
+	// traefik routes requests matching the rules of several deployments by priority
+	if provider == proxy.TraefikProvider {
+		return nil
+	}
+
+	for _, other := range others {
+		if other.Name == config.Name {
+			continue
+		}
+
+		for _, otherAlias := range other.Alias {
+			for _, alias := range config.Alias {
+				if !alias.Empty() && alias.String() == otherAlias.String() {
+					return fmt.Errorf("alias %s is already routed by deployment %s", alias, other.Name)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// upstreamPort returns the container port requests are forwarded to, empty if the deployment has no http port
+func (config Config) upstreamPort() string {
+	if config.TargetPort != "" {
+		return config.TargetPort
+	}
+
+	if ports := config.containerPorts(TCP); len(ports) > 0 {
+		return ports[0]
+	}
+	return ""
+}
+
+// SyncRoutes updates the proxy provider with the routes to the running containers of every deployment.
+// Traefik discovers the containers of deployments from their labels, only the routes of blue/green
+// deployments are synced to switch their live color.
+func SyncRoutes(ctx context.Context) error {
+	configs, err := GetAllDeploymentConfigs()
+	if err != nil {
+		return err
+	}
+
+	traefik := proxy.GetProvider().Name() == proxy.TraefikProvider
+
+	routes := make([]proxy.Route, 0, len(configs))
+	for _, config := range configs {
+		state, err := GetBlueGreen(config.Name)
+		if err != nil {
+			return err
+		}
+
+		if traefik && state.Live == "" {
+			continue
+		}
+
+		// blue/green deployments are routed using the configuration their live containers were created from
+		if state.Live != "" {
+			if live, err := GetRevision(config.Name, state.LiveRevision); err == nil {
+				config = live.Config
+			} else {
+				logger.Warnf("Unable to get live revision of deployment %s, routing the latest configuration, %v", config.Name, err)
+			}
+			config = config.withColor(state.Live)
+		}
+
+		// a deployment whose credentials cannot be resolved is left out of the routes so it is not
+		// exposed without authentication, the other deployments are still routed
+		route, err := config.route()
+		if err != nil {
+			logger.Errorf("unable to route deployment %v", err)
+			continue
+		}
+
+		if traefik {
+			routes = append(routes, route)
+			continue
+		}
+
+		port := config.upstreamPort()
+		if port == "" && len(config.Alias) > 0 {
+			logger.Warnf("Deployment %s has no target_port or ports to route requests to", config.Name)
+		}
+
+		containers, err := GetContainersByDeployment(ctx, config.Name)
+		if err != nil {
+			return err
+		}
+
+		// requests to blue/green deployments are only routed to the live containers
+		for _, c := range containers {
+			if port == "" || !c.State.Running || c.IPAddress == "" || (state.Live != "" && c.Color != state.Live) {
+				continue
+			}
+			route.Upstreams = append(route.Upstreams, net.JoinHostPort(c.IPAddress, port))
+		}
+
+		routes = append(routes, route)
+	}
+
+	if err := proxy.GetProvider().Sync(ctx, routes); err != nil {
+		return fmt.Errorf("unable to sync %s routes, %v", proxy.GetProvider().Name(), err)
+	}
+	return nil
+}
+
+// syncRoutes updates the proxy provider once the containers of a deployment changed. Failing
+// to update the proxy does not fail deployment jobs, routes are updated again by the next job.
+func syncRoutes(ctx context.Context) {
+	if err := SyncRoutes(ctx); err != nil {
+		logger.Errorf("unable to update proxy routes %v", err)
+	}
+}
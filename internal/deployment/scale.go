@@ -0,0 +1,190 @@
+package deployment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/docker/distribution/uuid"
+	"github.com/docker/docker/api/types"
+
+	"github.com/krane/krane/internal/job"
+	"github.com/krane/krane/internal/logger"
+)
+
+// Scale saves the number of replicas for a deployment and adds or removes containers
+// to match it without re-creating the containers already running. The replicas are saved
+// onto the deployment configuration without saving a revision, so changes to the configuration
+// which were not deployed yet are neither deployed nor attributed to the user scaling.
+func Scale(deployment string, replicas int, user string) (job.Job, error) {
+	if replicas < 0 {
+		return job.Job{}, errors.New("replicas cannot be negative")
+	}
+
+	config, err := GetDeploymentConfig(deployment)
+	if err != nil {
+		return job.Job{}, err
+	}
+
+	logger.Debugf("Scaling deployment %s to %d container(s) for user %s", deployment, replicas, user)
+	config.Scale = replicas
+	if err := putConfig(config); err != nil {
+		return job.Job{}, err
+	}
+
+	j, err := ScaleJob(deployment)
+	if err != nil {
+		return job.Job{}, err
+	}
+
+	return enqueue(j)
+}
+
+// ScaleJob returns the job used to scale the containers of a deployment to its configured scale.
+// Scaling up creates the missing containers from the configuration of the revision currently running,
+// scaling down removes the surplus containers starting with unhealthy containers, then the oldest containers.
+func ScaleJob(deployment string) (job.Job, error) {
+	return scaleJob(uuid.Generate().String(), deployment)
+}
+
+// scaleJob returns a scale deployment job with a given id
+func scaleJob(id, deployment string) (job.Job, error) {
+	saved, err := GetDeploymentConfig(deployment)
+	if err != nil {
+		return job.Job{}, err
+	}
+
+	// deployments saved before revisions were tracked are running their saved configuration
+	revision, err := runningRevision(deployment)
+	if err != nil {
+		revision, err = saveRevision(saved, KraneUser)
+		if err != nil {
+			return job.Job{}, err
+		}
+	}
+
+	// new containers match the containers already running, only the scale is taken from the saved configuration
+	config := revision.Config
+	config.Scale = saved.Scale
+
+	type ScaleDeploymentJobArgs struct {
+		job.Tracker
+		Config     Config
+		Revision   int
+		Containers []KraneContainer
+	}
+
+	e := createEventEmitter(config.Name, id)
+	return job.Job{
+		ID:          id,
+		Deployment:  config.Name,
+		Type:        string(ScaleDeploymentJobType),
+		RetryPolicy: retryPolicy(),
+		Supersede:   true,
+		Args: &ScaleDeploymentJobArgs{
+			Config:     config,
+			Revision:   revision.Revision,
+			Containers: []KraneContainer{},
+		},
+		Setup: func(ctx context.Context, args interface{}) error {
+			jobArgs := args.(*ScaleDeploymentJobArgs)
+
+			// ensure jobs collections
+			if err := CreateJobsCollection(jobArgs.Config.Name); err != nil {
+				logger.Errorf("unable to create jobs collection %v", err)
+				return err
+			}
+
+			// get containers (if any) currently part of this deployment
+			containers, err := GetContainersByDeployment(ctx, jobArgs.Config.Name)
+			if err != nil {
+				logger.Errorf("unable to get containers %v", err)
+				return err
+			}
+
+			// only the live containers of blue/green deployments are scaled, warm containers are left untouched
+			if color := liveColor(jobArgs.Config.Name); color != "" {
+				containers = containersByColor(containers, color)
+			}
+
+			jobArgs.Containers = containers
+			return nil
+		},
+		Run: func(ctx context.Context, args interface{}) error {
+			jobArgs := args.(*ScaleDeploymentJobArgs)
+			config := jobArgs.Config
+			current := len(jobArgs.Containers)
+
+			if color := liveColor(config.Name); color != "" {
+				config = config.withColor(color)
+			}
+
+			e.Phase = ScalePhase
+			e.emit(fmt.Sprintf("Scaling deployment from %d to %d container(s)", current, config.Scale))
+
+			switch {
+			case config.Scale > current:
+				if err := scaleUp(ctx, config, config.Scale-current, e, &jobArgs.Tracker); err != nil {
+					jobArgs.Track(string(ScalePhase), fmt.Sprintf("failed scaling up from %d to %d container(s): %v", current, config.Scale, err))
+					return err
+				}
+			case config.Scale < current:
+				e.Phase = TeardownPhase
+				surplus := selectContainersToRemove(jobArgs.Containers, current-config.Scale)
+				if err := removeContainers(ctx, surplus); err != nil {
+					jobArgs.Track(string(ScalePhase), fmt.Sprintf("failed scaling down from %d to %d container(s): %v", current, config.Scale, err))
+					return err
+				}
+			}
+
+			syncRoutes(ctx)
+
+			message := fmt.Sprintf("Scaled deployment from %d to %d container(s)", current, config.Scale)
+			jobArgs.Track(string(ScalePhase), message)
+			e.Phase = DonePhase
+			e.emit(message)
+
+			return markRevisionHealthy(config.Name, jobArgs.Revision)
+		},
+	}, nil
+}
+
+// scaleUp pulls the image, then creates, starts and health checks n new containers. If any
+// of the new containers fails, every container created while scaling up is removed.
+func scaleUp(ctx context.Context, config Config, n int, e *EventEmitter, tracker *job.Tracker) error {
+	wf := replaceContainersWorkflow(config, n, []KraneContainer{}, e, tracker)
+	if err := wf.Start(ctx); err != nil {
+		return err
+	}
+
+	logger.Debugf("%d container(s) added to deployment %s", n, config.Name)
+	return nil
+}
+
+// selectContainersToRemove returns n containers to remove when scaling down, unhealthy containers first, then the oldest containers
+func selectContainersToRemove(containers []KraneContainer, n int) []KraneContainer {
+	sorted := make([]KraneContainer, len(containers))
+	copy(sorted, containers)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		iUnhealthy, jUnhealthy := isUnhealthy(sorted[i]), isUnhealthy(sorted[j])
+		if iUnhealthy != jUnhealthy {
+			return iUnhealthy
+		}
+		return sorted[i].CreatedAt < sorted[j].CreatedAt
+	})
+
+	if n > len(sorted) {
+		n = len(sorted)
+	}
+	return sorted[:n]
+}
+
+// isUnhealthy returns true if a container is not running or failed its latest health check
+func isUnhealthy(c KraneContainer) bool {
+	if !c.State.Running {
+		return true
+	}
+	return c.State.Health != nil && c.State.Health.Status == types.Unhealthy
+}
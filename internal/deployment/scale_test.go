@@ -0,0 +1,34 @@
+package deployment
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelectContainersToRemove(t *testing.T) {
+	containers := []KraneContainer{
+		{ID: "newest", CreatedAt: 300, State: ContainerState{Running: true}},
+		{ID: "oldest", CreatedAt: 100, State: ContainerState{Running: true}},
+		{ID: "stopped", CreatedAt: 400, State: ContainerState{Running: false}},
+		{ID: "middle", CreatedAt: 200, State: ContainerState{Running: true}},
+		{ID: "unhealthy", CreatedAt: 500, State: ContainerState{Running: true, Health: &types.Health{Status: types.Unhealthy}}},
+	}
+
+	ids := func(containers []KraneContainer) []string {
+		result := make([]string, 0)
+		for _, c := range containers {
+			result = append(result, c.ID)
+		}
+		return result
+	}
+
+	assert.Equal(t, []string{"stopped", "unhealthy", "oldest"}, ids(selectContainersToRemove(containers, 3)))
+	assert.Equal(t, []string{"stopped"}, ids(selectContainersToRemove(containers, 1)))
+	assert.Len(t, selectContainersToRemove(containers, 10), 5)
+	assert.Empty(t, selectContainersToRemove(containers, 0))
+
+	// the original containers are left untouched
+	assert.Equal(t, "newest", containers[0].ID)
+}
@@ -0,0 +1,332 @@
+package deployment
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/mount"
+
+	"github.com/krane/krane/internal/constants"
+	"github.com/krane/krane/internal/docker"
+	"github.com/krane/krane/internal/logger"
+	"github.com/krane/krane/internal/utils"
+)
+
+// defaultSecretFileMode only allows the owner of a secret file to read it
+const defaultSecretFileMode = "0400"
+
+// defaultSecretFileDir is the container directory secret files are mounted into by default
+const defaultSecretFileDir = "/run/secrets"
+
+// SecretFile is a deployment secret mounted into the containers as a read-only file
+type SecretFile struct {
+	Secret string `json:"secret"` // secret alias (@MY_SECRET)
+	Path   string `json:"path"`   // container path of the file (default /run/secrets/<key>)
+	Mode   string `json:"mode"`   // octal file mode (default 0400)
+	UID    int    `json:"uid"`    // owner of the file (default 0)
+	GID    int    `json:"gid"`    // group of the file (default 0)
+}
+
+// key returns the key of the secret a secret file is resolved from
+func (f SecretFile) key() string {
+	key, _, _ := parseSecretReference(f.Secret)
+	return key
+}
+
+// fileMode returns the parsed mode of a secret file
+func (f SecretFile) fileMode() (os.FileMode, error) {
+	mode, err := strconv.ParseUint(f.Mode, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("invalid mode %s for secret file %s, must be an octal permission (ie. 0400)", f.Mode, f.Path)
+	}
+	return os.FileMode(mode), nil
+}
+
+// applyDefaults applies default secret file values
+func (f *SecretFile) applyDefaults() {
+	if f.Path == "" {
+		f.Path = path.Join(defaultSecretFileDir, f.key())
+	}
+
+	if f.Mode == "" {
+		f.Mode = defaultSecretFileMode
+	}
+}
+
+// isValid returns an error if a secret file is not valid
+func (f SecretFile) isValid() error {
+	if !strings.HasPrefix(f.Secret, "@") || f.key() == "" {
+		return fmt.Errorf("invalid secret %s for secret file, secrets are referenced by alias (ie. @MY_SECRET)", f.Secret)
+	}
+
+	if _, _, err := parseSecretReference(f.Secret); err != nil {
+		return err
+	}
+
+	if !path.IsAbs(f.Path) {
+		return fmt.Errorf("invalid secret file %s, container path must be absolute", f.Path)
+	}
+
+	if f.UID < 0 || f.GID < 0 {
+		return fmt.Errorf("invalid owner for secret file %s, uid and gid cannot be negative", f.Path)
+	}
+
+	_, err := f.fileMode()
+	return err
+}
+
+// isValidSecretFiles returns an error if the secret files of a deployment are not valid
+// or are mounted to a container path already used by a volume or tmpfs mount
+func (config Config) isValidSecretFiles() error {
+	paths := make(map[string]bool)
+	for _, v := range config.volumeMounts() {
+		paths[v.Target] = true
+	}
+	for target := range config.Tmpfs {
+		paths[target] = true
+	}
+
+	for _, f := range config.SecretFiles {
+		if err := f.isValid(); err != nil {
+			return err
+		}
+
+		if paths[f.Path] {
+			return fmt.Errorf("container path %s is mounted more than once", f.Path)
+		}
+		paths[f.Path] = true
+	}
+	return nil
+}
+
+// secretFilesDir returns the host directory the secret files of a container are written to
+func secretFilesDir(container string) string {
+	return filepath.Join(os.Getenv(constants.EnvSecretsMountPath), container)
+}
+
+// writeSecretFiles writes the secret files of a deployment for a container and returns the
+// read-only bind mounts of the files. The files are written to the secrets mount path
+// which must be a tmpfs so secrets are never written to disk.
+func writeSecretFiles(config Config, container string) ([]mount.Mount, error) {
+	mounts := make([]mount.Mount, 0, len(config.SecretFiles))
+	if len(config.SecretFiles) == 0 {
+		return mounts, nil
+	}
+
+	if err := isValidSecretsMountPath(); err != nil {
+		return nil, err
+	}
+
+	dir := secretFilesDir(container)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("unable to create secret files directory, %v", err)
+	}
+
+	for i, f := range config.SecretFiles {
+		secret, err := config.resolveSecret(f.Secret)
+		if err != nil || secret == nil {
+			removeSecretFiles(container)
+			return nil, fmt.Errorf("unable to resolve secret %s for secret file %s", f.Secret, f.Path)
+		}
+
+		mode, err := f.fileMode()
+		if err != nil {
+			removeSecretFiles(container)
+			return nil, err
+		}
+
+		source := filepath.Join(dir, fmt.Sprintf("%d-%s", i, f.key()))
+		if err := writeSecretFile(source, []byte(secret.Value), mode, f.UID, f.GID); err != nil {
+			removeSecretFiles(container)
+			return nil, fmt.Errorf("unable to write secret file %s, %v", f.Path, err)
+		}
+
+		mounts = append(mounts, mount.Mount{
+			Type:     mount.TypeBind,
+			Source:   source,
+			Target:   f.Path,
+			ReadOnly: true,
+		})
+	}
+
+	return mounts, nil
+}
+
+// writeSecretFile writes a secret file with its mode and owner
+func writeSecretFile(name string, value []byte, mode os.FileMode, uid, gid int) error {
+	if err := ioutil.WriteFile(name, value, mode); err != nil {
+		return err
+	}
+
+	// the mode is set again since the file creation mode is masked by the umask
+	if err := os.Chmod(name, mode); err != nil {
+		return err
+	}
+
+	if uid == os.Getuid() && gid == os.Getgid() {
+		return nil
+	}
+	return os.Chown(name, uid, gid)
+}
+
+// removeSecretFiles removes the secret files written for a container
+func removeSecretFiles(container string) {
+	if container == "" {
+		return
+	}
+
+	if err := os.RemoveAll(secretFilesDir(container)); err != nil {
+		logger.Warnf("Unable to remove secret files of container %s, %v", container, err)
+	}
+}
+
+// RestoreSecretFiles writes the missing secret files of the containers of deployments again. The secrets
+// mount path is a tmpfs wiped when the host reboots, containers restarted by their restart policy fail
+// to start without their secret files and are started once their files are restored.
+func RestoreSecretFiles(ctx context.Context, deployments []Deployment) {
+	for _, d := range deployments {
+		if len(d.Config.SecretFiles) == 0 {
+			continue
+		}
+
+		for _, c := range d.Containers {
+			container, err := docker.GetClient().GetOneContainer(ctx, c.ID)
+			if err != nil {
+				logger.Warnf("Unable to inspect container %s, %v", c.Name, err)
+				continue
+			}
+
+			restored, err := restoreSecretFiles(d.Config, container.Mounts)
+			if err != nil {
+				logger.Warnf("Unable to restore secret files of container %s, %v", c.Name, err)
+				continue
+			}
+
+			if restored == 0 {
+				continue
+			}
+			logger.Infof("Restored %d secret file(s) of container %s", restored, c.Name)
+
+			policy := container.HostConfig.RestartPolicy.Name
+			if c.State.Running || policy == "" || policy == NoRestart {
+				continue
+			}
+
+			if err := c.Start(ctx); err != nil {
+				logger.Warnf("Unable to start container %s, %v", c.Name, err)
+			}
+		}
+	}
+}
+
+// restoreSecretFiles writes the missing secret files bind mounted into a container from the
+// secret files of a deployment config, returning the number of secret files written
+func restoreSecretFiles(config Config, mounts []types.MountPoint) (int, error) {
+	root := filepath.Clean(os.Getenv(constants.EnvSecretsMountPath)) + string(filepath.Separator)
+
+	restored := 0
+	for _, m := range mounts {
+		if m.Type != mount.TypeBind || !strings.HasPrefix(m.Source, root) {
+			continue
+		}
+
+		if _, err := os.Stat(m.Source); !os.IsNotExist(err) {
+			continue
+		}
+
+		var file *SecretFile
+		for i := range config.SecretFiles {
+			if config.SecretFiles[i].Path == m.Destination {
+				file = &config.SecretFiles[i]
+			}
+		}
+		if file == nil {
+			return restored, fmt.Errorf("secret file %s is no longer configured", m.Destination)
+		}
+
+		if err := isValidSecretsMountPath(); err != nil {
+			return restored, err
+		}
+
+		secret, err := config.resolveSecret(file.Secret)
+		if err != nil || secret == nil {
+			return restored, fmt.Errorf("unable to resolve secret %s for secret file %s", file.Secret, file.Path)
+		}
+
+		mode, err := file.fileMode()
+		if err != nil {
+			return restored, err
+		}
+
+		if err := os.MkdirAll(filepath.Dir(m.Source), 0700); err != nil {
+			return restored, fmt.Errorf("unable to create secret files directory, %v", err)
+		}
+
+		if err := writeSecretFile(m.Source, []byte(secret.Value), mode, file.UID, file.GID); err != nil {
+			return restored, fmt.Errorf("unable to write secret file %s, %v", file.Path, err)
+		}
+		restored++
+	}
+	return restored, nil
+}
+
+// isValidSecretsMountPath returns an error if the secrets mount path is not a tmpfs, secret files
+// are only written to disk when explicitly allowed with SECRETS_MOUNT_ALLOW_DISK
+func isValidSecretsMountPath() error {
+	path := os.Getenv(constants.EnvSecretsMountPath)
+	fsType := mountType(path)
+	if fsType == "tmpfs" || fsType == "ramfs" {
+		return nil
+	}
+
+	if fsType == "" {
+		fsType = "unknown filesystem"
+	}
+
+	if utils.BoolEnv(constants.EnvSecretsMountAllowDisk) {
+		warnSecretsMountPath.Do(func() {
+			logger.Warnf("Secrets mount path %s is not a tmpfs (%s), secret files are written to disk", path, fsType)
+		})
+		return nil
+	}
+
+	return fmt.Errorf("secrets mount path %s is not a tmpfs (%s), set %s=true to write secret files to disk", path, fsType, constants.EnvSecretsMountAllowDisk)
+}
+
+// warnSecretsMountPath warns once when secret files are written to disk
+var warnSecretsMountPath sync.Once
+
+// mountType returns the filesystem type of the mount containing a path, empty if it cannot be determined
+func mountType(p string) string {
+	f, err := os.Open("/proc/mounts")
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	p = filepath.Clean(p)
+	fsType, longest := "", -1
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 {
+			continue
+		}
+
+		mountPoint := fields[1]
+		contained := p == mountPoint || mountPoint == "/" || strings.HasPrefix(p, mountPoint+"/")
+		if contained && len(mountPoint) > longest {
+			fsType, longest = fields[2], len(mountPoint)
+		}
+	}
+	return fsType
+}
@@ -0,0 +1,152 @@
+package deployment
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/krane/krane/internal/constants"
+)
+
+func TestSecretFileDefaults(t *testing.T) {
+	f := SecretFile{Secret: "@DB_PASSWORD"}
+	f.applyDefaults()
+	assert.Equal(t, SecretFile{Secret: "@DB_PASSWORD", Path: "/run/secrets/DB_PASSWORD", Mode: "0400"}, f)
+	assert.Nil(t, f.isValid())
+}
+
+func TestInvalidSecretFiles(t *testing.T) {
+	assert.Error(t, SecretFile{Secret: "DB_PASSWORD", Path: "/run/secrets/db", Mode: "0400"}.isValid())
+	assert.Error(t, SecretFile{Secret: "@DB_PASSWORD", Path: "run/secrets/db", Mode: "0400"}.isValid())
+	assert.Error(t, SecretFile{Secret: "@DB_PASSWORD", Path: "/run/secrets/db", Mode: "0999"}.isValid())
+	assert.Error(t, SecretFile{Secret: "@DB_PASSWORD", Path: "/run/secrets/db", Mode: "01777"}.isValid())
+	assert.Error(t, SecretFile{Secret: "@DB_PASSWORD", Path: "/run/secrets/db", Mode: "0400", UID: -1}.isValid())
+
+	assert.Error(t, Config{SecretFiles: []SecretFile{
+		{Secret: "@A", Path: "/run/secrets/a", Mode: "0400"},
+		{Secret: "@B", Path: "/run/secrets/a", Mode: "0400"},
+	}}.isValidSecretFiles())
+
+	assert.Error(t, Config{
+		Volumes:     map[string]string{"/etc/ssl/certs": "/certs/key.pem:ro"},
+		SecretFiles: []SecretFile{{Secret: "@KEY", Path: "/certs/key.pem", Mode: "0400"}},
+	}.isValidSecretFiles())
+}
+
+func TestWriteSecretFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "krane-secrets")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	os.Setenv(constants.EnvSecretsMountPath, dir)
+	defer os.Unsetenv(constants.EnvSecretsMountPath)
+
+	// the temporary directory is not necessarily a tmpfs
+	os.Setenv(constants.EnvSecretsMountAllowDisk, "true")
+	defer os.Unsetenv(constants.EnvSecretsMountAllowDisk)
+
+	deployment := "secret-files-test"
+	assert.Nil(t, CreateSecretsCollection(deployment))
+	_, err = AddSecret(deployment, "DB_PASSWORD", "s3cr3t", KraneUser)
+	assert.Nil(t, err)
+
+	config := Config{
+		Name: deployment,
+		SecretFiles: []SecretFile{
+			{Secret: "@DB_PASSWORD", Path: "/run/secrets/db_password", Mode: "0440", UID: os.Getuid(), GID: os.Getgid()},
+		},
+	}
+
+	mounts, err := writeSecretFiles(config, "secret-files-test-abc")
+	assert.Nil(t, err)
+
+	source := filepath.Join(dir, "secret-files-test-abc", "0-DB_PASSWORD")
+	assert.Equal(t, []mount.Mount{{Type: mount.TypeBind, Source: source, Target: "/run/secrets/db_password", ReadOnly: true}}, mounts)
+
+	value, err := ioutil.ReadFile(source)
+	assert.Nil(t, err)
+	assert.Equal(t, "s3cr3t", string(value))
+
+	info, err := os.Stat(source)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0440), info.Mode().Perm())
+
+	removeSecretFiles("secret-files-test-abc")
+	_, err = os.Stat(filepath.Join(dir, "secret-files-test-abc"))
+	assert.True(t, os.IsNotExist(err))
+
+	// missing secrets fail the container creation without leaving secret files behind
+	config.SecretFiles = append(config.SecretFiles, SecretFile{Secret: "@MISSING", Path: "/run/secrets/missing", Mode: "0400"})
+	_, err = writeSecretFiles(config, "secret-files-test-def")
+	assert.Error(t, err)
+	_, err = os.Stat(filepath.Join(dir, "secret-files-test-def"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestSecretsMountPathMustBeTmpfs(t *testing.T) {
+	os.Setenv(constants.EnvSecretsMountPath, "/krane-test-secrets")
+	defer os.Unsetenv(constants.EnvSecretsMountPath)
+
+	if fsType := mountType("/krane-test-secrets"); fsType == "tmpfs" || fsType == "ramfs" {
+		t.Skip("root filesystem is a tmpfs")
+	}
+
+	_, err := writeSecretFiles(Config{SecretFiles: []SecretFile{{Secret: "@A", Path: "/run/secrets/a", Mode: "0400"}}}, "secret-files-test-abc")
+	assert.Error(t, err)
+
+	os.Setenv(constants.EnvSecretsMountAllowDisk, "true")
+	defer os.Unsetenv(constants.EnvSecretsMountAllowDisk)
+	assert.Nil(t, isValidSecretsMountPath())
+}
+
+func TestRestoreSecretFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "krane-secrets")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	os.Setenv(constants.EnvSecretsMountPath, dir)
+	defer os.Unsetenv(constants.EnvSecretsMountPath)
+	os.Setenv(constants.EnvSecretsMountAllowDisk, "true")
+	defer os.Unsetenv(constants.EnvSecretsMountAllowDisk)
+
+	deployment := "secret-files-restore-test"
+	assert.Nil(t, CreateSecretsCollection(deployment))
+	_, err = AddSecret(deployment, "DB_PASSWORD", "s3cr3t", KraneUser)
+	assert.Nil(t, err)
+
+	config := Config{
+		Name: deployment,
+		SecretFiles: []SecretFile{
+			{Secret: "@DB_PASSWORD", Path: "/run/secrets/db_password", Mode: "0400", UID: os.Getuid(), GID: os.Getgid()},
+		},
+	}
+
+	source := filepath.Join(dir, "secret-files-restore-test-abc", "0-DB_PASSWORD")
+	mounts := []types.MountPoint{
+		{Type: mount.TypeBind, Source: source, Destination: "/run/secrets/db_password"},
+		{Type: mount.TypeBind, Source: "/var/lib/data", Destination: "/data"},
+	}
+
+	// the secret files of a container are written again once wiped (ie. after a host reboot)
+	restored, err := restoreSecretFiles(config, mounts)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, restored)
+
+	value, err := ioutil.ReadFile(source)
+	assert.Nil(t, err)
+	assert.Equal(t, "s3cr3t", string(value))
+
+	restored, err = restoreSecretFiles(config, mounts)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, restored)
+
+	// secret files removed from the deployment cannot be restored
+	assert.Nil(t, os.Remove(source))
+	_, err = restoreSecretFiles(Config{Name: deployment}, mounts)
+	assert.Error(t, err)
+}
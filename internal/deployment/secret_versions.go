@@ -0,0 +1,258 @@
+package deployment
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/krane/krane/internal/constants"
+	"github.com/krane/krane/internal/logger"
+	"github.com/krane/krane/internal/store"
+	"github.com/krane/krane/internal/utils"
+)
+
+// secretVersionsSuffix is appended to a secrets collection to name the collection storing the versions of its secrets
+const secretVersionsSuffix = "_versions"
+
+// parseSecretReference returns the key and the pinned version of a secret reference (@MY_SECRET:2).
+// The version is 0 for references floating on the latest version of the secret.
+func parseSecretReference(ref string) (string, int, error) {
+	key := strings.TrimPrefix(ref, "@")
+
+	i := strings.LastIndex(key, ":")
+	if i < 0 {
+		return key, 0, nil
+	}
+
+	version, err := strconv.Atoi(key[i+1:])
+	if err != nil || version < 1 {
+		return key[:i], 0, fmt.Errorf("invalid version for secret %s, must be a positive number", ref)
+	}
+	return key[:i], version, nil
+}
+
+// resolveSecret returns the secret a deployment resolves for a secret reference, either the
+// latest version of the secret or the version it is pinned to
+func (config Config) resolveSecret(ref string) (*Secret, error) {
+	return config.resolveReference(SecretReference{Secret: ref})
+}
+
+// resolveReference returns the secret a deployment resolves for a reference of its configuration,
+// either the latest version of the secret or the version it is pinned to
+func (config Config) resolveReference(ref SecretReference) (*Secret, error) {
+	_, version, err := parseSecretReference(ref.Secret)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, collection, err := config.lookupReference(ref)
+	if err != nil || version == 0 {
+		return secret, err
+	}
+
+	return getSecretVersion(collection, secret.Key, version)
+}
+
+// lookupReference returns the latest version of the secret a reference of a deployment configuration resolves
+// and the collection it was resolved from. Entries of the secrets map not resolving their alias fall back to
+// the secret named after their environment variable.
+func (config Config) lookupReference(ref SecretReference) (*Secret, string, error) {
+	key, _, err := parseSecretReference(ref.Secret)
+	if err != nil {
+		return nil, "", err
+	}
+
+	secret, collection, err := config.lookupSecret(key)
+	if err != nil && ref.Field == "secrets" && ref.Key != key {
+		if fallback, fallbackCollection, fallbackErr := config.lookupSecret(ref.Key); fallbackErr == nil {
+			return fallback, fallbackCollection, nil
+		}
+	}
+	return secret, collection, err
+}
+
+// getSecretVersion returns a version of a secret
+func getSecretVersion(collection, key string, version int) (*Secret, error) {
+	secret, err := getSecret(getSecretVersionsCollectionName(collection), secretVersionKey(key, version))
+	if err != nil {
+		return nil, err
+	}
+
+	if secret == nil && version == 1 {
+		// secrets saved before secrets were versioned are their own first version
+		latest, err := getSecret(collection, key)
+		if err != nil {
+			return nil, err
+		}
+
+		if latest != nil && latest.Version == 0 {
+			latest.Version = 1
+			return latest, nil
+		}
+	}
+
+	if secret == nil {
+		return nil, fmt.Errorf("version %d of secret %s not found", version, key)
+	}
+	return secret, nil
+}
+
+// getSecretVersions returns every version of a secret sorted from oldest to latest
+func getSecretVersions(collection, key string) ([]*Secret, error) {
+	all, err := getAllSecrets(getSecretVersionsCollectionName(collection))
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]*Secret, 0)
+	for _, secret := range all {
+		if secret.Key == key {
+			versions = append(versions, secret)
+		}
+	}
+
+	if len(versions) == 0 {
+		latest, err := getSecretVersion(collection, key, 1)
+		if err == nil {
+			versions = append(versions, latest)
+		}
+	}
+
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Version < versions[j].Version })
+	return versions, nil
+}
+
+// GetSecretVersionsRedacted returns every version of a deployment secret with <redacted> as their value
+func GetSecretVersionsRedacted(deployment, key string) ([]Secret, error) {
+	versions, err := getSecretVersions(getSecretsCollectionName(deployment), key)
+	return redactSecrets(versions), err
+}
+
+// GetGlobalSecretVersionsRedacted returns every version of a global secret with <redacted> as their value
+func GetGlobalSecretVersionsRedacted(key string) ([]Secret, error) {
+	versions, err := getSecretVersions(constants.GlobalSecretsCollectionName, key)
+	return redactSecrets(versions), err
+}
+
+// GetGroupSecretVersionsRedacted returns every version of a group secret with <redacted> as their value
+func GetGroupSecretVersionsRedacted(group, key string) ([]Secret, error) {
+	versions, err := getSecretVersions(getGroupSecretsCollectionName(group), key)
+	return redactSecrets(versions), err
+}
+
+// redeployOnSecretChange enqueues a run of the deployments floating on the latest version of a changed secret
+// which opted in to be redeployed when their secrets change, the ids of the enqueued jobs are returned
+func redeployOnSecretChange(collection, key string) []string {
+	jobs := make([]string, 0)
+
+	configs, err := secretReferencedBy(collection, key, true)
+	if err != nil {
+		logger.Errorf("unable to find deployments referencing the changed secret %v", err)
+		return jobs
+	}
+
+	for _, config := range configs {
+		if !config.RedeployOnSecretChange {
+			continue
+		}
+
+		j, err := RunJob(config.Name)
+		if err == nil {
+			j, err = enqueue(j)
+		}
+
+		if err != nil {
+			logger.Warnf("Unable to redeploy %s after secret %s changed, %v", config.Name, key, err)
+			continue
+		}
+
+		logger.Infof("Secret %s changed, redeploying %s with job %s", key, config.Name, j.ID)
+		jobs = append(jobs, j.ID)
+	}
+
+	return jobs
+}
+
+// pruneSecretVersions removes the oldest versions of a secret beyond the versions limit (SECRETS_VERSION_LIMIT)
+// within a transaction, pinned versions are kept. Every version is kept when the limit is 0.
+func pruneSecretVersions(tx store.Tx, collection, key string, pinned map[int]bool) error {
+	limit := int(utils.UIntEnv(constants.EnvSecretsVersionLimit))
+	if limit == 0 {
+		return nil
+	}
+
+	// only the key and version of the stored versions are read, their values are not decrypted
+	versionsCollection := getSecretVersionsCollectionName(collection)
+	versions := make([]int, 0)
+	for _, b := range tx.GetAll(versionsCollection) {
+		var stored storedSecret
+		if err := json.Unmarshal(b, &stored); err != nil {
+			return err
+		}
+
+		if stored.Key == key {
+			versions = append(versions, stored.Version)
+		}
+	}
+
+	if len(versions) <= limit {
+		return nil
+	}
+
+	sort.Ints(versions)
+	for _, version := range versions[:len(versions)-limit] {
+		if pinned[version] {
+			continue
+		}
+
+		if err := tx.Remove(versionsCollection, secretVersionKey(key, version)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// pinnedSecretVersions returns the versions of a secret resolved from a secrets collection which deployments are pinned to
+func pinnedSecretVersions(collection, key string) (map[int]bool, error) {
+	configs, err := secretReferencedBy(collection, key, false)
+	if err != nil {
+		return nil, err
+	}
+
+	pinned := make(map[int]bool)
+	for _, config := range configs {
+		for _, ref := range config.secretReferences() {
+			_, version, err := parseSecretReference(ref.Secret)
+			if err != nil || version == 0 {
+				continue
+			}
+
+			secret, resolvedFrom, err := config.lookupReference(ref)
+			if err == nil && secret != nil && secret.Key == key && resolvedFrom == collection {
+				pinned[version] = true
+			}
+		}
+	}
+
+	return pinned, nil
+}
+
+// secretStoreKey returns the key a secret is stored with in a secrets or secret versions collection
+func secretStoreKey(collection, key string, version int) string {
+	if strings.HasSuffix(collection, secretVersionsSuffix) {
+		return secretVersionKey(key, version)
+	}
+	return key
+}
+
+// secretVersionKey returns the key of a secret version, versions are zero padded to be stored in order
+func secretVersionKey(key string, version int) string {
+	return fmt.Sprintf("%s@%08d", key, version)
+}
+
+func getSecretVersionsCollectionName(collection string) string {
+	return collection + secretVersionsSuffix
+}
@@ -0,0 +1,211 @@
+package deployment
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/krane/krane/internal/constants"
+	"github.com/krane/krane/internal/job"
+	"github.com/krane/krane/internal/store"
+)
+
+func TestParseSecretReference(t *testing.T) {
+	key, version, err := parseSecretReference("@DATABASE_URL")
+	assert.Nil(t, err)
+	assert.Equal(t, "DATABASE_URL", key)
+	assert.Equal(t, 0, version)
+
+	key, version, err = parseSecretReference("@DATABASE_URL:3")
+	assert.Nil(t, err)
+	assert.Equal(t, "DATABASE_URL", key)
+	assert.Equal(t, 3, version)
+
+	_, _, err = parseSecretReference("@DATABASE_URL:0")
+	assert.Error(t, err)
+
+	_, _, err = parseSecretReference("@DATABASE_URL:latest")
+	assert.Error(t, err)
+}
+
+func TestSecretVersions(t *testing.T) {
+	deployment := "krane-test-versions"
+	assert.Nil(t, CreateSecretsCollection(deployment))
+
+	v1, err := AddSecret(deployment, "TOKEN", "first", "alice")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, v1.Version)
+	assert.Equal(t, "alice", v1.CreatedBy)
+	assert.NotZero(t, v1.CreatedAt)
+
+	v2, err := AddSecret(deployment, "TOKEN", "second", "bob")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, v2.Version)
+
+	// references float on the latest version unless pinned
+	config := Config{Name: deployment}
+	latest, err := config.resolveSecretValue("@TOKEN")
+	assert.Nil(t, err)
+	assert.Equal(t, "second", latest)
+
+	pinned, err := config.resolveSecretValue("@TOKEN:1")
+	assert.Nil(t, err)
+	assert.Equal(t, "first", pinned)
+
+	_, err = config.resolveSecretValue("@TOKEN:3")
+	assert.Error(t, err)
+
+	versions, err := GetSecretVersionsRedacted(deployment, "TOKEN")
+	assert.Nil(t, err)
+	assert.Len(t, versions, 2)
+	assert.Equal(t, 1, versions[0].Version)
+	assert.Equal(t, "alice", versions[0].CreatedBy)
+	assert.Equal(t, 2, versions[1].Version)
+	assert.Equal(t, "bob", versions[1].CreatedBy)
+	assert.Equal(t, "<redacted>", versions[1].Value)
+
+	// deleting a secret deletes its versions
+	assert.Nil(t, DeleteSecret(deployment, "TOKEN"))
+	versions, err = GetSecretVersionsRedacted(deployment, "TOKEN")
+	assert.Nil(t, err)
+	assert.Empty(t, versions)
+}
+
+func TestUnversionedSecretMigration(t *testing.T) {
+	deployment := "krane-test-unversioned"
+	collection := getSecretsCollectionName(deployment)
+
+	// secrets saved before secrets were versioned are their first version
+	legacy := &Secret{Deployment: deployment, Key: "TOKEN", Value: "legacy", Alias: "@TOKEN"}
+	assert.Nil(t, putSecret(collection, legacy))
+
+	config := Config{Name: deployment}
+	pinned, err := config.resolveSecretValue("@TOKEN:1")
+	assert.Nil(t, err)
+	assert.Equal(t, "legacy", pinned)
+
+	updated, err := AddSecret(deployment, "TOKEN", "updated", KraneUser)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, updated.Version)
+
+	pinned, err = config.resolveSecretValue("@TOKEN:1")
+	assert.Nil(t, err)
+	assert.Equal(t, "legacy", pinned)
+}
+
+func TestSecretReferencedByFloating(t *testing.T) {
+	for _, config := range []Config{
+		{Name: "krane-test-floating", Image: "nginx", RedeployOnSecretChange: true, Env: map[string]string{"API_KEY": "@SHARED_KEY"}},
+		{Name: "krane-test-pinned", Image: "nginx", RedeployOnSecretChange: true, Env: map[string]string{"API_KEY": "@SHARED_KEY:1"}},
+	} {
+		bytes, _ := json.Marshal(config)
+		assert.Nil(t, store.Client().Put(constants.DeploymentsCollectionName, config.Name, bytes))
+		defer DeleteConfig(config.Name)
+	}
+
+	collection := constants.GlobalSecretsCollectionName
+	defer store.Client().DeleteCollection(collection)
+	defer store.Client().DeleteCollection(getSecretVersionsCollectionName(collection))
+
+	secret := &Secret{Key: "SHARED_KEY", Value: "key", Alias: "@SHARED_KEY", Version: 1}
+	assert.Nil(t, putSecret(collection, secret))
+	assert.Nil(t, putSecret(getSecretVersionsCollectionName(collection), secret))
+
+	referencing, err := secretReferencedBy(collection, "SHARED_KEY", false)
+	assert.Nil(t, err)
+	assert.Len(t, referencing, 2)
+
+	// only deployments floating on the latest version are redeployed when the secret changes
+	floating, err := secretReferencedBy(collection, "SHARED_KEY", true)
+	assert.Nil(t, err)
+	assert.Len(t, floating, 1)
+	assert.Equal(t, "krane-test-floating", floating[0].Name)
+}
+
+func TestPruneSecretVersions(t *testing.T) {
+	deployment := "krane-test-prune"
+	config := Config{Name: deployment, Image: "nginx", Env: map[string]string{"TOKEN": "@TOKEN:1"}}
+	bytes, _ := json.Marshal(config)
+	assert.Nil(t, store.Client().Put(constants.DeploymentsCollectionName, deployment, bytes))
+	defer DeleteConfig(deployment)
+
+	os.Setenv(constants.EnvSecretsVersionLimit, "2")
+	defer os.Unsetenv(constants.EnvSecretsVersionLimit)
+
+	assert.Nil(t, CreateSecretsCollection(deployment))
+	for _, value := range []string{"first", "second", "third", "fourth"} {
+		_, err := AddSecret(deployment, "TOKEN", value, KraneUser)
+		assert.Nil(t, err)
+	}
+
+	// versions beyond the limit are removed unless a deployment is pinned to them
+	versions, err := GetSecretVersionsRedacted(deployment, "TOKEN")
+	assert.Nil(t, err)
+	assert.Len(t, versions, 3)
+	assert.Equal(t, 1, versions[0].Version)
+	assert.Equal(t, 3, versions[1].Version)
+	assert.Equal(t, 4, versions[2].Version)
+
+	pinned, err := config.resolveSecretValue("@TOKEN:1")
+	assert.Nil(t, err)
+	assert.Equal(t, "first", pinned)
+}
+
+func TestAddSecretConcurrently(t *testing.T) {
+	deployment := "krane-test-concurrent-secrets"
+	assert.Nil(t, CreateSecretsCollection(deployment))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := AddSecret(deployment, "TOKEN", fmt.Sprintf("value-%d", i), KraneUser)
+			assert.Nil(t, err)
+		}(i)
+	}
+	wg.Wait()
+
+	// every write is saved as its own version
+	versions, err := GetSecretVersionsRedacted(deployment, "TOKEN")
+	assert.Nil(t, err)
+	assert.Len(t, versions, 10)
+	for i, version := range versions {
+		assert.Equal(t, i+1, version.Version)
+	}
+}
+
+func TestRedeployOnSecretChange(t *testing.T) {
+	deployment := "krane-test-redeploy"
+	config := Config{Name: deployment, Image: "nginx", RedeployOnSecretChange: true, Env: map[string]string{"TOKEN": "@TOKEN"}}
+	bytes, _ := json.Marshal(config)
+	assert.Nil(t, store.Client().Put(constants.DeploymentsCollectionName, deployment, bytes))
+	defer DeleteConfig(deployment)
+
+	q := job.NewQueue(store.Client(), 0)
+	assert.Nil(t, CreateSecretsCollection(deployment))
+
+	first, err := AddSecret(deployment, "TOKEN", "first", KraneUser)
+	assert.Nil(t, err)
+	assert.Empty(t, first.Redeployments)
+
+	// changing a secret enqueues a run of the deployments floating on it
+	changed, err := AddSecret(deployment, "TOKEN", "second", KraneUser)
+	assert.Nil(t, err)
+	assert.Len(t, changed.Redeployments, 1)
+
+	j, ok := q.Get(changed.Redeployments[0])
+	assert.True(t, ok)
+	assert.Equal(t, deployment, j.Deployment)
+	_, err = q.Cancel(j.ID)
+	assert.Nil(t, err)
+
+	// saving a secret with an unchanged value does not
+	unchanged, err := AddSecret(deployment, "TOKEN", "second", KraneUser)
+	assert.Nil(t, err)
+	assert.Empty(t, unchanged.Redeployments)
+}
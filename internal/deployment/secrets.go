@@ -4,78 +4,478 @@ import (
 	"encoding/json"
 	"fmt"
 	"regexp"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/krane/krane/internal/constants"
+	"github.com/krane/krane/internal/encryption"
+	"github.com/krane/krane/internal/logger"
 	"github.com/krane/krane/internal/store"
 )
 
+// Secret is a sensitive value referenced by its alias in deployment configurations. Secrets belong to a deployment,
+// to a group of secrets imported by deployments, or are global secrets shared by every deployment.
 type Secret struct {
-	Deployment string `json:"deployment"`
+	Deployment string `json:"deployment,omitempty"`
+	Group      string `json:"group,omitempty"`
 	Key        string `json:"key"`
 	Value      string `json:"value"`
 	Alias      string `json:"alias"`
+	Version    int    `json:"version"`              // incremented on every write of the secret
+	CreatedAt  int64  `json:"created_at,omitempty"` // unix time the version was written
+	CreatedBy  string `json:"created_by,omitempty"` // user who wrote the version
+
+	// ids of the jobs enqueued to redeploy the deployments floating on the secret when it changed, not stored
+	Redeployments []string `json:"redeployments,omitempty"`
+}
+
+// storedSecret is a secret as saved in the db, its value is encrypted at rest
+type storedSecret struct {
+	Deployment string               `json:"deployment,omitempty"`
+	Group      string               `json:"group,omitempty"`
+	Key        string               `json:"key"`
+	Value      string               `json:"value,omitempty"` // plaintext value of secrets saved before secrets were encrypted
+	Alias      string               `json:"alias"`
+	Version    int                  `json:"version,omitempty"` // 0 for secrets saved before secrets were versioned
+	CreatedAt  int64                `json:"created_at,omitempty"`
+	CreatedBy  string               `json:"created_by,omitempty"`
+	Encrypted  *encryption.Envelope `json:"encrypted,omitempty"` // value encrypted with a data key wrapped by the master key
 }
 
 // AddSecret adds a secret to a deployment. Secrets are injected to the container during the container 'run' step.
 // When a secret is created, an alias is returned and can be used to reference the secret in the `deployment.json`
 // ie. SECRET_TOKEN=@secret-token (@secret-token was returned and how you reference the value for SECRET_TOKEN)
-func AddSecret(deployment, key, value string) (*Secret, error) {
-	if !isValidSecretKey(key) {
-		return &Secret{}, fmt.Errorf("invalid secret name %s", key)
+// Every write of a secret is stored as a new version attributed to the user writing it.
+func AddSecret(deployment, key, value, user string) (*Secret, error) {
+	secret := &Secret{Deployment: deployment, Key: key, Value: value, CreatedBy: user}
+	return addSecret(getSecretsCollectionName(deployment), secret)
+}
+
+// AddGlobalSecret adds a secret shared by every deployment
+func AddGlobalSecret(key, value, user string) (*Secret, error) {
+	secret := &Secret{Key: key, Value: value, CreatedBy: user}
+	return addSecret(constants.GlobalSecretsCollectionName, secret)
+}
+
+// AddGroupSecret adds a secret to a group of secrets, deployments importing the group can reference the secret.
+// The group is created with its first secret.
+func AddGroupSecret(group, key, value, user string) (*Secret, error) {
+	if !isValidSecretKey(group) {
+		return &Secret{}, fmt.Errorf("invalid secret group name %s", group)
 	}
 
-	secret := &Secret{
-		Deployment: deployment,
-		Key:        key,
-		Value:      value,
-		Alias:      formatSecretAlias(key),
+	group = normalizeSecretGroup(group)
+	secret, err := addSecret(getGroupSecretsCollectionName(group), &Secret{Group: group, Key: key, Value: value, CreatedBy: user})
+	if err != nil {
+		return secret, err
 	}
 
-	collection := getSecretsCollectionName(deployment)
-	bytes, _ := secret.SerializeSecret()
-	err := store.Client().Put(collection, secret.Key, bytes)
+	if err := store.Client().Put(constants.SecretGroupsCollectionName, group, []byte(group)); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// addSecret validates the key of a secret, formats its alias and saves it into a secrets collection
+// as the latest version of the secret. Deployments floating on the secret are redeployed if it changed.
+func addSecret(collection string, secret *Secret) (*Secret, error) {
+	if !isValidSecretKey(secret.Key) {
+		return &Secret{}, fmt.Errorf("invalid secret name %s", secret.Key)
+	}
+
+	// the store cannot be read within the transaction, versions deployments are pinned to are read beforehand
+	prune := true
+	pinned, err := pinnedSecretVersions(collection, secret.Key)
+	if err != nil {
+		logger.Warnf("Unable to prune the versions of secret %s, %v", secret.Key, err)
+		prune = false
+	}
+
+	// the version is read, incremented and written within a single transaction
+	// so concurrent writes of a secret cannot save the same version twice
+	var previous *Secret
+	versionsCollection := getSecretVersionsCollectionName(collection)
+	err = store.Client().Update(func(tx store.Tx) error {
+		var err error
+		previous, err = getSecretTx(tx, collection, secret.Key)
+		if err != nil {
+			return err
+		}
+
+		secret.Version = 1
+		if previous != nil {
+			// secrets saved before secrets were versioned are kept as their first version
+			if previous.Version == 0 {
+				previous.Version = 1
+				if err := putSecretTx(tx, versionsCollection, previous); err != nil {
+					return err
+				}
+			}
+			secret.Version = previous.Version + 1
+		}
+
+		secret.Alias = formatSecretAlias(secret.Key)
+		secret.CreatedAt = time.Now().Unix()
+
+		if err := putSecretTx(tx, versionsCollection, secret); err != nil {
+			return err
+		}
+
+		if err := putSecretTx(tx, collection, secret); err != nil {
+			return err
+		}
+
+		if !prune {
+			return nil
+		}
+		return pruneSecretVersions(tx, collection, secret.Key, pinned)
+	})
 	if err != nil {
 		return nil, err
 	}
 
+	if previous != nil && previous.Value != secret.Value {
+		secret.Redeployments = redeployOnSecretChange(collection, secret.Key)
+	}
+
 	return secret, nil
 }
 
-// DeleteSecret deletes a deployment secret
+// putSecret encrypts the value of a secret and upserts it into the db
+func putSecret(collection string, secret *Secret) error {
+	key, bytes, err := encodeSecret(collection, secret)
+	if err != nil {
+		return err
+	}
+	return store.Client().Put(collection, key, bytes)
+}
+
+// putSecretTx encrypts the value of a secret and upserts it within a transaction
+func putSecretTx(tx store.Tx, collection string, secret *Secret) error {
+	key, bytes, err := encodeSecret(collection, secret)
+	if err != nil {
+		return err
+	}
+	return tx.Put(collection, key, bytes)
+}
+
+// encodeSecret encrypts the value of a secret and returns the key and bytes it is stored with
+func encodeSecret(collection string, secret *Secret) (string, []byte, error) {
+	key := secretStoreKey(collection, secret.Key, secret.Version)
+	envelope, err := encryption.Encrypt([]byte(secret.Value), secretAdditionalData(collection, key))
+	if err != nil {
+		return "", nil, err
+	}
+
+	bytes, err := json.Marshal(storedSecret{
+		Deployment: secret.Deployment,
+		Group:      secret.Group,
+		Key:        secret.Key,
+		Alias:      secret.Alias,
+		Version:    secret.Version,
+		CreatedAt:  secret.CreatedAt,
+		CreatedBy:  secret.CreatedBy,
+		Encrypted:  &envelope,
+	})
+	return key, bytes, err
+}
+
+// readSecret decrypts a secret read from the db. Plaintext secrets saved before secrets were encrypted
+// at rest are encrypted in place when read.
+func readSecret(collection string, bytes []byte) (*Secret, error) {
+	secret, plaintext, err := decodeSecret(collection, bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	if plaintext {
+		logger.Debugf("Encrypting plaintext secret %s for deployment %s", secret.Key, secret.Deployment)
+		if err := putSecret(collection, secret); err != nil {
+			logger.Warnf("Unable to encrypt plaintext secret %s for deployment %s, %v", secret.Key, secret.Deployment, err)
+		}
+	}
+	return secret, nil
+}
+
+// decodeSecret decrypts a secret read from the db, returns true if the secret was saved before secrets were encrypted at rest
+func decodeSecret(collection string, bytes []byte) (*Secret, bool, error) {
+	var stored storedSecret
+	if err := json.Unmarshal(bytes, &stored); err != nil {
+		return nil, false, err
+	}
+
+	secret := &Secret{
+		Deployment: stored.Deployment,
+		Group:      stored.Group,
+		Key:        stored.Key,
+		Value:      stored.Value,
+		Alias:      stored.Alias,
+		Version:    stored.Version,
+		CreatedAt:  stored.CreatedAt,
+		CreatedBy:  stored.CreatedBy,
+	}
+
+	if stored.Encrypted == nil {
+		return secret, true, nil
+	}
+
+	key := secretStoreKey(collection, stored.Key, stored.Version)
+	value, err := encryption.Decrypt(*stored.Encrypted, secretAdditionalData(collection, key))
+	if err != nil {
+		return nil, false, fmt.Errorf("unable to decrypt secret %s for deployment %s, %v", stored.Key, stored.Deployment, err)
+	}
+
+	secret.Value = string(value)
+	return secret, false, nil
+}
+
+// EncryptPlaintextSecrets encrypts the secrets of every deployment saved before secrets were encrypted at rest
+func EncryptPlaintextSecrets() {
+	configs, err := GetAllDeploymentConfigs()
+	if err != nil {
+		logger.Errorf("unable to get deployments %v", err)
+		return
+	}
+
+	// plaintext secrets are encrypted when read
+	for _, config := range configs {
+		if _, err := GetAllSecrets(config.Name); err != nil {
+			logger.Errorf("unable to encrypt secrets %v", err)
+		}
+	}
+}
+
+// secretCollections returns the global, group and deployment secrets collections
+func secretCollections() ([]string, error) {
+	configs, err := GetAllDeploymentConfigs()
+	if err != nil {
+		return nil, err
+	}
+
+	groups, err := GetSecretGroups()
+	if err != nil {
+		return nil, err
+	}
+
+	collections := []string{constants.GlobalSecretsCollectionName}
+	for _, group := range groups {
+		collections = append(collections, getGroupSecretsCollectionName(group))
+	}
+	for _, config := range configs {
+		collections = append(collections, getSecretsCollectionName(config.Name))
+	}
+	return collections, nil
+}
+
+// VerifySecretsKey returns an error if secrets, or their previous versions, are encrypted with a master key
+// which is not configured (ie. a master key generated for a db holding secrets encrypted with another key)
+func VerifySecretsKey() error {
+	collections, err := secretCollections()
+	if err != nil {
+		return err
+	}
+
+	missing := make(map[string]int)
+	for _, collection := range collections {
+		for _, c := range []string{collection, getSecretVersionsCollectionName(collection)} {
+			values, err := store.Client().GetAll(c)
+			if err != nil {
+				return err
+			}
+
+			for _, bytes := range values {
+				var stored storedSecret
+				if err := json.Unmarshal(bytes, &stored); err != nil {
+					return err
+				}
+
+				if stored.Encrypted != nil && !encryption.HasKey(stored.Encrypted.KeyID) {
+					missing[stored.Encrypted.KeyID]++
+				}
+			}
+		}
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(missing))
+	for id, count := range missing {
+		keys = append(keys, fmt.Sprintf("%s (%d secret(s))", id, count))
+	}
+	sort.Strings(keys)
+	return fmt.Errorf("secrets are encrypted with master key(s) %s which are not configured", strings.Join(keys, ", "))
+}
+
+// ReEncryptSecrets encrypts the deployment, group and global secrets with new data keys wrapped by the current
+// master key, returning the number of secrets re-encrypted. Used when rotating the master key.
+func ReEncryptSecrets() (int, error) {
+	collections, err := secretCollections()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, collection := range collections {
+		secrets, err := getAllSecrets(collection)
+		if err != nil {
+			return count, err
+		}
+
+		for _, secret := range secrets {
+			if err := putSecret(collection, secret); err != nil {
+				return count, err
+			}
+			count++
+		}
+
+		// previous versions are re-encrypted along with the secrets
+		versionsCollection := getSecretVersionsCollectionName(collection)
+		versions, err := getAllSecrets(versionsCollection)
+		if err != nil {
+			return count, err
+		}
+
+		for _, version := range versions {
+			if err := putSecret(versionsCollection, version); err != nil {
+				return count, err
+			}
+		}
+	}
+
+	return count, nil
+}
+
+// DeleteSecret deletes a deployment secret, secrets still referenced by the deployment are not deleted
 func DeleteSecret(deployment, key string) error {
-	collection := getSecretsCollectionName(deployment)
+	return deleteSecret(getSecretsCollectionName(deployment), key)
+}
+
+// DeleteGlobalSecret deletes a global secret, secrets still referenced by a deployment are not deleted
+func DeleteGlobalSecret(key string) error {
+	return deleteSecret(constants.GlobalSecretsCollectionName, key)
+}
+
+// DeleteGroupSecret deletes a group secret, secrets still referenced by a deployment are not deleted
+func DeleteGroupSecret(group, key string) error {
+	return deleteSecret(getGroupSecretsCollectionName(group), key)
+}
+
+// deleteSecret deletes a secret and its versions from a secrets collection unless a deployment resolves one of its references to it
+func deleteSecret(collection, key string) error {
+	configs, err := secretReferencedBy(collection, key, false)
+	if err != nil {
+		return err
+	}
+
+	if len(configs) > 0 {
+		deployments := make([]string, 0, len(configs))
+		for _, config := range configs {
+			deployments = append(deployments, config.Name)
+		}
+		return fmt.Errorf("secret %s is referenced by deployments %s", key, strings.Join(deployments, ", "))
+	}
+
+	versions, err := getSecretVersions(collection, key)
+	if err != nil {
+		return err
+	}
+
+	versionsCollection := getSecretVersionsCollectionName(collection)
+	for _, version := range versions {
+		if err := store.Client().Remove(versionsCollection, secretVersionKey(key, version.Version)); err != nil {
+			return err
+		}
+	}
+
 	return store.Client().Remove(collection, key)
 }
 
+// secretReferencedBy returns the deployments referencing a secret resolved from a secrets collection,
+// only references floating on the latest version of the secret are returned when floating is true
+func secretReferencedBy(collection, key string, floating bool) ([]Config, error) {
+	configs, err := GetAllDeploymentConfigs()
+	if err != nil {
+		return nil, err
+	}
+
+	referencing := make([]Config, 0)
+	for _, config := range configs {
+		for _, ref := range config.secretReferences() {
+			_, version, err := parseSecretReference(ref.Secret)
+			if err != nil || (floating && version > 0) {
+				continue
+			}
+
+			// references are matched by the secret they resolve, a secret shadowed by a secret
+			// of the same name with a higher precedence is not referenced
+			secret, resolvedFrom, err := config.lookupReference(ref)
+			if err == nil && secret != nil && secret.Key == key && resolvedFrom == collection {
+				referencing = append(referencing, config)
+				break
+			}
+		}
+	}
+
+	return referencing, nil
+}
+
 // CreateSecretsCollection creates secrets collection for a deployment
 func CreateSecretsCollection(deployment string) error {
 	collection := getSecretsCollectionName(deployment)
+	if err := store.Client().CreateCollection(getSecretVersionsCollectionName(collection)); err != nil {
+		return err
+	}
 	return store.Client().CreateCollection(collection)
 }
 
 // DeleteCollection deletes secrets collection for a deployment
 func DeleteSecretsCollection(deployment string) error {
 	collection := getSecretsCollectionName(deployment)
+
+	// the versions collection does not exist for deployments not run since secrets were versioned
+	versionsCollection := getSecretVersionsCollectionName(collection)
+	if err := store.Client().CreateCollection(versionsCollection); err != nil {
+		return err
+	}
+	if err := store.Client().DeleteCollection(versionsCollection); err != nil {
+		return err
+	}
+
 	return store.Client().DeleteCollection(collection)
 }
 
 // GetAllSecrets returns all secrets for a deployment
 func GetAllSecrets(deployment string) ([]*Secret, error) {
-	collection := getSecretsCollectionName(deployment)
+	return getAllSecrets(getSecretsCollectionName(deployment))
+}
+
+// GetAllGlobalSecrets returns all global secrets
+func GetAllGlobalSecrets() ([]*Secret, error) {
+	return getAllSecrets(constants.GlobalSecretsCollectionName)
+}
+
+// GetAllGroupSecrets returns all secrets of a group
+func GetAllGroupSecrets(group string) ([]*Secret, error) {
+	return getAllSecrets(getGroupSecretsCollectionName(group))
+}
+
+// getAllSecrets returns all secrets of a secrets collection
+func getAllSecrets(collection string) ([]*Secret, error) {
 	bytes, err := store.Client().GetAll(collection)
 	if err != nil {
 		return make([]*Secret, 0), err
 	}
 
 	secrets := make([]*Secret, 0)
-	for _, secret := range bytes {
-		var s Secret
-		err := json.Unmarshal(secret, &s)
+	for _, b := range bytes {
+		s, err := readSecret(collection, b)
 		if err != nil {
 			return make([]*Secret, 0), err
 		}
-		secrets = append(secrets, &s)
+		secrets = append(secrets, s)
 	}
 
 	return secrets, nil
@@ -84,6 +484,22 @@ func GetAllSecrets(deployment string) ([]*Secret, error) {
 // GetAllSecretsRedacted returns all deployment secrets with <redacted> a their value
 func GetAllSecretsRedacted(deployment string) []Secret {
 	plainSecrets, _ := GetAllSecrets(deployment)
+	return redactSecrets(plainSecrets)
+}
+
+// GetAllGlobalSecretsRedacted returns all global secrets with <redacted> as their value
+func GetAllGlobalSecretsRedacted() []Secret {
+	plainSecrets, _ := GetAllGlobalSecrets()
+	return redactSecrets(plainSecrets)
+}
+
+// GetAllGroupSecretsRedacted returns all secrets of a group with <redacted> as their value
+func GetAllGroupSecretsRedacted(group string) []Secret {
+	plainSecrets, _ := GetAllGroupSecrets(group)
+	return redactSecrets(plainSecrets)
+}
+
+func redactSecrets(plainSecrets []*Secret) []Secret {
 	redactedSecrets := make([]Secret, 0)
 	for _, secret := range plainSecrets {
 		secret.Redact()
@@ -92,22 +508,144 @@ func GetAllSecretsRedacted(deployment string) []Secret {
 	return redactedSecrets
 }
 
+// GetSecretGroups returns the names of the secret groups
+func GetSecretGroups() ([]string, error) {
+	bytes, err := store.Client().GetAll(constants.SecretGroupsCollectionName)
+	if err != nil {
+		return nil, err
+	}
+
+	// groups created before group names were normalized are listed once
+	seen := make(map[string]bool, len(bytes))
+	groups := make([]string, 0, len(bytes))
+	for _, b := range bytes {
+		group := normalizeSecretGroup(string(b))
+		if !seen[group] {
+			seen[group] = true
+			groups = append(groups, group)
+		}
+	}
+
+	sort.Strings(groups)
+	return groups, nil
+}
+
+// isSecretGroup returns true if a secret group was created
+func isSecretGroup(group string) (bool, error) {
+	groups, err := GetSecretGroups()
+	if err != nil {
+		return false, err
+	}
+
+	for _, g := range groups {
+		if g == normalizeSecretGroup(group) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 // GetSecret returns a deployment secret if it exists
 func GetSecret(deployment, key string) (*Secret, error) {
-	collection := getSecretsCollectionName(deployment)
-	bytes, err := store.Client().Get(collection, key)
+	secret, err := getSecret(getSecretsCollectionName(deployment), key)
 	if err != nil {
 		return nil, err
 	}
 
-	if bytes == nil {
+	if secret == nil {
 		return nil, fmt.Errorf("secret with key %s not found for deployment %s", key, deployment)
 	}
 
-	var s *Secret
-	_ = json.Unmarshal(bytes, &s)
+	return secret, nil
+}
+
+// getSecret returns a secret from a secrets collection, nil if it does not exist
+func getSecret(collection, key string) (*Secret, error) {
+	bytes, err := store.Client().Get(collection, key)
+	if err != nil || bytes == nil {
+		return nil, err
+	}
 
-	return s, nil
+	return readSecret(collection, bytes)
+}
+
+// getSecretTx returns a secret read within a transaction, nil if it does not exist. Plaintext secrets
+// are not encrypted in place, they are encrypted once written back within the transaction.
+func getSecretTx(tx store.Tx, collection, key string) (*Secret, error) {
+	bytes := tx.Get(collection, key)
+	if bytes == nil {
+		return nil, nil
+	}
+
+	secret, _, err := decodeSecret(collection, bytes)
+	return secret, err
+}
+
+// secretCollections returns the collections the secrets of a deployment are resolved from by order of precedence:
+// the deployment secrets, the secrets of the groups it imports in order, then the global secrets
+func (config Config) secretCollections() []string {
+	collections := []string{getSecretsCollectionName(config.Name)}
+	for _, group := range config.SecretGroups {
+		collections = append(collections, getGroupSecretsCollectionName(group))
+	}
+	return append(collections, constants.GlobalSecretsCollectionName)
+}
+
+// lookupSecret returns the secret a deployment resolves for a name and the collection it was resolved from.
+// Within each collection the name is resolved as an alias (@API_TOKEN for the api-token secret) then as a key.
+func (config Config) lookupSecret(name string) (*Secret, string, error) {
+	for _, collection := range config.secretCollections() {
+		key, err := findSecretKeyByAlias(collection, "@"+name)
+		if err != nil {
+			return nil, "", err
+		}
+
+		if key == "" {
+			key = name
+		}
+
+		secret, err := getSecret(collection, key)
+		if err != nil {
+			return nil, "", err
+		}
+
+		if secret != nil {
+			return secret, collection, nil
+		}
+	}
+
+	return nil, "", fmt.Errorf("secret %s not found for deployment %s", name, config.Name)
+}
+
+// findSecretKeyByAlias returns the key of the secret of a secrets collection with an alias, empty if none has the alias.
+// A secret whose key is the alias itself (@API_TOKEN for API_TOKEN) takes precedence over other keys with the same alias.
+func findSecretKeyByAlias(collection, alias string) (string, error) {
+	bytes, err := store.Client().GetAll(collection)
+	if err != nil {
+		return "", err
+	}
+
+	found := ""
+	for _, b := range bytes {
+		var stored storedSecret
+		if err := json.Unmarshal(b, &stored); err != nil {
+			return "", err
+		}
+
+		if formatSecretAlias(stored.Key) != alias {
+			continue
+		}
+
+		if "@"+stored.Key == alias {
+			return stored.Key, nil
+		}
+
+		if found == "" {
+			found = stored.Key
+		}
+	}
+
+	return found, nil
 }
 
 // Redact masks the value for a secret
@@ -139,6 +677,21 @@ func isValidSecretKey(secret string) bool {
 
 func (s Secret) SerializeSecret() ([]byte, error) { return json.Marshal(s) }
 
+// secretAdditionalData binds the encrypted value of a secret to where it is stored
+func secretAdditionalData(collection, key string) []byte {
+	return []byte(fmt.Sprintf("%s/%s", collection, key))
+}
+
 func getSecretsCollectionName(deployment string) string {
 	return strings.ToLower(fmt.Sprintf("%s-%s", deployment, constants.SecretsCollectionName))
 }
+
+// normalizeSecretGroup returns the name a secret group is stored and imported with, group names are case insensitive
+func normalizeSecretGroup(group string) string {
+	return strings.ToLower(group)
+}
+
+// getGroupSecretsCollectionName returns the collection of a secret group, it cannot collide with the collection of a deployment
+func getGroupSecretsCollectionName(group string) string {
+	return fmt.Sprintf("group_%s_%s", normalizeSecretGroup(group), constants.SecretsCollectionName)
+}
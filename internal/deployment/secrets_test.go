@@ -8,6 +8,8 @@ import (
 
 	"github.com/stretchr/testify/assert"
 
+	"github.com/krane/krane/internal/constants"
+	"github.com/krane/krane/internal/encryption"
 	"github.com/krane/krane/internal/store"
 	"github.com/krane/krane/internal/utils"
 )
@@ -15,12 +17,18 @@ import (
 const boltpath = "./krane.db"
 const testDeployment = "krane-test"
 
+// testMasterKey is the master key secrets are encrypted with in tests
+var testMasterKey encryption.Key
+
 func teardown() { os.Remove(boltpath) }
 
 func TestMain(m *testing.M) {
 	store.Connect((boltpath))
 	defer store.Client().Disconnect()
 
+	testMasterKey, _ = encryption.NewKey()
+	encryption.SetKeys(testMasterKey)
+
 	code := m.Run()
 
 	teardown()
@@ -28,45 +36,45 @@ func TestMain(m *testing.M) {
 }
 
 func TestAddNewSecret(t *testing.T) {
-	s1, err := AddSecret(testDeployment, "token", "biensupernice")
+	s1, err := AddSecret(testDeployment, "token", "biensupernice", KraneUser)
 	assert.Nil(t, err)
 	assert.Equal(t, "token", s1.Key)
 	assert.Equal(t, "biensupernice", s1.Value)
 	assert.Equal(t, "@TOKEN", s1.Alias)
 
-	s2, err := AddSecret(testDeployment, "api_token", "biensupernice")
+	s2, err := AddSecret(testDeployment, "api_token", "biensupernice", KraneUser)
 	assert.Nil(t, err)
 	assert.Equal(t, "@API_TOKEN", s2.Alias)
 
-	s3, err := AddSecret(testDeployment, "api-token", "biensupernice")
+	s3, err := AddSecret(testDeployment, "api-token", "biensupernice", KraneUser)
 	assert.Nil(t, err)
 	assert.Equal(t, "@API_TOKEN", s3.Alias)
 
-	s4, err := AddSecret(testDeployment, "api-token123", "biensupernice")
+	s4, err := AddSecret(testDeployment, "api-token123", "biensupernice", KraneUser)
 	assert.Nil(t, err)
 	assert.Equal(t, "@API_TOKEN123", s4.Alias)
 
-	s5, err := AddSecret(testDeployment, "API_PORT_8080", "8080")
+	s5, err := AddSecret(testDeployment, "API_PORT_8080", "8080", KraneUser)
 	assert.Nil(t, err)
 	assert.Equal(t, "@API_PORT_8080", s5.Alias)
 
-	s6, err := AddSecret(testDeployment, "API-PORT-8080", "8080")
+	s6, err := AddSecret(testDeployment, "API-PORT-8080", "8080", KraneUser)
 	assert.Nil(t, err)
 	assert.Equal(t, "@API_PORT_8080", s6.Alias)
 
-	s7, err := AddSecret(testDeployment, "env", "dev")
+	s7, err := AddSecret(testDeployment, "env", "dev", KraneUser)
 	assert.Nil(t, err)
 	assert.Equal(t, "@ENV", s7.Alias)
 
-	s8, err := AddSecret(testDeployment, "8080_API_PORT", "8080")
+	s8, err := AddSecret(testDeployment, "8080_API_PORT", "8080", KraneUser)
 	assert.Nil(t, err)
 	assert.Equal(t, "@8080_API_PORT", s8.Alias)
 
-	s9, err := AddSecret(testDeployment, "8080-API-PORT", "8080")
+	s9, err := AddSecret(testDeployment, "8080-API-PORT", "8080", KraneUser)
 	assert.Nil(t, err)
 	assert.Equal(t, "@8080_API_PORT", s9.Alias)
 
-	s10, err := AddSecret(testDeployment, "aPi_ToKeN-1337", "8080")
+	s10, err := AddSecret(testDeployment, "aPi_ToKeN-1337", "8080", KraneUser)
 	assert.Nil(t, err)
 	assert.Equal(t, "@API_TOKEN_1337", s10.Alias)
 }
@@ -114,7 +122,7 @@ func TestGetSecretsByDeployment(t *testing.T) {
 	secretKey := utils.RandomString(20)
 	secretValue := utils.RandomString(20)
 
-	newSecret, err := AddSecret(testDeployment, secretKey, secretValue)
+	newSecret, err := AddSecret(testDeployment, secretKey, secretValue, KraneUser)
 	assert.Nil(t, err)
 
 	secrets, err := GetAllSecrets(testDeployment)
@@ -138,7 +146,7 @@ func TestGetSecret(t *testing.T) {
 	secretKey := utils.RandomString(20)
 	secretValue := utils.RandomString(20)
 
-	secr, err := AddSecret(testDeployment, secretKey, secretValue)
+	secr, err := AddSecret(testDeployment, secretKey, secretValue, KraneUser)
 	assert.Nil(t, err)
 
 	s, err := GetSecret(testDeployment, secr.Key)
@@ -160,7 +168,7 @@ func TestDeleteSecret(t *testing.T) {
 	secretValue := utils.RandomString(20)
 
 	// add
-	_, err := AddSecret(testDeployment, secretKey, secretValue)
+	_, err := AddSecret(testDeployment, secretKey, secretValue, KraneUser)
 	assert.Nil(t, err)
 
 	// get
@@ -180,3 +188,190 @@ func TestDeleteSecret(t *testing.T) {
 	assert.NotNil(t, err)
 	assert.Equal(t, fmt.Sprintf("secret with key %s not found for deployment %s", secretKey, testDeployment), err.Error())
 }
+
+func TestBasicAuthCredentials(t *testing.T) {
+	deployment := "basic-auth-test"
+	assert.Nil(t, CreateSecretsCollection(deployment))
+
+	_, err := AddSecret(deployment, "ADMIN_USER", "admin:$apr1$H6uskkkW$IgXLP6ewTrSuBkTrqE8wj/", KraneUser)
+	assert.Nil(t, err)
+	_, err = AddSecret(deployment, "PLAIN_USER", "password", KraneUser)
+	assert.Nil(t, err)
+
+	config := Config{Name: deployment}
+	config.Middlewares.BasicAuth.Users = []string{"@ADMIN_USER"}
+	credentials, err := config.basicAuthCredentials()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"admin:$apr1$H6uskkkW$IgXLP6ewTrSuBkTrqE8wj/"}, credentials)
+
+	config.Middlewares.BasicAuth.Users = []string{"@PLAIN_USER"}
+	_, err = config.basicAuthCredentials()
+	assert.Error(t, err)
+
+	config.Middlewares.BasicAuth.Users = []string{"@MISSING_USER"}
+	_, err = config.basicAuthCredentials()
+	assert.Error(t, err)
+
+	// containers are never created or routed without their basic auth credentials
+	config.Labels = map[string]string{}
+	_, err = config.route()
+	assert.Error(t, err)
+	_, err = config.DockerLabels()
+	assert.Error(t, err)
+}
+
+func TestSecretEncryptedAtRest(t *testing.T) {
+	_, err := AddSecret(testDeployment, "encrypted", "biensupernice", KraneUser)
+	assert.Nil(t, err)
+
+	bytes, err := store.Client().Get(getSecretsCollectionName(testDeployment), "encrypted")
+	assert.Nil(t, err)
+	assert.NotContains(t, string(bytes), "biensupernice")
+
+	s, err := GetSecret(testDeployment, "encrypted")
+	assert.Nil(t, err)
+	assert.Equal(t, "biensupernice", s.Value)
+}
+
+func TestPlaintextSecretMigration(t *testing.T) {
+	collection := getSecretsCollectionName(testDeployment)
+	plaintext := Secret{Deployment: testDeployment, Key: "plaintext", Value: "biensupernice", Alias: "@PLAINTEXT"}
+	bytes, _ := plaintext.SerializeSecret()
+	assert.Nil(t, store.Client().Put(collection, "plaintext", bytes))
+
+	s, err := GetSecret(testDeployment, "plaintext")
+	assert.Nil(t, err)
+	assert.Equal(t, plaintext, *s)
+
+	// plaintext secrets are encrypted once read
+	bytes, err = store.Client().Get(collection, "plaintext")
+	assert.Nil(t, err)
+	assert.NotContains(t, string(bytes), "biensupernice")
+
+	s, err = GetSecret(testDeployment, "plaintext")
+	assert.Nil(t, err)
+	assert.Equal(t, plaintext, *s)
+}
+
+func TestReEncryptSecrets(t *testing.T) {
+	deployment := "krane-test-rotate"
+	bytes, _ := Config{Name: deployment, Image: "nginx"}.Serialize()
+	assert.Nil(t, store.Client().Put(constants.DeploymentsCollectionName, deployment, bytes))
+	defer DeleteConfig(deployment)
+
+	_, err := AddSecret(deployment, "token", "biensupernice", KraneUser)
+	assert.Nil(t, err)
+
+	next, _ := encryption.NewKey()
+	encryption.SetKeys(next, testMasterKey)
+	defer encryption.SetKeys(testMasterKey)
+
+	count, err := ReEncryptSecrets()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+
+	// secrets are readable without the old master key once re-encrypted
+	encryption.SetKeys(next)
+	s, err := GetSecret(deployment, "token")
+	assert.Nil(t, err)
+	assert.Equal(t, "biensupernice", s.Value)
+}
+
+func TestVerifySecretsKey(t *testing.T) {
+	deployment := "krane-test-verify-key"
+	bytes, _ := Config{Name: deployment, Image: "nginx"}.Serialize()
+	assert.Nil(t, store.Client().Put(constants.DeploymentsCollectionName, deployment, bytes))
+	defer DeleteConfig(deployment)
+
+	_, err := AddSecret(deployment, "token", "biensupernice", KraneUser)
+	assert.Nil(t, err)
+	assert.Nil(t, VerifySecretsKey())
+
+	// a db holding secrets encrypted with another master key is rejected
+	other, _ := encryption.NewKey()
+	encryption.SetKeys(other)
+	defer encryption.SetKeys(testMasterKey)
+	assert.Error(t, VerifySecretsKey())
+
+	// the previous master key of an interrupted rotation still decrypts them
+	encryption.SetKeys(other, testMasterKey)
+	assert.Nil(t, VerifySecretsKey())
+}
+
+func TestSecretScopes(t *testing.T) {
+	deployment := "krane-test-scopes"
+	config := Config{Name: deployment, Image: "nginx", SecretGroups: []string{"registry"}, Env: map[string]string{
+		"API_KEY":    "@API_KEY",
+		"TOKEN":      "@TOKEN",
+		"REGISTRY":   "@REGISTRY_PASSWORD",
+		"LOCAL_ONLY": "@LOCAL",
+	}}
+	bytes, _ := config.Serialize()
+	assert.Nil(t, store.Client().Put(constants.DeploymentsCollectionName, deployment, bytes))
+	defer DeleteConfig(deployment)
+	defer store.Client().DeleteCollection(constants.GlobalSecretsCollectionName)
+	defer store.Client().DeleteCollection(constants.SecretGroupsCollectionName)
+	defer store.Client().DeleteCollection(getGroupSecretsCollectionName("registry"))
+
+	global, err := AddGlobalSecret("API_KEY", "global-key", KraneUser)
+	assert.Nil(t, err)
+	assert.Equal(t, "@API_KEY", global.Alias)
+	assert.Empty(t, global.Deployment)
+	assert.Empty(t, global.Group)
+	_, err = AddGlobalSecret("TOKEN", "global-token", KraneUser)
+	assert.Nil(t, err)
+	_, err = AddGroupSecret("registry", "REGISTRY_PASSWORD", "hunter2", KraneUser)
+	assert.Nil(t, err)
+	_, err = AddGroupSecret("registry", "TOKEN", "group-token", KraneUser)
+	assert.Nil(t, err)
+	_, err = AddSecret(deployment, "LOCAL", "local", KraneUser)
+	assert.Nil(t, err)
+
+	_, err = AddGroupSecret("invalid group", "TOKEN", "group-token", KraneUser)
+	assert.Error(t, err)
+
+	// groups are not created by secrets which cannot be saved
+	_, err = AddGroupSecret("other", "invalid key", "group-token", KraneUser)
+	assert.Error(t, err)
+
+	// group names are case insensitive
+	secret, err := AddGroupSecret("Registry", "TOKEN", "group-token", KraneUser)
+	assert.Nil(t, err)
+	assert.Equal(t, "registry", secret.Group)
+
+	groups, err := GetSecretGroups()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"registry"}, groups)
+
+	// deployments can only import existing groups
+	imports := Config{Name: deployment, Image: "nginx", SecretGroups: []string{"Registry"}}
+	imports.applyDefaults()
+	assert.Nil(t, imports.isValid())
+	assert.Equal(t, []string{"registry"}, imports.SecretGroups)
+	imports.SecretGroups = []string{"other"}
+	assert.EqualError(t, imports.isValid(), "unknown secret group other in deployment config")
+	groupSecrets := GetAllGroupSecretsRedacted("registry")
+	assert.Len(t, groupSecrets, 2)
+	for _, secret := range groupSecrets {
+		assert.Equal(t, "registry", secret.Group)
+		assert.Equal(t, "<redacted>", secret.Value)
+	}
+
+	// deployment secrets take precedence over the imported groups, which take precedence over global secrets
+	envs, err := config.DockerEnvs()
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"API_KEY=global-key", "TOKEN=group-token", "REGISTRY=hunter2", "LOCAL_ONLY=local"}, envs)
+
+	// secrets referenced by a deployment are not deleted
+	assert.EqualError(t, DeleteGlobalSecret("API_KEY"), "secret API_KEY is referenced by deployments krane-test-scopes")
+	assert.Error(t, DeleteGroupSecret("registry", "TOKEN"))
+	assert.Error(t, DeleteSecret(deployment, "LOCAL"))
+
+	// shadowed secrets are not resolved by the deployment and can be deleted
+	assert.Nil(t, DeleteGlobalSecret("TOKEN"))
+
+	config.SecretGroups = []string{}
+	bytes, _ = config.Serialize()
+	assert.Nil(t, store.Client().Put(constants.DeploymentsCollectionName, deployment, bytes))
+	assert.Nil(t, DeleteGroupSecret("registry", "TOKEN"))
+}
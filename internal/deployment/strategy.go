@@ -0,0 +1,245 @@
+package deployment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/krane/krane/internal/job"
+	"github.com/krane/krane/internal/logger"
+)
+
+// StrategyType is the approach used to replace the containers of a deployment during a run
+type StrategyType string
+
+const (
+	// AllAtOnceStrategy creates every new container, health checks them, then removes every old container
+	AllAtOnceStrategy StrategyType = "all_at_once"
+
+	// RollingStrategy replaces old containers with new containers in batches
+	RollingStrategy StrategyType = "rolling"
+
+	// BlueGreenStrategy creates the new containers alongside the live containers without routing requests
+	// to them, health checks them then switches the routing, the previous containers are kept warm for rollback
+	BlueGreenStrategy StrategyType = "blue_green"
+)
+
+// defaultKeepWarm is how long the previous color of a blue/green deployment is kept running after a switch
+const defaultKeepWarm = 10 * time.Minute
+
+// Strategy represents how containers are replaced when running a deployment
+type Strategy struct {
+	Type           StrategyType `json:"type"`            // all_at_once (default), rolling or blue_green
+	MaxSurge       int          `json:"max_surge"`       // number of containers created above the desired scale during a rolling update
+	MaxUnavailable int          `json:"max_unavailable"` // number of containers that can be removed below the desired scale during a rolling update
+	KeepWarm       string       `json:"keep_warm"`       // time the previous color of a blue/green deployment is kept running after a switch (default 10m)
+}
+
+// rolloutBatch is a single step of a rolling update
+type rolloutBatch struct {
+	Remove  int // old containers removed before the batch is created
+	Create  int // new containers created and health checked in the batch
+	Replace int // old containers removed once the batch is healthy
+}
+
+// applyDefaults applies default strategy values
+func (s *Strategy) applyDefaults() {
+	if s.Type == "" {
+		s.Type = AllAtOnceStrategy
+	}
+
+	if s.Type == RollingStrategy && s.MaxSurge == 0 && s.MaxUnavailable == 0 {
+		s.MaxSurge = 1
+	}
+
+	if s.Type == BlueGreenStrategy && s.KeepWarm == "" {
+		s.KeepWarm = defaultKeepWarm.String()
+	}
+}
+
+// isValid returns an error if a strategy is not valid
+func (s Strategy) isValid() error {
+	switch s.Type {
+	case "", AllAtOnceStrategy, RollingStrategy, BlueGreenStrategy:
+	default:
+		return fmt.Errorf("invalid strategy type %s", s.Type)
+	}
+
+	if s.MaxSurge < 0 {
+		return errors.New("strategy max_surge cannot be negative")
+	}
+
+	if s.MaxUnavailable < 0 {
+		return errors.New("strategy max_unavailable cannot be negative")
+	}
+
+	if s.Type == RollingStrategy && s.MaxSurge == 0 && s.MaxUnavailable == 0 {
+		return errors.New("strategy max_surge and max_unavailable cannot both be 0")
+	}
+
+	if s.KeepWarm != "" {
+		if d, err := time.ParseDuration(s.KeepWarm); err != nil || d < 0 {
+			return fmt.Errorf("invalid strategy keep_warm %s", s.KeepWarm)
+		}
+	}
+
+	return nil
+}
+
+// keepWarm returns how long the previous color of a blue/green deployment is kept running after a switch
+func (s Strategy) keepWarm() time.Duration {
+	d, err := time.ParseDuration(s.KeepWarm)
+	if err != nil {
+		return defaultKeepWarm
+	}
+	return d
+}
+
+// planRollingUpdate returns the batches required to replace current containers with desired containers.
+// Each batch keeps at most MaxSurge containers above and MaxUnavailable containers below the desired scale.
+func planRollingUpdate(current, desired int, s Strategy) []rolloutBatch {
+	batchSize := s.MaxSurge + s.MaxUnavailable
+	if batchSize < 1 {
+		batchSize = 1
+	}
+
+	batches := make([]rolloutBatch, 0)
+	old, created := current, 0
+	for created < desired || old > 0 {
+		create := min(batchSize, desired-created)
+		remove := min(s.MaxUnavailable, old)
+		old -= remove
+
+		// old containers replaced by the healthy batch, the last batch retires every remaining old container
+		replace := min(max(create-remove, 0), old)
+		if created+create == desired {
+			replace = old
+		}
+		old -= replace
+		created += create
+
+		batches = append(batches, rolloutBatch{Remove: remove, Create: create, Replace: replace})
+	}
+
+	return batches
+}
+
+// deployRolling replaces old containers with new containers in batches. Every batch is
+// health checked before moving onto the next batch, a failing batch stops the rollout.
+func deployRolling(ctx context.Context, config Config, old []KraneContainer, e *EventEmitter, tracker *job.Tracker) error {
+	batches := planRollingUpdate(len(old), config.Scale, config.Strategy)
+	e.Phase = RollingUpdatePhase
+
+	for i, batch := range batches {
+		step := fmt.Sprintf("batch %d/%d", i+1, len(batches))
+		if err := ctx.Err(); err != nil {
+			tracker.Track(step, fmt.Sprintf("rolling update stopped: %v", err))
+			return err
+		}
+
+		logger.Debugf("Deployment %s rolling update %s", config.Name, step)
+
+		if err := removeContainers(ctx, old[:batch.Remove]); err != nil {
+			tracker.Track(step, fmt.Sprintf("failed removing %d old container(s): %v", batch.Remove, err))
+			return err
+		}
+		old = old[batch.Remove:]
+
+		containers, err := createContainers(ctx, config, batch.Create)
+		if err == nil {
+			err = startContainers(ctx, containers)
+		}
+		if err == nil {
+			err = RetriableContainersHealthCheck(ctx, containers, config.HealthCheck)
+		}
+		if err != nil {
+			message := fmt.Sprintf("%s failed, stopping rolling update: %v", step, err)
+			tracker.Track(step, message)
+			e.emit(message)
+
+			// remove the containers from the failed batch, old containers not yet replaced are left running
+			if err := removeContainers(ctx, containers); err != nil {
+				logger.Errorf("unable to remove containers from failed batch %v", err)
+			}
+			return err
+		}
+
+		if err := removeContainers(ctx, old[:batch.Replace]); err != nil {
+			tracker.Track(step, fmt.Sprintf("failed removing %d old container(s): %v", batch.Replace, err))
+			return err
+		}
+		old = old[batch.Replace:]
+
+		message := fmt.Sprintf("%s healthy, %d container(s) created, %d container(s) removed", step, batch.Create, batch.Remove+batch.Replace)
+		tracker.Track(step, message)
+		e.emit(message)
+	}
+
+	return nil
+}
+
+// createContainers creates n containers from a deployment config, creating its named volumes if missing.
+// No container is created if a secret referenced by the deployment config cannot be resolved.
+func createContainers(ctx context.Context, config Config, n int) ([]KraneContainer, error) {
+	containers := make([]KraneContainer, 0)
+	if n == 0 {
+		return containers, nil
+	}
+
+	if err := config.validateSecrets(); err != nil {
+		logger.Errorf("unable to resolve deployment secrets %v", err)
+		return containers, job.NonRetryable(err)
+	}
+
+	if err := ensureVolumes(ctx, config); err != nil {
+		return containers, err
+	}
+
+	for i := 0; i < n; i++ {
+		c, err := ContainerCreate(ctx, config)
+		if err != nil {
+			logger.Errorf("unable to create container %v", err)
+			return containers, err
+		}
+		containers = append(containers, c)
+	}
+	return containers, nil
+}
+
+// startContainers starts a list of containers
+func startContainers(ctx context.Context, containers []KraneContainer) error {
+	for _, c := range containers {
+		if err := c.Start(ctx); err != nil {
+			logger.Errorf("unable to start container %v", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// removeContainers removes a list of containers
+func removeContainers(ctx context.Context, containers []KraneContainer) error {
+	for _, c := range containers {
+		logger.Debugf("Removing container %s", c.Name)
+		if err := c.Remove(ctx); err != nil {
+			logger.Errorf("unable to remove container %v", err)
+			return err
+		}
+	}
+	return nil
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,74 @@
+package deployment
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultStrategy(t *testing.T) {
+	s := Strategy{}
+	s.applyDefaults()
+	assert.Equal(t, AllAtOnceStrategy, s.Type)
+
+	rolling := Strategy{Type: RollingStrategy}
+	rolling.applyDefaults()
+	assert.Equal(t, 1, rolling.MaxSurge)
+	assert.Equal(t, 0, rolling.MaxUnavailable)
+}
+
+func TestInvalidStrategy(t *testing.T) {
+	assert.Error(t, Strategy{Type: "canary"}.isValid())
+	assert.Error(t, Strategy{Type: RollingStrategy, MaxSurge: -1, MaxUnavailable: 1}.isValid())
+	assert.Error(t, Strategy{Type: RollingStrategy, MaxSurge: 1, MaxUnavailable: -1}.isValid())
+	assert.Error(t, Strategy{Type: RollingStrategy}.isValid())
+	assert.Nil(t, Strategy{Type: RollingStrategy, MaxSurge: 1}.isValid())
+}
+
+func TestPlanRollingUpdateWithSurge(t *testing.T) {
+	batches := planRollingUpdate(3, 3, Strategy{Type: RollingStrategy, MaxSurge: 1})
+	assert.Equal(t, []rolloutBatch{
+		{Remove: 0, Create: 1, Replace: 1},
+		{Remove: 0, Create: 1, Replace: 1},
+		{Remove: 0, Create: 1, Replace: 1},
+	}, batches)
+}
+
+func TestPlanRollingUpdateWithUnavailable(t *testing.T) {
+	batches := planRollingUpdate(4, 4, Strategy{Type: RollingStrategy, MaxUnavailable: 2})
+	assert.Equal(t, []rolloutBatch{
+		{Remove: 2, Create: 2, Replace: 0},
+		{Remove: 2, Create: 2, Replace: 0},
+	}, batches)
+}
+
+func TestPlanRollingUpdateNeverExceedsSurgeOrUnavailable(t *testing.T) {
+	s := Strategy{Type: RollingStrategy, MaxSurge: 2, MaxUnavailable: 1}
+	for current := 0; current < 8; current++ {
+		for desired := 0; desired < 8; desired++ {
+			old, created := current, 0
+			for _, b := range planRollingUpdate(current, desired, s) {
+				old -= b.Remove
+				assert.True(t, old+created+b.Create <= max(current, desired)+s.MaxSurge)
+				created += b.Create
+				old -= b.Replace
+				assert.True(t, old >= 0)
+			}
+			assert.Equal(t, 0, old)
+			assert.Equal(t, desired, created)
+		}
+	}
+}
+
+func TestBlueGreenStrategy(t *testing.T) {
+	s := Strategy{Type: BlueGreenStrategy}
+	s.applyDefaults()
+	assert.Equal(t, "10m0s", s.KeepWarm)
+	assert.Equal(t, 10*time.Minute, s.keepWarm())
+	assert.Nil(t, s.isValid())
+
+	assert.Equal(t, time.Duration(0), Strategy{Type: BlueGreenStrategy, KeepWarm: "0s"}.keepWarm())
+	assert.Error(t, Strategy{Type: BlueGreenStrategy, KeepWarm: "soon"}.isValid())
+	assert.Error(t, Strategy{Type: BlueGreenStrategy, KeepWarm: "-1m"}.isValid())
+}
@@ -0,0 +1,162 @@
+package deployment
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// SecretReference is a secret alias (@MY_SECRET) referenced by a deployment configuration
+type SecretReference struct {
+	Field  string `json:"field"`         // config field referencing the secret (env, secrets, registry, labels...)
+	Key    string `json:"key,omitempty"` // key within the field for map or list fields
+	Secret string `json:"secret"`        // secret alias
+}
+
+// String returns the secret alias followed by where it is referenced (@DB_URL (env DATABASE_URL))
+func (r SecretReference) String() string {
+	if r.Key == "" {
+		return fmt.Sprintf("%s (%s)", r.Secret, r.Field)
+	}
+	return fmt.Sprintf("%s (%s %s)", r.Secret, r.Field, r.Key)
+}
+
+// DryRun is the result of validating a deployment configuration without running it
+type DryRun struct {
+	Deployment string            `json:"deployment"`
+	Valid      bool              `json:"valid"`
+	Error      string            `json:"error,omitempty"` // configuration error, empty if the configuration is valid
+	References []SecretReference `json:"references"`      // secrets referenced by the configuration
+	Missing    []SecretReference `json:"missing"`         // referenced secrets which cannot be resolved
+}
+
+// ValidateConfig validates a deployment configuration and reports the secrets it references
+// which cannot be resolved. Nothing is saved or run.
+func ValidateConfig(config Config) DryRun {
+	config.applyDefaults()
+
+	result := DryRun{
+		Deployment: config.Name,
+		References: config.secretReferences(),
+		Missing:    config.missingSecrets(),
+	}
+
+	if err := config.isValid(); err != nil {
+		result.Error = err.Error()
+	}
+
+	result.Valid = result.Error == "" && len(result.Missing) == 0
+	return result
+}
+
+// secretReferencePattern matches a secret alias or key optionally pinned to a version (@MY_SECRET or @MY_SECRET:2)
+var secretReferencePattern = regexp.MustCompile(`^@[a-zA-Z0-9_-]+(:[0-9]+)?$`)
+
+// isSecretReference returns true if a config value references a secret (@MY_SECRET), other values
+// starting with @ (ie. @scope/package) are literals and values starting with @@ are escaped literals
+func isSecretReference(value string) bool {
+	return secretReferencePattern.MatchString(value)
+}
+
+// resolveSecretValue returns the value of the secret a config value references, escaped literals (@@value)
+// are returned without their escape and other values are returned as is
+func (config Config) resolveSecretValue(value string) (string, error) {
+	if strings.HasPrefix(value, "@@") {
+		return value[1:], nil
+	}
+
+	if !isSecretReference(value) {
+		return value, nil
+	}
+
+	secret, err := config.resolveSecret(value)
+	if err != nil || secret == nil {
+		return "", fmt.Errorf("secret \"%s\" not found", value)
+	}
+	return secret.Value, nil
+}
+
+// secretAlias returns the alias of a deployment secret, secrets without an alias are resolved by key
+func secretAlias(key, alias string) string {
+	if alias == "" {
+		return formatSecretAlias(key)
+	}
+	return "@" + strings.TrimPrefix(alias, "@")
+}
+
+// secretReferences returns every secret referenced by a deployment configuration
+func (config Config) secretReferences() []SecretReference {
+	refs := make([]SecretReference, 0)
+
+	for _, k := range sortedMapKeys(config.Env) {
+		if isSecretReference(config.Env[k]) {
+			refs = append(refs, SecretReference{Field: "env", Key: k, Secret: config.Env[k]})
+		}
+	}
+
+	for _, k := range sortedMapKeys(config.Secrets) {
+		refs = append(refs, SecretReference{Field: "secrets", Key: k, Secret: secretAlias(k, config.Secrets[k])})
+	}
+
+	for _, f := range config.SecretFiles {
+		refs = append(refs, SecretReference{Field: "secret_files", Key: f.Path, Secret: f.Secret})
+	}
+
+	registry := []struct{ key, value string }{
+		{"url", config.Registry.URL},
+		{"username", config.Registry.Username},
+		{"password", config.Registry.Password},
+	}
+	for _, r := range registry {
+		if isSecretReference(r.value) {
+			refs = append(refs, SecretReference{Field: "registry", Key: r.key, Secret: r.value})
+		}
+	}
+
+	for _, k := range sortedMapKeys(config.Labels) {
+		if isSecretReference(config.Labels[k]) {
+			refs = append(refs, SecretReference{Field: "labels", Key: k, Secret: config.Labels[k]})
+		}
+	}
+
+	for _, user := range config.Middlewares.BasicAuth.Users {
+		refs = append(refs, SecretReference{Field: "middlewares.basic_auth.users", Secret: "@" + strings.TrimPrefix(user, "@")})
+	}
+
+	return refs
+}
+
+// missingSecrets returns the secrets referenced by a deployment configuration which cannot be resolved
+func (config Config) missingSecrets() []SecretReference {
+	missing := make([]SecretReference, 0)
+	for _, ref := range config.secretReferences() {
+		if secret, err := config.resolveReference(ref); err != nil || secret == nil {
+			missing = append(missing, ref)
+		}
+	}
+	return missing
+}
+
+// validateSecrets returns an error listing the secrets referenced by a deployment configuration which cannot be resolved
+func (config Config) validateSecrets() error {
+	missing := config.missingSecrets()
+	if len(missing) == 0 {
+		return nil
+	}
+
+	list := make([]string, 0, len(missing))
+	for _, ref := range missing {
+		list = append(list, ref.String())
+	}
+	return fmt.Errorf("missing secrets for deployment %s: %s", config.Name, strings.Join(list, ", "))
+}
+
+func sortedMapKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
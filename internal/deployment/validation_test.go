@@ -0,0 +1,151 @@
+package deployment
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateConfig(t *testing.T) {
+	deployment := "validation-test"
+	assert.Nil(t, CreateSecretsCollection(deployment))
+	_, err := AddSecret(deployment, "DATABASE_URL", "postgres://db", KraneUser)
+	assert.Nil(t, err)
+	_, err = AddSecret(deployment, "REGISTRY_PASSWORD", "hunter2", KraneUser)
+	assert.Nil(t, err)
+
+	config := Config{
+		Name:     deployment,
+		Image:    "nginx",
+		Env:      map[string]string{"NODE_ENV": "production", "DATABASE_URL": "@DATABASE_URL", "API_KEY": "@API_KEY"},
+		Secrets:  map[string]string{"TOKEN": "@TOKEN"},
+		Registry: Registry{Username: "krane", Password: "@REGISTRY_PASSWORD"},
+		Labels:   map[string]string{"owner": "@OWNER"},
+	}
+
+	result := ValidateConfig(config)
+	assert.False(t, result.Valid)
+	assert.Empty(t, result.Error)
+	assert.Equal(t, []SecretReference{
+		{Field: "env", Key: "API_KEY", Secret: "@API_KEY"},
+		{Field: "env", Key: "DATABASE_URL", Secret: "@DATABASE_URL"},
+		{Field: "secrets", Key: "TOKEN", Secret: "@TOKEN"},
+		{Field: "registry", Key: "password", Secret: "@REGISTRY_PASSWORD"},
+		{Field: "labels", Key: "owner", Secret: "@OWNER"},
+	}, result.References)
+	assert.Equal(t, []SecretReference{
+		{Field: "env", Key: "API_KEY", Secret: "@API_KEY"},
+		{Field: "secrets", Key: "TOKEN", Secret: "@TOKEN"},
+		{Field: "labels", Key: "owner", Secret: "@OWNER"},
+	}, result.Missing)
+
+	err = config.validateSecrets()
+	assert.Error(t, err)
+	assert.Equal(t, "missing secrets for deployment validation-test: @API_KEY (env API_KEY), @TOKEN (secrets TOKEN), @OWNER (labels owner)", err.Error())
+
+	// configuration errors are reported with the missing secrets
+	config.Image = ""
+	assert.Equal(t, "image required in deployment config", ValidateConfig(config).Error)
+
+	config.Image = "nginx"
+	delete(config.Env, "API_KEY")
+	config.Secrets = map[string]string{"DB": "@DATABASE_URL"}
+	config.Labels = map[string]string{}
+	result = ValidateConfig(config)
+	assert.True(t, result.Valid)
+	assert.Empty(t, result.Missing)
+	assert.Nil(t, config.validateSecrets())
+}
+
+func TestResolveSecretValues(t *testing.T) {
+	deployment := "resolve-secrets-test"
+	assert.Nil(t, CreateSecretsCollection(deployment))
+	_, err := AddSecret(deployment, "DATABASE_URL", "postgres://db", KraneUser)
+	assert.Nil(t, err)
+
+	config := Config{
+		Name:     deployment,
+		Env:      map[string]string{"DATABASE_URL": "@DATABASE_URL", "NODE_ENV": "production"},
+		Secrets:  map[string]string{"DB": "@DATABASE_URL"},
+		Registry: Registry{URL: "docker.io", Password: "@DATABASE_URL"},
+	}
+
+	envs, err := config.DockerEnvs()
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"DATABASE_URL=postgres://db", "NODE_ENV=production", "DB=postgres://db"}, envs)
+
+	assert.Nil(t, config.ResolveRegistryCredentials())
+	assert.Equal(t, Registry{URL: "docker.io", Password: "postgres://db"}, config.Registry)
+
+	config.Registry.Username = "@MISSING"
+	assert.Error(t, config.ResolveRegistryCredentials())
+
+	// containers are never created with unresolved secret references
+	config.Env["MISSING"] = "@MISSING"
+	_, err = config.DockerEnvs()
+	assert.Error(t, err)
+
+	config.Env = map[string]string{}
+	config.Secrets["MISSING"] = "@MISSING"
+	_, err = config.DockerEnvs()
+	assert.Error(t, err)
+
+	config.Secrets = map[string]string{}
+	config.Labels = map[string]string{"db": "@MISSING"}
+	_, err = config.DockerLabels()
+	assert.Error(t, err)
+}
+
+func TestResolveSecretAlias(t *testing.T) {
+	deployment := "resolve-alias-test"
+	assert.Nil(t, CreateSecretsCollection(deployment))
+	_, err := AddSecret(deployment, "api-token", "hunter2", KraneUser)
+	assert.Nil(t, err)
+	_, err = AddSecret(deployment, "api-token", "hunter3", KraneUser)
+	assert.Nil(t, err)
+	_, err = AddSecret(deployment, "SIGNING_KEY", "signing", KraneUser)
+	assert.Nil(t, err)
+
+	config := Config{
+		Name: deployment,
+		Env: map[string]string{
+			"TOKEN":   "@API_TOKEN",
+			"PINNED":  "@API_TOKEN:1",
+			"KEY":     "@api-token",
+			"HANDLE":  "@@krane",
+			"PACKAGE": "@scope/pkg",
+			"EMAIL":   "@ krane",
+		},
+		// secrets not resolving their alias are resolved by the environment variable they are injected as
+		Secrets: map[string]string{"API_TOKEN": "", "SIGNING_KEY": "@UNKNOWN"},
+	}
+
+	assert.Empty(t, config.missingSecrets())
+	envs, err := config.DockerEnvs()
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{
+		"TOKEN=hunter3",
+		"PINNED=hunter2",
+		"KEY=hunter3",
+		"HANDLE=@krane",
+		"PACKAGE=@scope/pkg",
+		"EMAIL=@ krane",
+		"API_TOKEN=hunter3",
+		"SIGNING_KEY=signing",
+	}, envs)
+
+	// escaped literals and values which cannot be a secret alias are not secret references
+	for _, ref := range config.secretReferences() {
+		assert.NotContains(t, []string{"HANDLE", "PACKAGE", "EMAIL"}, ref.Key)
+	}
+}
+
+func TestIsSecretReference(t *testing.T) {
+	for _, value := range []string{"@API_TOKEN", "@api-token", "@API_TOKEN:2"} {
+		assert.True(t, isSecretReference(value), value)
+	}
+
+	for _, value := range []string{"", "@", "@@API_TOKEN", "@scope/pkg", "@API_TOKEN:latest", "user@example.com", "API_TOKEN"} {
+		assert.False(t, isSecretReference(value), value)
+	}
+}
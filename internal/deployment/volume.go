@@ -1,10 +1,301 @@
 package deployment
 
-import "github.com/docker/docker/api/types"
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/go-units"
+
+	"github.com/krane/krane/internal/docker"
+	"github.com/krane/krane/internal/logger"
+)
+
+// readOnlyOption is appended to a container volume path to mount a volume read-only (/data:ro)
+const readOnlyOption = "ro"
+
+var volumeNameRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
 
 type Volume struct {
+	Type            string `json:"type"`           // bind, volume or tmpfs
+	Name            string `json:"name,omitempty"` // docker volume name for named volumes
 	HostVolume      string `json:"host_volume"`
 	ContainerVolume string `json:"container_volume"`
+	ReadOnly        bool   `json:"read_only"`
+}
+
+// NamedVolume represents a named docker volume managed by Krane for a deployment
+type NamedVolume struct {
+	Name       string            `json:"name"`       // volume name in the deployment configuration
+	Deployment string            `json:"deployment"` // deployment the volume belongs to
+	Volume     string            `json:"volume"`     // docker volume name
+	Driver     string            `json:"driver"`
+	Mountpoint string            `json:"mountpoint"` // path of the volume on the host
+	Labels     map[string]string `json:"labels"`
+}
+
+// volumeMount is a parsed entry of the deployment volumes
+type volumeMount struct {
+	Source   string // host path for bind mounts, volume name for named volumes
+	Target   string
+	ReadOnly bool
+	Named    bool
+}
+
+// parseVolume parses a deployment volume. Sources starting with / are host paths bind
+// mounted into the container, other sources are named volumes. The target is the
+// container path optionally followed by :ro to mount the volume read-only.
+func parseVolume(source, target string) (volumeMount, error) {
+	v := volumeMount{Source: source, Target: target}
+
+	if i := strings.LastIndex(target, ":"); i >= 0 {
+		v.Target = target[:i]
+		switch option := target[i+1:]; option {
+		case readOnlyOption:
+			v.ReadOnly = true
+		case "rw":
+		default:
+			return volumeMount{}, fmt.Errorf("invalid volume option %s for volume %s, only ro and rw are supported", option, source)
+		}
+	}
+
+	if !path.IsAbs(v.Target) {
+		return volumeMount{}, fmt.Errorf("invalid volume %s, container path %s must be absolute", source, v.Target)
+	}
+
+	// docker only bind mounts absolute host paths
+	if strings.HasPrefix(source, ".") {
+		return volumeMount{}, fmt.Errorf("invalid volume %s, host path must be absolute", source)
+	}
+
+	v.Named = !strings.HasPrefix(source, "/")
+	if v.Named && !volumeNameRegex.MatchString(source) {
+		return volumeMount{}, fmt.Errorf("invalid volume name %s", source)
+	}
+
+	return v, nil
+}
+
+// volumeMounts returns the parsed volumes of a deployment sorted by container path
+func (config Config) volumeMounts() []volumeMount {
+	mounts := make([]volumeMount, 0)
+	for source, target := range config.Volumes {
+		v, err := parseVolume(source, target)
+		if err != nil {
+			logger.Warnf("Skipping volume for deployment %s, %v", config.Name, err)
+			continue
+		}
+		mounts = append(mounts, v)
+	}
+
+	sort.Slice(mounts, func(i, j int) bool { return mounts[i].Target < mounts[j].Target })
+	return mounts
+}
+
+// isValidVolumes returns an error if the volumes or tmpfs mounts of a deployment are not valid
+func (config Config) isValidVolumes() error {
+	targets := make(map[string]bool)
+	for source, target := range config.Volumes {
+		v, err := parseVolume(source, target)
+		if err != nil {
+			return err
+		}
+
+		if targets[v.Target] {
+			return fmt.Errorf("container path %s is mounted more than once", v.Target)
+		}
+		targets[v.Target] = true
+	}
+
+	for target, size := range config.Tmpfs {
+		if !path.IsAbs(target) {
+			return fmt.Errorf("invalid tmpfs, container path %s must be absolute", target)
+		}
+
+		if targets[target] {
+			return fmt.Errorf("container path %s is mounted more than once", target)
+		}
+		targets[target] = true
+
+		if _, err := parseMemory("tmpfs size", size); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// volumeName returns the docker volume name of a deployment named volume. Deployment
+// names cannot contain a dot so volume names of different deployments never collide.
+func volumeName(deployment, name string) string {
+	return fmt.Sprintf("%s.%s", deployment, name)
+}
+
+// ensureVolumes creates the named volumes of a deployment which do not exist yet.
+// Named volumes are never removed with the containers of a deployment, the data
+// they hold is kept across deployment runs.
+func ensureVolumes(ctx context.Context, config Config) error {
+	client := docker.GetClient()
+	for _, v := range config.volumeMounts() {
+		if !v.Named {
+			continue
+		}
+
+		name := volumeName(config.Name, v.Source)
+		if _, err := client.GetVolume(ctx, name); err == nil {
+			continue
+		}
+
+		logger.Debugf("Creating volume %s for deployment %s", name, config.Name)
+		if _, err := client.CreateVolume(ctx, name, map[string]string{
+			docker.ContainerDeploymentLabel: config.Name,
+			docker.VolumeNameLabel:          v.Source,
+		}); err != nil {
+			logger.Errorf("unable to create volume %v", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// GetVolumes returns the named volumes of a deployment
+func GetVolumes(ctx context.Context, deployment string) ([]NamedVolume, error) {
+	dockerVolumes, err := docker.GetClient().GetVolumesByLabel(ctx, docker.ContainerDeploymentLabel, deployment)
+	if err != nil {
+		return make([]NamedVolume, 0), err
+	}
+
+	volumes := make([]NamedVolume, 0)
+	for _, v := range dockerVolumes {
+		volumes = append(volumes, fromDockerVolumeToNamedVolume(*v))
+	}
+
+	sort.Slice(volumes, func(i, j int) bool { return volumes[i].Name < volumes[j].Name })
+	return volumes, nil
+}
+
+// GetVolume returns a named volume of a deployment
+func GetVolume(ctx context.Context, deployment, name string) (NamedVolume, error) {
+	v, err := docker.GetClient().GetVolume(ctx, volumeName(deployment, name))
+	if err != nil || v.Labels[docker.ContainerDeploymentLabel] != deployment {
+		return NamedVolume{}, fmt.Errorf("volume %s not found for deployment %s", name, deployment)
+	}
+	return fromDockerVolumeToNamedVolume(v), nil
+}
+
+// BackupVolume returns a tar archive of the content of a deployment named volume.
+// The archive is created using the deployment image which must be available on the host.
+func BackupVolume(ctx context.Context, deployment, name string) (io.ReadCloser, error) {
+	v, err := GetVolume(ctx, deployment, name)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := GetDeploymentConfig(deployment)
+	if err != nil {
+		return nil, err
+	}
+
+	image := fmt.Sprintf("%s/%s:%s", config.Registry.URL, config.Image, config.Tag)
+	return docker.GetClient().ExportVolume(ctx, v.Volume, image)
+}
+
+// DeleteVolumes removes the named volumes of a deployment
+func DeleteVolumes(ctx context.Context, deployment string) error {
+	volumes, err := GetVolumes(ctx, deployment)
+	if err != nil {
+		return err
+	}
+
+	for _, v := range volumes {
+		if err := DeleteVolume(ctx, deployment, v.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteVolume removes a named volume of a deployment, volumes in use by a container are not removed
+func DeleteVolume(ctx context.Context, deployment, name string) error {
+	v, err := GetVolume(ctx, deployment, name)
+	if err != nil {
+		return err
+	}
+
+	if err := docker.GetClient().RemoveVolume(ctx, v.Volume); err != nil {
+		logger.Errorf("unable to remove volume %v", err)
+		return err
+	}
+
+	logger.Debugf("Volume %s for deployment %s removed", v.Volume, deployment)
+	return nil
+}
+
+// DockerVolumeMount returns a list of formatted Docker volume mounts
+func (config Config) DockerVolumeMount() []mount.Mount {
+	volumes := make([]mount.Mount, 0)
+	for _, v := range config.volumeMounts() {
+		if v.Named {
+			volumes = append(volumes, mount.Mount{
+				Type:     mount.TypeVolume,
+				Source:   volumeName(config.Name, v.Source),
+				Target:   v.Target,
+				ReadOnly: v.ReadOnly,
+			})
+			continue
+		}
+
+		volumes = append(volumes, mount.Mount{
+			Type:     mount.TypeBind,
+			Source:   v.Source,
+			Target:   v.Target,
+			ReadOnly: v.ReadOnly,
+		})
+	}
+
+	targets := make([]string, 0, len(config.Tmpfs))
+	for target := range config.Tmpfs {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+
+	for _, target := range targets {
+		sizeBytes, _ := units.RAMInBytes(config.Tmpfs[target])
+		volumes = append(volumes, mount.Mount{
+			Type:         mount.TypeTmpfs,
+			Target:       target,
+			TmpfsOptions: &mount.TmpfsOptions{SizeBytes: sizeBytes},
+		})
+	}
+
+	return volumes
+}
+
+// DockerVolumeSet returns a set of Docker formatted volumes
+func (config Config) DockerVolumeSet() map[string]struct{} {
+	volumes := make(map[string]struct{}, 0)
+	for _, v := range config.volumeMounts() {
+		volumes[v.Target] = struct{}{}
+	}
+	return volumes
+}
+
+// fromDockerVolumeToNamedVolume converts a docker volume into a deployment named volume
+func fromDockerVolumeToNamedVolume(v types.Volume) NamedVolume {
+	return NamedVolume{
+		Name:       v.Labels[docker.VolumeNameLabel],
+		Deployment: v.Labels[docker.ContainerDeploymentLabel],
+		Volume:     v.Name,
+		Driver:     v.Driver,
+		Mountpoint: v.Mountpoint,
+		Labels:     v.Labels,
+	}
 }
 
 // fromMountPointToVolumeList converts a list of volume MountPoints into a list of formatted Krane Volumes
@@ -12,8 +303,11 @@ func fromMountPointToVolumeList(mounts []types.MountPoint) []Volume {
 	volumes := make([]Volume, 0)
 	for _, m := range mounts {
 		volumes = append(volumes, Volume{
+			Type:            string(m.Type),
+			Name:            m.Name,
 			HostVolume:      m.Source,
 			ContainerVolume: m.Destination,
+			ReadOnly:        !m.RW,
 		})
 	}
 	return volumes
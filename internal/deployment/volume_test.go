@@ -0,0 +1,71 @@
+package deployment
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types/mount"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseVolume(t *testing.T) {
+	bind, err := parseVolume("/host/path", "/container/path")
+	assert.Nil(t, err)
+	assert.Equal(t, volumeMount{Source: "/host/path", Target: "/container/path"}, bind)
+
+	named, err := parseVolume("pgdata", "/var/lib/postgresql/data")
+	assert.Nil(t, err)
+	assert.True(t, named.Named)
+
+	readOnly, err := parseVolume("/etc/ssl/certs", "/certs:ro")
+	assert.Nil(t, err)
+	assert.Equal(t, volumeMount{Source: "/etc/ssl/certs", Target: "/certs", ReadOnly: true}, readOnly)
+
+	_, err = parseVolume("./certs", "/certs")
+	assert.Error(t, err)
+
+	_, err = parseVolume("pgdata", "/data:rx")
+	assert.Error(t, err)
+
+	_, err = parseVolume("pgdata", "data")
+	assert.Error(t, err)
+
+	_, err = parseVolume("pg data", "/data")
+	assert.Error(t, err)
+}
+
+func TestInvalidVolumes(t *testing.T) {
+	assert.Error(t, Config{Volumes: map[string]string{"a": "/data", "b": "/data:ro"}}.isValidVolumes())
+	assert.Error(t, Config{Volumes: map[string]string{"a": "/data"}, Tmpfs: map[string]string{"/data": ""}}.isValidVolumes())
+	assert.Error(t, Config{Tmpfs: map[string]string{"tmp": ""}}.isValidVolumes())
+	assert.Error(t, Config{Tmpfs: map[string]string{"/tmp": "large"}}.isValidVolumes())
+
+	assert.Nil(t, Config{
+		Volumes: map[string]string{"/var/run/docker.sock": "/var/run/docker.sock", "pgdata": "/data:ro"},
+		Tmpfs:   map[string]string{"/tmp": "64m", "/run": ""},
+	}.isValidVolumes())
+}
+
+func TestVolumeName(t *testing.T) {
+	// deployment names cannot contain the separator, my_app's data and my's app_data never collide
+	assert.NotEqual(t, volumeName("my_app", "data"), volumeName("my", "app_data"))
+	assert.Equal(t, "my_app.data", volumeName("my_app", "data"))
+}
+
+func TestDockerVolumeMount(t *testing.T) {
+	config := Config{
+		Name:    "postgres",
+		Volumes: map[string]string{"/etc/ssl/certs": "/certs:ro", "pgdata": "/var/lib/postgresql/data"},
+		Tmpfs:   map[string]string{"/tmp": "64m"},
+	}
+
+	assert.Equal(t, []mount.Mount{
+		{Type: mount.TypeBind, Source: "/etc/ssl/certs", Target: "/certs", ReadOnly: true},
+		{Type: mount.TypeVolume, Source: "postgres.pgdata", Target: "/var/lib/postgresql/data"},
+		{Type: mount.TypeTmpfs, Target: "/tmp", TmpfsOptions: &mount.TmpfsOptions{SizeBytes: 64 * 1024 * 1024}},
+	}, config.DockerVolumeMount())
+
+	assert.Equal(t, map[string]struct{}{
+		"/certs":                   {},
+		"/var/lib/postgresql/data": {},
+	}, config.DockerVolumeSet())
+}
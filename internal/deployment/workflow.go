@@ -0,0 +1,142 @@
+package deployment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/krane/krane/internal/constants"
+	"github.com/krane/krane/internal/job"
+	"github.com/krane/krane/internal/logger"
+	"github.com/krane/krane/internal/utils"
+)
+
+// Steps of the workflows used to replace the containers of a deployment
+const (
+	PullStep          = "pull"
+	CreateStep        = "create"
+	StartStep         = "start"
+	HealthStep        = "health"
+	TeardownStep      = "teardown"
+	RollingUpdateStep = "rolling_update"
+	SwitchStep        = "switch"
+)
+
+// pullImageAttempts is how many times pulling an image is attempted before a deployment fails
+const pullImageAttempts = 3
+
+// deployWorkflow returns the workflow replacing the current containers of a deployment using its strategy
+func deployWorkflow(config Config, revision int, old []KraneContainer, e *EventEmitter, tracker *job.Tracker) job.Workflow {
+	if config.Strategy.Type == BlueGreenStrategy {
+		return blueGreenWorkflow(config, revision, old, e, tracker)
+	}
+
+	if config.Strategy.Type != RollingStrategy {
+		return replaceContainersWorkflow(config, config.Scale, old, e, tracker)
+	}
+
+	// rolling updates create, start, health check and remove containers batch by batch
+	wf := job.NewWorkflow(config.Name, tracker)
+	wf.With(PullStep, pullImageStep(config, e), job.Retry(job.NewRetryPolicy(pullImageAttempts)))
+	wf.With(RollingUpdateStep, func(ctx context.Context, _ interface{}) error {
+		return deployRolling(ctx, config, old, e, tracker)
+	}, job.DependsOn(PullStep))
+	return wf
+}
+
+// replaceContainersWorkflow returns the workflow pulling the image for a deployment, creating, starting
+// and health checking n new containers then removing the old containers (pull → create → start → health → teardown).
+// The new containers are removed if any step fails, healthy containers are only kept when removing
+// the old containers fails. Steps added after the teardown (ie. switching blue/green colors) remove them.
+func replaceContainersWorkflow(config Config, n int, old []KraneContainer, e *EventEmitter, tracker *job.Tracker) job.Workflow {
+	containers := make([]KraneContainer, 0)
+	keep := false
+
+	wf := job.NewWorkflow(config.Name, tracker)
+	wf.With(PullStep, pullImageStep(config, e), job.Retry(job.NewRetryPolicy(pullImageAttempts)))
+
+	wf.With(CreateStep, func(ctx context.Context, _ interface{}) error {
+		e.Phase = CreateContainerPhase
+
+		// containers created by a previous attempt are kept
+		created, err := createContainers(ctx, config, n-len(containers))
+		containers = append(containers, created...)
+		if err != nil {
+			return err
+		}
+
+		logger.Debugf("%d/%d container(s) for deployment %s created", len(containers), n, config.Name)
+		return nil
+	}, job.DependsOn(PullStep), job.Undo(func(ctx context.Context, _ interface{}) error {
+		if keep {
+			logger.Debugf("Keeping %d healthy container(s) for deployment %s", len(containers), config.Name)
+			return nil
+		}
+
+		logger.Debugf("Removing %d container(s) created for deployment %s", len(containers), config.Name)
+		return removeContainers(ctx, containers)
+	}))
+
+	wf.With(StartStep, func(ctx context.Context, _ interface{}) error {
+		e.Phase = StartContainerPhase
+		if err := startContainers(ctx, containers); err != nil {
+			return err
+		}
+
+		logger.Debugf("%d container(s) for deployment %s started", len(containers), config.Name)
+		return nil
+	}, job.DependsOn(CreateStep))
+
+	wf.With(HealthStep, func(ctx context.Context, _ interface{}) error {
+		e.Phase = HealthCheckPhase
+		if err := RetriableContainersHealthCheck(ctx, containers, config.HealthCheck); err != nil {
+			logger.Errorf("containers did not pass health check %v", err)
+			return err
+		}
+
+		logger.Debugf("Deployment %s health check complete", config.Name)
+		tracker.Track(string(HealthCheckPhase), fmt.Sprintf("%d container(s) healthy", len(containers)))
+		return nil
+	}, job.DependsOn(StartStep))
+
+	wf.With(TeardownStep, func(ctx context.Context, _ interface{}) error {
+		e.Phase = TeardownPhase
+		if err := removeContainers(ctx, old); err != nil {
+			keep = true
+			return err
+		}
+		return nil
+	}, job.DependsOn(HealthStep))
+
+	return wf
+}
+
+// pullImageStep returns the workflow step pulling the image for a deployment
+func pullImageStep(config Config, e *EventEmitter) job.GenericHandler {
+	return func(ctx context.Context, _ interface{}) error {
+		if err := pullImage(ctx, config, e); err != nil {
+			return pullImageError{err}
+		}
+		return nil
+	}
+}
+
+// pullImageError is an error pulling the image of a deployment from the pull step
+type pullImageError struct {
+	err error
+}
+
+func (e pullImageError) Error() string { return e.err.Error() }
+
+func (e pullImageError) Unwrap() error { return e.err }
+
+// retryPolicy returns the retry policy of deployment jobs. The pull step already retries pulling the image,
+// jobs failing to pull the image are not attempted again so an image is pulled at most pullImageAttempts times.
+func retryPolicy() job.RetryPolicy {
+	policy := job.NewRetryPolicy(utils.UIntEnv(constants.EnvDeploymentRetryPolicy))
+	policy.Retryable = func(err error) bool {
+		var pullErr pullImageError
+		return !errors.As(err, &pullErr)
+	}
+	return policy
+}
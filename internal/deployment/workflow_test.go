@@ -0,0 +1,18 @@
+package deployment
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicyDoesNotRetryImagePulls(t *testing.T) {
+	policy := retryPolicy()
+
+	err := pullImageError{errors.New("manifest unknown")}
+	assert.False(t, policy.Retryable(err))
+	assert.False(t, policy.Retryable(fmt.Errorf("deployment failed: %w", err)))
+	assert.True(t, policy.Retryable(errors.New("container is not healthy")))
+}
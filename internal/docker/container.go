@@ -3,6 +3,7 @@ package docker
 import (
 	"bufio"
 	"context"
+	"os"
 	"sync"
 	"time"
 
@@ -15,6 +16,9 @@ import (
 
 const ContainerDeploymentLabel = "krane.deployment"
 
+// ContainerColorLabel is the color (blue or green) of the containers of blue/green deployments
+const ContainerColorLabel = "krane.deployment.color"
+
 // DockerConfig properties required to create a docker container
 type DockerConfig struct {
 	ContainerName string
@@ -25,6 +29,8 @@ type DockerConfig struct {
 	PortSet       nat.PortSet
 	VolumeMounts  []mount.Mount
 	VolumeSet     map[string]struct{}
+	Resources     container.Resources
+	RestartPolicy container.RestartPolicy
 	Aliases       []string
 	Env           []string // Comma separated, formatted NODE_ENV=dev
 	Command       []string
@@ -34,7 +40,7 @@ type DockerConfig struct {
 // CreateContainer creates a docker container from a docker config
 func (c *Client) CreateContainer(ctx context.Context, config DockerConfig) (container.ContainerCreateCreatedBody, error) {
 	networkingConfig := createNetworkingConfig(config.NetworkID, config.Aliases)
-	hostConfig := createHostConfig(config.Ports, config.VolumeMounts)
+	hostConfig := createHostConfig(config.Ports, config.VolumeMounts, config.Resources, config.RestartPolicy)
 	containerConfig := createContainerConfig(config.ContainerName,
 		config.Image,
 		config.Env,
@@ -65,7 +71,7 @@ func (c *Client) StopContainer(ctx context.Context, containerID string) error {
 	return c.ContainerStop(ctx, containerID, &timeout)
 }
 
-// RemoveContainer removes a docker container
+// RemoveContainer removes a docker container and its anonymous volumes, named volumes are kept
 func (c *Client) RemoveContainer(ctx context.Context, containerID string, force bool) error {
 	options := types.ContainerRemoveOptions{
 		RemoveVolumes: true,
@@ -79,21 +85,51 @@ func (c *Client) GetOneContainer(ctx context.Context, containerId string) (types
 	return c.ContainerInspect(ctx, containerId)
 }
 
+// ExecContainer runs a command inside a running container and returns the exit code of the command
+func (c *Client) ExecContainer(ctx context.Context, containerID string, cmd []string) (int, error) {
+	exec, err := c.ContainerExecCreate(ctx, containerID, types.ExecConfig{Cmd: cmd, Detach: true})
+	if err != nil {
+		return -1, err
+	}
+
+	if err := c.ContainerExecStart(ctx, exec.ID, types.ExecStartCheck{Detach: true}); err != nil {
+		return -1, err
+	}
+
+	// poll until the command exits or the context is done
+	for {
+		inspect, err := c.ContainerExecInspect(ctx, exec.ID)
+		if err != nil {
+			return -1, err
+		}
+
+		if !inspect.Running {
+			return inspect.ExitCode, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return -1, ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
 // GetKraneContainers : gets all containers on the host machine
-func (c *Client) GetAllContainers(ctx *context.Context) ([]types.ContainerJSON, error) {
+func (c *Client) GetAllContainers(ctx context.Context) ([]types.ContainerJSON, error) {
 	options := types.ContainerListOptions{
 		All:   true,
 		Quiet: false,
 	}
 
-	containers, err := c.ContainerList(*ctx, options)
+	containers, err := c.ContainerList(ctx, options)
 	if err != nil {
 		return make([]types.ContainerJSON, 0), err
 	}
 
 	toJsonContainers := make([]types.ContainerJSON, 0)
 	for _, cc := range containers {
-		containerJson, err := c.GetOneContainer(*ctx, cc.ID)
+		containerJson, err := c.GetOneContainer(ctx, cc.ID)
 		if err != nil {
 			return make([]types.ContainerJSON, 0), err
 		}
@@ -165,10 +201,25 @@ func (c *Client) StreamContainerLogs(containerID string, out chan []byte, done c
 	return nil
 }
 
+// Self returns the container Krane is running in. Docker sets the hostname of a container to its id,
+// returns false when no container matches the hostname since Krane is running directly on the docker host.
+func (c *Client) Self(ctx context.Context) (types.ContainerJSON, bool) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return types.ContainerJSON{}, false
+	}
+
+	self, err := c.ContainerInspect(ctx, hostname)
+	if err != nil {
+		return types.ContainerJSON{}, false
+	}
+	return self, true
+}
+
 // ConnectContainerToNetwork connects a container to a docker network
-func (c *Client) ConnectContainerToNetwork(ctx *context.Context, networkID string, containerID string) (err error) {
+func (c *Client) ConnectContainerToNetwork(ctx context.Context, networkID string, containerID string) (err error) {
 	config := network.EndpointSettings{NetworkID: networkID}
-	return c.NetworkConnect(*ctx, networkID, containerID, &config)
+	return c.NetworkConnect(ctx, networkID, containerID, &config)
 }
 
 // createHostConfig returns the entire container config required to create a Docker container
@@ -202,10 +253,12 @@ func createContainerConfig(
 }
 
 // createHostConfig returns the host config for a Docker container
-func createHostConfig(ports nat.PortMap, volumes []mount.Mount) container.HostConfig {
+func createHostConfig(ports nat.PortMap, volumes []mount.Mount, resources container.Resources, restartPolicy container.RestartPolicy) container.HostConfig {
 	return container.HostConfig{
-		PortBindings: ports,
-		AutoRemove:   false,
-		Mounts:       volumes,
+		PortBindings:  ports,
+		AutoRemove:    false,
+		Mounts:        volumes,
+		Resources:     resources,
+		RestartPolicy: restartPolicy,
 	}
 }
@@ -9,10 +9,7 @@ import (
 )
 
 // PullImage pulls a container image from a registry onto the host machine
-func (c *Client) PullImage(image string, tag string, registry RegistryCredentials) (io.Reader, error) {
-	ctx := context.Background()
-	defer ctx.Done()
-
+func (c *Client) PullImage(ctx context.Context, image string, tag string, registry RegistryCredentials) (io.Reader, error) {
 	ref := createImageRef(registry.URL, image, tag)
 	return c.ImagePull(ctx, ref, types.ImagePullOptions{
 		All:          false,
@@ -21,12 +18,12 @@ func (c *Client) PullImage(image string, tag string, registry RegistryCredential
 }
 
 // RemoveImage removes a docker image from the host machine
-func (c *Client) RemoveImage(ctx *context.Context, imageID string) ([]types.ImageDelete, error) {
+func (c *Client) RemoveImage(ctx context.Context, imageID string) ([]types.ImageDelete, error) {
 	options := types.ImageRemoveOptions{
 		Force:         true,
 		PruneChildren: true,
 	}
-	return c.ImageRemove(*ctx, imageID, options)
+	return c.ImageRemove(ctx, imageID, options)
 }
 
 // createImageRef returns a formatted docker image url
@@ -36,3 +33,10 @@ func createImageRef(registry, image, tag string) string {
 	}
 	return fmt.Sprintf("%s/%s:%s", registry, image, tag)
 }
+
+// GetImage returns the image pulled onto the host machine for a registry, image and tag
+func (c *Client) GetImage(ctx context.Context, registryURL, image, tag string) (types.ImageInspect, error) {
+	ref := createImageRef(registryURL, image, tag)
+	img, _, err := c.ImageInspectWithRaw(ctx, ref)
+	return img, err
+}
@@ -18,31 +18,52 @@ func EnsureKraneDockerNetwork() {
 	ctx := context.Background()
 	defer ctx.Done()
 
-	_, err := instance.CreateBridgeNetwork(&ctx, KraneNetworkName)
+	n, err := instance.CreateBridgeNetwork(ctx, KraneNetworkName)
 	if err != nil {
 		logger.Fatalf("Unable to create Krane network, %v", err)
 	}
+
+	// health check probes dial containers on the Krane network
+	if err := instance.connectSelfToNetwork(ctx, n.ID); err != nil {
+		logger.Fatalf("Unable to connect Krane to the Krane network, %v", err)
+	}
+}
+
+// connectSelfToNetwork connects the container Krane is running in to a docker network,
+// Krane running directly on the docker host can already reach bridge networks
+func (c *Client) connectSelfToNetwork(ctx context.Context, networkID string) error {
+	self, ok := c.Self(ctx)
+	if !ok {
+		logger.Debugf("Krane is not running in a container, skipping connecting to %s network", KraneNetworkName)
+		return nil
+	}
+
+	if self.NetworkSettings != nil {
+		if _, ok := self.NetworkSettings.Networks[KraneNetworkName]; ok {
+			return nil
+		}
+	}
+
+	logger.Infof("Connecting Krane to %s network", KraneNetworkName)
+	return c.ConnectContainerToNetwork(ctx, networkID, self.ID)
 }
 
 // CreateBridgeNetwork creates a docker bridge network
-func (c *Client) CreateBridgeNetwork(ctx *context.Context, name string) (types.NetworkCreateResponse, error) {
-	n, _ := c.GetNetworkByName(name)
+func (c *Client) CreateBridgeNetwork(ctx context.Context, name string) (types.NetworkCreateResponse, error) {
+	n, _ := c.GetNetworkByName(ctx, name)
 
 	if n.ID != "" {
 		return types.NetworkCreateResponse{ID: n.ID}, nil
 	}
 
-	return c.NetworkCreate(*ctx, name, types.NetworkCreate{
+	return c.NetworkCreate(ctx, name, types.NetworkCreate{
 		Driver:         "bridge",
 		CheckDuplicate: true,
 	})
 }
 
 // GetNetworkByName returns the network (if it exist) from the docker host
-func (c *Client) GetNetworkByName(name string) (types.NetworkResource, error) {
-	ctx := context.Background()
-	defer ctx.Done()
-
+func (c *Client) GetNetworkByName(ctx context.Context, name string) (types.NetworkResource, error) {
 	networks, err := c.NetworkList(ctx, types.NetworkListOptions{})
 	if err != nil {
 		return types.NetworkResource{}, err
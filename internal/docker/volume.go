@@ -0,0 +1,94 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/mount"
+	volumetypes "github.com/docker/docker/api/types/volume"
+)
+
+const VolumeNameLabel = "krane.volume"
+
+// CreateVolume creates a named docker volume using the local driver
+func (c *Client) CreateVolume(ctx context.Context, name string, labels map[string]string) (types.Volume, error) {
+	return c.VolumeCreate(ctx, volumetypes.VolumesCreateBody{
+		Name:       name,
+		Driver:     "local",
+		DriverOpts: map[string]string{},
+		Labels:     labels,
+	})
+}
+
+// GetVolume returns a docker volume if it exists
+func (c *Client) GetVolume(ctx context.Context, name string) (types.Volume, error) {
+	return c.VolumeInspect(ctx, name)
+}
+
+// GetVolumesByLabel returns the docker volumes with a label set to a value
+func (c *Client) GetVolumesByLabel(ctx context.Context, label, value string) ([]*types.Volume, error) {
+	args := filters.NewArgs()
+	args.Add("label", fmt.Sprintf("%s=%s", label, value))
+
+	body, err := c.VolumeList(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	return body.Volumes, nil
+}
+
+// RemoveVolume removes a docker volume, volumes in use by a container are not removed
+func (c *Client) RemoveVolume(ctx context.Context, name string) error {
+	return c.VolumeRemove(ctx, name, false)
+}
+
+// ExportVolume returns a tar archive of the content of a docker volume. The volume is mounted
+// read-only into a container created (but never started) from an image already available on
+// the host, the container is removed once the archive is closed.
+func (c *Client) ExportVolume(ctx context.Context, name, image string) (io.ReadCloser, error) {
+	target := fmt.Sprintf("/%s", name)
+	body, err := c.ContainerCreate(
+		ctx,
+		&container.Config{Image: image},
+		&container.HostConfig{Mounts: []mount.Mount{{
+			Type:     mount.TypeVolume,
+			Source:   name,
+			Target:   target,
+			ReadOnly: true,
+		}}},
+		nil,
+		"",
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	archive, _, err := c.CopyFromContainer(ctx, body.ID, target)
+	if err != nil {
+		_ = c.RemoveContainer(context.Background(), body.ID, true)
+		return nil, err
+	}
+
+	return &volumeArchive{ReadCloser: archive, remove: func() error {
+		return c.RemoveContainer(context.Background(), body.ID, true)
+	}}, nil
+}
+
+// volumeArchive is a volume tar archive removing the container used to export the volume once closed
+type volumeArchive struct {
+	io.ReadCloser
+	remove func() error
+}
+
+// Close closes the archive and removes the container used to export the volume
+func (a *volumeArchive) Close() error {
+	err := a.ReadCloser.Close()
+	if rmErr := a.remove(); rmErr != nil {
+		return rmErr
+	}
+	return err
+}
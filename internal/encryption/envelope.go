@@ -0,0 +1,124 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+)
+
+// envelopeVersion is the version of the envelope format
+const envelopeVersion = 1
+
+// Envelope is a value encrypted with its own data key, the data key is encrypted with a master key.
+// Both are encrypted with AES-256-GCM, nonces are prepended to the encrypted bytes.
+type Envelope struct {
+	Version    int    `json:"version"`
+	KeyID      string `json:"key_id"`     // id of the master key the data key is wrapped with
+	DataKey    []byte `json:"data_key"`   // data key encrypted with the master key
+	Ciphertext []byte `json:"ciphertext"` // value encrypted with the data key
+}
+
+// Encrypt encrypts a value with a new data key wrapped by the master key. The additional data is
+// authenticated but not encrypted, it must be the same when decrypting (ie. where the value is stored).
+func Encrypt(plaintext, additionalData []byte) (Envelope, error) {
+	keyring.RLock()
+	master := keyring.primary
+	keyring.RUnlock()
+
+	if len(master.bytes) == 0 {
+		return Envelope{}, errors.New("secrets master key not configured")
+	}
+
+	dataKey, err := randomBytes(keySize)
+	if err != nil {
+		return Envelope{}, err
+	}
+
+	ciphertext, err := seal(dataKey, plaintext, additionalData)
+	if err != nil {
+		return Envelope{}, err
+	}
+
+	wrapped, err := seal(master.bytes, dataKey, []byte(master.ID))
+	if err != nil {
+		return Envelope{}, err
+	}
+
+	return Envelope{
+		Version:    envelopeVersion,
+		KeyID:      master.ID,
+		DataKey:    wrapped,
+		Ciphertext: ciphertext,
+	}, nil
+}
+
+// Decrypt unwraps the data key of an envelope with the master key it was wrapped by and decrypts the value
+func Decrypt(e Envelope, additionalData []byte) ([]byte, error) {
+	if e.Version != envelopeVersion {
+		return nil, fmt.Errorf("unsupported envelope version %d", e.Version)
+	}
+
+	keyring.RLock()
+	master, ok := keyring.keys[e.KeyID]
+	keyring.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("master key %s not found", e.KeyID)
+	}
+
+	dataKey, err := open(master.bytes, e.DataKey, []byte(master.ID))
+	if err != nil {
+		return nil, fmt.Errorf("unable to unwrap data key, %v", err)
+	}
+
+	plaintext, err := open(dataKey, e.Ciphertext, additionalData)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt value, %v", err)
+	}
+	return plaintext, nil
+}
+
+// Primary returns true if an envelope is wrapped with the master key new values are encrypted with
+func (e Envelope) Primary() bool {
+	keyring.RLock()
+	defer keyring.RUnlock()
+	return e.KeyID == keyring.primary.ID
+}
+
+// seal encrypts and authenticates bytes with AES-GCM returning the nonce followed by the ciphertext
+func seal(key, plaintext, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, err := randomBytes(gcm.NonceSize())
+	if err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// open authenticates and decrypts bytes sealed with AES-GCM
+func open(key, sealed, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, additionalData)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,176 @@
+package encryption
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/krane/krane/internal/constants"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	key, err := NewKey()
+	assert.Nil(t, err)
+	SetKeys(key)
+
+	e, err := Encrypt([]byte("biensupernice"), []byte("krane-secrets/token"))
+	assert.Nil(t, err)
+	assert.Equal(t, key.ID, e.KeyID)
+	assert.True(t, e.Primary())
+	assert.NotContains(t, string(e.Ciphertext), "biensupernice")
+
+	plaintext, err := Decrypt(e, []byte("krane-secrets/token"))
+	assert.Nil(t, err)
+	assert.Equal(t, "biensupernice", string(plaintext))
+
+	// every value is encrypted with its own data key
+	other, err := Encrypt([]byte("biensupernice"), []byte("krane-secrets/token"))
+	assert.Nil(t, err)
+	assert.NotEqual(t, e.DataKey, other.DataKey)
+	assert.NotEqual(t, e.Ciphertext, other.Ciphertext)
+}
+
+func TestDecryptFailsWhenTampered(t *testing.T) {
+	key, _ := NewKey()
+	SetKeys(key)
+
+	e, err := Encrypt([]byte("biensupernice"), []byte("krane-secrets/token"))
+	assert.Nil(t, err)
+
+	// values are bound to where they are stored
+	_, err = Decrypt(e, []byte("krane-secrets/password"))
+	assert.Error(t, err)
+
+	tampered := e
+	tampered.Ciphertext = append([]byte{}, e.Ciphertext...)
+	tampered.Ciphertext[len(tampered.Ciphertext)-1] ^= 1
+	_, err = Decrypt(tampered, []byte("krane-secrets/token"))
+	assert.Error(t, err)
+
+	tampered = e
+	tampered.Version = 2
+	_, err = Decrypt(tampered, []byte("krane-secrets/token"))
+	assert.Error(t, err)
+}
+
+func TestDecryptWithRotatedKey(t *testing.T) {
+	old, _ := NewKey()
+	SetKeys(old)
+
+	e, err := Encrypt([]byte("biensupernice"), nil)
+	assert.Nil(t, err)
+
+	next, _ := NewKey()
+	SetKeys(next, old)
+	assert.False(t, e.Primary())
+
+	plaintext, err := Decrypt(e, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "biensupernice", string(plaintext))
+
+	rotated, err := Encrypt(plaintext, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, next.ID, rotated.KeyID)
+
+	// once the old key is dropped, values it wrapped cannot be decrypted
+	SetKeys(next)
+	_, err = Decrypt(e, nil)
+	assert.Error(t, err)
+	_, err = Decrypt(rotated, nil)
+	assert.Nil(t, err)
+}
+
+func TestParseKey(t *testing.T) {
+	key, _ := NewKey()
+	parsed, err := ParseKey(key.String() + "\n")
+	assert.Nil(t, err)
+	assert.Equal(t, key.ID, parsed.ID)
+
+	_, err = ParseKey("not base64!")
+	assert.Error(t, err)
+
+	_, err = ParseKey("c2hvcnQ=")
+	assert.Error(t, err)
+}
+
+func TestLoadKeyGeneratesKeyFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "krane-key")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "krane.key")
+	os.Setenv(constants.EnvSecretsKeyFile, path)
+	defer os.Unsetenv(constants.EnvSecretsKeyFile)
+
+	key, err := LoadKey()
+	assert.Nil(t, err)
+
+	info, err := os.Stat(path)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	loaded, err := LoadKey()
+	assert.Nil(t, err)
+	assert.Equal(t, key.ID, loaded.ID)
+
+	// the environment takes precedence over the key file
+	env, _ := NewKey()
+	os.Setenv(constants.EnvSecretsMasterKey, env.String())
+	defer os.Unsetenv(constants.EnvSecretsMasterKey)
+
+	loaded, err = LoadKey()
+	assert.Nil(t, err)
+	assert.Equal(t, env.ID, loaded.ID)
+}
+
+func TestLoadKeyDefaultsKeyFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "krane-key")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	os.Unsetenv(constants.EnvSecretsMasterKey)
+	os.Unsetenv(constants.EnvSecretsKeyFile)
+	defer os.Setenv(constants.EnvDatabasePath, os.Getenv(constants.EnvDatabasePath))
+	os.Setenv(constants.EnvDatabasePath, filepath.Join(dir, "krane.db"))
+
+	path := filepath.Join(dir, "krane.key")
+	assert.Equal(t, path, KeyFilePath())
+	assert.Equal(t, path+".new", PendingKeyPath())
+
+	key, err := LoadKey()
+	assert.Nil(t, err)
+
+	info, err := os.Stat(path)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	loaded, err := ReadKeyFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, key.ID, loaded.ID)
+}
+
+func TestPreviousKey(t *testing.T) {
+	_, ok, err := PreviousKey()
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	previous, _ := NewKey()
+	os.Setenv(constants.EnvSecretsPreviousKey, previous.String())
+	defer os.Unsetenv(constants.EnvSecretsPreviousKey)
+
+	key, ok, err := PreviousKey()
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, previous.ID, key.ID)
+
+	current, _ := NewKey()
+	SetKeys(current, key)
+	assert.True(t, HasKey(previous.ID))
+	assert.True(t, HasKey(current.ID))
+
+	SetKeys(current)
+	assert.False(t, HasKey(previous.ID))
+}
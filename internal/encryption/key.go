@@ -0,0 +1,209 @@
+package encryption
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/krane/krane/internal/constants"
+	"github.com/krane/krane/internal/logger"
+)
+
+// keySize is the size of master and data keys, AES-256 keys are used
+const keySize = 32
+
+// defaultKeyFileName is the name of the master key file generated when no key is configured
+const defaultKeyFileName = "krane.key"
+
+// RotateCommand is the krane command re-encrypting every secret with a new master key
+const RotateCommand = "rotate-secrets-key"
+
+// Key is a master key wrapping the data keys secrets are encrypted with
+type Key struct {
+	ID    string // fingerprint of the key stored alongside the data keys it wraps
+	bytes []byte
+}
+
+// NewKey returns a random master key
+func NewKey() (Key, error) {
+	b, err := randomBytes(keySize)
+	if err != nil {
+		return Key{}, err
+	}
+	return newKey(b), nil
+}
+
+// ParseKey returns a master key from its base64 encoding
+func ParseKey(encoded string) (Key, error) {
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return Key{}, errors.New("master key must be base64 encoded")
+	}
+
+	if len(b) != keySize {
+		return Key{}, fmt.Errorf("master key must be %d bytes, got %d bytes", keySize, len(b))
+	}
+	return newKey(b), nil
+}
+
+// String returns the base64 encoding of the key
+func (k Key) String() string { return base64.StdEncoding.EncodeToString(k.bytes) }
+
+func newKey(b []byte) Key {
+	sum := sha256.Sum256(b)
+	return Key{ID: hex.EncodeToString(sum[:8]), bytes: b}
+}
+
+// keyring holds the master key new data keys are wrapped with, and every master key data keys can be unwrapped with
+var keyring = struct {
+	sync.RWMutex
+	primary Key
+	keys    map[string]Key
+}{keys: make(map[string]Key)}
+
+// Configure loads the master key from the environment or the key file, the key file is generated in the
+// directory of the db when neither is set. Keys left by an interrupted rotation (the previous master key set in the environment, or
+// the pending key file) are only used to unwrap data keys.
+func Configure() {
+	key, err := LoadKey()
+	if err != nil {
+		logger.Fatalf("Unable to load secrets master key, %v", err)
+		return
+	}
+
+	keys := make([]Key, 0)
+	if os.Getenv(constants.EnvSecretsMasterKey) == "" {
+		// a key left by an interrupted rotation still unwraps the data keys it re-encrypted
+		if pending, err := ReadKeyFile(PendingKeyPath()); err == nil {
+			logger.Warnf("Secrets master key rotation was interrupted, run `krane %s` to complete it", RotateCommand)
+			keys = append(keys, pending)
+		}
+	}
+
+	previous, ok, err := PreviousKey()
+	if err != nil {
+		logger.Fatalf("Unable to load previous secrets master key, %v", err)
+		return
+	}
+	if ok {
+		keys = append(keys, previous)
+	}
+
+	SetKeys(key, keys...)
+	logger.Infof("Secrets are encrypted with master key %s", key.ID)
+}
+
+// SetKeys sets the master key used to wrap data keys, other keys are only used to unwrap data keys
+func SetKeys(primary Key, others ...Key) {
+	keyring.Lock()
+	defer keyring.Unlock()
+
+	keyring.primary = primary
+	keyring.keys = map[string]Key{primary.ID: primary}
+	for _, k := range others {
+		keyring.keys[k.ID] = k
+	}
+}
+
+// LoadKey returns the master key set in the environment, otherwise the master key read from the key file.
+// The key file is generated when it does not exist yet.
+func LoadKey() (Key, error) {
+	if encoded := os.Getenv(constants.EnvSecretsMasterKey); encoded != "" {
+		return ParseKey(encoded)
+	}
+
+	path := KeyFilePath()
+	if os.Getenv(constants.EnvSecretsKeyFile) == "" {
+		logger.Warnf("%s and %s are not set, using master key file %s", constants.EnvSecretsMasterKey, constants.EnvSecretsKeyFile, path)
+	}
+
+	key, err := ReadKeyFile(path)
+	if err == nil {
+		return key, nil
+	}
+
+	if !os.IsNotExist(err) {
+		return Key{}, err
+	}
+
+	logger.Warnf("Secrets master key file %s not found, generating a new master key. Secrets cannot be decrypted without it, back it up", path)
+	key, err = NewKey()
+	if err != nil {
+		return Key{}, err
+	}
+	return key, WriteKeyFile(path, key)
+}
+
+// PreviousKey returns the previous master key set in the environment, used to complete a rotation of a
+// master key set in the environment. Returns false if no previous master key is set.
+func PreviousKey() (Key, bool, error) {
+	encoded := os.Getenv(constants.EnvSecretsPreviousKey)
+	if encoded == "" {
+		return Key{}, false, nil
+	}
+
+	key, err := ParseKey(encoded)
+	if err != nil {
+		return Key{}, false, err
+	}
+	return key, true, nil
+}
+
+// HasKey returns true if data keys wrapped by a master key can be unwrapped
+func HasKey(id string) bool {
+	keyring.RLock()
+	defer keyring.RUnlock()
+	_, ok := keyring.keys[id]
+	return ok
+}
+
+// KeyFilePath returns the path of the master key file, defaults to krane.key in the directory of the db
+func KeyFilePath() string {
+	if path := os.Getenv(constants.EnvSecretsKeyFile); path != "" {
+		return path
+	}
+	return filepath.Join(filepath.Dir(os.Getenv(constants.EnvDatabasePath)), defaultKeyFileName)
+}
+
+// PendingKeyPath returns the path the new master key is written to while secrets are re-encrypted
+func PendingKeyPath() string {
+	return fmt.Sprintf("%s.new", KeyFilePath())
+}
+
+// WriteKeyFile writes a master key to a file only readable by its owner
+func WriteKeyFile(path string, key Key) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, []byte(key.String()+"\n"), 0600)
+}
+
+// ReadKeyFile reads a master key from a file
+func ReadKeyFile(path string) (Key, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Key{}, err
+	}
+
+	key, err := ParseKey(string(b))
+	if err != nil {
+		return Key{}, fmt.Errorf("invalid key file %s, %v", path, err)
+	}
+	return key, nil
+}
+
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
@@ -1,24 +1,39 @@
 package job
 
-import "github.com/krane/krane/internal/logger"
+import (
+	"errors"
+
+	"github.com/krane/krane/internal/logger"
+)
 
 type Enqueuer struct {
-	queue   chan Job
+	queue   *Queue
 	Handler GenericHandler
 }
 
-func NewEnqueuer(jobQueue chan Job) Enqueuer {
-	return Enqueuer{queue: jobQueue, Handler: nil}
+func NewEnqueuer(queue *Queue) Enqueuer {
+	return Enqueuer{queue: queue, Handler: nil}
 }
 
+// Enqueue persists a job to the queue returning the queued job with its position in the queue
 func (e *Enqueuer) Enqueue(job Job) (Job, error) {
 	err := job.validate()
 	if err != nil {
 		return Job{}, err
 	}
 
+	if e.queue == nil {
+		return Job{}, errors.New("job queue not initialized")
+	}
+
 	logger.Debugf("Queueing new job %s", job.ID)
-	e.queue <- job // Blocks here until space opens up in the queue
-	logger.Debugf("Job %s Queued", job.ID)
+	position, err := e.queue.push(job)
+	if err != nil {
+		return Job{}, err
+	}
+
+	job.State = Queued
+	job.QueuePosition = position
+	logger.Debugf("Job %s Queued at position %d", job.ID, position)
 	return job, nil
 }
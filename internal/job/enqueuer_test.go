@@ -1,9 +1,10 @@
 package job
 
 import (
+	"context"
 	"os"
+	"strconv"
 	"testing"
-	"time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -26,52 +27,59 @@ func TestMain(m *testing.M) {
 }
 
 func TestNewEnqueuer(t *testing.T) {
-	jobChannel := make(chan Job)
+	q := newQueue(store.Client(), 0)
 
-	e := NewEnqueuer(jobChannel)
+	e := NewEnqueuer(q)
 
 	assert.NotNil(t, e)
-	assert.Equal(t, jobChannel, e.queue)
+	assert.Equal(t, q, e.queue)
 }
 
 func TestEnqueueNewJobs(t *testing.T) {
-	jobQueue := make(chan Job)
+	resetQueueCollection()
+	q := newQueue(store.Client(), 0)
 
-	e := NewEnqueuer(jobQueue)
+	e := NewEnqueuer(q)
 
 	jobCount := 10
 	var jobHandlerCalls int
 
-	// Act
-	go func(handler *int) {
-		for i := 0; i < jobCount; i++ {
-			job := Job{
-				ID:         string(i),
-				Deployment: namespace,
-				Type:       "test",
-				Args:       map[string]string{"name": "test"},
-				Run: func(args interface{}) error {
-					assert.Equal(t, "test", args.(map[string]string)["name"])
-					*handler += 1
-					return nil
-				},
-			}
-
-			_, err := e.Enqueue(job)
-			assert.Nil(t, err)
-			time.Sleep(1 * time.Second)
+	for i := 0; i < jobCount; i++ {
+		job := Job{
+			ID:         strconv.Itoa(i),
+			Deployment: namespace,
+			Type:       "test",
+			Args:       map[string]string{"name": "test"},
+			Run: func(ctx context.Context, args interface{}) error {
+				assert.Equal(t, "test", args.(map[string]string)["name"])
+				jobHandlerCalls += 1
+				return nil
+			},
 		}
-	}(&jobHandlerCalls)
 
-	// Assert
+		queued, err := e.Enqueue(job)
+		assert.Nil(t, err)
+		assert.Equal(t, Queued, queued.State)
+		assert.Equal(t, i+1, queued.QueuePosition)
+	}
+
 	for i := 0; i < jobCount; i++ {
-		j := <-jobQueue
-		j.Run(j.Args)
-		assert.NotNil(t, j)
-		assert.Equal(t, j.ID, string(i))
+		j, _, ok := q.lease("worker")
+		assert.True(t, ok)
+		j.Run(context.Background(), j.Args)
+		assert.Equal(t, j.ID, strconv.Itoa(i))
 		assert.Equal(t, j.Deployment, namespace)
 		assert.Equal(t, j.Args.(map[string]string)["name"], "test")
+		q.ack(j)
 	}
 
 	assert.Equal(t, jobCount, jobHandlerCalls)
+	assert.Equal(t, 0, q.Len())
+}
+
+func TestEnqueueInvalidJob(t *testing.T) {
+	e := NewEnqueuer(newQueue(store.Client(), 0))
+
+	_, err := e.Enqueue(Job{ID: "invalid", Deployment: namespace})
+	assert.Error(t, err)
 }
@@ -2,7 +2,9 @@ package job
 
 import (
 	"container/heap"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -14,22 +16,31 @@ import (
 )
 
 type Job struct {
-	ID          string         `json:"id"`               // Unique job ID
-	Deployment  string         `json:"deployment"`       // Deployment used for scoping jobs.
-	Type        string         `json:"type"`             // The type of job
-	Status      Status         `json:"status"`           // The response of the current job with details for execution counts etc..
-	State       State          `json:"state"`            // Current state of a job (running | complete)
-	StartTime   int64          `json:"start_time_epoch"` // Job Start time - epoch in seconds since 1970
-	EndTime     int64          `json:"end_time_epoch"`   // Job end time - epoch in seconds since 1970
-	RetryPolicy uint           `json:"retry_policy"`     // Job retry policy
-	Args        interface{}    `json:"-"`                // Arguments passed down to job handlers
-	Setup       GenericHandler `json:"-"`                // Setup is the initial execution fn for a job typically to setup arguments
-	Run         GenericHandler `json:"-"`                // Run is the main executor fn for a job
-	Finally     GenericHandler `json:"-"`                // Final fn is the final execution fn for a job
+	ID            string         `json:"id"`                       // Unique job ID
+	Deployment    string         `json:"deployment"`               // Deployment used for scoping jobs.
+	Type          string         `json:"type"`                     // The type of job
+	Status        Status         `json:"status"`                   // The response of the current job with details for execution counts etc..
+	State         State          `json:"state"`                    // Current state of a job (running | complete)
+	StartTime     int64          `json:"start_time_epoch"`         // Job Start time - epoch in seconds since 1970
+	EndTime       int64          `json:"end_time_epoch"`           // Job end time - epoch in seconds since 1970
+	EnqueueTime   int64          `json:"enqueue_time_epoch"`       // Job enqueue time - epoch in seconds since 1970
+	QueuePosition int            `json:"queue_position,omitempty"` // Position of a pending job in the queue
+	RetryPolicy   RetryPolicy    `json:"retry_policy"`             // Job retry policy
+	Supersede     bool           `json:"supersede"`                // Whether queuing the job supersedes pending jobs of the same type for the deployment
+	Args          interface{}    `json:"-"`                        // Arguments passed down to job handlers
+	Setup         GenericHandler `json:"-"`                        // Setup is the initial execution fn for a job typically to setup arguments
+	Run           GenericHandler `json:"-"`                        // Run is the main executor fn for a job
+	Finally       GenericHandler `json:"-"`                        // Final fn is the final execution fn for a job
+	Rollback      GenericHandler `json:"-"`                        // Rollback fn is executed when every execution of a job failed
 }
 
-// GenericHandler is a generic job handler that takes in job arguments
-type GenericHandler func(args interface{}) error
+// ErrNothingToRollback is returned by a Rollback handler when a failed job left nothing to roll back,
+// the job ends as failed without being rolled back
+var ErrNothingToRollback = errors.New("nothing to roll back")
+
+// GenericHandler is a generic job handler that takes in job arguments. The context
+// is cancelled when the job is cancelled, handlers should stop executing once done.
+type GenericHandler func(ctx context.Context, args interface{}) error
 
 // Serialize a job into bytes
 func (j *Job) Serialize() ([]byte, error) { return json.Marshal(j) }
@@ -42,14 +53,18 @@ func (j *Job) start() {
 	j.StartTime = time.Now().Unix()
 	j.State = Started
 	j.Status.Failures = []Error{}
+	j.Status.Attempts = []Attempt{}
 }
 
-func (j *Job) end() {
+func (j *Job) end() { j.endWith(Completed) }
+
+// endWith ends a job with a final state
+func (j *Job) endWith(state State) {
 	if j.State != Started {
 		return
 	}
 	j.EndTime = time.Now().Unix()
-	j.State = Completed
+	j.State = state
 	j.save()
 }
 
@@ -60,10 +75,11 @@ func (j *Job) save() {
 
 	// timestamp(RFC3339) is used as the key for the activity.
 	// This leverages bolts time range scans which is an efficient way of performing lookups
-	// for activity within a time range in an efficient manner.
-	timestamp := utils.UTCDateString()
+	// for activity within a time range in an efficient manner. The job id is appended to the
+	// timestamp so jobs ending within the same second don't overwrite each other.
+	key := fmt.Sprintf("%s_%s", utils.UTCDateString(), j.ID)
 
-	err := store.Client().Put(collection, timestamp, bytes)
+	err := store.Client().Put(collection, key, bytes)
 	if err != nil {
 		logger.Errorf("Unhandled error when inserting job into the db, %s", err)
 		return
@@ -84,12 +100,7 @@ func (j *Job) validate() error {
 		return fmt.Errorf("run must be implemented for a job")
 	}
 
-	maxRetryPolicy := utils.UIntEnv(constants.EnvJobMaxRetryPolicy)
-	if j.RetryPolicy > maxRetryPolicy {
-		return fmt.Errorf("retry policy %d exceeds job max retry policy %d", j.RetryPolicy, maxRetryPolicy)
-	}
-
-	return nil
+	return j.RetryPolicy.validate()
 }
 
 // N dimensional Job array
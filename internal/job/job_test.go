@@ -5,6 +5,9 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/krane/krane/internal/store"
+	"github.com/krane/krane/internal/utils"
 )
 
 func TestStartJob(t *testing.T) {
@@ -26,6 +29,22 @@ func TestEndJob(t *testing.T) {
 	assert.True(t, time.Now().Unix() >= j.EndTime)
 }
 
+func TestEndedJobsAreSavedByID(t *testing.T) {
+	first := Job{ID: "first", Deployment: "saved-jobs-test"}
+	second := Job{ID: "second", Deployment: "saved-jobs-test"}
+
+	// jobs ending within the same second are both saved
+	first.start()
+	second.start()
+	first.end()
+	second.end()
+
+	minDate, maxDate := utils.CalculateTimeRange(1)
+	saved, err := store.Client().GetInRange(GetJobsCollectionName("saved-jobs-test"), minDate, maxDate)
+	assert.Nil(t, err)
+	assert.Len(t, saved, 2)
+}
+
 func TestJobNotStartedOnCallToJobEnd(t *testing.T) {
 	j := Job{}
 
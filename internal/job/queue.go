@@ -1,20 +1,334 @@
 package job
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
 	"sync"
+	"time"
 
+	"github.com/krane/krane/internal/constants"
 	"github.com/krane/krane/internal/logger"
+	"github.com/krane/krane/internal/store"
 )
 
 var once sync.Once
-var queue chan Job
+var queue *Queue
 
-// Queue : get the job queue
-func Queue() chan Job { return queue }
+// Queue is a durable FIFO queue of jobs. Queued jobs are persisted to the store and
+// leased by a worker while executing, a job is removed from the queue once acknowledged.
+// Jobs for the same deployment are leased one at a time in the order they were queued,
+// jobs for different deployments are leased in parallel.
+type Queue struct {
+	sync.Mutex
+	capacity uint
+	store    store.Store
+	pending  []Job
+	leased   map[string]Job
+	cancels  map[string]context.CancelFunc
+	ready    chan struct{}
+}
+
+// record is a job persisted in the queue collection
+type record struct {
+	Job      Job    `json:"job"`
+	Sequence int64  `json:"sequence"`        // order in which jobs were queued
+	Lease    *Lease `json:"lease,omitempty"` // set while a worker is executing the job
+}
+
+// Lease represents a worker executing a job
+type Lease struct {
+	Worker   string `json:"worker"`
+	LeasedAt int64  `json:"leased_at_epoch"`
+}
 
-// NewBufferedQueue : create a buffered channel for queuing jobs
-func NewBufferedQueue(queueSize uint) chan Job {
-	logger.Debugf("Creating job queue of size %d", queueSize)
-	once.Do(func() { queue = make(chan Job, queueSize) })
+// GetQueue : get the job queue
+func GetQueue() *Queue { return queue }
+
+// NewQueue : create a durable job queue holding up to capacity pending jobs (0 is unbounded)
+func NewQueue(store store.Store, capacity uint) *Queue {
+	logger.Debugf("Creating job queue of size %d", capacity)
+	once.Do(func() { queue = newQueue(store, capacity) })
 	return queue
 }
+
+func newQueue(store store.Store, capacity uint) *Queue {
+	return &Queue{
+		capacity: capacity,
+		store:    store,
+		pending:  make([]Job, 0),
+		leased:   make(map[string]Job),
+		cancels:  make(map[string]context.CancelFunc),
+		ready:    make(chan struct{}, 1),
+	}
+}
+
+// Restore loads the jobs persisted in the queue collection. Pending jobs are resumed,
+// jobs that were leased by a worker when Krane stopped are ended as interrupted.
+func (q *Queue) Restore() error {
+	q.Lock()
+	defer q.Unlock()
+
+	bytes, err := q.store.GetAll(constants.QueueCollectionName)
+	if err != nil {
+		return err
+	}
+
+	records := make([]record, 0)
+	for _, b := range bytes {
+		var r record
+		if err := json.Unmarshal(b, &r); err != nil {
+			logger.Errorf("unable to deserialize queued job %v", err)
+			continue
+		}
+		records = append(records, r)
+	}
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Sequence < records[j].Sequence })
+
+	for _, r := range records {
+		if r.Lease != nil {
+			logger.Warnf("Job %s was interrupted while running on worker %s", r.Job.ID, r.Lease.Worker)
+			q.end(r.Job, Interrupted, errors.New("job interrupted while running, Krane stopped before the job completed"))
+			continue
+		}
+
+		j, err := rebuild(r.Job)
+		if err != nil {
+			logger.Warnf("Unable to resume job %s, %v", r.Job.ID, err)
+			q.end(r.Job, Interrupted, fmt.Errorf("unable to resume job: %v", err))
+			continue
+		}
+
+		j.State = Queued
+		j.EnqueueTime = r.Job.EnqueueTime
+		q.pending = append(q.pending, j)
+		logger.Infof("Resuming queued job %s for deployment %s", j.ID, j.Deployment)
+	}
+
+	if len(q.pending) > 0 {
+		q.signal()
+	}
+
+	return nil
+}
+
+// push persists and appends a job to the queue returning its position in the queue
+func (q *Queue) push(j Job) (int, error) {
+	q.Lock()
+	defer q.Unlock()
+
+	if q.capacity > 0 && uint(len(q.pending)) >= q.capacity {
+		return 0, fmt.Errorf("job queue is full, %d job(s) pending", len(q.pending))
+	}
+
+	j.State = Queued
+	j.EnqueueTime = time.Now().Unix()
+	if err := q.persist(record{Job: j, Sequence: time.Now().UnixNano()}); err != nil {
+		return 0, err
+	}
+
+	if j.Supersede {
+		q.supersede(j)
+	}
+
+	q.pending = append(q.pending, j)
+	q.signal()
+
+	return len(q.pending), nil
+}
+
+// lease removes the next pending job from the queue and leases it to a worker. Pending jobs
+// for a deployment with a job already leased are skipped until the leased job is acknowledged.
+// The returned context is cancelled when the job is cancelled or acknowledged.
+func (q *Queue) lease(worker string) (Job, context.Context, bool) {
+	q.Lock()
+	defer q.Unlock()
+
+	running := make(map[string]bool)
+	for _, j := range q.leased {
+		running[j.Deployment] = true
+	}
+
+	for i, j := range q.pending {
+		if running[j.Deployment] {
+			continue
+		}
+
+		q.pending = append(q.pending[:i:i], q.pending[i+1:]...)
+
+		lease := &Lease{Worker: worker, LeasedAt: time.Now().Unix()}
+		if err := q.persist(record{Job: j, Sequence: time.Now().UnixNano(), Lease: lease}); err != nil {
+			logger.Errorf("unable to persist job lease %v", err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		q.leased[j.ID] = j
+		q.cancels[j.ID] = cancel
+
+		// wake up another worker if jobs are still pending
+		if len(q.pending) > 0 {
+			q.signal()
+		}
+
+		return j, ctx, true
+	}
+
+	return Job{}, nil, false
+}
+
+// ack removes a job executed by a worker from the queue
+func (q *Queue) ack(j Job) {
+	q.Lock()
+	defer q.Unlock()
+
+	if cancel, ok := q.cancels[j.ID]; ok {
+		cancel()
+	}
+	delete(q.cancels, j.ID)
+	delete(q.leased, j.ID)
+
+	if err := q.store.Remove(constants.QueueCollectionName, j.ID); err != nil {
+		logger.Errorf("unable to remove job from queue %v", err)
+	}
+
+	// pending jobs for the same deployment can now be leased
+	if len(q.pending) > 0 {
+		q.signal()
+	}
+}
+
+// Cancel cancels a job. A pending job is removed from the queue and ended as cancelled,
+// a running job has its context cancelled and is ended as cancelled by its worker.
+func (q *Queue) Cancel(id string) (Job, error) {
+	q.Lock()
+	defer q.Unlock()
+
+	for i, j := range q.pending {
+		if j.ID != id {
+			continue
+		}
+
+		q.pending = append(q.pending[:i:i], q.pending[i+1:]...)
+		j = q.end(j, Cancelled, errors.New("job cancelled before it started"))
+		logger.Infof("Pending job %s cancelled", id)
+		return j, nil
+	}
+
+	if j, ok := q.leased[id]; ok {
+		q.cancels[id]()
+		logger.Infof("Running job %s cancelled", id)
+		return j, nil
+	}
+
+	return Job{}, fmt.Errorf("job %s is not pending or running", id)
+}
+
+// supersede ends every pending job of the same type for the same deployment as a newer job
+func (q *Queue) supersede(newer Job) {
+	pending := make([]Job, 0, len(q.pending))
+	for _, j := range q.pending {
+		if j.Deployment != newer.Deployment || j.Type != newer.Type {
+			pending = append(pending, j)
+			continue
+		}
+
+		logger.Infof("Pending job %s superseded by job %s", j.ID, newer.ID)
+		q.end(j, Superseded, fmt.Errorf("job superseded by job %s", newer.ID))
+	}
+	q.pending = pending
+}
+
+// Position returns the 1-based position of a pending job in the queue, 0 if the job is not pending
+func (q *Queue) Position(id string) int {
+	q.Lock()
+	defer q.Unlock()
+
+	for i, j := range q.pending {
+		if j.ID == id {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// Get returns a pending or running job from the queue
+func (q *Queue) Get(id string) (Job, bool) {
+	q.Lock()
+	defer q.Unlock()
+
+	for i, j := range q.pending {
+		if j.ID == id {
+			j.QueuePosition = i + 1
+			return j, true
+		}
+	}
+
+	j, ok := q.leased[id]
+	return j, ok
+}
+
+// Len returns the number of pending jobs
+func (q *Queue) Len() int {
+	q.Lock()
+	defer q.Unlock()
+	return len(q.pending)
+}
+
+// InFlight returns true if a deployment has a job pending or running
+func InFlight(deployment string) bool {
+	q := GetQueue()
+	if q == nil {
+		return false
+	}
+	return q.inFlight(deployment)
+}
+
+// inFlight returns true if a deployment has a job pending or leased in the queue
+func (q *Queue) inFlight(deployment string) bool {
+	q.Lock()
+	defer q.Unlock()
+
+	for _, j := range q.pending {
+		if j.Deployment == deployment {
+			return true
+		}
+	}
+	for _, j := range q.leased {
+		if j.Deployment == deployment {
+			return true
+		}
+	}
+	return false
+}
+
+// end ends a job that will not be executed with a final state and removes it from the queue
+func (q *Queue) end(j Job, state State, err error) Job {
+	j.State = state
+	j.EndTime = time.Now().Unix()
+	j.WithError(err)
+	j.save()
+
+	if err := q.store.Remove(constants.QueueCollectionName, j.ID); err != nil {
+		logger.Errorf("unable to remove job from queue %v", err)
+	}
+	return j
+}
+
+// persist stores a queue record keyed by job id
+func (q *Queue) persist(r record) error {
+	bytes, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return q.store.Put(constants.QueueCollectionName, r.Job.ID, bytes)
+}
+
+// signal wakes up a worker waiting for jobs
+func (q *Queue) signal() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
@@ -1,21 +1,170 @@
 package job
 
 import (
+	"context"
+	"errors"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/krane/krane/internal/constants"
+	"github.com/krane/krane/internal/store"
 )
 
-func TestQueueCapacityOnNewQueueInstance(t *testing.T) {
-	qSize := 10
-	queue := NewBufferedQueue(uint(qSize))
-	assert.Equal(t, qSize, cap(queue))
-	assert.Equal(t, 0, len(queue))
+func resetQueueCollection() {
+	_ = store.Client().CreateCollection(constants.QueueCollectionName)
+	_ = store.Client().DeleteCollection(constants.QueueCollectionName)
 }
 
 func TestReturnSameQueueInstance(t *testing.T) {
-	qSize := 10
-	q1 := NewBufferedQueue(uint(qSize))
-	q2 := NewBufferedQueue(uint(qSize))
-	assert.Exactly(t, &q1, &q2)
+	q1 := NewQueue(store.Client(), 10)
+	q2 := NewQueue(store.Client(), 10)
+	assert.Same(t, q1, q2)
+	assert.Same(t, q1, GetQueue())
+}
+
+func TestQueueCapacity(t *testing.T) {
+	resetQueueCollection()
+	q := newQueue(store.Client(), 2)
+
+	position, err := q.push(Job{ID: "capacity-1", Deployment: namespace})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, position)
+
+	position, err = q.push(Job{ID: "capacity-2", Deployment: namespace})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, position)
+
+	_, err = q.push(Job{ID: "capacity-3", Deployment: namespace})
+	assert.Error(t, err)
+	assert.Equal(t, 2, q.Len())
+}
+
+func TestQueueLeaseAndAck(t *testing.T) {
+	resetQueueCollection()
+	q := newQueue(store.Client(), 0)
+
+	_, _ = q.push(Job{ID: "lease-1", Deployment: namespace})
+	_, _ = q.push(Job{ID: "lease-2", Deployment: namespace})
+	assert.Equal(t, 2, q.Position("lease-2"))
+
+	j, _, ok := q.lease("worker-1")
+	assert.True(t, ok)
+	assert.Equal(t, "lease-1", j.ID)
+	assert.Equal(t, 1, q.Position("lease-2"))
+
+	// leased jobs are still part of the queue until acknowledged
+	leased, ok := q.Get("lease-1")
+	assert.True(t, ok)
+	assert.Equal(t, "lease-1", leased.ID)
+
+	q.ack(j)
+	_, ok = q.Get("lease-1")
+	assert.False(t, ok)
+
+	bytes, err := store.Client().Get(constants.QueueCollectionName, "lease-1")
+	assert.Nil(t, err)
+	assert.Nil(t, bytes)
+}
+
+func TestRestoreQueue(t *testing.T) {
+	resetQueueCollection()
+	Register("restore-test", func(j Job) (Job, error) {
+		if j.ID == "restore-unbuildable" {
+			return Job{}, errors.New("unable to rebuild job")
+		}
+		return Job{ID: j.ID, Deployment: j.Deployment, Type: j.Type, Run: func(ctx context.Context, args interface{}) error { return nil }}, nil
+	})
+
+	previous := newQueue(store.Client(), 0)
+	_, _ = previous.push(Job{ID: "restore-running", Deployment: namespace, Type: "restore-test"})
+	_, _ = previous.push(Job{ID: "restore-pending", Deployment: namespace, Type: "restore-test"})
+	_, _ = previous.push(Job{ID: "restore-unbuildable", Deployment: namespace, Type: "restore-test"})
+	_, _ = previous.push(Job{ID: "restore-unknown", Deployment: namespace, Type: "unknown"})
+	_, _, _ = previous.lease("worker-1")
+
+	// a new queue is created as if Krane restarted
+	q := newQueue(store.Client(), 0)
+	assert.Nil(t, q.Restore())
+	assert.Equal(t, 1, q.Len())
+
+	j, ok := q.Get("restore-pending")
+	assert.True(t, ok)
+	assert.Equal(t, Queued, j.State)
+	assert.NotNil(t, j.Run)
+
+	for _, id := range []string{"restore-running", "restore-unbuildable", "restore-unknown"} {
+		_, ok := q.Get(id)
+		assert.False(t, ok)
+
+		bytes, err := store.Client().Get(constants.QueueCollectionName, id)
+		assert.Nil(t, err)
+		assert.Nil(t, bytes)
+	}
+}
+
+func TestQueueSerializesJobsPerDeployment(t *testing.T) {
+	resetQueueCollection()
+	q := newQueue(store.Client(), 0)
+
+	_, _ = q.push(Job{ID: "serial-a1", Deployment: "a"})
+	_, _ = q.push(Job{ID: "serial-a2", Deployment: "a"})
+	_, _ = q.push(Job{ID: "serial-b1", Deployment: "b"})
+
+	a1, _, ok := q.lease("worker-1")
+	assert.True(t, ok)
+	assert.Equal(t, "serial-a1", a1.ID)
+
+	// the second job for deployment a waits for the first one, deployment b runs in parallel
+	b1, _, ok := q.lease("worker-2")
+	assert.True(t, ok)
+	assert.Equal(t, "serial-b1", b1.ID)
+
+	_, _, ok = q.lease("worker-3")
+	assert.False(t, ok)
+
+	q.ack(a1)
+	a2, _, ok := q.lease("worker-3")
+	assert.True(t, ok)
+	assert.Equal(t, "serial-a2", a2.ID)
+}
+
+func TestQueueSupersedesPendingJobs(t *testing.T) {
+	resetQueueCollection()
+	q := newQueue(store.Client(), 0)
+
+	_, _ = q.push(Job{ID: "supersede-1", Deployment: namespace, Type: "run", Supersede: true})
+	_, _ = q.push(Job{ID: "supersede-other", Deployment: namespace, Type: "stop"})
+	_, _ = q.push(Job{ID: "supersede-2", Deployment: namespace, Type: "run", Supersede: true})
+
+	_, ok := q.Get("supersede-1")
+	assert.False(t, ok)
+	assert.Equal(t, 1, q.Position("supersede-other"))
+	assert.Equal(t, 2, q.Position("supersede-2"))
+
+	bytes, err := store.Client().Get(constants.QueueCollectionName, "supersede-1")
+	assert.Nil(t, err)
+	assert.Nil(t, bytes)
+}
+
+func TestCancelJobs(t *testing.T) {
+	resetQueueCollection()
+	q := newQueue(store.Client(), 0)
+
+	_, _ = q.push(Job{ID: "cancel-running", Deployment: namespace})
+	_, _ = q.push(Job{ID: "cancel-pending", Deployment: namespace})
+
+	running, ctx, _ := q.lease("worker-1")
+
+	cancelled, err := q.Cancel("cancel-pending")
+	assert.Nil(t, err)
+	assert.Equal(t, Cancelled, cancelled.State)
+	assert.Equal(t, 0, q.Len())
+
+	_, err = q.Cancel(running.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, context.Canceled, ctx.Err())
+
+	_, err = q.Cancel("cancel-unknown")
+	assert.Error(t, err)
 }
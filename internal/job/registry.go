@@ -0,0 +1,44 @@
+package job
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Builder re-creates a job and its handlers from a job restored from the queue.
+// Handlers are not persisted, every job type queued must register a builder to be resumed after a restart.
+type Builder func(j Job) (Job, error)
+
+var builders = struct {
+	sync.RWMutex
+	types map[string]Builder
+}{types: make(map[string]Builder)}
+
+// Register registers the builder for a job type
+func Register(jobType string, builder Builder) {
+	builders.Lock()
+	defer builders.Unlock()
+	builders.types[jobType] = builder
+}
+
+// rebuild re-creates a restored job using the builder registered for its type
+func rebuild(j Job) (Job, error) {
+	builders.RLock()
+	builder, ok := builders.types[j.Type]
+	builders.RUnlock()
+
+	if !ok {
+		return Job{}, fmt.Errorf("no builder registered for job type %s", j.Type)
+	}
+
+	rebuilt, err := builder(j)
+	if err != nil {
+		return Job{}, err
+	}
+
+	if rebuilt.ID != j.ID {
+		return Job{}, fmt.Errorf("rebuilt job %s does not match queued job %s", rebuilt.ID, j.ID)
+	}
+
+	return rebuilt, nil
+}
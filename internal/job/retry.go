@@ -0,0 +1,146 @@
+package job
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/krane/krane/internal/constants"
+	"github.com/krane/krane/internal/utils"
+)
+
+const (
+	defaultRetryBackoff    = 5 * time.Second
+	defaultMaxRetryBackoff = 1 * time.Minute
+	defaultRetryJitter     = 0.2
+)
+
+// RetryPolicy configures how many times a job is attempted and how long to wait between attempts.
+// The delay between attempts grows exponentially from Backoff up to MaxBackoff, and a random
+// fraction (Jitter) of the delay is removed so jobs failing together don't retry together.
+// Retryable decides which errors are retried, it is not stored and must be set again when a job is rebuilt.
+type RetryPolicy struct {
+	MaxAttempts uint             `json:"max_attempts"` // Max executions of a job, a job is not retried once an attempt succeeds
+	Backoff     time.Duration    `json:"backoff"`      // Delay before the second attempt, doubled for every following attempt
+	MaxBackoff  time.Duration    `json:"max_backoff"`  // Max delay between attempts
+	Jitter      float64          `json:"jitter"`       // Fraction of the delay randomized, between 0 and 1
+	Retryable   func(error) bool `json:"-"`            // Returns false for errors which are not retried, every error is retried when not set
+}
+
+// NewRetryPolicy returns a retry policy attempting a job up to maxAttempts times with the default backoff
+func NewRetryPolicy(maxAttempts uint) RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: maxAttempts,
+		Backoff:     defaultRetryBackoff,
+		MaxBackoff:  defaultMaxRetryBackoff,
+		Jitter:      defaultRetryJitter,
+	}
+}
+
+// attempts returns the max executions of a job, a job is always attempted at least once
+func (p RetryPolicy) attempts() uint {
+	if p.MaxAttempts == 0 {
+		return 1
+	}
+	return p.MaxAttempts
+}
+
+// delay returns how long to wait before the next attempt after a number of failed attempts
+func (p RetryPolicy) delay(failed uint) time.Duration {
+	if failed == 0 || p.Backoff <= 0 {
+		return 0
+	}
+
+	d := p.Backoff
+	for i := uint(1); i < failed; i++ {
+		d *= 2
+		if p.MaxBackoff > 0 && d >= p.MaxBackoff {
+			break
+		}
+	}
+
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+
+	if p.Jitter > 0 {
+		d -= time.Duration(p.Jitter * rand.Float64() * float64(d))
+	}
+
+	return d
+}
+
+// nonRetryableError is an error failing a job or workflow step without retrying it
+type nonRetryableError struct {
+	err error
+}
+
+func (e nonRetryableError) Error() string {
+	return e.err.Error()
+}
+
+func (e nonRetryableError) Unwrap() error {
+	return e.err
+}
+
+// NonRetryable marks an error which cannot be fixed by attempting a job again (ie. an invalid
+// configuration), jobs and workflow steps failing with the error are not retried
+func NonRetryable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return nonRetryableError{err}
+}
+
+// retryable returns true if a failed attempt with an error should be retried,
+// non retryable errors are never retried regardless of the policy
+func (p RetryPolicy) retryable(err error) bool {
+	var nonRetryable nonRetryableError
+	if errors.As(err, &nonRetryable) {
+		return false
+	}
+
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return true
+}
+
+// validate returns an error if a retry policy is not valid
+func (p RetryPolicy) validate() error {
+	maxAttempts := utils.UIntEnv(constants.EnvJobMaxRetryPolicy)
+	if p.MaxAttempts > maxAttempts {
+		return fmt.Errorf("retry policy %d exceeds job max retry policy %d", p.MaxAttempts, maxAttempts)
+	}
+
+	if p.Backoff < 0 || p.MaxBackoff < 0 {
+		return errors.New("retry policy backoff cannot be negative")
+	}
+
+	if p.Jitter < 0 || p.Jitter > 1 {
+		return fmt.Errorf("retry policy jitter %v must be between 0 and 1", p.Jitter)
+	}
+
+	return nil
+}
+
+// UnmarshalJSON deserializes a retry policy, jobs stored before retry policies were introduced
+// stored the max attempts as a number and are deserialized with the default backoff.
+func (p *RetryPolicy) UnmarshalJSON(b []byte) error {
+	var maxAttempts uint
+	if err := json.Unmarshal(b, &maxAttempts); err == nil {
+		*p = NewRetryPolicy(maxAttempts)
+		return nil
+	}
+
+	type policy RetryPolicy
+	var decoded policy
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		return err
+	}
+
+	*p = RetryPolicy(decoded)
+	return nil
+}
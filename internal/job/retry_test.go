@@ -0,0 +1,89 @@
+package job
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/krane/krane/internal/constants"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 5, Backoff: time.Second, MaxBackoff: 5 * time.Second}
+
+	assert.Equal(t, time.Duration(0), p.delay(0))
+	assert.Equal(t, 1*time.Second, p.delay(1))
+	assert.Equal(t, 2*time.Second, p.delay(2))
+	assert.Equal(t, 4*time.Second, p.delay(3))
+	assert.Equal(t, 5*time.Second, p.delay(4))
+	assert.Equal(t, 5*time.Second, p.delay(100))
+
+	assert.Equal(t, time.Duration(0), RetryPolicy{MaxAttempts: 5}.delay(3))
+}
+
+func TestRetryPolicyDelayJitter(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 5, Backoff: time.Second, MaxBackoff: time.Minute, Jitter: 0.5}
+
+	for i := 0; i < 100; i++ {
+		d := p.delay(2)
+		assert.True(t, d > 1*time.Second && d <= 2*time.Second, "delay %s out of range", d)
+	}
+}
+
+func TestRetryPolicyRetryableErrors(t *testing.T) {
+	errTimeout := errors.New("timeout")
+	errNotFound := errors.New("not found")
+
+	p := RetryPolicy{MaxAttempts: 3}
+	assert.True(t, p.retryable(errTimeout))
+	assert.False(t, p.retryable(NonRetryable(errNotFound)))
+	assert.False(t, p.retryable(fmt.Errorf("pull failed: %w", NonRetryable(errNotFound))))
+	assert.True(t, errors.Is(NonRetryable(errNotFound), errNotFound))
+	assert.Equal(t, "not found", NonRetryable(errNotFound).Error())
+	assert.Nil(t, NonRetryable(nil))
+}
+
+func TestRetryPolicyRetryable(t *testing.T) {
+	errTimeout := errors.New("timeout")
+	errNotFound := errors.New("not found")
+
+	p := RetryPolicy{MaxAttempts: 3, Retryable: func(err error) bool { return !errors.Is(err, errNotFound) }}
+	assert.True(t, p.retryable(errTimeout))
+	assert.False(t, p.retryable(fmt.Errorf("pull failed: %w", errNotFound)))
+
+	// non retryable errors are not retried even if the policy retries them
+	p.Retryable = func(error) bool { return true }
+	assert.False(t, p.retryable(NonRetryable(errTimeout)))
+}
+
+func TestRetryPolicyAttempts(t *testing.T) {
+	assert.Equal(t, uint(1), RetryPolicy{}.attempts())
+	assert.Equal(t, uint(3), RetryPolicy{MaxAttempts: 3}.attempts())
+}
+
+func TestInvalidRetryPolicy(t *testing.T) {
+	os.Setenv(constants.EnvJobMaxRetryPolicy, "3")
+
+	assert.Nil(t, NewRetryPolicy(3).validate())
+	assert.Error(t, NewRetryPolicy(4).validate())
+	assert.Error(t, RetryPolicy{MaxAttempts: 1, Backoff: -time.Second}.validate())
+	assert.Error(t, RetryPolicy{MaxAttempts: 1, Jitter: 1.5}.validate())
+}
+
+func TestDeserializeRetryPolicy(t *testing.T) {
+	var j Job
+	assert.Nil(t, json.Unmarshal([]byte(`{"retry_policy": 3}`), &j))
+	assert.Equal(t, NewRetryPolicy(3), j.RetryPolicy)
+
+	bytes, err := json.Marshal(Job{RetryPolicy: RetryPolicy{MaxAttempts: 2, Backoff: time.Second}})
+	assert.Nil(t, err)
+
+	j = Job{}
+	assert.Nil(t, json.Unmarshal(bytes, &j))
+	assert.Equal(t, RetryPolicy{MaxAttempts: 2, Backoff: time.Second}, j.RetryPolicy)
+}
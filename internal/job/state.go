@@ -3,6 +3,12 @@ package job
 type State string
 
 const (
-	Started   State = "STARTED"
-	Completed State = "COMPLETED"
+	Queued      State = "QUEUED"
+	Interrupted State = "INTERRUPTED"
+	Started     State = "STARTED"
+	Completed   State = "COMPLETED"
+	RolledBack  State = "ROLLED_BACK"
+	Superseded  State = "SUPERSEDED"
+	Cancelled   State = "CANCELLED"
+	TimedOut    State = "TIMED_OUT"
 )
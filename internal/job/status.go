@@ -1,7 +1,49 @@
 package job
 
 type Status struct {
-	ExecutionCount uint    `json:"execution_count"`
-	FailureCount   uint    `json:"failure_count"`
-	Failures       []Error `json:"failures"`
+	ExecutionCount uint         `json:"execution_count"`
+	FailureCount   uint         `json:"failure_count"`
+	Failures       []Error      `json:"failures"`
+	Attempts       []Attempt    `json:"attempts"`
+	Progress       []Progress   `json:"progress"`
+	Steps          []StepStatus `json:"steps"`
+}
+
+// Attempt is a single execution of a job
+type Attempt struct {
+	Execution uint   `json:"execution"`
+	StartTime int64  `json:"start_time_epoch"`
+	Duration  int64  `json:"duration_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Progress is a step recorded by a job handler while the job executes
+type Progress struct {
+	Execution uint   `json:"execution"`
+	Step      string `json:"step"`
+	Message   string `json:"message"`
+	Timestamp int64  `json:"timestamp_epoch"`
+}
+
+// StepState is the state of a workflow step
+type StepState string
+
+const (
+	StepPending    StepState = "PENDING"
+	StepSucceeded  StepState = "SUCCEEDED"
+	StepFailed     StepState = "FAILED"
+	StepSkipped    StepState = "SKIPPED"
+	StepUndone     StepState = "UNDONE"
+	StepUndoFailed StepState = "UNDO_FAILED"
+)
+
+// StepStatus is the status of a workflow step recorded while the job executes
+type StepStatus struct {
+	Execution uint      `json:"execution"`
+	Step      string    `json:"step"`
+	State     StepState `json:"state"`
+	Attempts  uint      `json:"attempts"`
+	Error     string    `json:"error,omitempty"`
+	StartTime int64     `json:"start_time_epoch"`
+	EndTime   int64     `json:"end_time_epoch"`
 }
@@ -0,0 +1,33 @@
+package job
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/krane/krane/internal/constants"
+	"github.com/krane/krane/internal/utils"
+)
+
+// defaultTimeout is the timeout for jobs when no timeout is configured
+const defaultTimeout = 30 * time.Minute
+
+// Timeout returns how long a job of a given type can run before its context is cancelled.
+// A timeout for a job type is configured with JOB_TIMEOUT_<TYPE> (i.e JOB_TIMEOUT_RUN_DEPLOYMENT),
+// otherwise the JOB_TIMEOUT applies to every job type.
+func Timeout(jobType string) time.Duration {
+	if timeout := utils.DurationEnv(timeoutEnv(jobType)); timeout > 0 {
+		return timeout
+	}
+
+	if timeout := utils.DurationEnv(constants.EnvJobTimeout); timeout > 0 {
+		return timeout
+	}
+
+	return defaultTimeout
+}
+
+// timeoutEnv returns the environment variable used to configure the timeout of a job type
+func timeoutEnv(jobType string) string {
+	return fmt.Sprintf("%s_%s", constants.EnvJobTimeout, strings.ToUpper(jobType))
+}
@@ -0,0 +1,29 @@
+package job
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/krane/krane/internal/constants"
+)
+
+func TestJobTimeout(t *testing.T) {
+	os.Unsetenv(constants.EnvJobTimeout)
+	assert.Equal(t, defaultTimeout, Timeout("RUN_DEPLOYMENT"))
+
+	os.Setenv(constants.EnvJobTimeout, "10m")
+	defer os.Unsetenv(constants.EnvJobTimeout)
+	assert.Equal(t, 10*time.Minute, Timeout("RUN_DEPLOYMENT"))
+
+	os.Setenv("JOB_TIMEOUT_RUN_DEPLOYMENT", "90s")
+	defer os.Unsetenv("JOB_TIMEOUT_RUN_DEPLOYMENT")
+	assert.Equal(t, 90*time.Second, Timeout("RUN_DEPLOYMENT"))
+	assert.Equal(t, 10*time.Minute, Timeout("DELETE_DEPLOYMENT"))
+
+	// invalid durations fall back to the default timeout
+	os.Setenv(constants.EnvJobTimeout, "ten minutes")
+	assert.Equal(t, defaultTimeout, Timeout("DELETE_DEPLOYMENT"))
+}
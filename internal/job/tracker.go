@@ -0,0 +1,62 @@
+package job
+
+import "time"
+
+// Tracker is embedded into job arguments allowing handlers to record the progress of a job.
+// Recorded progress and workflow steps are copied onto the job status once the job ends.
+type Tracker struct {
+	execution uint
+	progress  []Progress
+	steps     []StepStatus
+}
+
+// tracked is implemented by job arguments embedding a Tracker
+type tracked interface {
+	setExecution(execution uint)
+	trackSteps(steps []StepStatus)
+	Progress() []Progress
+	Steps() []StepStatus
+}
+
+// Track records a step and message for the current job execution
+func (t *Tracker) Track(step, message string) {
+	t.progress = append(t.progress, Progress{
+		Execution: t.execution,
+		Step:      step,
+		Message:   message,
+		Timestamp: time.Now().Unix(),
+	})
+}
+
+// Progress returns the recorded progress
+func (t *Tracker) Progress() []Progress { return t.progress }
+
+// Steps returns the recorded workflow steps
+func (t *Tracker) Steps() []StepStatus { return t.steps }
+
+// trackSteps records the status of workflow steps for the current job execution
+func (t *Tracker) trackSteps(steps []StepStatus) {
+	for _, s := range steps {
+		s.Execution = t.execution
+		t.steps = append(t.steps, s)
+	}
+}
+
+// FailedStep returns the workflow step the current job execution failed at, empty if no step failed
+func (t *Tracker) FailedStep() string {
+	failed := ""
+	for _, s := range t.steps {
+		if s.Execution != t.execution || s.State == StepPending || s.State == StepSkipped {
+			continue
+		}
+
+		// steps after the failed step are skipped, the failed step keeps its error once undone
+		failed = ""
+		if s.Error != "" {
+			failed = s.Step
+		}
+	}
+	return failed
+}
+
+func (t *Tracker) setExecution(execution uint) { t.execution = execution }
@@ -1,7 +1,10 @@
 package job
 
 import (
+	"context"
+	"fmt"
 	"os"
+	"time"
 
 	"github.com/pkg/errors"
 
@@ -9,78 +12,192 @@ import (
 )
 
 type worker struct {
-	workerPool chan chan Job
-	channel    chan Job
-	quit       chan bool
+	id    string
+	queue *Queue
+	quit  chan struct{}
+	done  chan struct{}
 }
 
 // newWorker is a helper for creating new workers; a worker runs in its
-// own routine waiting to process work from a job queue
-func newWorker(workerPool chan chan Job, jobChannel chan Job) *worker {
-	return &worker{workerPool, jobChannel, make(chan bool)}
+// own routine leasing jobs from the job queue
+func newWorker(id string, queue *Queue) *worker {
+	return &worker{id, queue, make(chan struct{}), make(chan struct{})}
 }
 
 // Start starts a worker
 func (w *worker) start() {
-	logger.Debugf("Worker starting with pid: %d", os.Getpid())
+	logger.Debugf("Worker %s starting with pid: %d", w.id, os.Getpid())
 	go w.loop()
 }
 
-// stop stops a worker
+// stop stops a worker, waiting for the job it is executing (if any) to complete
 func (w *worker) stop() {
-	logger.Debug("Worker stopping")
-	w.quit <- true
+	logger.Debugf("Worker %s stopping", w.id)
+	close(w.quit)
+	<-w.done
 	return
 }
 
-// loop will infinitely block for jobs to come through from job queue
+// loop will infinitely lease jobs from the job queue until the worker is stopped
 func (w *worker) loop() {
 	logger.Debug("Worker loop started")
+	defer close(w.done)
+
 	for {
 		select {
-		case job := <-w.channel:
-			job.start()
-
-			for i := 0; i < int(job.RetryPolicy); i++ {
-				job.Status.ExecutionCount++
-
-				if job.Setup != nil {
-					logger.Debugf("Setting up job %s", job.ID)
-					if err := job.Setup(job.Args); err != nil {
-						job.WithError(err)
-						job.Status.FailureCount++
-						continue
-					}
-				}
-
-				if job.Run == nil {
-					job.WithError(errors.New("job must have a Run implementation"))
-					job.Status.FailureCount++
-					return
-				}
-
-				if err := job.Run(job.Args); err != nil {
-					job.WithError(err)
-					job.Status.FailureCount++
-					continue
-				}
-
-				if job.Finally != nil {
-					logger.Debugf("Tearing down job %s", job.ID)
-					if err := job.Finally(job.Args); err != nil {
-						job.WithError(err)
-						job.Status.FailureCount++
-						continue
-					}
-				}
-
-				logger.Debugf("Completed job %s", job.ID)
-			}
-
-			job.end()
 		case <-w.quit:
 			logger.Debug("Quitting worker")
 			return
+		default:
+		}
+
+		job, ctx, ok := w.queue.lease(w.id)
+		if !ok {
+			select {
+			case <-w.queue.ready:
+				continue
+			case <-w.quit:
+				logger.Debug("Quitting worker")
+				return
+			}
+		}
+
+		// jobs are cancelled once they exceed the timeout configured for their type
+		timeout := Timeout(job.Type)
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+
+		job.start()
+
+		failed := w.execute(ctx, &job)
+
+		state := Completed
+		switch {
+		case ctx.Err() == context.Canceled:
+			// cancelled jobs are not rolled back, the job is ended as is
+			logger.Debugf("Job %s cancelled", job.ID)
+			job.WithError(errors.New("job cancelled while running"))
+			state = Cancelled
+		case ctx.Err() == context.DeadlineExceeded:
+			// timed out jobs are not rolled back, their context is already done
+			logger.Warnf("Job %s timed out after %s", job.ID, timeout)
+			job.WithError(fmt.Errorf("job timed out after %s", timeout))
+			state = TimedOut
+		case failed && job.Rollback != nil:
+			logger.Debugf("Rolling back job %s", job.ID)
+			err := job.Rollback(ctx, job.Args)
+			switch {
+			case err == ErrNothingToRollback:
+				logger.Debugf("Nothing to roll back for job %s", job.ID)
+			case err != nil:
+				job.WithError(err)
+			default:
+				state = RolledBack
+			}
+		}
+		cancel()
+
+		if t, ok := job.Args.(tracked); ok {
+			job.Status.Progress = t.Progress()
+			job.Status.Steps = t.Steps()
+		}
+
+		job.endWith(state)
+		w.queue.ack(job)
+	}
+}
+
+// execute attempts a job until an attempt succeeds, the retry policy of the job is exhausted,
+// a non retryable error is returned or the job context is done. Returns true if the job failed.
+func (w *worker) execute(ctx context.Context, job *Job) bool {
+	if job.Run == nil {
+		job.WithError(errors.New("job must have a Run implementation"))
+		job.Status.FailureCount++
+		return true
+	}
+
+	policy := job.RetryPolicy
+	failed := false
+
+	for attempt := uint(1); attempt <= policy.attempts(); attempt++ {
+		if attempt > 1 {
+			delay := policy.delay(attempt - 1)
+			logger.Debugf("Retrying job %s in %s", job.ID, delay)
+			if !wait(ctx, delay) {
+				break
+			}
+		}
+
+		if ctx.Err() != nil {
+			break
 		}
+
+		job.Status.ExecutionCount++
+		if t, ok := job.Args.(tracked); ok {
+			t.setExecution(job.Status.ExecutionCount)
+		}
+
+		start := time.Now()
+		err := w.attempt(ctx, job)
+
+		record := Attempt{
+			Execution: job.Status.ExecutionCount,
+			StartTime: start.Unix(),
+			Duration:  time.Since(start).Milliseconds(),
+		}
+
+		if err == nil {
+			job.Status.Attempts = append(job.Status.Attempts, record)
+			logger.Debugf("Completed job %s", job.ID)
+			return false
+		}
+
+		record.Error = err.Error()
+		job.Status.Attempts = append(job.Status.Attempts, record)
+		job.WithError(err)
+		job.Status.FailureCount++
+		failed = true
+
+		if !policy.retryable(err) {
+			logger.Debugf("Job %s failed with a non retryable error, %v", job.ID, err)
+			break
+		}
+	}
+
+	return failed
+}
+
+// attempt executes the Setup, Run and Finally handlers of a job once
+func (w *worker) attempt(ctx context.Context, job *Job) error {
+	if job.Setup != nil {
+		logger.Debugf("Setting up job %s", job.ID)
+		if err := job.Setup(ctx, job.Args); err != nil {
+			return err
+		}
+	}
+
+	if err := job.Run(ctx, job.Args); err != nil {
+		return err
+	}
+
+	if job.Finally != nil {
+		logger.Debugf("Tearing down job %s", job.ID)
+		if err := job.Finally(ctx, job.Args); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// wait waits for a delay returning false if the context is done before the delay elapsed
+func wait(ctx context.Context, delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
 	}
 }
@@ -0,0 +1,112 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorkerStopsRetryingOnSuccess(t *testing.T) {
+	runs := 0
+	j := Job{
+		ID:          "retry-success",
+		RetryPolicy: RetryPolicy{MaxAttempts: 3},
+		Run: func(ctx context.Context, args interface{}) error {
+			runs++
+			return nil
+		},
+	}
+
+	failed := newWorker("retry", nil).execute(context.Background(), &j)
+	assert.False(t, failed)
+	assert.Equal(t, 1, runs)
+	assert.Equal(t, uint(1), j.Status.ExecutionCount)
+	assert.Len(t, j.Status.Attempts, 1)
+	assert.Empty(t, j.Status.Attempts[0].Error)
+}
+
+func TestWorkerRetriesFailedAttempts(t *testing.T) {
+	runs := 0
+	j := Job{
+		ID:          "retry-failure",
+		RetryPolicy: RetryPolicy{MaxAttempts: 3},
+		Run: func(ctx context.Context, args interface{}) error {
+			runs++
+			if runs < 3 {
+				return errors.New("not ready")
+			}
+			return nil
+		},
+	}
+
+	failed := newWorker("retry", nil).execute(context.Background(), &j)
+	assert.False(t, failed)
+	assert.Equal(t, 3, runs)
+	assert.Equal(t, uint(2), j.Status.FailureCount)
+	assert.Len(t, j.Status.Attempts, 3)
+	assert.Equal(t, "not ready", j.Status.Attempts[0].Error)
+	assert.Equal(t, uint(2), j.Status.Attempts[1].Execution)
+	assert.Empty(t, j.Status.Attempts[2].Error)
+}
+
+func TestWorkerDoesNotRetryNonRetryableErrors(t *testing.T) {
+	runs := 0
+	j := Job{
+		ID:          "retry-non-retryable",
+		RetryPolicy: RetryPolicy{MaxAttempts: 3},
+		Run: func(ctx context.Context, args interface{}) error {
+			runs++
+			return NonRetryable(errors.New("invalid configuration"))
+		},
+	}
+
+	failed := newWorker("retry", nil).execute(context.Background(), &j)
+	assert.True(t, failed)
+	assert.Equal(t, 1, runs)
+	assert.Len(t, j.Status.Failures, 1)
+}
+
+func TestWorkerDoesNotRetryErrorsExcludedByPolicy(t *testing.T) {
+	errNotFound := errors.New("image not found")
+	runs := 0
+	j := Job{
+		ID: "retry-excluded",
+		RetryPolicy: RetryPolicy{MaxAttempts: 3, Retryable: func(err error) bool {
+			return !errors.Is(err, errNotFound)
+		}},
+		Run: func(ctx context.Context, args interface{}) error {
+			runs++
+			return errNotFound
+		},
+	}
+
+	failed := newWorker("retry", nil).execute(context.Background(), &j)
+	assert.True(t, failed)
+	assert.Equal(t, 1, runs)
+}
+
+func TestWorkerFailsJobsWithoutRun(t *testing.T) {
+	j := Job{ID: "retry-no-run", RetryPolicy: RetryPolicy{MaxAttempts: 3}}
+
+	failed := newWorker("retry", nil).execute(context.Background(), &j)
+	assert.True(t, failed)
+	assert.Equal(t, uint(0), j.Status.ExecutionCount)
+	assert.Equal(t, "job must have a Run implementation", j.Status.Failures[0].Message)
+}
+
+func TestWorkerAttemptsJobsWithoutRetryPolicyOnce(t *testing.T) {
+	runs := 0
+	j := Job{
+		ID: "retry-no-policy",
+		Run: func(ctx context.Context, args interface{}) error {
+			runs++
+			return nil
+		},
+	}
+
+	failed := newWorker("retry", nil).execute(context.Background(), &j)
+	assert.False(t, failed)
+	assert.Equal(t, 1, runs)
+}
@@ -1,6 +1,7 @@
 package job
 
 import (
+	"fmt"
 	"os"
 	"sync"
 
@@ -18,26 +19,24 @@ type WorkerPool struct {
 
 	store store.Store
 
-	workers    []*worker
-	workerPool chan chan Job
-	jobChannel chan Job
+	workers []*worker
+	queue   *Queue
 }
 
 // NewWorkerPool : create a concurrent pool of workers to process Jobs from the queue
-func NewWorkerPool(concurrency uint, jobChannel chan Job, store store.Store) WorkerPool {
+func NewWorkerPool(concurrency uint, queue *Queue, store store.Store) WorkerPool {
 	logger.Debugf("Creating new worker pool with %d worker(s)", concurrency)
 	wpID := utils.ShortID()
 	wp := WorkerPool{
 		workerPoolID: wpID,
 		concurrency:  concurrency,
 		store:        store,
-		workerPool:   make(chan chan Job, concurrency),
-		jobChannel:   jobChannel,
+		queue:        queue,
 	}
 
 	for i := uint(0); i < wp.concurrency; i++ {
 		logger.Debugf("Appending new worker to worker pool %s", wp.workerPoolID)
-		w := newWorker(wp.workerPool, wp.jobChannel)
+		w := newWorker(fmt.Sprintf("%s-%d", wp.workerPoolID, i), wp.queue)
 		wp.workers = append(wp.workers, w)
 	}
 
@@ -67,6 +66,8 @@ func (wp *WorkerPool) Start() {
 	return
 }
 
+// Stop : stops all the workers part of the worker pool, waiting for the jobs being executed to complete.
+// Pending jobs remain persisted in the queue and are resumed the next time Krane starts.
 func (wp *WorkerPool) Stop() {
 	logger.Info("Disconnect signal received")
 
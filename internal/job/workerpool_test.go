@@ -0,0 +1,103 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/krane/krane/internal/constants"
+	"github.com/krane/krane/internal/store"
+)
+
+func TestWorkerPoolStopWaitsForRunningJobs(t *testing.T) {
+	os.Setenv(constants.EnvJobMaxRetryPolicy, "1")
+	resetQueueCollection()
+	q := newQueue(store.Client(), 0)
+	e := NewEnqueuer(q)
+
+	started := make(chan bool)
+	completed := false
+	_, err := e.Enqueue(Job{
+		ID:          "workerpool-stop",
+		Deployment:  namespace,
+		Type:        "test",
+		RetryPolicy: RetryPolicy{MaxAttempts: 1},
+		Run: func(ctx context.Context, args interface{}) error {
+			started <- true
+			time.Sleep(100 * time.Millisecond)
+			completed = true
+			return nil
+		},
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	wp := NewWorkerPool(2, q, store.Client())
+	wp.Start()
+	<-started
+	wp.Stop()
+
+	assert.True(t, completed)
+	_, ok := q.Get("workerpool-stop")
+	assert.False(t, ok)
+	assert.False(t, q.inFlight(namespace))
+}
+
+func TestWorkerTimesOutJobs(t *testing.T) {
+	os.Setenv(constants.EnvJobMaxRetryPolicy, "1")
+	os.Setenv("JOB_TIMEOUT_TEST_TIMEOUT", "50ms")
+	defer os.Unsetenv("JOB_TIMEOUT_TEST_TIMEOUT")
+	resetQueueCollection()
+	_ = store.Client().CreateCollection(GetJobsCollectionName(namespace))
+	q := newQueue(store.Client(), 0)
+	e := NewEnqueuer(q)
+
+	rolledBack := false
+	_, err := e.Enqueue(Job{
+		ID:          "worker-timeout",
+		Deployment:  namespace,
+		Type:        "TEST_TIMEOUT",
+		RetryPolicy: RetryPolicy{MaxAttempts: 1},
+		Run: func(ctx context.Context, args interface{}) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+		Rollback: func(ctx context.Context, args interface{}) error {
+			rolledBack = true
+			return nil
+		},
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	w := newWorker("timeout", q)
+	w.start()
+	for q.inFlight(namespace) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	w.stop()
+
+	assert.False(t, rolledBack)
+
+	bytes, err := store.Client().GetAll(GetJobsCollectionName(namespace))
+	assert.Nil(t, err)
+
+	var timedOut *Job
+	for _, b := range bytes {
+		var j Job
+		if err := json.Unmarshal(b, &j); err == nil && j.ID == "worker-timeout" {
+			timedOut = &j
+		}
+	}
+	if !assert.NotNil(t, timedOut) {
+		return
+	}
+	assert.Equal(t, TimedOut, timedOut.State)
+	assert.Equal(t, "job timed out after 50ms", timedOut.Status.Failures[len(timedOut.Status.Failures)-1].Message)
+}
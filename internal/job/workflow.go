@@ -1,20 +1,52 @@
 package job
 
 import (
+	"context"
+	"fmt"
+	"time"
+
 	"github.com/krane/krane/internal/logger"
 )
 
+// undoTimeout is how long undo handlers have to compensate a failed workflow
+const undoTimeout = 5 * time.Minute
+
+// Workflow is a graph of named steps. A step runs once every step it depends on succeeded,
+// when more than one step is ready they are run one at a time in the order they were added.
+// A workflow stops at the first failing step, executing the undo handlers of the steps
+// that ran in the reverse order they ran in.
 type Workflow struct {
-	name string
-	args interface{}
-	head *Step
-	curr *Step
+	name  string
+	args  interface{}
+	steps []*Step
 }
 
+// Step is a named handler in a Workflow
 type Step struct {
-	name string
-	fn   GenericHandler
-	next *Step
+	name  string
+	fn    GenericHandler
+	undo  GenericHandler
+	deps  []string
+	retry RetryPolicy
+}
+
+// StepOption configures a Step added to a Workflow
+type StepOption func(s *Step)
+
+// DependsOn declares the steps that must succeed before a Step runs
+func DependsOn(steps ...string) StepOption {
+	return func(s *Step) { s.deps = append(s.deps, steps...) }
+}
+
+// Undo sets the compensating handler of a Step, executed if the Workflow fails after the Step ran
+func Undo(handler GenericHandler) StepOption {
+	return func(s *Step) { s.undo = handler }
+}
+
+// Retry sets the retry policy of a Step, steps are attempted once by default. Steps are retried within
+// an attempt of their job, a Step is executed up to its max attempts times for every attempt of the job.
+func Retry(policy RetryPolicy) StepOption {
+	return func(s *Step) { s.retry = policy }
 }
 
 // NewWorkflow : creates a new workflow
@@ -23,49 +55,159 @@ func NewWorkflow(name string, args interface{}) Workflow {
 }
 
 // With : add new step to a workflow
-func (wf *Workflow) With(name string, handler GenericHandler) {
-	s := &Step{name: name, fn: handler}
-	if wf.head == nil {
-		wf.head = s
-	} else {
-		currStep := wf.head
-		for currStep.next != nil {
-			currStep = currStep.next
-		}
-		currStep.next = s
+func (wf *Workflow) With(name string, handler GenericHandler, options ...StepOption) {
+	s := &Step{name: name, fn: handler, retry: RetryPolicy{MaxAttempts: 1}}
+	for _, option := range options {
+		option(s)
 	}
+	wf.steps = append(wf.steps, s)
 }
 
 // Start : executes every Step in a Workflow
-// returns an error if any Step in the Workflow errors out.
-func (wf *Workflow) Start() error {
-	wf.curr = wf.head
-
-	// run every Step starting from the head of the Workflow
-	// until there aren't any steps left to run
-	for wf.curr != nil {
-		logger.Debugf("Running Workflow %s | Step %s", wf.name, wf.curr.name)
-
-		// execute every Step passing down args
-		err := wf.curr.fn(wf.args)
-		if err != nil {
-			// if any Step fails, the Workflow
-			// stops executing further steps
+// returns an error if the Workflow is not a valid graph, any Step in the Workflow errors out or the context is done.
+// The status of every Step is recorded onto the Workflow arguments when they embed a Tracker.
+func (wf *Workflow) Start(ctx context.Context) error {
+	order, err := wf.order()
+	if err != nil {
+		return err
+	}
+
+	statuses := make([]StepStatus, len(order))
+	for i, s := range order {
+		statuses[i] = StepStatus{Step: s.name, State: StepPending}
+	}
+	defer wf.track(statuses)
+
+	for i, s := range order {
+		logger.Debugf("Running Workflow %s | Step %s", wf.name, s.name)
+
+		if err := wf.run(ctx, s, &statuses[i]); err != nil {
+			// if any Step fails, the Workflow stops executing
+			// further steps and undoes the steps that ran
+			for j := i + 1; j < len(order); j++ {
+				statuses[j].State = StepSkipped
+			}
+			wf.undo(order[:i+1], statuses)
 			return err
 		}
-
-		wf.curr = wf.next()
 	}
 
 	return nil
 }
 
-// next : execute the next Step (if any) in the Workflow
-func (wf *Workflow) next() *Step {
-	if wf.curr == nil {
-		return nil
+// run attempts a Step until it succeeds or its retry policy is exhausted
+func (wf *Workflow) run(ctx context.Context, s *Step, status *StepStatus) error {
+	status.StartTime = time.Now().Unix()
+	defer func() { status.EndTime = time.Now().Unix() }()
+
+	var err error
+	for attempt := uint(1); attempt <= s.retry.attempts(); attempt++ {
+		if attempt > 1 {
+			delay := s.retry.delay(attempt - 1)
+			logger.Debugf("Retrying Workflow %s | Step %s in %s", wf.name, s.name, delay)
+			if !wait(ctx, delay) {
+				break
+			}
+		}
+
+		if err = ctx.Err(); err != nil {
+			break
+		}
+
+		status.Attempts++
+		if err = s.fn(ctx, wf.args); err == nil {
+			status.State = StepSucceeded
+			status.Error = ""
+			return nil
+		}
+
+		if !s.retry.retryable(err) {
+			break
+		}
 	}
 
-	wf.curr = wf.curr.next
-	return wf.curr
+	status.State = StepFailed
+	status.Error = err.Error()
+	return err
+}
+
+// undo executes the undo handlers of the steps that ran in reverse order. Undo handlers run
+// even if the Workflow context is done so steps interrupted by a cancellation are compensated.
+func (wf *Workflow) undo(ran []*Step, statuses []StepStatus) {
+	ctx, cancel := context.WithTimeout(context.Background(), undoTimeout)
+	defer cancel()
+
+	for i := len(ran) - 1; i >= 0; i-- {
+		s := ran[i]
+		if s.undo == nil {
+			continue
+		}
+
+		logger.Debugf("Undoing Workflow %s | Step %s", wf.name, s.name)
+		if err := s.undo(ctx, wf.args); err != nil {
+			logger.Warnf("Unable to undo Workflow %s | Step %s, %v", wf.name, s.name, err)
+			statuses[i].State = StepUndoFailed
+			statuses[i].Error = err.Error()
+			continue
+		}
+		statuses[i].State = StepUndone
+	}
+}
+
+// order returns the steps of a Workflow sorted so every Step comes after its dependencies,
+// returns an error if a Step name is duplicated, a dependency does not exist or the steps form a cycle.
+func (wf *Workflow) order() ([]*Step, error) {
+	steps := make(map[string]*Step)
+	for _, s := range wf.steps {
+		if _, ok := steps[s.name]; ok {
+			return nil, fmt.Errorf("workflow %s has more than one step named %s", wf.name, s.name)
+		}
+		steps[s.name] = s
+	}
+
+	for _, s := range wf.steps {
+		for _, dep := range s.deps {
+			if _, ok := steps[dep]; !ok {
+				return nil, fmt.Errorf("workflow %s step %s depends on unknown step %s", wf.name, s.name, dep)
+			}
+		}
+	}
+
+	order := make([]*Step, 0, len(wf.steps))
+	done := make(map[string]bool)
+	for len(order) < len(wf.steps) {
+		progressed := false
+		for _, s := range wf.steps {
+			if done[s.name] || !dependenciesDone(s, done) {
+				continue
+			}
+			order = append(order, s)
+			done[s.name] = true
+			progressed = true
+			break
+		}
+
+		if !progressed {
+			return nil, fmt.Errorf("workflow %s steps have a circular dependency", wf.name)
+		}
+	}
+
+	return order, nil
+}
+
+// track records the status of every Step onto the Workflow arguments
+func (wf *Workflow) track(statuses []StepStatus) {
+	if t, ok := wf.args.(tracked); ok {
+		t.trackSteps(statuses)
+	}
+}
+
+// dependenciesDone returns true if every dependency of a Step is done
+func dependenciesDone(s *Step, done map[string]bool) bool {
+	for _, dep := range s.deps {
+		if !done[dep] {
+			return false
+		}
+	}
+	return true
 }
@@ -1,24 +1,21 @@
 package job
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
 
 func TestWorkflowWithNoStepsDoesntError(t *testing.T) {
 	wf := NewWorkflow("noSteps", nil)
-	err := wf.Start()
+	err := wf.Start(context.Background())
 	assert.Nil(t, err)
 }
 
-func TestWorkflowWithNoStepsOnCallNextReturnsNil(t *testing.T) {
-	wf := NewWorkflow("noSteps", nil)
-	assert.Nil(t, wf.next())
-}
-
 func TestWorkflowWithNSteps(t *testing.T) {
 	// This test is formatted a bit weird to test
 	// that the steps in a Workflow are executed.
@@ -33,7 +30,7 @@ func TestWorkflowWithNSteps(t *testing.T) {
 	x := 0
 
 	// Step function used to increment x
-	incX := func(args interface{}) error {
+	incX := func(ctx context.Context, args interface{}) error {
 		x := args.(map[string]*int)["stepCount"]
 		*x++
 		return nil
@@ -55,7 +52,7 @@ func TestWorkflowWithNSteps(t *testing.T) {
 	}
 
 	// Start the Workflow
-	err := wf.Start()
+	err := wf.Start(context.Background())
 
 	assert.Nil(t, err)
 	assert.Equal(t, stepCount, *args["stepCount"])
@@ -64,7 +61,7 @@ func TestWorkflowWithNSteps(t *testing.T) {
 func TestWorkflowError(t *testing.T) {
 	wf := NewWorkflow("testWorkflowError", nil)
 
-	step := func(args interface{}) error {
+	step := func(ctx context.Context, args interface{}) error {
 		if args == nil {
 			return errors.New("Step args cannot be nil")
 		}
@@ -73,8 +70,127 @@ func TestWorkflowError(t *testing.T) {
 
 	wf.With("VerifyArgsNotNil", step)
 
-	err := wf.Start()
+	err := wf.Start(context.Background())
 
 	assert.Error(t, err)
 	assert.Equal(t, "Step args cannot be nil", err.Error())
 }
+
+func TestWorkflowRunsStepsAfterDependencies(t *testing.T) {
+	ran := make([]string, 0)
+	step := func(name string) GenericHandler {
+		return func(ctx context.Context, args interface{}) error {
+			ran = append(ran, name)
+			return nil
+		}
+	}
+
+	wf := NewWorkflow("testDependencies", nil)
+	wf.With("teardown", step("teardown"), DependsOn("health"))
+	wf.With("health", step("health"), DependsOn("start"))
+	wf.With("pull", step("pull"))
+	wf.With("start", step("start"), DependsOn("create"))
+	wf.With("create", step("create"), DependsOn("pull"))
+
+	assert.Nil(t, wf.Start(context.Background()))
+	assert.Equal(t, []string{"pull", "create", "start", "health", "teardown"}, ran)
+}
+
+func TestInvalidWorkflow(t *testing.T) {
+	noop := func(ctx context.Context, args interface{}) error { return nil }
+
+	unknown := NewWorkflow("testUnknownDependency", nil)
+	unknown.With("start", noop, DependsOn("create"))
+	assert.Error(t, unknown.Start(context.Background()))
+
+	duplicate := NewWorkflow("testDuplicateStep", nil)
+	duplicate.With("start", noop)
+	duplicate.With("start", noop)
+	assert.Error(t, duplicate.Start(context.Background()))
+
+	cycle := NewWorkflow("testCycle", nil)
+	cycle.With("a", noop, DependsOn("c"))
+	cycle.With("b", noop, DependsOn("a"))
+	cycle.With("c", noop, DependsOn("b"))
+	assert.Error(t, cycle.Start(context.Background()))
+}
+
+func TestWorkflowUndoesStepsThatRan(t *testing.T) {
+	undone := make([]string, 0)
+	undo := func(name string) GenericHandler {
+		return func(ctx context.Context, args interface{}) error {
+			undone = append(undone, name)
+			return nil
+		}
+	}
+	noop := func(ctx context.Context, args interface{}) error { return nil }
+
+	args := &struct{ Tracker }{}
+	wf := NewWorkflow("testUndo", args)
+	wf.With("create", noop, Undo(undo("create")))
+	wf.With("start", noop, DependsOn("create"), Undo(undo("start")))
+	wf.With("health", func(ctx context.Context, args interface{}) error {
+		return errors.New("unhealthy")
+	}, DependsOn("start"), Undo(undo("health")))
+	wf.With("teardown", noop, DependsOn("health"), Undo(undo("teardown")))
+
+	err := wf.Start(context.Background())
+	assert.Error(t, err)
+	assert.Equal(t, []string{"health", "start", "create"}, undone)
+
+	steps := args.Steps()
+	assert.Len(t, steps, 4)
+	assert.Equal(t, StepUndone, steps[0].State)
+	assert.Equal(t, StepUndone, steps[1].State)
+	assert.Equal(t, StepUndone, steps[2].State)
+	assert.Equal(t, "unhealthy", steps[2].Error)
+	assert.Equal(t, StepSkipped, steps[3].State)
+
+	// the failed step is found once undone
+	assert.Equal(t, "health", args.FailedStep())
+}
+
+func TestWorkflowFailedStep(t *testing.T) {
+	noop := func(ctx context.Context, args interface{}) error { return nil }
+
+	args := &struct{ Tracker }{}
+	assert.Empty(t, args.FailedStep())
+
+	wf := NewWorkflow("testFailedStep", args)
+	wf.With("pull", func(ctx context.Context, args interface{}) error {
+		return errors.New("registry unavailable")
+	})
+	wf.With("create", noop, DependsOn("pull"))
+	assert.Error(t, wf.Start(context.Background()))
+	assert.Equal(t, "pull", args.FailedStep())
+
+	// only the steps of the current execution are considered
+	args.setExecution(1)
+	succeeded := NewWorkflow("testFailedStep", args)
+	succeeded.With("pull", noop)
+	succeeded.With("create", noop, DependsOn("pull"))
+	assert.Nil(t, succeeded.Start(context.Background()))
+	assert.Empty(t, args.FailedStep())
+}
+
+func TestWorkflowRetriesSteps(t *testing.T) {
+	pulls := 0
+	args := &struct{ Tracker }{}
+	wf := NewWorkflow("testRetry", args)
+	wf.With("pull", func(ctx context.Context, args interface{}) error {
+		pulls++
+		if pulls < 3 {
+			return errors.New("registry unavailable")
+		}
+		return nil
+	}, Retry(RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}))
+
+	assert.Nil(t, wf.Start(context.Background()))
+	assert.Equal(t, 3, pulls)
+
+	steps := args.Steps()
+	assert.Len(t, steps, 1)
+	assert.Equal(t, StepSucceeded, steps[0].State)
+	assert.Equal(t, uint(3), steps[0].Attempts)
+	assert.Empty(t, steps[0].Error)
+}
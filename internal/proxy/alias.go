@@ -0,0 +1,151 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"strings"
+)
+
+// Alias routes http requests for a domain, and optionally a path prefix, to a deployment
+type Alias struct {
+	Host        string `json:"host"`         // domain alias (my-app.example.com or my-app.localhost)
+	PathPrefix  string `json:"path_prefix"`  // only route requests with paths starting with the prefix (ie. /api)
+	StripPrefix bool   `json:"strip_prefix"` // remove the path prefix before forwarding requests to the containers
+	Priority    int    `json:"priority"`     // router priority, higher priorities are matched first (default 0, the rule length)
+}
+
+// UnmarshalJSON decodes an alias from an object or from a domain (ie. "my-app.example.com")
+func (a *Alias) UnmarshalJSON(data []byte) error {
+	var host string
+	if err := json.Unmarshal(data, &host); err == nil {
+		*a = Alias{Host: host}
+		return nil
+	}
+
+	// decode into a type without the UnmarshalJSON method to avoid recursion
+	type alias Alias
+	var decoded alias
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	*a = Alias(decoded)
+	return nil
+}
+
+// String returns the domain and path prefix of an alias (ie. my-app.example.com/api)
+func (a Alias) String() string {
+	return a.Host + a.PathPrefix
+}
+
+// Empty returns whether an alias does not route any request
+func (a Alias) Empty() bool {
+	return a.Host == "" && a.PathPrefix == ""
+}
+
+var (
+	// hostPattern matches RFC 1123 hostnames, optionally prefixed by a *. wildcard (*.example.com)
+	hostPattern = regexp.MustCompile(`^(\*\.)?[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$`)
+
+	// pathPrefixPattern matches URL paths made of unreserved and percent-encoded characters. Characters with
+	// a meaning in the Traefik rules or in the Caddy and nginx configurations (`;{}* and whitespace) are not allowed.
+	pathPrefixPattern = regexp.MustCompile(`^(/([a-zA-Z0-9._~!+,=:@-]|%[0-9a-fA-F]{2})*)+$`)
+)
+
+// IsValid returns an error if an alias is not valid. Hosts and path prefixes are inserted as is in the
+// configuration of the proxy, only hostnames and URL path characters are allowed.
+func (a Alias) IsValid() error {
+	if a.Host != "" && (len(a.Host) > 253 || !hostPattern.MatchString(a.Host)) {
+		return fmt.Errorf("invalid alias %q, host must be a valid hostname", a.Host)
+	}
+
+	if a.PathPrefix != "" && !strings.HasPrefix(a.PathPrefix, "/") {
+		return fmt.Errorf("invalid alias %s, path_prefix must start with /", a)
+	}
+
+	if a.PathPrefix != "" && !pathPrefixPattern.MatchString(a.PathPrefix) {
+		return fmt.Errorf("invalid alias %q, path_prefix must only contain URL path characters", a)
+	}
+
+	if a.StripPrefix && a.PathPrefix == "" {
+		return fmt.Errorf("invalid alias %s, strip_prefix requires a path_prefix", a)
+	}
+
+	if a.Priority < 0 {
+		return errors.New("invalid alias priority, cannot be negative")
+	}
+
+	return nil
+}
+
+// rule returns the Host and PathPrefix rule of an alias
+func (a Alias) rule() string {
+	rules := make([]string, 0)
+	if a.Host != "" {
+		rules = append(rules, fmt.Sprintf("Host(`%s`)", a.Host))
+	}
+	if a.PathPrefix != "" {
+		rules = append(rules, fmt.Sprintf("PathPrefix(`%s`)", a.PathPrefix))
+	}
+	return strings.Join(rules, " && ")
+}
+
+// Hosts returns the unique domains of a list of aliases
+func Hosts(aliases []Alias) []string {
+	hosts := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, a := range aliases {
+		if a.Host == "" || seen[a.Host] {
+			continue
+		}
+		seen[a.Host] = true
+		hosts = append(hosts, a.Host)
+	}
+	return hosts
+}
+
+// routerName returns the name of the router of an alias routed on its own. The name is a hash of the
+// domain and path prefix so it does not change when aliases are reordered, and it starts with a digit
+// so it never collides with the routers of a deployment (deployment names start with a letter).
+func (a Alias) routerName(deployment string) string {
+	h := fnv.New32a()
+	h.Write([]byte(a.String()))
+	return fmt.Sprintf("%010d-%s", h.Sum32(), deployment)
+}
+
+// aliasRouter is the http router of a deployment routing requests for one or more aliases
+type aliasRouter struct {
+	name    string
+	aliases []Alias
+}
+
+// rule returns the rule of a router matching any of its aliases
+func (r aliasRouter) rule() string {
+	rules := make([]string, 0, len(r.aliases))
+	for _, a := range r.aliases {
+		rules = append(rules, a.rule())
+	}
+	return strings.Join(rules, " || ")
+}
+
+// aliasRouters returns the http routers of a deployment. Aliases without a path prefix or priority
+// are routed by the deployment router, every other alias is routed by its own router since prefix
+// stripping and priorities apply to a whole router.
+func aliasRouters(deployment string, aliases []Alias) []aliasRouter {
+	routers := []aliasRouter{{name: deployment, aliases: make([]Alias, 0)}}
+	for _, a := range aliases {
+		if a.Empty() {
+			continue
+		}
+
+		if a.PathPrefix == "" && a.Priority == 0 {
+			routers[0].aliases = append(routers[0].aliases, a)
+			continue
+		}
+
+		routers = append(routers, aliasRouter{name: a.routerName(deployment), aliases: []Alias{a}})
+	}
+	return routers
+}
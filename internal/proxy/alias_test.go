@@ -0,0 +1,156 @@
+package proxy
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/krane/krane/internal/proxy/middlewares"
+)
+
+func TestUnmarshalAliases(t *testing.T) {
+	var aliases []Alias
+	err := json.Unmarshal([]byte(`["example.com", {"host": "example.com", "path_prefix": "/api", "strip_prefix": true, "priority": 10}]`), &aliases)
+	assert.Nil(t, err)
+	assert.Equal(t, []Alias{
+		{Host: "example.com"},
+		{Host: "example.com", PathPrefix: "/api", StripPrefix: true, Priority: 10},
+	}, aliases)
+
+	assert.Error(t, json.Unmarshal([]byte(`[80]`), &aliases))
+}
+
+func TestAliasIsValid(t *testing.T) {
+	assert.Nil(t, Alias{Host: "example.com"}.IsValid())
+	assert.Nil(t, Alias{PathPrefix: "/api", StripPrefix: true}.IsValid())
+
+	assert.Error(t, Alias{Host: "example.com", PathPrefix: "api"}.IsValid())
+	assert.Error(t, Alias{Host: "example.com", StripPrefix: true}.IsValid())
+	assert.Error(t, Alias{Host: "example.com", Priority: -1}.IsValid())
+}
+
+func TestAliasIsValidHost(t *testing.T) {
+	for _, host := range []string{"example.com", "my-app.example.com", "localhost", "*.example.com", "app1.example.io"} {
+		assert.Nil(t, Alias{Host: host}.IsValid(), host)
+	}
+
+	for _, host := range []string{
+		"example.com`) || Host(`evil.com",
+		"example .com",
+		"example.com\n",
+		"example.com;",
+		"example.com{",
+		"example.com}",
+		"example.com\tevil",
+		"-example.com",
+		"example-.com",
+		"example..com",
+		"example.com:8080",
+		"example.com/api",
+		"*example.com",
+		"app.*.example.com",
+		strings.Repeat("a", 64) + ".com",
+	} {
+		assert.Error(t, Alias{Host: host}.IsValid(), host)
+	}
+}
+
+func TestAliasIsValidPathPrefix(t *testing.T) {
+	for _, prefix := range []string{"/", "/api", "/api/v1", "/my-app_v2.0", "/~user", "/caf%C3%A9", "/a:b@c+d,e=f!"} {
+		assert.Nil(t, Alias{Host: "example.com", PathPrefix: prefix}.IsValid(), prefix)
+	}
+
+	for _, prefix := range []string{
+		"/api`)",
+		"/api v1",
+		"/api\n",
+		"/api;",
+		"/api{",
+		"/api}",
+		"/api\t",
+		"/api*",
+		"/api?x=1",
+		"/api#top",
+		"/api'",
+		"/api\"",
+		"/api$1",
+		"/api%zz",
+	} {
+		assert.Error(t, Alias{Host: "example.com", PathPrefix: prefix}.IsValid(), prefix)
+	}
+}
+
+func TestTraefikRouterLabels(t *testing.T) {
+	labels := TraefikRouterLabels("app", []Alias{
+		{Host: "example.com"},
+		{Host: "www.example.com"},
+		{},
+		{Host: "example.com", PathPrefix: "/api", Priority: 10},
+	}, false)
+
+	assert.Equal(t, map[string]string{
+		"traefik.http.routers.app-insecure.rule":                   "Host(`example.com`) || Host(`www.example.com`)",
+		"traefik.http.routers.app-insecure.entrypoints":            "web",
+		"traefik.http.routers.0506037977-app-insecure.rule":        "Host(`example.com`) && PathPrefix(`/api`)",
+		"traefik.http.routers.0506037977-app-insecure.entrypoints": "web",
+		"traefik.http.routers.0506037977-app-insecure.priority":    "10",
+	}, labels)
+}
+
+func TestTraefikMiddlewareLabels(t *testing.T) {
+	labels := TraefikMiddlewareLabels("app", []Alias{
+		{Host: "example.com"},
+		{Host: "example.com", PathPrefix: "/api", StripPrefix: true},
+	}, true, 10, middlewares.Middlewares{})
+
+	assert.Equal(t, "redirect-to-https,app-ratelimit", labels["traefik.http.routers.app-insecure.middlewares"])
+	assert.Equal(t, "app-ratelimit", labels["traefik.http.routers.app-secure.middlewares"])
+	assert.Equal(t, "redirect-to-https,0506037977-app-stripprefix,app-ratelimit", labels["traefik.http.routers.0506037977-app-insecure.middlewares"])
+	assert.Equal(t, "0506037977-app-stripprefix,app-ratelimit", labels["traefik.http.routers.0506037977-app-secure.middlewares"])
+	assert.Equal(t, "/api", labels["traefik.http.middlewares.0506037977-app-stripprefix.stripprefix.prefixes"])
+}
+
+func TestTraefikMiddlewareLabelsWithoutMiddlewares(t *testing.T) {
+	labels := TraefikMiddlewareLabels("app", []Alias{{Host: "example.com"}}, false, 0, middlewares.Middlewares{})
+	assert.Empty(t, labels)
+
+	labels = TraefikMiddlewareLabels("app", []Alias{{Host: "example.com"}}, true, 0, middlewares.Middlewares{})
+	assert.Equal(t, "redirect-to-https", labels["traefik.http.routers.app-insecure.middlewares"])
+	assert.NotContains(t, labels, "traefik.http.routers.app-secure.middlewares")
+}
+
+func TestTraefikMiddlewareLabelsOrder(t *testing.T) {
+	labels := TraefikMiddlewareLabels("app", []Alias{{Host: "example.com"}}, false, 5, middlewares.Middlewares{
+		BasicAuth:      middlewares.BasicAuth{Users: []string{"@ADMIN"}, Credentials: []string{"admin:$apr1$hash"}},
+		IPAllowList:    middlewares.IPAllowList{SourceRange: []string{"10.0.0.0/8"}},
+		Headers:        middlewares.Headers{HSTS: middlewares.HSTS{MaxAge: 31536000}},
+		Compress:       true,
+		Retry:          middlewares.Retry{Attempts: 3},
+		CircuitBreaker: middlewares.CircuitBreaker{Expression: "NetworkErrorRatio() > 0.30"},
+	})
+
+	assert.Equal(t,
+		"app-ipallowlist,app-headers,app-basicauth,app-ratelimit,app-compress,app-circuitbreaker,app-retry",
+		labels["traefik.http.routers.app-insecure.middlewares"])
+	assert.Equal(t, "admin:$apr1$hash", labels["traefik.http.middlewares.app-basicauth.basicauth.users"])
+	assert.Equal(t, "5", labels["traefik.http.middlewares.app-ratelimit.ratelimit.average"])
+}
+
+func TestAliasRouterNames(t *testing.T) {
+	api := Alias{Host: "example.com", PathPrefix: "/api"}
+	admin := Alias{Host: "example.com", PathPrefix: "/admin"}
+
+	// router names do not change when aliases are reordered
+	routers := aliasRouters("app", []Alias{api, admin})
+	reordered := aliasRouters("app", []Alias{admin, api})
+	assert.Equal(t, routers[1].name, reordered[2].name)
+	assert.Equal(t, routers[2].name, reordered[1].name)
+
+	// alias routers never collide with the router of another deployment (ie. app-1)
+	for _, r := range routers[1:] {
+		assert.NotEqual(t, "app-1", r.name)
+		assert.Regexp(t, "^[0-9]{10}-app$", r.name)
+	}
+}
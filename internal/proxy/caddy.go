@@ -0,0 +1,157 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/krane/krane/internal/logger"
+	"github.com/krane/krane/internal/proxy/middlewares"
+)
+
+// renderCaddyfile renders the Caddyfile serving the sites of deployments. Secure sites use
+// Caddy automatic HTTPS, other sites are only served over http.
+func renderCaddyfile(sites []site) []byte {
+	var b bytes.Buffer
+	b.WriteString(configHeader)
+
+	for i, s := range sites {
+		address := s.host
+		switch {
+		case s.host == "":
+			address = ":80"
+		case !s.secure:
+			address = fmt.Sprintf("http://%s", s.host)
+		}
+
+		fmt.Fprintf(&b, "\n%s {\n", address)
+		for j, l := range s.locations {
+			writeCaddyLocation(&b, fmt.Sprintf("krane_%d_%d", i, j), l)
+		}
+		b.WriteString("}\n")
+	}
+
+	return b.Bytes()
+}
+
+// writeCaddyLocation writes the handle block routing a path prefix of a site to a deployment
+func writeCaddyLocation(b *bytes.Buffer, id string, l location) {
+	handle := "handle"
+	if l.stripPrefix {
+		handle = "handle_path"
+	}
+
+	if l.pathPrefix == "" {
+		fmt.Fprintf(b, "\t%s {\n", handle)
+	} else {
+		fmt.Fprintf(b, "\t%s %s* {\n", handle, l.pathPrefix)
+	}
+
+	mw := l.middlewares
+
+	// ip allowlist
+	if len(mw.IPAllowList.SourceRange) > 0 {
+		fmt.Fprintf(b, "\t\t@%s_denied not remote_ip %s\n", id, strings.Join(mw.IPAllowList.SourceRange, " "))
+		fmt.Fprintf(b, "\t\trespond @%s_denied 403\n", id)
+	}
+
+	// headers
+	for _, name := range sortedKeys(mw.Headers.Request) {
+		writeCaddyHeader(b, "request_header", name, mw.Headers.Request[name])
+	}
+	for _, name := range sortedKeys(mw.Headers.Response) {
+		writeCaddyHeader(b, "header", name, mw.Headers.Response[name])
+	}
+
+	cors := mw.Headers.CORS
+	if len(cors.AllowOrigins) > 0 {
+		fmt.Fprintf(b, "\t\t@%s_cors header Origin %s\n", id, strings.Join(cors.AllowOrigins, " "))
+		fmt.Fprintf(b, "\t\theader @%s_cors Access-Control-Allow-Origin {http.request.header.Origin}\n", id)
+		fmt.Fprintf(b, "\t\theader @%s_cors Vary Origin\n", id)
+		if len(cors.AllowMethods) > 0 {
+			fmt.Fprintf(b, "\t\theader @%s_cors Access-Control-Allow-Methods %q\n", id, strings.Join(cors.AllowMethods, ", "))
+		}
+		if len(cors.AllowHeaders) > 0 {
+			fmt.Fprintf(b, "\t\theader @%s_cors Access-Control-Allow-Headers %q\n", id, strings.Join(cors.AllowHeaders, ", "))
+		}
+		if cors.AllowCredentials {
+			fmt.Fprintf(b, "\t\theader @%s_cors Access-Control-Allow-Credentials true\n", id)
+		}
+		if cors.MaxAge > 0 {
+			fmt.Fprintf(b, "\t\theader @%s_cors Access-Control-Max-Age %d\n", id, cors.MaxAge)
+		}
+	}
+
+	if hsts := hstsHeader(mw.Headers.HSTS); hsts != "" {
+		writeCaddyHeader(b, "header", "Strict-Transport-Security", hsts)
+	}
+
+	// basic auth, Caddy only supports bcrypt hashed passwords
+	if len(mw.BasicAuth.Credentials) > 0 {
+		if mw.BasicAuth.Realm != "" {
+			fmt.Fprintf(b, "\t\tbasicauth bcrypt %q {\n", mw.BasicAuth.Realm)
+		} else {
+			b.WriteString("\t\tbasicauth {\n")
+		}
+		for _, credentials := range mw.BasicAuth.Credentials {
+			fmt.Fprintf(b, "\t\t\t%s\n", strings.Replace(credentials, ":", " ", 1))
+		}
+		b.WriteString("\t\t}\n")
+		if mw.BasicAuth.RemoveHeader {
+			writeCaddyHeader(b, "request_header", "Authorization", "")
+		}
+	}
+
+	if l.rateLimit > 0 || mw.CircuitBreaker.Expression != "" {
+		logger.Warnf("rate limit and circuit breaker of deployment %s are not supported by caddy", l.deployment)
+	}
+
+	if mw.Compress {
+		b.WriteString("\t\tencode gzip\n")
+	}
+
+	if mw.Retry.Attempts > 0 {
+		fmt.Fprintf(b, "\t\treverse_proxy %s {\n", strings.Join(l.upstreams, " "))
+		fmt.Fprintf(b, "\t\t\tlb_retries %d\n", mw.Retry.Attempts)
+		b.WriteString("\t\t}\n")
+	} else {
+		fmt.Fprintf(b, "\t\treverse_proxy %s\n", strings.Join(l.upstreams, " "))
+	}
+
+	b.WriteString("\t}\n")
+}
+
+// writeCaddyHeader writes a header directive, empty values remove the header
+func writeCaddyHeader(b *bytes.Buffer, directive, name, value string) {
+	if value == "" {
+		fmt.Fprintf(b, "\t\t%s -%s\n", directive, name)
+		return
+	}
+	fmt.Fprintf(b, "\t\t%s %s %q\n", directive, name, value)
+}
+
+// hstsHeader returns the value of the Strict-Transport-Security header, empty if HSTS is disabled
+func hstsHeader(hsts middlewares.HSTS) string {
+	if hsts.MaxAge <= 0 {
+		return ""
+	}
+
+	value := fmt.Sprintf("max-age=%d", hsts.MaxAge)
+	if hsts.IncludeSubdomains {
+		value += "; includeSubDomains"
+	}
+	if hsts.Preload {
+		value += "; preload"
+	}
+	return value
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
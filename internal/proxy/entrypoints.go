@@ -0,0 +1,90 @@
+package proxy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Entrypoints of the proxy used by http routers
+const (
+	WebEntrypoint       = "web"
+	WebSecureEntrypoint = "web-secure"
+)
+
+// Entrypoint is a port the proxy listens on for tcp or udp routers
+type Entrypoint struct {
+	Name     string
+	Port     string
+	Protocol string // tcp or udp
+}
+
+// ParseEntrypoints parses a comma separated list of proxy entrypoints
+// formatted as name=port[/protocol] (ie. postgres=5432,dns=53/udp)
+func ParseEntrypoints(value string) ([]Entrypoint, error) {
+	entrypoints := make([]Entrypoint, 0)
+	names := make(map[string]bool)
+
+	for _, spec := range strings.Split(value, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+
+		i := strings.Index(spec, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid entrypoint %s, expected name=port[/protocol]", spec)
+		}
+
+		e := Entrypoint{Name: spec[:i], Port: spec[i+1:], Protocol: "tcp"}
+		if j := strings.Index(e.Port, "/"); j >= 0 {
+			e.Port, e.Protocol = e.Port[:j], e.Port[j+1:]
+		}
+
+		if e.Protocol != "tcp" && e.Protocol != "udp" {
+			return nil, fmt.Errorf("invalid entrypoint %s, protocol must be tcp or udp", spec)
+		}
+
+		if err := isValidRoute(e.Name, e.Port); err != nil {
+			return nil, err
+		}
+
+		if names[e.Name] {
+			return nil, fmt.Errorf("entrypoint %s is defined more than once", e.Name)
+		}
+		names[e.Name] = true
+
+		entrypoints = append(entrypoints, e)
+	}
+
+	return entrypoints, nil
+}
+
+// Address returns the address the proxy listens on for an entrypoint (ie. :53/udp)
+func (e Entrypoint) Address() string {
+	return fmt.Sprintf(":%s/%s", e.Port, e.Protocol)
+}
+
+// TraefikEntrypointEnvs returns the environment variables configuring the entrypoints of the proxy
+func TraefikEntrypointEnvs(entrypoints []Entrypoint) map[string]string {
+	envs := make(map[string]string, 0)
+	for _, e := range entrypoints {
+		envs[fmt.Sprintf("TRAEFIK_ENTRYPOINTS_%s_ADDRESS", strings.ToUpper(e.Name))] = e.Address()
+	}
+	return envs
+}
+
+// isReservedEntrypoint returns whether an entrypoint is reserved for http routers or the proxy dashboard
+func isReservedEntrypoint(name string) bool {
+	switch name {
+	case WebEntrypoint, WebSecureEntrypoint, "traefik":
+		return true
+	}
+	return false
+}
+
+// isValidPort returns whether a port is a number between 1 and 65535
+func isValidPort(port string) bool {
+	n, err := strconv.Atoi(port)
+	return err == nil && n > 0 && n <= 65535
+}
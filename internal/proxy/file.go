@@ -0,0 +1,295 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/krane/krane/internal/logger"
+	"github.com/krane/krane/internal/proxy/middlewares"
+)
+
+// configHeader is written at the top of the configuration files rendered by Krane
+const configHeader = "# Generated by Krane, changes are overwritten when deployments are updated\n"
+
+// FileProvider routes requests using a Caddy or nginx configuration file rendered from the
+// routes of every deployment, the server is reloaded every time the configuration changes.
+type FileProvider struct {
+	server        string
+	configPath    string
+	reloadCommand []string
+	mu            sync.Mutex
+}
+
+// NewFileProvider returns a Caddy or nginx provider, the default configuration path and
+// reload command are used when empty (/etc/caddy/Caddyfile or /etc/nginx/conf.d/krane.conf)
+func NewFileProvider(server, configPath, reloadCommand string) *FileProvider {
+	if configPath == "" {
+		configPath = "/etc/nginx/conf.d/krane.conf"
+		if server == CaddyProvider {
+			configPath = "/etc/caddy/Caddyfile"
+		}
+	}
+
+	if reloadCommand == "" {
+		reloadCommand = "nginx -s reload"
+		if server == CaddyProvider {
+			reloadCommand = fmt.Sprintf("caddy reload --config %s --adapter caddyfile", configPath)
+		}
+	}
+
+	return &FileProvider{
+		server:        server,
+		configPath:    configPath,
+		reloadCommand: strings.Fields(reloadCommand),
+	}
+}
+
+// Name returns the name of the server the configuration is rendered for
+func (p *FileProvider) Name() string { return p.server }
+
+// Labels returns no labels, routes are rendered to the configuration file when syncing
+func (p *FileProvider) Labels(_ Route) map[string]string { return make(map[string]string, 0) }
+
+// Sync renders the configuration of the server and reloads it when the configuration changed
+func (p *FileProvider) Sync(ctx context.Context, routes []Route) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// a route the server cannot serve is left out, the other deployments are still routed
+	files := p.render(p.validRoutes(routes))
+
+	changed := false
+	for _, path := range sortedFilePaths(files) {
+		current, _ := ioutil.ReadFile(path)
+		if bytes.Equal(current, files[path]) {
+			continue
+		}
+
+		if err := writeFile(path, files[path]); err != nil {
+			return err
+		}
+		changed = true
+	}
+
+	// basic auth users files of deleted deployments, or deployments no longer using basic auth
+	stale, err := p.staleHtpasswdFiles(files)
+	if err != nil {
+		return err
+	}
+	for _, path := range stale {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		changed = true
+	}
+
+	if !changed {
+		return nil
+	}
+
+	logger.Debugf("Reloading %s with the routes of %d deployment(s)", p.server, len(routes))
+	if len(p.reloadCommand) == 0 {
+		return errors.New("missing proxy reload command")
+	}
+
+	out, err := exec.CommandContext(ctx, p.reloadCommand[0], p.reloadCommand[1:]...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("unable to reload %s, %v: %s", p.server, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// validRoutes returns the routes the server can serve, see ValidateRoute. Each domain and path prefix
+// can only be routed once, the routes of other deployments routing the same alias are left out.
+func (p *FileProvider) validRoutes(routes []Route) []Route {
+	valid := make([]Route, 0, len(routes))
+	routed := make(map[string]string)
+
+	for _, r := range routes {
+		if err := ValidateRoute(p.server, r); err != nil {
+			logger.Warnf("Unable to route deployment %s, %v", r.Deployment, err)
+			continue
+		}
+
+		conflict := ""
+		for _, a := range r.Aliases {
+			if other, ok := routed[a.String()]; ok && !a.Empty() {
+				conflict = fmt.Sprintf("alias %s is already routed by deployment %s", a, other)
+				break
+			}
+		}
+
+		if conflict != "" {
+			logger.Warnf("Unable to route deployment %s, %s", r.Deployment, conflict)
+			continue
+		}
+
+		for _, a := range r.Aliases {
+			if !a.Empty() {
+				routed[a.String()] = r.Deployment
+			}
+		}
+		valid = append(valid, r)
+	}
+	return valid
+}
+
+// staleHtpasswdFiles returns the nginx basic auth users files which are no longer rendered
+func (p *FileProvider) staleHtpasswdFiles(files map[string][]byte) ([]string, error) {
+	if p.server != NginxProvider {
+		return []string{}, nil
+	}
+
+	paths, err := filepath.Glob(p.htpasswdPath("*"))
+	if err != nil {
+		return nil, err
+	}
+
+	stale := make([]string, 0)
+	for _, path := range paths {
+		if _, ok := files[path]; !ok {
+			stale = append(stale, path)
+		}
+	}
+	return stale, nil
+}
+
+// render returns the content of the configuration files of the server by path
+func (p *FileProvider) render(routes []Route) map[string][]byte {
+	s := sites(routes)
+	if p.server == CaddyProvider {
+		return map[string][]byte{p.configPath: renderCaddyfile(s)}
+	}
+
+	files := map[string][]byte{p.configPath: renderNginxConfig(s, p.htpasswdPath)}
+	for _, r := range routes {
+		if len(r.Middlewares.BasicAuth.Credentials) > 0 {
+			files[p.htpasswdPath(r.Deployment)] = []byte(strings.Join(r.Middlewares.BasicAuth.Credentials, "\n") + "\n")
+		}
+	}
+	return files
+}
+
+// htpasswdPath returns the path of the nginx basic auth users file of a deployment
+func (p *FileProvider) htpasswdPath(deployment string) string {
+	return filepath.Join(filepath.Dir(p.configPath), fmt.Sprintf("krane-%s.htpasswd", deployment))
+}
+
+// site is a domain served by the proxy and the locations routing its requests to deployments
+type site struct {
+	host      string // empty for requests to any domain
+	secure    bool
+	locations []location
+}
+
+// location routes the requests for a path prefix of a site to the containers of a deployment
+type location struct {
+	deployment  string
+	pathPrefix  string
+	stripPrefix bool
+	priority    int
+	upstreams   []string
+	rateLimit   uint
+	middlewares middlewares.Middlewares
+}
+
+// sites returns the sites served by the proxy sorted by domain, locations are sorted by
+// priority then by longest path prefix. Deployments without running containers are not routed.
+func sites(routes []Route) []site {
+	byHost := make(map[string]*site)
+	for _, r := range routes {
+		if len(r.Upstreams) == 0 {
+			continue
+		}
+
+		if len(r.TCP) > 0 || len(r.UDP) > 0 {
+			logger.Warnf("tcp and udp routers of deployment %s are not supported by file proxy providers", r.Deployment)
+		}
+
+		for _, a := range r.Aliases {
+			if a.Empty() {
+				continue
+			}
+
+			s, ok := byHost[a.Host]
+			if !ok {
+				s = &site{host: a.Host}
+				byHost[a.Host] = s
+			}
+
+			s.secure = s.secure || r.Secure
+			s.locations = append(s.locations, location{
+				deployment:  r.Deployment,
+				pathPrefix:  a.PathPrefix,
+				stripPrefix: a.StripPrefix,
+				priority:    a.Priority,
+				upstreams:   r.Upstreams,
+				rateLimit:   r.RateLimit,
+				middlewares: r.Middlewares,
+			})
+		}
+	}
+
+	all := make([]site, 0, len(byHost))
+	for _, s := range byHost {
+		sort.SliceStable(s.locations, func(i, j int) bool {
+			a, b := s.locations[i], s.locations[j]
+			if a.priority != b.priority {
+				return a.priority > b.priority
+			}
+			if len(a.pathPrefix) != len(b.pathPrefix) {
+				return len(a.pathPrefix) > len(b.pathPrefix)
+			}
+			return a.deployment < b.deployment
+		})
+		all = append(all, *s)
+	}
+
+	sort.Slice(all, func(i, j int) bool { return all[i].host < all[j].host })
+	return all
+}
+
+// writeFile atomically replaces the content of a file. Files are only readable by their owner since
+// they hold basic auth users, the mode and owner of existing files are kept so the server can be
+// granted access to them (ie. a htpasswd file readable by the nginx worker group).
+func writeFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	tmp := fmt.Sprintf("%s.tmp", path)
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+
+	if info, err := os.Stat(path); err == nil {
+		if err := os.Chmod(tmp, info.Mode().Perm()); err != nil {
+			return err
+		}
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+			if err := os.Chown(tmp, int(stat.Uid), int(stat.Gid)); err != nil {
+				return err
+			}
+		}
+	}
+	return os.Rename(tmp, path)
+}
+
+func sortedFilePaths(files map[string][]byte) []string {
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
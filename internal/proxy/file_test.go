@@ -0,0 +1,205 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/krane/krane/internal/proxy/middlewares"
+)
+
+var testRoutes = []Route{
+	{
+		Deployment: "web",
+		Aliases:    []Alias{{Host: "example.com"}},
+		Secure:     true,
+		Upstreams:  []string{"172.18.0.2:80", "172.18.0.3:80"},
+		Middlewares: middlewares.Middlewares{
+			Compress: true,
+			Headers:  middlewares.Headers{HSTS: middlewares.HSTS{MaxAge: 60}},
+		},
+	},
+	{
+		Deployment: "api",
+		Aliases:    []Alias{{Host: "example.com", PathPrefix: "/api", StripPrefix: true}},
+		RateLimit:  10,
+		Upstreams:  []string{"172.18.0.4:8080"},
+		Middlewares: middlewares.Middlewares{
+			IPAllowList: middlewares.IPAllowList{SourceRange: []string{"10.0.0.0/8"}},
+			BasicAuth:   middlewares.BasicAuth{Users: []string{"@ADMIN"}, Credentials: []string{"admin:$2y$05$hash"}},
+		},
+	},
+	{
+		Deployment: "stopped",
+		Aliases:    []Alias{{Host: "stopped.example.com"}},
+	},
+}
+
+func TestNewProvider(t *testing.T) {
+	p, err := NewProvider("", "", "")
+	assert.Nil(t, err)
+	assert.Equal(t, TraefikProvider, p.Name())
+
+	p, err = NewProvider(CaddyProvider, "", "")
+	assert.Nil(t, err)
+	assert.Equal(t, "/etc/caddy/Caddyfile", p.(*FileProvider).configPath)
+	assert.Equal(t, []string{"caddy", "reload", "--config", "/etc/caddy/Caddyfile", "--adapter", "caddyfile"}, p.(*FileProvider).reloadCommand)
+
+	p, err = NewProvider(NginxProvider, "/etc/nginx/sites-enabled/krane", "systemctl reload nginx")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"systemctl", "reload", "nginx"}, p.(*FileProvider).reloadCommand)
+	assert.Empty(t, p.Labels(testRoutes[0]))
+
+	_, err = NewProvider("haproxy", "", "")
+	assert.Error(t, err)
+}
+
+func TestRenderCaddyfile(t *testing.T) {
+	assert.Equal(t, configHeader+`
+example.com {
+	handle_path /api* {
+		@krane_0_0_denied not remote_ip 10.0.0.0/8
+		respond @krane_0_0_denied 403
+		basicauth {
+			admin $2y$05$hash
+		}
+		reverse_proxy 172.18.0.4:8080
+	}
+	handle {
+		header Strict-Transport-Security "max-age=60"
+		encode gzip
+		reverse_proxy 172.18.0.2:80 172.18.0.3:80
+	}
+}
+`, string(renderCaddyfile(sites(testRoutes))))
+}
+
+func TestRenderNginxConfig(t *testing.T) {
+	htpasswd := func(deployment string) string { return fmt.Sprintf("/etc/nginx/krane-%s.htpasswd", deployment) }
+
+	assert.Equal(t, configHeader+`
+limit_req_zone $binary_remote_addr zone=krane_api:10m rate=10r/s;
+
+upstream krane_api {
+	server 172.18.0.4:8080;
+}
+
+upstream krane_web {
+	server 172.18.0.2:80;
+	server 172.18.0.3:80;
+}
+
+server {
+	listen 80;
+	server_name example.com;
+
+	location /api {
+		allow 10.0.0.0/8;
+		deny all;
+		auth_basic "Restricted";
+		auth_basic_user_file /etc/nginx/krane-api.htpasswd;
+		limit_req zone=krane_api burst=10 nodelay;
+		proxy_set_header Host $host;
+		proxy_set_header X-Real-IP $remote_addr;
+		proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+		proxy_set_header X-Forwarded-Proto $scheme;
+		rewrite ^/api/?(.*)$ /$1 break;
+		proxy_pass http://krane_api;
+	}
+
+	location / {
+		proxy_set_header Host $host;
+		proxy_set_header X-Real-IP $remote_addr;
+		proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+		proxy_set_header X-Forwarded-Proto $scheme;
+		add_header Strict-Transport-Security "max-age=60" always;
+		gzip on;
+		gzip_proxied any;
+		proxy_pass http://krane_web;
+	}
+}
+`, string(renderNginxConfig(sites(testRoutes), htpasswd)))
+}
+
+func TestFileProviderSync(t *testing.T) {
+	dir, err := ioutil.TempDir("", "krane-proxy")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	// nginx does not provision TLS certificates
+	routes := append([]Route{}, testRoutes...)
+	routes[0].Secure = false
+
+	configPath := filepath.Join(dir, "krane.conf")
+	reloaded := filepath.Join(dir, "reloaded")
+	p := NewFileProvider(NginxProvider, configPath, fmt.Sprintf("touch %s", reloaded))
+
+	assert.Nil(t, p.Sync(context.Background(), routes))
+	assert.FileExists(t, configPath)
+	assert.FileExists(t, reloaded)
+
+	htpasswdPath := filepath.Join(dir, "krane-api.htpasswd")
+	htpasswd, err := ioutil.ReadFile(htpasswdPath)
+	assert.Nil(t, err)
+	assert.Equal(t, "admin:$2y$05$hash\n", string(htpasswd))
+
+	info, err := os.Stat(htpasswdPath)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// the server is only reloaded when the configuration changed
+	assert.Nil(t, os.Remove(reloaded))
+	assert.Nil(t, p.Sync(context.Background(), routes))
+	_, err = os.Stat(reloaded)
+	assert.True(t, os.IsNotExist(err))
+
+	// the basic auth users file of a deleted deployment is removed
+	assert.Nil(t, p.Sync(context.Background(), routes[:1]))
+	assert.FileExists(t, reloaded)
+	_, err = os.Stat(htpasswdPath)
+	assert.True(t, os.IsNotExist(err))
+
+	// reload failures are returned
+	p = NewFileProvider(NginxProvider, configPath, "false")
+	assert.Nil(t, os.Remove(configPath))
+	assert.Error(t, p.Sync(context.Background(), routes[:1]))
+}
+
+func TestFileProviderValidRoutes(t *testing.T) {
+	caddy := NewFileProvider(CaddyProvider, "", "")
+	nginx := NewFileProvider(NginxProvider, "", "")
+
+	deployments := func(routes []Route) []string {
+		names := make([]string, 0)
+		for _, r := range routes {
+			names = append(names, r.Deployment)
+		}
+		return names
+	}
+
+	assert.Equal(t, deployments(testRoutes), deployments(caddy.validRoutes(testRoutes)))
+
+	// nginx cannot serve secure deployments, the other deployments are still routed
+	assert.Error(t, ValidateRoute(NginxProvider, testRoutes[0]))
+	assert.Equal(t, deployments(testRoutes[1:]), deployments(nginx.validRoutes(testRoutes)))
+
+	// a domain and path prefix can only be routed once
+	duplicate := Route{Deployment: "other", Aliases: []Alias{{Host: "example.com"}}}
+	assert.Equal(t, deployments(testRoutes), deployments(caddy.validRoutes(append(testRoutes, duplicate))))
+
+	duplicate.Aliases[0].PathPrefix = "/other"
+	assert.Contains(t, deployments(caddy.validRoutes(append(testRoutes, duplicate))), "other")
+
+	// caddy only supports bcrypt hashed passwords
+	apr1 := Route{Deployment: "apr1", Middlewares: middlewares.Middlewares{
+		BasicAuth: middlewares.BasicAuth{Credentials: []string{"admin:$apr1$salt$hash"}},
+	}}
+	assert.Error(t, ValidateRoute(CaddyProvider, apr1))
+	assert.Empty(t, caddy.validRoutes([]Route{apr1}))
+	assert.Len(t, nginx.validRoutes([]Route{apr1}), 1)
+}
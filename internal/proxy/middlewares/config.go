@@ -0,0 +1,167 @@
+package middlewares
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var headerNameRegex = regexp.MustCompile("^[A-Za-z0-9!#$%&'*+.^_`|~-]+$")
+
+// circuitBreakerMetrics are the metrics a circuit breaker expression can be built from
+var circuitBreakerMetrics = []string{"NetworkErrorRatio()", "ResponseCodeRatio(", "LatencyAtQuantileMS("}
+
+// Middlewares are the optional middlewares applied to the requests routed to a deployment
+type Middlewares struct {
+	BasicAuth      BasicAuth      `json:"basic_auth"`      // require credentials taken from deployment secrets
+	IPAllowList    IPAllowList    `json:"ip_allowlist"`    // only allow requests from ip ranges
+	Headers        Headers        `json:"headers"`         // custom request/response headers, CORS and HSTS
+	Compress       bool           `json:"compress"`        // gzip compress responses
+	Retry          Retry          `json:"retry"`           // retry requests on network errors
+	CircuitBreaker CircuitBreaker `json:"circuit_breaker"` // stop forwarding requests to unhealthy containers
+}
+
+// BasicAuth requires requests to authenticate with one of the users stored as deployment secrets
+type BasicAuth struct {
+	Users        []string `json:"users"`         // secret aliases (ie. @ADMIN_USER) with values formatted as htpasswd entries (user:hash)
+	Realm        string   `json:"realm"`         // authentication realm (default traefik)
+	RemoveHeader bool     `json:"remove_header"` // remove the Authorization header before forwarding requests
+	Credentials  []string `json:"-"`             // resolved htpasswd entries of the users
+}
+
+// IPAllowList only allows requests from ip addresses or ranges
+type IPAllowList struct {
+	SourceRange []string `json:"source_range"` // ip addresses or CIDR ranges (ie. 10.0.0.0/8)
+	Depth       int      `json:"depth"`        // X-Forwarded-For depth used to find the client ip (default 0, the remote address)
+}
+
+// Headers are custom headers added to requests and responses
+type Headers struct {
+	Request  map[string]string `json:"request"`  // headers added to requests, empty values remove the header
+	Response map[string]string `json:"response"` // headers added to responses, empty values remove the header
+	CORS     CORS              `json:"cors"`
+	HSTS     HSTS              `json:"hsts"`
+}
+
+// CORS are the Cross-Origin Resource Sharing response headers
+type CORS struct {
+	AllowOrigins     []string `json:"allow_origins"`
+	AllowMethods     []string `json:"allow_methods"`
+	AllowHeaders     []string `json:"allow_headers"`
+	AllowCredentials bool     `json:"allow_credentials"`
+	MaxAge           int64    `json:"max_age"` // seconds preflight requests are cached for
+}
+
+// HSTS is the HTTP Strict Transport Security response header
+type HSTS struct {
+	MaxAge            int64 `json:"max_age"` // seconds browsers only use https for the domain, 0 disables HSTS
+	IncludeSubdomains bool  `json:"include_subdomains"`
+	Preload           bool  `json:"preload"`
+}
+
+// Retry retries requests forwarded to the containers on network errors
+type Retry struct {
+	Attempts        int    `json:"attempts"`         // 0 disables retries
+	InitialInterval string `json:"initial_interval"` // backoff before the first retry (ie. 100ms)
+}
+
+// CircuitBreaker stops forwarding requests to the containers when its expression is true
+type CircuitBreaker struct {
+	Expression string `json:"expression"` // ie. NetworkErrorRatio() > 0.30
+}
+
+// IsValid returns an error if the middlewares of a deployment are not valid
+func (m Middlewares) IsValid() error {
+	for _, user := range m.BasicAuth.Users {
+		if !strings.HasPrefix(user, "@") {
+			return fmt.Errorf("invalid basic_auth user %s, must reference a secret (ie. @ADMIN_USER)", user)
+		}
+	}
+
+	for _, source := range m.IPAllowList.SourceRange {
+		if _, _, err := net.ParseCIDR(source); err != nil && net.ParseIP(source) == nil {
+			return fmt.Errorf("invalid ip_allowlist source_range %s, must be an ip address or CIDR range", source)
+		}
+	}
+
+	if m.IPAllowList.Depth < 0 {
+		return errors.New("invalid ip_allowlist depth, cannot be negative")
+	}
+
+	if err := m.Headers.isValid(); err != nil {
+		return err
+	}
+
+	if m.Retry.Attempts < 0 {
+		return errors.New("invalid retry attempts, cannot be negative")
+	}
+
+	if m.Retry.InitialInterval != "" {
+		if d, err := time.ParseDuration(m.Retry.InitialInterval); err != nil || d < 0 {
+			return fmt.Errorf("invalid retry initial_interval %s", m.Retry.InitialInterval)
+		}
+	}
+
+	if expression := m.CircuitBreaker.Expression; expression != "" && !containsAny(expression, circuitBreakerMetrics) {
+		return fmt.Errorf("invalid circuit_breaker expression %s, must use NetworkErrorRatio, ResponseCodeRatio or LatencyAtQuantileMS", expression)
+	}
+
+	return nil
+}
+
+// isValid returns an error if the custom headers, CORS or HSTS configuration is not valid
+func (h Headers) isValid() error {
+	for _, headers := range []map[string]string{h.Request, h.Response} {
+		for name := range headers {
+			if !headerNameRegex.MatchString(name) {
+				return fmt.Errorf("invalid header name %s", name)
+			}
+		}
+	}
+
+	for _, name := range h.CORS.AllowHeaders {
+		if !headerNameRegex.MatchString(name) {
+			return fmt.Errorf("invalid cors allow_headers %s", name)
+		}
+	}
+
+	for _, method := range h.CORS.AllowMethods {
+		if !isHTTPMethod(method) {
+			return fmt.Errorf("invalid cors allow_methods %s", method)
+		}
+	}
+
+	if h.CORS.MaxAge < 0 {
+		return errors.New("invalid cors max_age, cannot be negative")
+	}
+
+	if h.HSTS.MaxAge < 0 {
+		return errors.New("invalid hsts max_age, cannot be negative")
+	}
+
+	return nil
+}
+
+// isHTTPMethod returns whether a method is a standard HTTP method
+func isHTTPMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// containsAny returns whether a value contains any of the substrings
+func containsAny(value string, substrings []string) bool {
+	for _, s := range substrings {
+		if strings.Contains(value, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -3,6 +3,7 @@ package middlewares
 import (
 	"fmt"
 	"strconv"
+	"strings"
 )
 
 func RedirectToHTTPSLabels(deployment string) map[string]string {
@@ -16,8 +17,132 @@ func RedirectToHTTPSLabels(deployment string) map[string]string {
 	return labels
 }
 
+// RateLimitLabels returns the rate limit middleware labels, no labels if there is no rate limit
 func RateLimitLabels(deployment string, rateLimit uint) map[string]string {
 	labels := make(map[string]string, 0)
+	if rateLimit == 0 {
+		return labels
+	}
+
 	labels[fmt.Sprintf("traefik.http.middlewares.%s-ratelimit.ratelimit.average", deployment)] = strconv.FormatUint(uint64(rateLimit), 10)
 	return labels
 }
+
+func StripPrefixLabels(router string, prefix string) map[string]string {
+	labels := make(map[string]string, 0)
+	labels[fmt.Sprintf("traefik.http.middlewares.%s-stripprefix.stripprefix.prefixes", router)] = prefix
+	return labels
+}
+
+// BasicAuthLabels returns the basic auth middleware labels, no labels if no credentials were resolved
+func BasicAuthLabels(deployment string, auth BasicAuth) map[string]string {
+	labels := make(map[string]string, 0)
+	if len(auth.Credentials) == 0 {
+		return labels
+	}
+
+	labels[fmt.Sprintf("traefik.http.middlewares.%s-basicauth.basicauth.users", deployment)] = strings.Join(auth.Credentials, ",")
+	if auth.Realm != "" {
+		labels[fmt.Sprintf("traefik.http.middlewares.%s-basicauth.basicauth.realm", deployment)] = auth.Realm
+	}
+	if auth.RemoveHeader {
+		labels[fmt.Sprintf("traefik.http.middlewares.%s-basicauth.basicauth.removeheader", deployment)] = "true"
+	}
+	return labels
+}
+
+// IPAllowListLabels returns the ip allowlist middleware labels, no labels if no source range is allowed
+func IPAllowListLabels(deployment string, allowlist IPAllowList) map[string]string {
+	labels := make(map[string]string, 0)
+	if len(allowlist.SourceRange) == 0 {
+		return labels
+	}
+
+	labels[fmt.Sprintf("traefik.http.middlewares.%s-ipallowlist.ipwhitelist.sourcerange", deployment)] = strings.Join(allowlist.SourceRange, ",")
+	if allowlist.Depth > 0 {
+		labels[fmt.Sprintf("traefik.http.middlewares.%s-ipallowlist.ipwhitelist.ipstrategy.depth", deployment)] = strconv.Itoa(allowlist.Depth)
+	}
+	return labels
+}
+
+// HeadersLabels returns the headers middleware labels for custom headers, CORS and HSTS, no labels if no header is set
+func HeadersLabels(deployment string, headers Headers) map[string]string {
+	labels := make(map[string]string, 0)
+	prefix := fmt.Sprintf("traefik.http.middlewares.%s-headers.headers", deployment)
+
+	for name, value := range headers.Request {
+		labels[fmt.Sprintf("%s.customrequestheaders.%s", prefix, name)] = value
+	}
+
+	for name, value := range headers.Response {
+		labels[fmt.Sprintf("%s.customresponseheaders.%s", prefix, name)] = value
+	}
+
+	cors := headers.CORS
+	if len(cors.AllowOrigins) > 0 {
+		labels[fmt.Sprintf("%s.accesscontrolalloworiginlist", prefix)] = strings.Join(cors.AllowOrigins, ",")
+		labels[fmt.Sprintf("%s.addvaryheader", prefix)] = "true"
+
+		if len(cors.AllowMethods) > 0 {
+			labels[fmt.Sprintf("%s.accesscontrolallowmethods", prefix)] = strings.Join(cors.AllowMethods, ",")
+		}
+		if len(cors.AllowHeaders) > 0 {
+			labels[fmt.Sprintf("%s.accesscontrolallowheaders", prefix)] = strings.Join(cors.AllowHeaders, ",")
+		}
+		if cors.AllowCredentials {
+			labels[fmt.Sprintf("%s.accesscontrolallowcredentials", prefix)] = "true"
+		}
+		if cors.MaxAge > 0 {
+			labels[fmt.Sprintf("%s.accesscontrolmaxage", prefix)] = strconv.FormatInt(cors.MaxAge, 10)
+		}
+	}
+
+	hsts := headers.HSTS
+	if hsts.MaxAge > 0 {
+		labels[fmt.Sprintf("%s.stsseconds", prefix)] = strconv.FormatInt(hsts.MaxAge, 10)
+		if hsts.IncludeSubdomains {
+			labels[fmt.Sprintf("%s.stsincludesubdomains", prefix)] = "true"
+		}
+		if hsts.Preload {
+			labels[fmt.Sprintf("%s.stspreload", prefix)] = "true"
+		}
+	}
+
+	return labels
+}
+
+// CompressLabels returns the compress middleware labels, no labels if compression is disabled
+func CompressLabels(deployment string, compress bool) map[string]string {
+	labels := make(map[string]string, 0)
+	if !compress {
+		return labels
+	}
+
+	labels[fmt.Sprintf("traefik.http.middlewares.%s-compress.compress", deployment)] = "true"
+	return labels
+}
+
+// RetryLabels returns the retry middleware labels, no labels if retries are disabled
+func RetryLabels(deployment string, retry Retry) map[string]string {
+	labels := make(map[string]string, 0)
+	if retry.Attempts == 0 {
+		return labels
+	}
+
+	labels[fmt.Sprintf("traefik.http.middlewares.%s-retry.retry.attempts", deployment)] = strconv.Itoa(retry.Attempts)
+	if retry.InitialInterval != "" {
+		labels[fmt.Sprintf("traefik.http.middlewares.%s-retry.retry.initialinterval", deployment)] = retry.InitialInterval
+	}
+	return labels
+}
+
+// CircuitBreakerLabels returns the circuit breaker middleware labels, no labels if there is no expression
+func CircuitBreakerLabels(deployment string, breaker CircuitBreaker) map[string]string {
+	labels := make(map[string]string, 0)
+	if breaker.Expression == "" {
+		return labels
+	}
+
+	labels[fmt.Sprintf("traefik.http.middlewares.%s-circuitbreaker.circuitbreaker.expression", deployment)] = breaker.Expression
+	return labels
+}
@@ -0,0 +1,68 @@
+package middlewares
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddlewaresIsValid(t *testing.T) {
+	assert.Nil(t, Middlewares{}.IsValid())
+	assert.Nil(t, Middlewares{
+		BasicAuth:   BasicAuth{Users: []string{"@ADMIN"}},
+		IPAllowList: IPAllowList{SourceRange: []string{"10.0.0.0/8", "192.168.1.7"}},
+		Headers: Headers{
+			Request:  map[string]string{"X-Forwarded-Proto": "https"},
+			Response: map[string]string{"Server": ""},
+			CORS:     CORS{AllowOrigins: []string{"https://example.com"}, AllowMethods: []string{"GET", "POST"}},
+		},
+		Retry:          Retry{Attempts: 3, InitialInterval: "100ms"},
+		CircuitBreaker: CircuitBreaker{Expression: "ResponseCodeRatio(500, 600, 0, 600) > 0.25"},
+	}.IsValid())
+
+	invalid := []Middlewares{
+		{BasicAuth: BasicAuth{Users: []string{"admin:password"}}},
+		{IPAllowList: IPAllowList{SourceRange: []string{"10.0.0.0/33"}}},
+		{IPAllowList: IPAllowList{Depth: -1}},
+		{Headers: Headers{Request: map[string]string{"X Forwarded": "x"}}},
+		{Headers: Headers{CORS: CORS{AllowMethods: []string{"FETCH"}}}},
+		{Headers: Headers{HSTS: HSTS{MaxAge: -1}}},
+		{Retry: Retry{Attempts: -1}},
+		{Retry: Retry{Attempts: 3, InitialInterval: "fast"}},
+		{CircuitBreaker: CircuitBreaker{Expression: "errors > 1"}},
+	}
+	for _, m := range invalid {
+		assert.Error(t, m.IsValid())
+	}
+}
+
+func TestHeadersLabels(t *testing.T) {
+	assert.Empty(t, HeadersLabels("app", Headers{}))
+
+	assert.Equal(t, map[string]string{
+		"traefik.http.middlewares.app-headers.headers.customrequestheaders.X-Env":    "prod",
+		"traefik.http.middlewares.app-headers.headers.customresponseheaders.Server":  "",
+		"traefik.http.middlewares.app-headers.headers.accesscontrolalloworiginlist":  "https://example.com",
+		"traefik.http.middlewares.app-headers.headers.accesscontrolallowmethods":     "GET,POST",
+		"traefik.http.middlewares.app-headers.headers.accesscontrolallowcredentials": "true",
+		"traefik.http.middlewares.app-headers.headers.accesscontrolmaxage":           "600",
+		"traefik.http.middlewares.app-headers.headers.addvaryheader":                 "true",
+		"traefik.http.middlewares.app-headers.headers.stsseconds":                    "31536000",
+		"traefik.http.middlewares.app-headers.headers.stsincludesubdomains":          "true",
+	}, HeadersLabels("app", Headers{
+		Request:  map[string]string{"X-Env": "prod"},
+		Response: map[string]string{"Server": ""},
+		CORS: CORS{
+			AllowOrigins:     []string{"https://example.com"},
+			AllowMethods:     []string{"GET", "POST"},
+			AllowCredentials: true,
+			MaxAge:           600,
+		},
+		HSTS: HSTS{MaxAge: 31536000, IncludeSubdomains: true},
+	}))
+}
+
+func TestRateLimitLabels(t *testing.T) {
+	assert.Empty(t, RateLimitLabels("app", 0))
+	assert.Equal(t, map[string]string{"traefik.http.middlewares.app-ratelimit.ratelimit.average": "100"}, RateLimitLabels("app", 100))
+}
@@ -0,0 +1,167 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/krane/krane/internal/logger"
+)
+
+// renderNginxConfig renders the nginx configuration, included in the http block, serving the sites of
+// deployments. nginx does not provision TLS certificates, every site is served over http and secure
+// deployments are rejected when syncing.
+func renderNginxConfig(sites []site, htpasswdPath func(deployment string) string) []byte {
+	var b bytes.Buffer
+	b.WriteString(configHeader)
+
+	// upstreams and rate limit zones are shared by the locations of a deployment
+	upstreams := make(map[string]bool)
+	for _, s := range sites {
+		for _, l := range s.locations {
+			if upstreams[l.deployment] {
+				continue
+			}
+			upstreams[l.deployment] = true
+
+			if l.rateLimit > 0 {
+				fmt.Fprintf(&b, "\nlimit_req_zone $binary_remote_addr zone=%s:10m rate=%dr/s;\n", nginxName(l.deployment), l.rateLimit)
+			}
+
+			fmt.Fprintf(&b, "\nupstream %s {\n", nginxName(l.deployment))
+			for _, upstream := range l.upstreams {
+				fmt.Fprintf(&b, "\tserver %s;\n", upstream)
+			}
+			b.WriteString("}\n")
+		}
+	}
+
+	for i, s := range sites {
+		b.WriteString("\nserver {\n")
+		if s.host == "" {
+			b.WriteString("\tlisten 80 default_server;\n\tserver_name _;\n")
+		} else {
+			fmt.Fprintf(&b, "\tlisten 80;\n\tserver_name %s;\n", s.host)
+		}
+
+		for j, l := range s.locations {
+			writeNginxLocation(&b, fmt.Sprintf("krane_%d_%d", i, j), l, htpasswdPath(l.deployment))
+		}
+		b.WriteString("}\n")
+	}
+
+	return b.Bytes()
+}
+
+// writeNginxLocation writes the location block routing a path prefix of a site to a deployment
+func writeNginxLocation(b *bytes.Buffer, id string, l location, htpasswd string) {
+	path := l.pathPrefix
+	if path == "" {
+		path = "/"
+	}
+	fmt.Fprintf(b, "\n\tlocation %s {\n", path)
+
+	mw := l.middlewares
+
+	// ip allowlist
+	if len(mw.IPAllowList.SourceRange) > 0 {
+		for _, source := range mw.IPAllowList.SourceRange {
+			fmt.Fprintf(b, "\t\tallow %s;\n", source)
+		}
+		b.WriteString("\t\tdeny all;\n")
+	}
+
+	// basic auth
+	if len(mw.BasicAuth.Credentials) > 0 {
+		realm := mw.BasicAuth.Realm
+		if realm == "" {
+			realm = "Restricted"
+		}
+		fmt.Fprintf(b, "\t\tauth_basic %q;\n", realm)
+		fmt.Fprintf(b, "\t\tauth_basic_user_file %s;\n", htpasswd)
+		if mw.BasicAuth.RemoveHeader {
+			b.WriteString("\t\tproxy_set_header Authorization \"\";\n")
+		}
+	}
+
+	// rate limit
+	if l.rateLimit > 0 {
+		fmt.Fprintf(b, "\t\tlimit_req zone=%s burst=%d nodelay;\n", nginxName(l.deployment), l.rateLimit)
+	}
+
+	if mw.CircuitBreaker.Expression != "" {
+		logger.Warnf("circuit breaker of deployment %s is not supported by nginx", l.deployment)
+	}
+
+	// headers
+	b.WriteString("\t\tproxy_set_header Host $host;\n")
+	b.WriteString("\t\tproxy_set_header X-Real-IP $remote_addr;\n")
+	b.WriteString("\t\tproxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;\n")
+	b.WriteString("\t\tproxy_set_header X-Forwarded-Proto $scheme;\n")
+	for _, name := range sortedKeys(mw.Headers.Request) {
+		fmt.Fprintf(b, "\t\tproxy_set_header %s %q;\n", name, mw.Headers.Request[name])
+	}
+	for _, name := range sortedKeys(mw.Headers.Response) {
+		if value := mw.Headers.Response[name]; value != "" {
+			fmt.Fprintf(b, "\t\tadd_header %s %q always;\n", name, value)
+			continue
+		}
+		fmt.Fprintf(b, "\t\tproxy_hide_header %s;\n", name)
+	}
+
+	cors := mw.Headers.CORS
+	if len(cors.AllowOrigins) > 0 {
+		origins := make([]string, 0, len(cors.AllowOrigins))
+		for _, origin := range cors.AllowOrigins {
+			origins = append(origins, regexp.QuoteMeta(origin))
+		}
+
+		fmt.Fprintf(b, "\t\tset $%s_origin \"\";\n", id)
+		fmt.Fprintf(b, "\t\tif ($http_origin ~ \"^(%s)$\") {\n", strings.Join(origins, "|"))
+		fmt.Fprintf(b, "\t\t\tset $%s_origin $http_origin;\n", id)
+		b.WriteString("\t\t}\n")
+		fmt.Fprintf(b, "\t\tadd_header Access-Control-Allow-Origin $%s_origin always;\n", id)
+		b.WriteString("\t\tadd_header Vary Origin always;\n")
+		if len(cors.AllowMethods) > 0 {
+			fmt.Fprintf(b, "\t\tadd_header Access-Control-Allow-Methods %q always;\n", strings.Join(cors.AllowMethods, ", "))
+		}
+		if len(cors.AllowHeaders) > 0 {
+			fmt.Fprintf(b, "\t\tadd_header Access-Control-Allow-Headers %q always;\n", strings.Join(cors.AllowHeaders, ", "))
+		}
+		if cors.AllowCredentials {
+			b.WriteString("\t\tadd_header Access-Control-Allow-Credentials true always;\n")
+		}
+		if cors.MaxAge > 0 {
+			fmt.Fprintf(b, "\t\tadd_header Access-Control-Max-Age %d always;\n", cors.MaxAge)
+		}
+	}
+
+	if hsts := hstsHeader(mw.Headers.HSTS); hsts != "" {
+		fmt.Fprintf(b, "\t\tadd_header Strict-Transport-Security %q always;\n", hsts)
+	}
+
+	// compress
+	if mw.Compress {
+		b.WriteString("\t\tgzip on;\n\t\tgzip_proxied any;\n")
+	}
+
+	// retry
+	if mw.Retry.Attempts > 0 {
+		b.WriteString("\t\tproxy_next_upstream error timeout;\n")
+		fmt.Fprintf(b, "\t\tproxy_next_upstream_tries %d;\n", mw.Retry.Attempts+1)
+	}
+
+	// strip prefix
+	if l.stripPrefix {
+		fmt.Fprintf(b, "\t\trewrite ^%s/?(.*)$ /$1 break;\n", regexp.QuoteMeta(l.pathPrefix))
+	}
+
+	fmt.Fprintf(b, "\t\tproxy_pass http://%s;\n", nginxName(l.deployment))
+	b.WriteString("\t}\n")
+}
+
+// nginxName returns the name of the upstream and rate limit zone of a deployment
+func nginxName(deployment string) string {
+	return fmt.Sprintf("krane_%s", strings.ReplaceAll(deployment, "-", "_"))
+}
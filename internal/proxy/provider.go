@@ -0,0 +1,218 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/krane/krane/internal/constants"
+	"github.com/krane/krane/internal/docker"
+	"github.com/krane/krane/internal/logger"
+	"github.com/krane/krane/internal/proxy/middlewares"
+)
+
+// Routing providers
+const (
+	TraefikProvider = "traefik"
+	CaddyProvider   = "caddy"
+	NginxProvider   = "nginx"
+)
+
+// Route is the routing configuration of a deployment
+type Route struct {
+	Deployment  string
+	Aliases     []Alias
+	Secure      bool
+	RateLimit   uint
+	Middlewares middlewares.Middlewares
+	TCP         []TCPRouter
+	UDP         []UDPRouter
+	Ports       []string // container ports serving http requests
+	TargetPort  string   // container port requests are load-balanced through
+	Upstreams   []string // addresses (ip:port) of the running containers of the deployment
+	Color       string   // color of the blue/green containers requests are routed to
+}
+
+// port returns the container port requests are forwarded to, empty if the deployment has no http port
+func (r Route) port() string {
+	if r.TargetPort != "" {
+		return r.TargetPort
+	}
+
+	if len(r.Ports) > 0 {
+		return r.Ports[0]
+	}
+	return ""
+}
+
+// Provider turns the routes of deployments into the configuration of a reverse proxy
+type Provider interface {
+	// Name returns the name of the provider (traefik, caddy or nginx)
+	Name() string
+
+	// Labels returns the container labels configuring the routing of a deployment
+	Labels(route Route) map[string]string
+
+	// Sync updates the reverse proxy with the routes of every deployment
+	Sync(ctx context.Context, routes []Route) error
+}
+
+var (
+	provider Provider = NewTraefik("")
+	once     sync.Once
+)
+
+// GetProvider returns the routing provider
+func GetProvider() Provider { return provider }
+
+// Configure sets up the routing provider from the environment, Traefik labels are used by default
+func Configure() {
+	once.Do(func() {
+		name := strings.ToLower(os.Getenv(constants.EnvProxyProvider))
+		p, err := NewProvider(name, os.Getenv(constants.EnvProxyConfigPath), os.Getenv(constants.EnvProxyReloadCommand))
+		if err != nil {
+			logger.Fatalf("Invalid proxy provider, %v", err)
+			return
+		}
+
+		logger.Infof("Using %s proxy provider", p.Name())
+		provider = p
+	})
+}
+
+// NewProvider returns a routing provider. Caddy and nginx providers render their configuration
+// to a file and run a command to reload the server, Traefik watches its dynamic configuration
+// file for changes. Defaults are used for empty values.
+func NewProvider(name, configPath, reloadCommand string) (Provider, error) {
+	switch name {
+	case "", TraefikProvider:
+		return NewTraefik(configPath), nil
+	case CaddyProvider, NginxProvider:
+		return NewFileProvider(name, configPath, reloadCommand), nil
+	default:
+		return nil, fmt.Errorf("unknown provider %s, must be one of traefik, caddy or nginx", name)
+	}
+}
+
+// Traefik routes requests using Traefik labels applied to the containers of a deployment. Requests to
+// blue/green deployments are routed through a dynamic configuration file watched by Traefik instead,
+// switching colors without re-creating containers.
+type Traefik struct {
+	configPath string
+	mu         sync.Mutex
+}
+
+// NewTraefik returns the Traefik provider, the dynamic configuration is rendered to
+// /etc/krane/traefik/krane.yml when the configuration path is empty
+func NewTraefik(configPath string) *Traefik {
+	if configPath == "" {
+		configPath = "/etc/krane/traefik/krane.yml"
+	}
+	return &Traefik{configPath: configPath}
+}
+
+// TraefikConfigMountPath is where the directory of the dynamic configuration is mounted in the Traefik container
+const TraefikConfigMountPath = "/etc/traefik/krane"
+
+// TraefikFileProviderEnvs returns the environment variables enabling the Traefik file provider, watching
+// the dynamic configuration mounted in the Traefik container
+func TraefikFileProviderEnvs() map[string]string {
+	return map[string]string{
+		"TRAEFIK_PROVIDERS_FILE_DIRECTORY": TraefikConfigMountPath,
+		"TRAEFIK_PROVIDERS_FILE_WATCH":     "true",
+	}
+}
+
+// Name returns the name of the Traefik provider
+func (t *Traefik) Name() string { return TraefikProvider }
+
+// ConfigDir returns the directory of the dynamic configuration, watched by Traefik
+func (t *Traefik) ConfigDir() string { return filepath.Dir(t.configPath) }
+
+// Labels returns the Traefik labels routing requests to the containers of a deployment. The containers
+// of blue/green deployments only define the service of their color, their routers are rendered to the
+// dynamic configuration when syncing.
+func (t *Traefik) Labels(route Route) map[string]string {
+	labels := make(map[string]string, 0)
+
+	// default traefik labels
+	labels["traefik.enable"] = "true"
+	labels["traefik.docker.network"] = docker.KraneNetworkName
+
+	if route.Color != "" {
+		for k, v := range TraefikColorServiceLabels(route.Deployment, route.Color, route.port(), route.TCP, route.UDP) {
+			labels[k] = v
+		}
+		return labels
+	}
+
+	for _, l := range []map[string]string{
+		TraefikRouterLabels(route.Deployment, route.Aliases, route.Secure),
+		TraefikMiddlewareLabels(route.Deployment, route.Aliases, route.Secure, route.RateLimit, route.Middlewares),
+		TraefikServiceLabels(route.Deployment, route.Ports, route.TargetPort),
+		TraefikTCPRouterLabels(route.Deployment, route.TCP),
+		TraefikUDPRouterLabels(route.Deployment, route.UDP),
+	} {
+		for k, v := range l {
+			labels[k] = v
+		}
+	}
+
+	return labels
+}
+
+// Sync renders the routers of blue/green deployments to the dynamic configuration, routing requests
+// to the services of their live color. Traefik discovers the routes of other deployments from labels.
+func (t *Traefik) Sync(_ context.Context, routes []Route) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	data, err := renderTraefikConfig(routes)
+	if err != nil {
+		return err
+	}
+
+	current, _ := ioutil.ReadFile(t.configPath)
+	if bytes.Equal(current, data) {
+		return nil
+	}
+
+	logger.Debugf("Writing Traefik dynamic configuration to %s", t.configPath)
+	return writeFile(t.configPath, data)
+}
+
+// ValidateRoute returns an error if a provider cannot serve the route of a deployment, nginx cannot serve
+// secure deployments since it does not provision TLS certificates and Caddy only supports bcrypt hashed
+// basic auth passwords.
+func ValidateRoute(provider string, route Route) error {
+	if provider == NginxProvider && route.Secure {
+		return fmt.Errorf("deployment %s is secure but nginx does not provision TLS certificates", route.Deployment)
+	}
+
+	if err := ValidateCredentials(provider, route.Middlewares.BasicAuth.Credentials); err != nil {
+		return fmt.Errorf("invalid basic auth users for deployment %s, %v", route.Deployment, err)
+	}
+	return nil
+}
+
+// ValidateCredentials returns an error if the htpasswd entries (user:hash) of basic auth users cannot be
+// verified by a provider, Caddy only supports bcrypt hashed passwords.
+func ValidateCredentials(provider string, credentials []string) error {
+	if provider != CaddyProvider {
+		return nil
+	}
+
+	for _, c := range credentials {
+		user := strings.SplitN(c, ":", 2)[0]
+		hash := strings.TrimPrefix(c, user+":")
+		if !strings.HasPrefix(hash, "$2a$") && !strings.HasPrefix(hash, "$2b$") && !strings.HasPrefix(hash, "$2y$") {
+			return fmt.Errorf("password of user %s must be hashed with bcrypt", user)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// wildcardSNI routes every connection received on a tcp entrypoint, with or without TLS
+const wildcardSNI = "*"
+
+var entrypointNameRegex = regexp.MustCompile(`^[a-z0-9]+$`)
+
+// TCPRouter routes tcp connections received on a proxy entrypoint to a container port
+type TCPRouter struct {
+	Entrypoint  string   `json:"entrypoint"`  // proxy entrypoint receiving the connections (ie. postgres)
+	Port        string   `json:"port"`        // container port the connections are forwarded to
+	HostSNI     []string `json:"host_sni"`    // TLS server names routed to the deployment (default *, every connection)
+	TLS         bool     `json:"tls"`         // terminate TLS in the proxy w/ auto generated certs
+	Passthrough bool     `json:"passthrough"` // forward TLS connections to the container without terminating them
+}
+
+// UDPRouter routes udp datagrams received on a proxy entrypoint to a container port
+type UDPRouter struct {
+	Entrypoint string `json:"entrypoint"` // proxy entrypoint receiving the datagrams (ie. dns)
+	Port       string `json:"port"`       // container port the datagrams are forwarded to
+}
+
+// IsValid returns an error if a tcp router is not valid
+func (r TCPRouter) IsValid() error {
+	if err := isValidRoute(r.Entrypoint, r.Port); err != nil {
+		return err
+	}
+
+	for _, host := range r.HostSNI {
+		if host == "" {
+			return fmt.Errorf("invalid tcp router for entrypoint %s, host_sni cannot be empty", r.Entrypoint)
+		}
+
+		// server names are only known from the TLS handshake
+		if host != wildcardSNI && !r.TLS && !r.Passthrough {
+			return fmt.Errorf("invalid tcp router for entrypoint %s, host_sni %s requires tls or passthrough", r.Entrypoint, host)
+		}
+	}
+
+	return nil
+}
+
+// IsValid returns an error if a udp router is not valid
+func (r UDPRouter) IsValid() error {
+	return isValidRoute(r.Entrypoint, r.Port)
+}
+
+// rule returns the HostSNI rule of a tcp router
+func (r TCPRouter) rule() string {
+	hosts := r.HostSNI
+	if len(hosts) == 0 {
+		hosts = []string{wildcardSNI}
+	}
+
+	rules := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		rules = append(rules, fmt.Sprintf("HostSNI(`%s`)", host))
+	}
+	return strings.Join(rules, " || ")
+}
+
+// isValidRoute returns an error if an entrypoint or container port of a router is not valid
+func isValidRoute(entrypoint, port string) error {
+	if !entrypointNameRegex.MatchString(entrypoint) {
+		return fmt.Errorf("invalid entrypoint %s, must only contain lowercase letters and numbers", entrypoint)
+	}
+
+	if isReservedEntrypoint(entrypoint) {
+		return fmt.Errorf("invalid entrypoint %s, reserved for http routers", entrypoint)
+	}
+
+	if !isValidPort(port) {
+		return fmt.Errorf("invalid port %s for entrypoint %s, must be between 1 and 65535", port, entrypoint)
+	}
+
+	return nil
+}
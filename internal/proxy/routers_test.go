@@ -0,0 +1,71 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseEntrypoints(t *testing.T) {
+	entrypoints, err := ParseEntrypoints("postgres=5432, dns=53/udp")
+	assert.Nil(t, err)
+	assert.Equal(t, []Entrypoint{
+		{Name: "postgres", Port: "5432", Protocol: "tcp"},
+		{Name: "dns", Port: "53", Protocol: "udp"},
+	}, entrypoints)
+
+	assert.Equal(t, map[string]string{
+		"TRAEFIK_ENTRYPOINTS_POSTGRES_ADDRESS": ":5432/tcp",
+		"TRAEFIK_ENTRYPOINTS_DNS_ADDRESS":      ":53/udp",
+	}, TraefikEntrypointEnvs(entrypoints))
+
+	entrypoints, err = ParseEntrypoints("")
+	assert.Nil(t, err)
+	assert.Empty(t, entrypoints)
+
+	invalid := []string{"postgres", "postgres=", "postgres=5432/sctp", "web=8000", "Postgres=5432", "pg=5432,pg=5433"}
+	for _, value := range invalid {
+		_, err := ParseEntrypoints(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestTCPRouterIsValid(t *testing.T) {
+	assert.Nil(t, TCPRouter{Entrypoint: "postgres", Port: "5432"}.IsValid())
+	assert.Nil(t, TCPRouter{Entrypoint: "postgres", Port: "5432", HostSNI: []string{"db.example.com"}, TLS: true}.IsValid())
+	assert.Nil(t, TCPRouter{Entrypoint: "postgres", Port: "5432", HostSNI: []string{"db.example.com"}, Passthrough: true}.IsValid())
+
+	assert.Error(t, TCPRouter{Entrypoint: "postgres", Port: "5432", HostSNI: []string{"db.example.com"}}.IsValid())
+	assert.Error(t, TCPRouter{Entrypoint: "postgres", Port: "5432", HostSNI: []string{""}, TLS: true}.IsValid())
+	assert.Error(t, TCPRouter{Entrypoint: "web", Port: "80"}.IsValid())
+	assert.Error(t, TCPRouter{Entrypoint: "postgres"}.IsValid())
+	assert.Error(t, UDPRouter{Entrypoint: "dns", Port: "dns"}.IsValid())
+}
+
+func TestTraefikTCPRouterLabels(t *testing.T) {
+	labels := TraefikTCPRouterLabels("db", []TCPRouter{
+		{Entrypoint: "postgres", Port: "5432", HostSNI: []string{"a.example.com", "b.example.com"}, TLS: true},
+		{Entrypoint: "redis", Port: "6379"},
+	})
+
+	assert.Equal(t, map[string]string{
+		"traefik.tcp.routers.db-postgres.rule":                      "HostSNI(`a.example.com`) || HostSNI(`b.example.com`)",
+		"traefik.tcp.routers.db-postgres.entrypoints":               "postgres",
+		"traefik.tcp.routers.db-postgres.service":                   "db-postgres",
+		"traefik.tcp.routers.db-postgres.tls":                       "true",
+		"traefik.tcp.routers.db-postgres.tls.certresolver":          "lets-encrypt",
+		"traefik.tcp.services.db-postgres.loadbalancer.server.port": "5432",
+		"traefik.tcp.routers.db-redis.rule":                         "HostSNI(`*`)",
+		"traefik.tcp.routers.db-redis.entrypoints":                  "redis",
+		"traefik.tcp.routers.db-redis.service":                      "db-redis",
+		"traefik.tcp.services.db-redis.loadbalancer.server.port":    "6379",
+	}, labels)
+}
+
+func TestTraefikUDPRouterLabels(t *testing.T) {
+	assert.Equal(t, map[string]string{
+		"traefik.udp.routers.dns-dns.entrypoints":               "dns",
+		"traefik.udp.routers.dns-dns.service":                   "dns-dns",
+		"traefik.udp.services.dns-dns.loadbalancer.server.port": "53",
+	}, TraefikUDPRouterLabels("dns", []UDPRouter{{Entrypoint: "dns", Port: "53"}}))
+}
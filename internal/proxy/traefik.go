@@ -1,8 +1,9 @@
 package proxy
 
 import (
-	"bytes"
+	"encoding/json"
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/krane/krane/internal/proxy/middlewares"
@@ -13,52 +14,87 @@ type TraefikLabel struct {
 	Value string
 }
 
-func TraefikRouterLabels(deployment string, aliases []string, secure bool) map[string]string {
-	// configure aliases as Host('my-alias.example.com') labels
-	var hostRules bytes.Buffer
-	for i, alias := range aliases {
-		if alias == "" {
-			continue
+func TraefikRouterLabels(deployment string, aliases []Alias, secure bool) map[string]string {
+	labels := make(map[string]string, 0)
+
+	for _, r := range aliasRouters(deployment, aliases) {
+		// configure aliases as Host('my-alias.example.com') && PathPrefix('/api') rules
+		rule := r.rule()
+
+		// http
+		if rule != "" {
+			labels[fmt.Sprintf("traefik.http.routers.%s-insecure.rule", r.name)] = rule
+		}
+		labels[fmt.Sprintf("traefik.http.routers.%s-insecure.entrypoints", r.name)] = WebEntrypoint
+
+		if secure {
+			// https
+			labels[fmt.Sprintf("traefik.http.routers.%s-secure.tls", r.name)] = "true"
+			labels[fmt.Sprintf("traefik.http.routers.%s-secure.entrypoints", r.name)] = WebSecureEntrypoint
+			labels[fmt.Sprintf("traefik.http.routers.%s-secure.tls.certresolver", r.name)] = "lets-encrypt"
+			if rule != "" {
+				labels[fmt.Sprintf("traefik.http.routers.%s-secure.rule", r.name)] = rule
+			}
 		}
 
-		if i == len(aliases)-1 {
-			// if last or only alias, just append the host with no OR operator
-			hostRules.WriteString(fmt.Sprintf("Host(`%s`)", alias))
-		} else {
-			// append OR operator if not the last alias
-			hostRules.WriteString(fmt.Sprintf("Host(`%s`) || ", alias))
+		// routers with their own alias are prioritized using the alias priority
+		if len(r.aliases) == 1 && r.aliases[0].Priority > 0 {
+			priority := strconv.Itoa(r.aliases[0].Priority)
+			labels[fmt.Sprintf("traefik.http.routers.%s-insecure.priority", r.name)] = priority
+			if secure {
+				labels[fmt.Sprintf("traefik.http.routers.%s-secure.priority", r.name)] = priority
+			}
 		}
 	}
 
+	return labels
+}
+
+// TraefikTCPRouterLabels returns the labels routing tcp connections received on proxy entrypoints to a deployment
+func TraefikTCPRouterLabels(deployment string, routers []TCPRouter) map[string]string {
 	labels := make(map[string]string, 0)
 
-	// http
-	if hostRules.String() != "" {
-		labels[fmt.Sprintf("traefik.http.routers.%s-insecure.rule", deployment)] = hostRules.String()
-	}
-	labels[fmt.Sprintf("traefik.http.routers.%s-insecure.entrypoints", deployment)] = "web"
+	for _, r := range routers {
+		name := fmt.Sprintf("%s-%s", deployment, r.Entrypoint)
+		labels[fmt.Sprintf("traefik.tcp.routers.%s.rule", name)] = r.rule()
+		labels[fmt.Sprintf("traefik.tcp.routers.%s.entrypoints", name)] = r.Entrypoint
+		labels[fmt.Sprintf("traefik.tcp.routers.%s.service", name)] = name
+		labels[fmt.Sprintf("traefik.tcp.services.%s.loadbalancer.server.port", name)] = r.Port
 
-	if secure {
-		// https
-		labels[fmt.Sprintf("traefik.http.routers.%s-secure.tls", deployment)] = "true"
-		labels[fmt.Sprintf("traefik.http.routers.%s-secure.entrypoints", deployment)] = "web-secure"
-		labels[fmt.Sprintf("traefik.http.routers.%s-secure.tls.certresolver", deployment)] = "lets-encrypt"
-		if hostRules.String() != "" {
-			labels[fmt.Sprintf("traefik.http.routers.%s-secure.rule", deployment)] = hostRules.String()
+		if r.Passthrough {
+			labels[fmt.Sprintf("traefik.tcp.routers.%s.tls", name)] = "true"
+			labels[fmt.Sprintf("traefik.tcp.routers.%s.tls.passthrough", name)] = "true"
+		} else if r.TLS {
+			labels[fmt.Sprintf("traefik.tcp.routers.%s.tls", name)] = "true"
+			labels[fmt.Sprintf("traefik.tcp.routers.%s.tls.certresolver", name)] = "lets-encrypt"
 		}
 	}
 
 	return labels
 }
 
-func TraefikServiceLabels(deployment string, ports map[string]string, targetPort string) map[string]string {
+// TraefikUDPRouterLabels returns the labels routing udp datagrams received on proxy entrypoints to a deployment
+func TraefikUDPRouterLabels(deployment string, routers []UDPRouter) map[string]string {
+	labels := make(map[string]string, 0)
+
+	for _, r := range routers {
+		name := fmt.Sprintf("%s-%s", deployment, r.Entrypoint)
+		labels[fmt.Sprintf("traefik.udp.routers.%s.entrypoints", name)] = r.Entrypoint
+		labels[fmt.Sprintf("traefik.udp.routers.%s.service", name)] = name
+		labels[fmt.Sprintf("traefik.udp.services.%s.loadbalancer.server.port", name)] = r.Port
+	}
+
+	return labels
+}
+
+func TraefikServiceLabels(deployment string, containerPorts []string, targetPort string) map[string]string {
 	labels := make(map[string]string, 0)
 
 	if targetPort != "" {
 		labels[fmt.Sprintf("traefik.http.services.%s.loadbalancer.server.port", deployment)] = targetPort
 		labels[fmt.Sprintf("traefik.http.services.%s.loadbalancer.server.scheme", deployment)] = "http"
 	} else {
-		for _, containerPort := range ports {
+		for _, containerPort := range containerPorts {
 			labels[fmt.Sprintf("traefik.http.services.%s-%s.loadbalancer.server.port", deployment, containerPort)] = containerPort
 			labels[fmt.Sprintf("traefik.http.services.%s-%s.loadbalancer.server.scheme", deployment, containerPort)] = "http"
 		}
@@ -67,29 +103,171 @@ func TraefikServiceLabels(deployment string, ports map[string]string, targetPort
 	return labels
 }
 
-func TraefikMiddlewareLabels(deployment string, secured bool, rateLimit uint) map[string]string {
+func TraefikMiddlewareLabels(deployment string, aliases []Alias, secured bool, rateLimit uint, mw middlewares.Middlewares) map[string]string {
 	labels := make(map[string]string, 0)
 
-	allMiddlewares := make([]string, 0)
-
 	// http redirect
 	if secured {
 		for k, v := range middlewares.RedirectToHTTPSLabels(deployment) {
 			labels[k] = v
 		}
-		allMiddlewares = append(allMiddlewares, "redirect-to-https")
 	}
 
-	// rate limit
-	for k, v := range middlewares.RateLimitLabels(deployment, rateLimit) {
-		labels[k] = v
+	// deployment middlewares in the order requests go through them, middlewares
+	// without labels are not enabled and not attached to the deployment
+	deploymentMiddlewares := make([]string, 0)
+	for _, m := range []struct {
+		name   string
+		labels map[string]string
+	}{
+		{"ipallowlist", middlewares.IPAllowListLabels(deployment, mw.IPAllowList)},
+		{"headers", middlewares.HeadersLabels(deployment, mw.Headers)},
+		{"basicauth", middlewares.BasicAuthLabels(deployment, mw.BasicAuth)},
+		{"ratelimit", middlewares.RateLimitLabels(deployment, rateLimit)},
+		{"compress", middlewares.CompressLabels(deployment, mw.Compress)},
+		{"circuitbreaker", middlewares.CircuitBreakerLabels(deployment, mw.CircuitBreaker)},
+		{"retry", middlewares.RetryLabels(deployment, mw.Retry)},
+	} {
+		if len(m.labels) == 0 {
+			continue
+		}
+
+		for k, v := range m.labels {
+			labels[k] = v
+		}
+		deploymentMiddlewares = append(deploymentMiddlewares, fmt.Sprintf("%s-%s", deployment, m.name))
+	}
+
+	for _, r := range aliasRouters(deployment, aliases) {
+		routerMiddlewares := make([]string, 0)
+
+		// strip prefix
+		if len(r.aliases) == 1 && r.aliases[0].StripPrefix {
+			for k, v := range middlewares.StripPrefixLabels(r.name, r.aliases[0].PathPrefix) {
+				labels[k] = v
+			}
+			routerMiddlewares = append(routerMiddlewares, fmt.Sprintf("%s-stripprefix", r.name))
+		}
+
+		routerMiddlewares = append(routerMiddlewares, deploymentMiddlewares...)
+
+		// attach all middlewares to the routers, insecure requests are redirected to https when secured
+		if !secured {
+			if len(routerMiddlewares) > 0 {
+				labels[fmt.Sprintf("traefik.http.routers.%s-insecure.middlewares", r.name)] = strings.Join(routerMiddlewares, ",")
+			}
+			continue
+		}
+
+		insecureMiddlewares := append([]string{"redirect-to-https"}, routerMiddlewares...)
+		labels[fmt.Sprintf("traefik.http.routers.%s-insecure.middlewares", r.name)] = strings.Join(insecureMiddlewares, ",")
+		if len(routerMiddlewares) > 0 {
+			labels[fmt.Sprintf("traefik.http.routers.%s-secure.middlewares", r.name)] = strings.Join(routerMiddlewares, ",")
+		}
+	}
+
+	return labels
+}
+
+// TraefikColorServiceLabels returns the labels defining the services of the blue/green containers of a color,
+// the routers of the deployment are rendered to the dynamic configuration
+func TraefikColorServiceLabels(deployment, color, port string, tcp []TCPRouter, udp []UDPRouter) map[string]string {
+	labels := make(map[string]string, 0)
+
+	if port != "" {
+		name := fmt.Sprintf("%s-%s", deployment, color)
+		labels[fmt.Sprintf("traefik.http.services.%s.loadbalancer.server.port", name)] = port
+		labels[fmt.Sprintf("traefik.http.services.%s.loadbalancer.server.scheme", name)] = "http"
+	}
+
+	for _, r := range tcp {
+		labels[fmt.Sprintf("traefik.tcp.services.%s-%s-%s.loadbalancer.server.port", deployment, r.Entrypoint, color)] = r.Port
 	}
-	allMiddlewares = append(allMiddlewares, fmt.Sprintf("%s-ratelimit", deployment))
 
-	// attach all middlewares to the deployment
-	mw := strings.Join(allMiddlewares[:], ",")
-	labels[fmt.Sprintf("traefik.http.routers.%s-insecure.middlewares", deployment)] = mw
-	labels[fmt.Sprintf("traefik.http.routers.%s-secure.middlewares", deployment)] = strings.Replace(mw, "redirect-to-https,", " ", 1)
+	for _, r := range udp {
+		labels[fmt.Sprintf("traefik.udp.services.%s-%s-%s.loadbalancer.server.port", deployment, r.Entrypoint, color)] = r.Port
+	}
+
+	return labels
+}
+
+// traefikColorRouterLabels returns the labels of the routers and middlewares of a blue/green deployment,
+// routing requests to the services defined by the containers of its live color (ie. web-blue@docker)
+func traefikColorRouterLabels(route Route) map[string]string {
+	labels := make(map[string]string, 0)
+
+	for _, l := range []map[string]string{
+		TraefikRouterLabels(route.Deployment, route.Aliases, route.Secure),
+		TraefikMiddlewareLabels(route.Deployment, route.Aliases, route.Secure, route.RateLimit, route.Middlewares),
+		TraefikTCPRouterLabels(route.Deployment, route.TCP),
+		TraefikUDPRouterLabels(route.Deployment, route.UDP),
+	} {
+		for k, v := range l {
+			// services are defined by the labels of the containers
+			if strings.Split(k, ".")[2] == "services" {
+				continue
+			}
+			labels[k] = v
+		}
+	}
+
+	routers := make(map[string]string, 0)
+	for k := range labels {
+		// traefik.<protocol>.routers.<router>.<option>
+		parts := strings.Split(k, ".")
+		if parts[2] != "routers" {
+			continue
+		}
+
+		service := fmt.Sprintf("%s-%s@docker", route.Deployment, route.Color)
+		if parts[1] != "http" {
+			service = fmt.Sprintf("%s-%s@docker", parts[3], route.Color)
+		}
+		routers[fmt.Sprintf("traefik.%s.routers.%s.service", parts[1], parts[3])] = service
+	}
 
+	for k, v := range routers {
+		labels[k] = v
+	}
 	return labels
 }
+
+// renderTraefikConfig renders the Traefik dynamic configuration of blue/green deployments from the labels
+// of their routers and middlewares. The configuration is rendered as json, which Traefik reads as yaml.
+func renderTraefikConfig(routes []Route) ([]byte, error) {
+	config := make(map[string]interface{})
+	for _, r := range routes {
+		if r.Color == "" {
+			continue
+		}
+
+		for k, v := range traefikColorRouterLabels(r) {
+			setConfigValue(config, strings.Split(strings.TrimPrefix(k, "traefik."), "."), v)
+		}
+	}
+
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]byte(configHeader), data...), '\n'), nil
+}
+
+// setConfigValue sets the value of a dotted label path in the dynamic configuration. Options enabled
+// with a "true" label (ie. tls=true) are replaced by their own options when they have any.
+func setConfigValue(config map[string]interface{}, path []string, value string) {
+	for _, key := range path[:len(path)-1] {
+		next, ok := config[key].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			config[key] = next
+		}
+		config = next
+	}
+
+	key := path[len(path)-1]
+	if _, ok := config[key].(map[string]interface{}); ok {
+		return
+	}
+	config[key] = value
+}
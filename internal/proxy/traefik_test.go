@@ -0,0 +1,100 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTraefikColorLabels(t *testing.T) {
+	route := Route{
+		Deployment: "web",
+		Aliases:    []Alias{{Host: "example.com"}},
+		TargetPort: "8080",
+		TCP:        []TCPRouter{{Entrypoint: "postgres", Port: "5432"}},
+		Color:      "blue",
+	}
+
+	assert.Equal(t, map[string]string{
+		"traefik.enable":         "true",
+		"traefik.docker.network": "krane",
+		"traefik.http.services.web-blue.loadbalancer.server.port":         "8080",
+		"traefik.http.services.web-blue.loadbalancer.server.scheme":       "http",
+		"traefik.tcp.services.web-postgres-blue.loadbalancer.server.port": "5432",
+	}, NewTraefik("").Labels(route))
+}
+
+func TestRenderTraefikConfig(t *testing.T) {
+	routes := []Route{
+		{
+			Deployment: "web",
+			Aliases:    []Alias{{Host: "example.com"}},
+			Secure:     true,
+			TargetPort: "8080",
+			TCP:        []TCPRouter{{Entrypoint: "postgres", Port: "5432"}},
+			Color:      "green",
+		},
+		// deployments without a live color are routed using labels
+		{Deployment: "api", Aliases: []Alias{{Host: "api.example.com"}}},
+	}
+
+	data, err := renderTraefikConfig(routes)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(string(data), configHeader))
+
+	var config struct {
+		HTTP struct {
+			Routers     map[string]map[string]interface{} `json:"routers"`
+			Middlewares map[string]interface{}            `json:"middlewares"`
+			Services    map[string]interface{}            `json:"services"`
+		} `json:"http"`
+		TCP struct {
+			Routers map[string]map[string]interface{} `json:"routers"`
+		} `json:"tcp"`
+	}
+	assert.Nil(t, json.Unmarshal([]byte(strings.TrimPrefix(string(data), configHeader)), &config))
+
+	// routers of the live color route requests to the services defined by the container labels
+	assert.Len(t, config.HTTP.Routers, 2)
+	assert.Equal(t, "web-green@docker", config.HTTP.Routers["web-insecure"]["service"])
+	assert.Equal(t, "web-green@docker", config.HTTP.Routers["web-secure"]["service"])
+	assert.Equal(t, map[string]interface{}{"certresolver": "lets-encrypt"}, config.HTTP.Routers["web-secure"]["tls"])
+	assert.Contains(t, config.HTTP.Middlewares, "redirect-to-https")
+	assert.Empty(t, config.HTTP.Services)
+	assert.Equal(t, "web-postgres-green@docker", config.TCP.Routers["web-postgres"]["service"])
+}
+
+func TestTraefikSync(t *testing.T) {
+	dir, err := ioutil.TempDir("", "krane-traefik")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	configPath := filepath.Join(dir, "krane.yml")
+	p := NewTraefik(configPath)
+	assert.Equal(t, dir, p.ConfigDir())
+
+	assert.Nil(t, p.Sync(context.Background(), []Route{}))
+	data, err := ioutil.ReadFile(configPath)
+	assert.Nil(t, err)
+	assert.Equal(t, configHeader+"{}\n", string(data))
+
+	// switching colors only rewrites the dynamic configuration
+	route := Route{Deployment: "web", Aliases: []Alias{{Host: "example.com"}}, TargetPort: "8080", Color: "blue"}
+	assert.Nil(t, p.Sync(context.Background(), []Route{route}))
+	data, err = ioutil.ReadFile(configPath)
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), "web-blue@docker")
+
+	route.Color = "green"
+	assert.Nil(t, p.Sync(context.Background(), []Route{route}))
+	data, err = ioutil.ReadFile(configPath)
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), "web-green@docker")
+	assert.NotContains(t, string(data), "web-blue@docker")
+}
@@ -0,0 +1,71 @@
+package scheduler
+
+import (
+	"sync"
+	"time"
+)
+
+// maxReconcileBackoff is the longest time a drifted deployment waits between reconcile attempts
+const maxReconcileBackoff = 30 * time.Minute
+
+// backoff tracks reconcile attempts per deployment so deployments failing to reach
+// their desired state (ie. crash-looping containers) are not redeployed on every poll
+type backoff struct {
+	sync.Mutex
+	base        time.Duration
+	max         time.Duration
+	deployments map[string]reconcileAttempt
+}
+
+// reconcileAttempt is the latest reconcile attempt for a deployment
+type reconcileAttempt struct {
+	count int       // consecutive reconcile attempts
+	next  time.Time // earliest time the next reconcile can be attempted
+}
+
+// newBackoff returns a backoff doubling the delay between attempts starting from base up to max
+func newBackoff(base, max time.Duration) *backoff {
+	return &backoff{base: base, max: max, deployments: make(map[string]reconcileAttempt)}
+}
+
+// attempt records a reconcile attempt for a deployment returning false if the
+// deployment is still backing off from a previous attempt
+func (b *backoff) attempt(deployment string, now time.Time) bool {
+	b.Lock()
+	defer b.Unlock()
+
+	previous := b.deployments[deployment]
+	if now.Before(previous.next) {
+		return false
+	}
+
+	count := previous.count + 1
+	b.deployments[deployment] = reconcileAttempt{count: count, next: now.Add(b.delay(count))}
+	return true
+}
+
+// next returns the earliest time a deployment can be reconciled
+func (b *backoff) next(deployment string) time.Time {
+	b.Lock()
+	defer b.Unlock()
+	return b.deployments[deployment].next
+}
+
+// reset clears the reconcile attempts of a deployment once in its desired state
+func (b *backoff) reset(deployment string) {
+	b.Lock()
+	defer b.Unlock()
+	delete(b.deployments, deployment)
+}
+
+// delay returns the exponential delay after a number of attempts
+func (b *backoff) delay(attempts int) time.Duration {
+	d := b.base
+	for i := 1; i < attempts; i++ {
+		d *= 2
+		if d >= b.max {
+			return b.max
+		}
+	}
+	return d
+}
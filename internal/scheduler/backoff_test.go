@@ -0,0 +1,35 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	b := newBackoff(30*time.Second, 5*time.Minute)
+	assert.Equal(t, 30*time.Second, b.delay(1))
+	assert.Equal(t, 60*time.Second, b.delay(2))
+	assert.Equal(t, 4*time.Minute, b.delay(4))
+	assert.Equal(t, 5*time.Minute, b.delay(5))
+	assert.Equal(t, 5*time.Minute, b.delay(50))
+}
+
+func TestBackoffAttempt(t *testing.T) {
+	b := newBackoff(30*time.Second, 5*time.Minute)
+	now := time.Now()
+
+	assert.True(t, b.attempt("app", now))
+	assert.Equal(t, now.Add(30*time.Second), b.next("app"))
+
+	// still backing off from the first attempt
+	assert.False(t, b.attempt("app", now.Add(10*time.Second)))
+	assert.True(t, b.attempt("other", now))
+
+	assert.True(t, b.attempt("app", now.Add(30*time.Second)))
+	assert.Equal(t, now.Add(90*time.Second), b.next("app"))
+
+	b.reset("app")
+	assert.True(t, b.attempt("app", now.Add(31*time.Second)))
+}
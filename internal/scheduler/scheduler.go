@@ -1,6 +1,10 @@
 package scheduler
 
 import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"time"
 
 	"github.com/pkg/errors"
@@ -13,60 +17,192 @@ import (
 )
 
 type Scheduler struct {
-	store    store.Store
-	docker   *docker.Client
-	enqueuer job.Enqueuer
-	interval time.Duration
+	store        store.Store
+	docker       *docker.Client
+	enqueuer     job.Enqueuer
+	interval     time.Duration
+	pullInterval time.Duration
+	backoff      *backoff
 }
 
-// New returns a new scheduler used to poll and create deployment resources
-func New(store store.Store, dockerClient *docker.Client, jobEnqueuer job.Enqueuer, interval_ms string) Scheduler {
+// New returns a new scheduler used to poll and create deployment resources. Images are pulled
+// every pullInterval so tags updated in the registry drift, images are never pulled when it is 0.
+func New(store store.Store, dockerClient *docker.Client, jobEnqueuer job.Enqueuer, interval_ms string, pullInterval time.Duration) Scheduler {
 	interval, _ := time.ParseDuration(interval_ms + "ms")
-	return Scheduler{store, dockerClient, jobEnqueuer, interval}
+	return Scheduler{store, dockerClient, jobEnqueuer, interval, pullInterval, newBackoff(interval, maxReconcileBackoff)}
 }
 
-// Run starts the scheduler polling on an interval
+// Run starts the scheduler polling on an interval, and pulling the images of deployments on the pull interval
 func (s *Scheduler) Run() {
 	logger.Debug("Starting Scheduler")
 
+	if s.pullInterval > 0 {
+		go s.pullLoop()
+	}
+
 	for {
 		go s.poll()
 		<-time.After(s.interval)
 	}
 }
 
+// pullLoop pulls the images of the running deployments on the pull interval. Pulls are kept off the poll
+// so registries are not hit on every poll, and large pulls are not cancelled by the poll interval.
+func (s *Scheduler) pullLoop() {
+	for {
+		<-time.After(s.pullInterval)
+		s.pullImages()
+	}
+}
+
+// pullImages pulls the images of the deployments with running containers one at a time
+func (s *Scheduler) pullImages() {
+	ctx, cancel := context.WithTimeout(context.Background(), s.pullInterval)
+	defer cancel()
+
+	deployments, err := deployment.GetAllDeployments(ctx)
+	if err != nil {
+		logger.Error(errors.Wrap(err, "Unhandled error when pulling images"))
+		return
+	}
+
+	for _, d := range deployments {
+		if len(d.LiveContainers()) == 0 {
+			continue
+		}
+
+		logger.Debugf("Pulling image for deployment %s", d.Config.Name)
+		if err := s.pullImage(ctx, d.Config); err != nil {
+			logger.Warnf("Unable to pull image for deployment %s, %v", d.Config.Name, err)
+		}
+	}
+}
+
 // poll will on an interval get deployments and queue jobs if they are not
 // in a desired state. For example, if a deployment has a scale of 3 but only
 // 1 container is running, the scheduler schedules a new job to update the deployment state.
 func (s *Scheduler) poll() {
 	logger.Debug("Scheduler polling")
 
-	deployments, err := deployment.GetAllDeployments()
+	ctx, cancel := context.WithTimeout(context.Background(), s.interval)
+	defer cancel()
+
+	deployments, err := deployment.GetAllDeployments(ctx)
 	if err != nil {
 		logger.Error(errors.Wrap(err, "Unhandled error when polling"))
+	} else {
+		// containers removed outside of Krane never have their probe results forgotten
+		deployment.PruneHealth(deployments)
+
+		// secret files wiped by a host reboot are restored before probing the containers
+		deployment.RestoreSecretFiles(ctx, deployments)
 	}
 
 	for _, d := range deployments {
-		if hasDesiredState(d) {
-			continue
-		}
+		s.reconcile(ctx, d)
 	}
 
 	logger.Debugf("Next poll in %s", s.interval.String())
 }
 
-// hasDesiredState checks that deployments are in parity with their configurations
-func hasDesiredState(d deployment.Deployment) bool {
+// reconcile queues a job to run a deployment when its containers drifted from its configuration.
+// Deployments with a job in flight are skipped, and deployments failing to reach their desired
+// state are backed off exponentially between reconcile attempts.
+func (s *Scheduler) reconcile(ctx context.Context, d deployment.Deployment) {
+	name := d.Config.Name
+
+	if job.InFlight(name) {
+		logger.Debugf("Deployment %s has a job in flight, skipping reconcile", name)
+		return
+	}
+
+	reason, drifted, scaled := s.drift(ctx, d)
+	if !drifted {
+		s.backoff.reset(name)
+		return
+	}
+
+	if !s.backoff.attempt(name, time.Now()) {
+		logger.Debugf("Deployment %s drifted (%s), backing off until %s", name, reason, s.backoff.next(name).Format(time.RFC3339))
+		return
+	}
+
+	// deployments only drifting in container count are scaled instead of re-creating every container
+	createJob := deployment.RunJob
+	if scaled {
+		createJob = deployment.ScaleJob
+	}
+
+	j, err := createJob(name)
+	if err != nil {
+		logger.Errorf("unable to create reconcile job %v", err)
+		return
+	}
+
+	if _, err := s.enqueuer.Enqueue(j); err != nil {
+		logger.Errorf("unable to enqueue reconcile job %v", err)
+		return
+	}
+
+	logger.Infof("Deployment %s drifted (%s), reconcile job %s queued", name, reason, j.ID)
+}
+
+// drift returns why a deployment is not in parity with its configuration (if drifted),
+// and whether the drift can be fixed by scaling the deployment
+func (s *Scheduler) drift(ctx context.Context, d deployment.Deployment) (string, bool, bool) {
 	config := d.Config
-	containers := d.Containers
+	containers := d.LiveContainers()
 
 	if config.Scale != len(containers) {
-		return false
+		return fmt.Sprintf("%d/%d container(s)", len(containers), config.Scale), true, true
+	}
+
+	for _, c := range containers {
+		if err := c.Probe(ctx, config.HealthCheck); err != nil {
+			return fmt.Sprintf("container %s is not healthy", c.Name), true, false
+		}
+	}
+
+	if len(containers) == 0 {
+		return "", false, false
+	}
+
+	// tags updated in the registry (ie. latest) drift once their image is pulled on the pull interval
+	image, err := s.docker.GetImage(ctx, config.Registry.URL, config.Image, config.Tag)
+	if err != nil {
+		logger.Warnf("Unable to inspect image for deployment %s, %v", config.Name, err)
+		return "", false, false
+	}
+
+	for _, c := range containers {
+		if c.ImageID != image.ID {
+			return fmt.Sprintf("container %s is not running image %s", c.Name, image.ID), true, false
+		}
+	}
+
+	return "", false, false
+}
+
+// pullImage pulls the image of a deployment onto the host machine
+func (s *Scheduler) pullImage(ctx context.Context, config deployment.Config) error {
+	if err := config.ResolveRegistryCredentials(); err != nil {
+		return err
+	}
+
+	reader, err := s.docker.PullImage(ctx, config.Image, config.Tag, docker.RegistryCredentials{
+		URL:      config.Registry.URL,
+		Username: config.Registry.Username,
+		Password: config.Registry.Password,
+	})
+	if err != nil {
+		return err
 	}
 
-	if err := deployment.RetriableContainersHealthCheck(containers, 3); err != nil {
-		return false
+	if closer, ok := reader.(io.Closer); ok {
+		defer closer.Close()
 	}
 
-	return true
+	// the pull completes once its progress stream is read
+	_, err = io.Copy(ioutil.Discard, reader)
+	return err
 }
@@ -80,7 +80,7 @@ func (b *BoltDB) Disconnect() {
 
 // Put upsert a key/value pair
 func (b *BoltDB) Put(collection string, key string, value []byte) error {
-	return instance.Update(func(tx *bolt.Tx) error {
+	return instance.DB.Update(func(tx *bolt.Tx) error {
 		bkt, err := tx.CreateBucketIfNotExists([]byte(collection))
 		if err != nil {
 			return fmt.Errorf("unable to create bucket for %s", collection)
@@ -92,7 +92,7 @@ func (b *BoltDB) Put(collection string, key string, value []byte) error {
 
 // Get get a key/value pair from a bucket
 func (b *BoltDB) Get(collection, key string) (data []byte, err error) {
-	err = instance.View(func(tx *bolt.Tx) error {
+	err = instance.DB.View(func(tx *bolt.Tx) error {
 		bkt := tx.Bucket([]byte(collection))
 		if bkt == nil {
 			return nil
@@ -111,7 +111,7 @@ func (b *BoltDB) Get(collection, key string) (data []byte, err error) {
 
 // GetAll get all key/value pairs in a collection
 func (b *BoltDB) GetAll(collection string) (data [][]byte, err error) {
-	err = instance.View(func(tx *bolt.Tx) (err error) {
+	err = instance.DB.View(func(tx *bolt.Tx) (err error) {
 		bkt := tx.Bucket([]byte(collection))
 		if bkt == nil {
 			return
@@ -135,8 +135,9 @@ func (b *BoltDB) GetAll(collection string) (data [][]byte, err error) {
 // GetInRange get key/value pairs within a time range
 // minDate: RFC3339 sortable time string ie. 1990-01-01T00:00:00Z
 // maxDate example: RFC3339 sortable time string ie. 2000-01-01T00:00:00Z
+// keys suffixed to be unique (ie. 2000-01-01T00:00:00Z_<id>) are compared by their timestamp
 func (b *BoltDB) GetInRange(collection, minDate, maxDate string) (data [][]byte, err error) {
-	err = instance.View(func(tx *bolt.Tx) (err error) {
+	err = instance.DB.View(func(tx *bolt.Tx) (err error) {
 		bkt := tx.Bucket([]byte(collection))
 		if bkt == nil {
 			return nil
@@ -144,7 +145,7 @@ func (b *BoltDB) GetInRange(collection, minDate, maxDate string) (data [][]byte,
 
 		c := bkt.Cursor()
 
-		for k, v := c.Seek([]byte(minDate)); k != nil && bytes.Compare(k, []byte(maxDate)) <= 0; k, v = c.Next() {
+		for k, v := c.Seek([]byte(minDate)); k != nil && bytes.Compare(keyPrefix(k, len(maxDate)), []byte(maxDate)) <= 0; k, v = c.Next() {
 			data = append(data, v)
 		}
 		return
@@ -152,8 +153,16 @@ func (b *BoltDB) GetInRange(collection, minDate, maxDate string) (data [][]byte,
 	return
 }
 
+// keyPrefix returns the first n bytes of a key
+func keyPrefix(k []byte, n int) []byte {
+	if len(k) > n {
+		return k[:n]
+	}
+	return k
+}
+
 func (b *BoltDB) Remove(collection string, key string) error {
-	return instance.Update(func(tx *bolt.Tx) error {
+	return instance.DB.Update(func(tx *bolt.Tx) error {
 		bkt := tx.Bucket([]byte(collection))
 		if bkt == nil {
 			// dont return err if bkt does not exists
@@ -164,14 +173,72 @@ func (b *BoltDB) Remove(collection string, key string) error {
 }
 
 func (b *BoltDB) DeleteCollection(collection string) error {
-	return instance.Update(func(tx *bolt.Tx) error {
+	return instance.DB.Update(func(tx *bolt.Tx) error {
 		return tx.DeleteBucket([]byte(collection))
 	})
 }
 
 func (b *BoltDB) CreateCollection(collection string) error {
-	return instance.Update(func(tx *bolt.Tx) error {
+	return instance.DB.Update(func(tx *bolt.Tx) error {
 		_, err := tx.CreateBucketIfNotExists([]byte(collection))
 		return err
 	})
 }
+
+// Update executes a function within a read-write transaction, every change is discarded if the function returns an error
+func (b *BoltDB) Update(fn func(tx Tx) error) error {
+	return instance.DB.Update(func(tx *bolt.Tx) error {
+		return fn(boltTx{tx})
+	})
+}
+
+// boltTx is a read-write bolt transaction
+type boltTx struct {
+	tx *bolt.Tx
+}
+
+// Get get a key/value pair from a bucket, the value is copied since it is only valid during the transaction
+func (t boltTx) Get(collection, key string) []byte {
+	bkt := t.tx.Bucket([]byte(collection))
+	if bkt == nil {
+		return nil
+	}
+
+	value := bkt.Get([]byte(key))
+	if value == nil {
+		return nil
+	}
+	return append([]byte{}, value...)
+}
+
+// GetAll get all key/value pairs in a collection
+func (t boltTx) GetAll(collection string) (data [][]byte) {
+	bkt := t.tx.Bucket([]byte(collection))
+	if bkt == nil {
+		return nil
+	}
+
+	_ = bkt.ForEach(func(k, v []byte) error {
+		data = append(data, append([]byte{}, v...))
+		return nil
+	})
+	return data
+}
+
+// Put upsert a key/value pair
+func (t boltTx) Put(collection string, key string, value []byte) error {
+	bkt, err := t.tx.CreateBucketIfNotExists([]byte(collection))
+	if err != nil {
+		return fmt.Errorf("unable to create bucket for %s", collection)
+	}
+	return bkt.Put([]byte(key), value)
+}
+
+// Remove removes a key/value pair, missing buckets are not an error
+func (t boltTx) Remove(collection string, key string) error {
+	bkt := t.tx.Bucket([]byte(collection))
+	if bkt == nil {
+		return nil
+	}
+	return bkt.Delete([]byte(key))
+}
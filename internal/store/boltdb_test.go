@@ -2,6 +2,7 @@ package store
 
 import (
 	"encoding/json"
+	"errors"
 	"os"
 	"testing"
 	"time"
@@ -157,3 +158,46 @@ func TestBoltGetAll(t *testing.T) {
 		assert.NotNil(t, hero.CreatedAt)
 	}
 }
+
+func TestBoltGetInRange(t *testing.T) {
+	bkt := "range-test"
+
+	assert.Nil(t, Client().Put(bkt, "2000-01-01T00:00:00Z", []byte("1")))
+	assert.Nil(t, Client().Put(bkt, "2000-01-02T00:00:00Z_a", []byte("2")))
+	assert.Nil(t, Client().Put(bkt, "2000-01-02T00:00:00Z_b", []byte("3")))
+	assert.Nil(t, Client().Put(bkt, "2000-01-03T00:00:00Z_c", []byte("4")))
+
+	// keys suffixed by an id are within the range of their timestamp
+	data, err := Client().GetInRange(bkt, "2000-01-02T00:00:00Z", "2000-01-02T00:00:00Z")
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("2"), []byte("3")}, data)
+
+	data, err = Client().GetInRange(bkt, "1999-12-31T00:00:00Z", "2000-01-02T12:00:00Z")
+	assert.Nil(t, err)
+	assert.Len(t, data, 3)
+}
+
+func TestBoltUpdate(t *testing.T) {
+	bkt := "update-test"
+
+	err := Client().Update(func(tx Tx) error {
+		assert.Nil(t, tx.Get(bkt, "counter"))
+		assert.Nil(t, tx.Put(bkt, "counter", []byte("1")))
+		assert.Equal(t, []byte("1"), tx.Get(bkt, "counter"))
+		return nil
+	})
+	assert.Nil(t, err)
+
+	// changes are discarded when the transaction fails
+	err = Client().Update(func(tx Tx) error {
+		assert.Nil(t, tx.Put(bkt, "counter", []byte("2")))
+		assert.Nil(t, tx.Remove(bkt, "missing"))
+		assert.Len(t, tx.GetAll(bkt), 1)
+		return errors.New("conflict")
+	})
+	assert.Error(t, err)
+
+	counter, err := Client().Get(bkt, "counter")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("1"), counter)
+}
@@ -9,4 +9,14 @@ type Store interface {
 	Remove(collection string, key string) error
 	DeleteCollection(collection string) error
 	CreateCollection(collection string) error
+	Update(fn func(tx Tx) error) error
+}
+
+// Tx reads and writes key/value pairs within a single read-write transaction, changes are
+// discarded if the transaction returns an error. The Store must not be used within a transaction.
+type Tx interface {
+	Get(collection, key string) []byte
+	GetAll(collection string) [][]byte
+	Put(collection string, key string, value []byte) error
+	Remove(collection string, key string) error
 }
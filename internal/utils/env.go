@@ -5,6 +5,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 	"unicode/utf8"
 )
 
@@ -69,7 +70,8 @@ func IsSensitiveEnv(str string) bool {
 	return strings.Contains(strings.ToLower(str), "email") ||
 		strings.Contains(strings.ToLower(str), "password") ||
 		strings.Contains(strings.ToLower(str), "token") ||
-		strings.Contains(strings.ToLower(str), "private_key")
+		strings.Contains(strings.ToLower(str), "private_key") ||
+		strings.Contains(strings.ToLower(str), "master_key")
 }
 
 // UIntEnv returns the unsigned int environment variable or 0 if not found
@@ -101,3 +103,13 @@ func BoolEnv(key string) bool {
 	v, _ := strconv.ParseBool(value)
 	return v
 }
+
+// DurationEnv returns the duration environment variable or 0 if not found or invalid
+func DurationEnv(key string) time.Duration {
+	value, found := os.LookupEnv(key)
+	if !found {
+		return 0
+	}
+	v, _ := time.ParseDuration(value)
+	return v
+}